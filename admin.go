@@ -0,0 +1,270 @@
+package gostc
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/pprof"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// EffectiveConfig returns a copy of the fully-resolved configuration after
+// options, presets and validation have been applied
+func (s *Server) EffectiveConfig() Config {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return *s.config.Clone()
+}
+
+// serveConfig writes the redacted effective configuration as JSON
+func (s *Server) serveConfig(w http.ResponseWriter, r *http.Request) {
+	s.serveJSON(w, r, http.StatusOK, s.config.Redacted())
+}
+
+// healthJSON is the health endpoint's response
+type healthJSON struct {
+	Status     string `json:"status"`
+	CacheItems int    `json:"cache_items"`
+	UptimeSec  int64  `json:"uptime_sec"`
+}
+
+// serveHealth reports the server as healthy until Stop is called, then
+// answers 503 so load balancers drain it
+func (s *Server) serveHealth(w http.ResponseWriter, r *http.Request) {
+	health := healthJSON{
+		Status:     "ok",
+		CacheItems: s.cache.Stats().ItemCount,
+		UptimeSec:  int64(time.Since(s.startedAt).Seconds()),
+	}
+
+	select {
+	case <-s.shutdown:
+		health.Status = "shutting_down"
+		s.serveJSON(w, r, http.StatusServiceUnavailable, health)
+	default:
+		s.serveJSON(w, r, http.StatusOK, health)
+	}
+}
+
+// serveLiveness reports that the process is up and handling requests
+func (s *Server) serveLiveness(w http.ResponseWriter, r *http.Request) {
+	s.serveJSON(w, r, http.StatusOK, map[string]string{"status": "ok"})
+}
+
+// serveReadiness reports whether the server should receive traffic: only
+// after Start has run the version scan and started the watcher, and not
+// while reloading or shutting down
+func (s *Server) serveReadiness(w http.ResponseWriter, r *http.Request) {
+	select {
+	case <-s.shutdown:
+		s.serveJSON(w, r, http.StatusServiceUnavailable, map[string]string{"status": "shutting_down"})
+		return
+	default:
+	}
+
+	if !s.ready.Load() {
+		s.serveJSON(w, r, http.StatusServiceUnavailable, map[string]string{"status": "not_ready"})
+		return
+	}
+	s.serveJSON(w, r, http.StatusOK, map[string]string{"status": "ok"})
+}
+
+// CacheKeys returns the keys currently held in the cache
+func (s *Server) CacheKeys() []CacheKey {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.cache.Keys()
+}
+
+// cacheEntryJSON is the debug endpoint's view of a cached entry
+type cacheEntryJSON struct {
+	Path        string  `json:"path"`
+	Compression string  `json:"compression"`
+	Versioned   bool    `json:"versioned"`
+	Size        int64   `json:"size"`
+	AgeSeconds  float64 `json:"ageSeconds"`
+	AccessCount int64   `json:"accessCount"`
+}
+
+// serveCacheDebug lists cached entries sorted by path
+func (s *Server) serveCacheDebug(w http.ResponseWriter, r *http.Request) {
+	infos := s.cache.Entries()
+	sort.Slice(infos, func(i, j int) bool {
+		return infos[i].Key.String() < infos[j].Key.String()
+	})
+
+	entries := make([]cacheEntryJSON, 0, len(infos))
+	for _, info := range infos {
+		entries = append(entries, cacheEntryJSON{
+			Path:        info.Key.Path,
+			Compression: compressionName(info.Key.Compression),
+			Versioned:   info.Key.IsVersioned,
+			Size:        info.Size,
+			AgeSeconds:  info.Age.Seconds(),
+			AccessCount: info.AccessCount,
+		})
+	}
+
+	stats := s.cache.Stats()
+	s.serveJSON(w, r, http.StatusOK, map[string]interface{}{
+		"items":   stats.ItemCount,
+		"size":    stats.Size,
+		"entries": entries,
+	})
+}
+
+// CompressionStats returns totals for the compressions run since the
+// server was created or last reloaded
+func (s *Server) CompressionStats() CompressionStats {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.compression.Stats()
+}
+
+// serveCompressionStats reports CompressionStats
+func (s *Server) serveCompressionStats(w http.ResponseWriter, r *http.Request) {
+	s.serveJSON(w, r, http.StatusOK, s.compression.Stats())
+}
+
+// RecentErrors returns up to limit of the most recently handled errors,
+// oldest first
+func (s *Server) RecentErrors(limit int) []LoggedError {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.errorHandler.logger.GetRecentErrors(limit)
+}
+
+// defaultRecentErrorsLimit is how many errors the errors endpoint returns
+// without a limit parameter
+const defaultRecentErrorsLimit = 100
+
+// loggedErrorJSON is the errors endpoint's view of a handled error
+type loggedErrorJSON struct {
+	Type      string    `json:"type"`
+	Op        string    `json:"op"`
+	Method    string    `json:"method"`
+	Path      string    `json:"path"`
+	Status    int       `json:"status"`
+	Timestamp time.Time `json:"timestamp"`
+	ClientIP  string    `json:"clientIP"`
+	RequestID string    `json:"requestId,omitempty"`
+}
+
+// serveRecentErrors lists recent errors, oldest first; ?limit= picks how
+// many
+func (s *Server) serveRecentErrors(w http.ResponseWriter, r *http.Request) {
+	limit := defaultRecentErrorsLimit
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			http.Error(w, "Invalid limit", http.StatusBadRequest)
+			return
+		}
+		limit = n
+	}
+
+	logged := s.errorHandler.logger.GetRecentErrors(limit)
+	entries := make([]loggedErrorJSON, 0, len(logged))
+	for _, le := range logged {
+		entries = append(entries, loggedErrorJSON{
+			Type:      errorTypeName(le.Error.Type),
+			Op:        le.Error.Op,
+			Method:    le.Method,
+			Path:      le.Path,
+			Status:    le.Error.HTTPStatus(),
+			Timestamp: le.Timestamp,
+			ClientIP:  le.ClientIP,
+			RequestID: le.Error.RequestID,
+		})
+	}
+
+	s.serveJSON(w, r, http.StatusOK, map[string]interface{}{
+		"count":  len(entries),
+		"errors": entries,
+	})
+}
+
+// errorTypeName returns a stable lowercase name for t
+func errorTypeName(t ErrorType) string {
+	switch t {
+	case ErrorTypeValidation:
+		return "validation"
+	case ErrorTypeNotFound:
+		return "not_found"
+	case ErrorTypePermission:
+		return "permission"
+	case ErrorTypeRateLimit:
+		return "rate_limit"
+	case ErrorTypeServerError:
+		return "server_error"
+	case ErrorTypeTimeout:
+		return "timeout"
+	case ErrorTypeConfiguration:
+		return "configuration"
+	case ErrorTypeSecurity:
+		return "security"
+	default:
+		return "unknown"
+	}
+}
+
+// compressionName returns the Content-Encoding token for a single encoding
+func compressionName(c CompressionType) string {
+	switch c {
+	case Gzip:
+		return "gzip"
+	case Brotli:
+		return "br"
+	default:
+		return "identity"
+	}
+}
+
+// pprofPrefix is where WithPprof mounts the profiling handlers
+const pprofPrefix = "/debug/pprof/"
+
+// pprofHandler routes pprofPrefix to the net/http/pprof handlers. Index
+// serves the named profiles (heap, goroutine, ...) below the prefix.
+func pprofHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc(pprofPrefix, pprof.Index)
+	mux.HandleFunc(pprofPrefix+"cmdline", pprof.Cmdline)
+	mux.HandleFunc(pprofPrefix+"profile", pprof.Profile)
+	mux.HandleFunc(pprofPrefix+"symbol", pprof.Symbol)
+	mux.HandleFunc(pprofPrefix+"trace", pprof.Trace)
+	return mux
+}
+
+// serveJSON writes v as an indented JSON response, compressed like any
+// other generated body
+func (s *Server) serveJSON(w http.ResponseWriter, r *http.Request, status int, v interface{}) {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	s.writeGenerated(w, r, status, "application/json", data)
+}
+
+// writeJSON encodes v as an indented JSON response
+func writeJSON(w http.ResponseWriter, r *http.Request, status int, v interface{}) {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	if r.Method != "HEAD" {
+		w.Write(data)
+	}
+}
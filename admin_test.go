@@ -0,0 +1,348 @@
+package gostc
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEffectiveConfig(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	server, err := NewWithPresetServer(PresetProduction,
+		WithRoot(tmpDir),
+		WithCacheTTL(42*time.Second),
+		WithTLS("/etc/tls/cert.pem", "/etc/tls/key.pem"),
+		WithMetrics(false),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	config := server.EffectiveConfig()
+	if config.Root != tmpDir {
+		t.Errorf("Expected root %s, got %s", tmpDir, config.Root)
+	}
+	if config.CacheTTL != 42*time.Second {
+		t.Errorf("Expected CacheTTL 42s, got %v", config.CacheTTL)
+	}
+	if config.MaxConnections != 5000 {
+		t.Errorf("Expected production preset MaxConnections 5000, got %d", config.MaxConnections)
+	}
+	if config.TLSKey != "/etc/tls/key.pem" {
+		t.Errorf("EffectiveConfig should not redact, got TLSKey %q", config.TLSKey)
+	}
+
+	// Mutating the copy must not affect the server
+	config.StaticPrefixes[0] = "/mutated/"
+	if server.config.StaticPrefixes[0] == "/mutated/" {
+		t.Error("EffectiveConfig should return an independent copy")
+	}
+
+	redacted := config.Redacted()
+	if redacted.TLSKey != redactedValue {
+		t.Errorf("Expected redacted TLSKey, got %q", redacted.TLSKey)
+	}
+	if redacted.TLSCert != "/etc/tls/cert.pem" {
+		t.Errorf("TLSCert should be kept, got %q", redacted.TLSCert)
+	}
+}
+
+func TestConfigEndpoint(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	server, err := New(
+		WithRoot(tmpDir),
+		WithCompressionLevel(9),
+		WithTLS("cert.pem", "secret-key.pem"),
+		WithConfigEndpoint("/debug/config"),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req := httptest.NewRequest("GET", "/debug/config", nil)
+	req.RemoteAddr = "127.0.0.1:4321"
+	w := httptest.NewRecorder()
+	server.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d", w.Code)
+	}
+	if ct := w.Header().Get("Content-Type"); ct != "application/json" {
+		t.Errorf("Expected JSON content type, got %s", ct)
+	}
+
+	var config Config
+	if err := json.Unmarshal(w.Body.Bytes(), &config); err != nil {
+		t.Fatalf("Invalid JSON: %v", err)
+	}
+	if config.Root != tmpDir || config.CompressionLevel != 9 {
+		t.Errorf("Endpoint config does not reflect options: root=%s level=%d", config.Root, config.CompressionLevel)
+	}
+	if config.TLSKey != redactedValue {
+		t.Errorf("Expected TLS key to be redacted, got %q", config.TLSKey)
+	}
+}
+
+func TestConfigEndpointGuarded(t *testing.T) {
+	server, err := New(
+		WithRoot(t.TempDir()),
+		WithWatcher(false),
+		WithConfigEndpoint("/debug/config"),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req := httptest.NewRequest("GET", "/debug/config", nil)
+	req.RemoteAddr = "203.0.113.7:4321"
+	w := httptest.NewRecorder()
+	server.ServeHTTP(w, req)
+
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 for a remote client, got %d", w.Code)
+	}
+	if strings.Contains(w.Body.String(), "Root") {
+		t.Error("Remote client should not see the configuration")
+	}
+}
+
+func TestConfigEndpointDisabledByDefault(t *testing.T) {
+	server, err := New(WithRoot(t.TempDir()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req := httptest.NewRequest("GET", "/debug/config", nil)
+	w := httptest.NewRecorder()
+	server.ServeHTTP(w, req)
+
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 when endpoint disabled, got %d", w.Code)
+	}
+}
+
+func TestCacheDebugEndpoint(t *testing.T) {
+	tmpDir := t.TempDir()
+	os.WriteFile(filepath.Join(tmpDir, "a.txt"), []byte("aaaa"), 0644)
+	os.WriteFile(filepath.Join(tmpDir, "b.css"), []byte(strings.Repeat("body{color:red}", 100)), 0644)
+
+	for _, strategy := range []CacheStrategy{LRU, LFU} {
+		server, err := New(
+			WithRoot(tmpDir),
+			WithWatcher(false),
+			WithCacheStrategy(strategy),
+			WithCacheDebugEndpoint("/debug/cache"),
+		)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// Populate the cache, hitting a.txt twice more
+		for _, p := range []string{"/a.txt", "/a.txt", "/a.txt"} {
+			server.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", p, nil))
+		}
+		req := httptest.NewRequest("GET", "/b.css", nil)
+		req.Header.Set("Accept-Encoding", "gzip")
+		server.ServeHTTP(httptest.NewRecorder(), req)
+
+		if keys := server.CacheKeys(); len(keys) != 2 {
+			t.Errorf("strategy %d: expected 2 cache keys, got %v", strategy, keys)
+		}
+
+		req = httptest.NewRequest("GET", "/debug/cache", nil)
+		req.RemoteAddr = "127.0.0.1:4321"
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, req)
+		if w.Code != http.StatusOK {
+			t.Fatalf("strategy %d: expected 200, got %d", strategy, w.Code)
+		}
+
+		var listing struct {
+			Items   int              `json:"items"`
+			Entries []cacheEntryJSON `json:"entries"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &listing); err != nil {
+			t.Fatalf("Invalid JSON: %v", err)
+		}
+		if listing.Items != 2 || len(listing.Entries) != 2 {
+			t.Fatalf("strategy %d: expected 2 entries, got %+v", strategy, listing)
+		}
+
+		a, b := listing.Entries[0], listing.Entries[1]
+		if a.Path != "/a.txt" || a.Compression != "identity" || a.Size != 4 || a.AccessCount != 2 {
+			t.Errorf("strategy %d: unexpected a.txt entry %+v", strategy, a)
+		}
+		if b.Path != "/b.css" || b.Compression != "gzip" || b.Size <= 0 || b.AgeSeconds < 0 {
+			t.Errorf("strategy %d: unexpected b.css entry %+v", strategy, b)
+		}
+
+		server.Stop()
+	}
+}
+
+func TestCacheDebugEndpointGuarded(t *testing.T) {
+	server, err := New(
+		WithRoot(t.TempDir()),
+		WithWatcher(false),
+		WithCacheDebugEndpoint("/debug/cache"),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		header     string
+	}{
+		{"Remote", "203.0.113.7:4321", ""},
+		{"ProxiedThroughLoopback", "127.0.0.1:4321", "203.0.113.7"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/debug/cache", nil)
+			req.RemoteAddr = tt.remoteAddr
+			if tt.header != "" {
+				req.Header.Set("X-Forwarded-For", tt.header)
+			}
+			w := httptest.NewRecorder()
+			server.ServeHTTP(w, req)
+
+			if w.Code != http.StatusNotFound {
+				t.Errorf("Expected 404, got %d", w.Code)
+			}
+		})
+	}
+}
+
+func TestErrorsEndpoint(t *testing.T) {
+	server, err := New(
+		WithRoot(t.TempDir()),
+		WithWatcher(false),
+		WithErrorsEndpoint("/debug/errors"),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, path := range []string{"/missing-1.txt", "/missing-2.txt", "/missing-3.txt"} {
+		req := httptest.NewRequest("GET", path, nil)
+		server.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	if recent := server.RecentErrors(2); len(recent) != 2 || recent[1].Path != "/missing-3.txt" {
+		t.Fatalf("Expected the two newest errors, got %+v", recent)
+	}
+
+	req := httptest.NewRequest("GET", "/debug/errors?limit=10", nil)
+	req.RemoteAddr = "127.0.0.1:4321"
+	w := httptest.NewRecorder()
+	server.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d", w.Code)
+	}
+
+	var body struct {
+		Count  int `json:"count"`
+		Errors []struct {
+			Type      string    `json:"type"`
+			Op        string    `json:"op"`
+			Path      string    `json:"path"`
+			Status    int       `json:"status"`
+			Timestamp time.Time `json:"timestamp"`
+			ClientIP  string    `json:"clientIP"`
+		} `json:"errors"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatalf("Invalid JSON: %v", err)
+	}
+
+	if body.Count != 3 || len(body.Errors) != 3 {
+		t.Fatalf("Expected 3 errors, got %d", body.Count)
+	}
+	for i, e := range body.Errors {
+		wantPath := []string{"/missing-1.txt", "/missing-2.txt", "/missing-3.txt"}[i]
+		if e.Path != wantPath || e.Type != "not_found" || e.Status != http.StatusNotFound || e.Op == "" {
+			t.Errorf("Error %d: unexpected %+v", i, e)
+		}
+		if e.ClientIP != "192.0.2.1" || e.Timestamp.IsZero() {
+			t.Errorf("Error %d: expected client IP and timestamp, got %+v", i, e)
+		}
+	}
+
+	// Remote clients can't read the errors
+	req = httptest.NewRequest("GET", "/debug/errors", nil)
+	w = httptest.NewRecorder()
+	server.ServeHTTP(w, req)
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 for a remote client, got %d", w.Code)
+	}
+}
+
+func TestPprof(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	for _, enabled := range []bool{true, false} {
+		server, err := New(
+			WithRoot(tmpDir),
+			WithWatcher(false),
+			WithPprof(enabled),
+		)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		req := httptest.NewRequest("GET", "/debug/pprof/", nil)
+		req.RemoteAddr = "127.0.0.1:4321"
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, req)
+
+		want := http.StatusNotFound
+		if enabled {
+			want = http.StatusOK
+		}
+		if w.Code != want {
+			t.Errorf("pprof enabled=%v: expected %d, got %d", enabled, want, w.Code)
+		}
+	}
+
+	server, err := New(WithRoot(tmpDir), WithWatcher(false), WithPprof(true))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Named profiles are served below the index
+	req := httptest.NewRequest("GET", "/debug/pprof/goroutine?debug=1", nil)
+	req.RemoteAddr = "127.0.0.1:4321"
+	w := httptest.NewRecorder()
+	server.ServeHTTP(w, req)
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "goroutine profile") {
+		t.Errorf("Expected the goroutine profile, got %d", w.Code)
+	}
+
+	// Remote clients never reach the profiler
+	req = httptest.NewRequest("GET", "/debug/pprof/", nil)
+	req.RemoteAddr = "203.0.113.7:4321"
+	w = httptest.NewRecorder()
+	server.ServeHTTP(w, req)
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 for a remote client, got %d", w.Code)
+	}
+
+	// Files are still served from the catch-all route
+	os.WriteFile(filepath.Join(tmpDir, "a.txt"), []byte("aaaa"), 0644)
+	w = httptest.NewRecorder()
+	server.ServeHTTP(w, httptest.NewRequest("GET", "/a.txt", nil))
+	if w.Code != http.StatusOK || w.Body.String() != "aaaa" {
+		t.Errorf("Expected the file handler to serve /a.txt, got %d", w.Code)
+	}
+}
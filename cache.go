@@ -2,6 +2,7 @@ package gostc
 
 import (
 	"container/heap"
+	"fmt"
 	"sync"
 	"time"
 
@@ -14,6 +15,11 @@ type CacheKey struct {
 	IsVersioned bool
 }
 
+// String returns a stable textual form of the key
+func (k CacheKey) String() string {
+	return fmt.Sprintf("%s|%d|%t", k.Path, k.Compression, k.IsVersioned)
+}
+
 type CacheEntry struct {
 	Data         []byte
 	ContentType  string
@@ -22,14 +28,67 @@ type CacheEntry struct {
 	CreatedAt    time.Time
 	AccessCount  int64
 	Size         int64
+	Encoding     CompressionType // Encoding of Data (NoCompression = identity)
+	Preload      []string        // Versioned assets announced in Link preload headers
 }
 
+// Cache stores rendered responses by CacheKey. Implementations must be safe
+// for concurrent use. Entries passed to Set and returned by Get are not
+// modified by the server afterwards, so a backend may keep or share them.
+// Custom implementations, such as a cache shared between servers, are
+// installed with WithCacheBackend.
 type Cache interface {
+	// Get returns the entry for key, or false on a miss or expiry
 	Get(key CacheKey) (*CacheEntry, bool)
+	// Set stores entry under key, replacing any previous entry
 	Set(key CacheKey, entry *CacheEntry)
+	// Delete removes key; deleting a missing key is not an error
 	Delete(key CacheKey)
+	// Clear removes every entry
 	Clear()
+	// Stats reports hit, miss and size counters
 	Stats() CacheStats
+	// Stop releases background goroutines; safe to call more than once
+	Stop()
+	// Keys lists the cached keys, for debugging
+	Keys() []CacheKey
+	// Entries describes the cached entries without their data, for debugging
+	Entries() []CacheEntryInfo
+}
+
+// GetOrSet returns the entry cached under key, or on a miss calls fill and
+// caches its result. Nothing is cached when fill fails. Concurrent misses
+// each call fill; callers wanting one fill per key serialize them, as the
+// server does with singleflight.
+func GetOrSet(cache Cache, key CacheKey, fill func() (*CacheEntry, error)) (*CacheEntry, error) {
+	if entry, ok := cache.Get(key); ok {
+		return entry, nil
+	}
+
+	entry, err := fill()
+	if err != nil {
+		return nil, err
+	}
+
+	cache.Set(key, entry)
+	return entry, nil
+}
+
+// CacheEntryInfo describes a cached entry without its data
+type CacheEntryInfo struct {
+	Key         CacheKey
+	Size        int64
+	Age         time.Duration
+	AccessCount int64
+}
+
+func entryInfo(key CacheKey, entry *CacheEntry, now time.Time) CacheEntryInfo {
+	return CacheEntryInfo{
+		Key:         key,
+		Size:        entry.Size,
+		Age:         now.Sub(entry.CreatedAt),
+		AccessCount: entry.AccessCount,
+	}
 }
 
 type CacheStats struct {
@@ -48,6 +107,7 @@ type LRUCache struct {
 	currentSize int64
 	ttl         time.Duration
 	stopCleanup chan struct{}
+	stopOnce    sync.Once
 }
 
 func NewLRUCache(maxSize int64, ttl time.Duration) (*LRUCache, error) {
@@ -87,8 +147,9 @@ func NewLRUCache(maxSize int64, ttl time.Duration) (*LRUCache, error) {
 }
 
 func (c *LRUCache) Get(key CacheKey) (*CacheEntry, bool) {
-	c.mu.RLock()
-	defer c.mu.RUnlock()
+	// Full lock: Get updates stats, access counts and may remove expired entries
+	c.mu.Lock()
+	defer c.mu.Unlock()
 
 	entry, ok := c.cache.Get(key)
 	if !ok {
@@ -160,14 +221,37 @@ func (c *LRUCache) Clear() {
 }
 
 func (c *LRUCache) Stats() CacheStats {
-	c.mu.RLock()
-	defer c.mu.RUnlock()
+	c.mu.Lock()
+	defer c.mu.Unlock()
 
 	c.stats.Size = c.currentSize
 	c.stats.ItemCount = c.cache.Len()
 	return c.stats
 }
 
+// Keys returns the cached keys from oldest to newest
+func (c *LRUCache) Keys() []CacheKey {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.cache.Keys()
+}
+
+// Entries describes every cached entry without affecting recency or stats
+func (c *LRUCache) Entries() []CacheEntryInfo {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	infos := make([]CacheEntryInfo, 0, c.cache.Len())
+	for _, key := range c.cache.Keys() {
+		if entry, ok := c.cache.Peek(key); ok && entry != nil {
+			infos = append(infos, entryInfo(key, entry, now))
+		}
+	}
+	return infos
+}
+
 func (c *LRUCache) evictToSize(targetSize int64) {
 	for c.currentSize > targetSize && c.cache.Len() > 0 {
 		c.cache.RemoveOldest()
@@ -203,7 +287,7 @@ func (c *LRUCache) cleanupExpired() {
 
 // Stop gracefully shuts down the cache and its cleanup goroutine
 func (c *LRUCache) Stop() {
-	close(c.stopCleanup)
+	c.stopOnce.Do(func() { close(c.stopCleanup) })
 }
 
 type LFUCache struct {
@@ -213,8 +297,11 @@ type LFUCache struct {
 	maxSize     int64
 	currentSize int64
 	ttl         time.Duration
+	decay       time.Duration
+	lastDecay   time.Time
 	stats       CacheStats
 	stopCleanup chan struct{}
+	stopOnce    sync.Once
 }
 
 type lfuEntry struct {
@@ -252,6 +339,13 @@ func (h *minHeap) Pop() interface{} {
 }
 
 func NewLFUCache(maxSize int64, ttl time.Duration) *LFUCache {
+	return NewLFUCacheWithDecay(maxSize, ttl, 0)
+}
+
+// NewLFUCacheWithDecay returns an LFU cache whose access counts are halved
+// every decay interval (0 = never), so a formerly hot entry can be evicted
+// once newer entries overtake it
+func NewLFUCacheWithDecay(maxSize int64, ttl, decay time.Duration) *LFUCache {
 	h := &minHeap{}
 	heap.Init(h)
 
@@ -260,6 +354,8 @@ func NewLFUCache(maxSize int64, ttl time.Duration) *LFUCache {
 		freqList:    h,
 		maxSize:     maxSize,
 		ttl:         ttl,
+		decay:       decay,
+		lastDecay:   time.Now(),
 		stopCleanup: make(chan struct{}),
 	}
 
@@ -284,6 +380,7 @@ func (c *LFUCache) Get(key CacheKey) (*CacheEntry, bool) {
 		}
 
 		item.freq++
+		item.entry.AccessCount++
 		if item.index >= 0 && item.index < c.freqList.Len() {
 			heap.Fix(c.freqList, item.index)
 		}
@@ -357,14 +454,39 @@ func (c *LFUCache) Clear() {
 }
 
 func (c *LFUCache) Stats() CacheStats {
-	c.mu.RLock()
-	defer c.mu.RUnlock()
+	c.mu.Lock()
+	defer c.mu.Unlock()
 
 	c.stats.Size = c.currentSize
 	c.stats.ItemCount = len(c.items)
 	return c.stats
 }
 
+// Keys returns the cached keys in no particular order
+func (c *LFUCache) Keys() []CacheKey {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	keys := make([]CacheKey, 0, len(c.items))
+	for key := range c.items {
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+// Entries describes every cached entry without affecting frequencies or stats
+func (c *LFUCache) Entries() []CacheEntryInfo {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	infos := make([]CacheEntryInfo, 0, len(c.items))
+	for key, item := range c.items {
+		infos = append(infos, entryInfo(key, item.entry, now))
+	}
+	return infos
+}
+
 func (c *LFUCache) removeItem(item *lfuEntry) {
 	heap.Remove(c.freqList, item.index)
 	delete(c.items, item.key)
@@ -382,8 +504,22 @@ func (c *LFUCache) evictLFU() {
 	c.stats.Evictions++
 }
 
+// decayFrequencies halves every access count. Halving never reorders two
+// counts, so the heap stays valid without fixing it up.
+func (c *LFUCache) decayFrequencies() {
+	for _, item := range c.items {
+		item.freq /= 2
+	}
+}
+
+// cleanupExpired drops expired entries and, when decay is enabled, halves
+// access counts once per decay interval
 func (c *LFUCache) cleanupExpired() {
-	ticker := time.NewTicker(c.ttl / 2)
+	interval := c.ttl / 2
+	if c.decay > 0 && (interval <= 0 || c.decay < interval) {
+		interval = c.decay
+	}
+	ticker := time.NewTicker(interval)
 	defer ticker.Stop()
 
 	for {
@@ -398,6 +534,11 @@ func (c *LFUCache) cleanupExpired() {
 					delete(c.items, key)
 				}
 			}
+
+			if c.decay > 0 && now.Sub(c.lastDecay) >= c.decay {
+				c.decayFrequencies()
+				c.lastDecay = now
+			}
 			c.mu.Unlock()
 		case <-c.stopCleanup:
 			return
@@ -407,16 +548,26 @@ func (c *LFUCache) cleanupExpired() {
 
 // Stop gracefully shuts down the cache and its cleanup goroutine
 func (c *LFUCache) Stop() {
-	close(c.stopCleanup)
+	c.stopOnce.Do(func() { close(c.stopCleanup) })
 }
 
+// NewCache returns config.CacheBackend when set, otherwise a new in-memory
+// cache using config.CacheStrategy
 func NewCache(config *Config) (Cache, error) {
+	if config.CacheBackend != nil {
+		return config.CacheBackend, nil
+	}
+
+	// Entries past CacheTTL stay around for the stale window; the server
+	// decides whether a stale entry may still be served
+	ttl := config.CacheTTL + config.StaleWhileRevalidate
+
 	switch config.CacheStrategy {
 	case LFU:
-		return NewLFUCache(config.CacheSize, config.CacheTTL), nil
+		return NewLFUCacheWithDecay(config.CacheSize, ttl, config.CacheDecayInterval), nil
 	case LRU:
 		fallthrough
 	default:
-		return NewLRUCache(config.CacheSize, config.CacheTTL)
+		return NewLRUCache(config.CacheSize, ttl)
 	}
 }
@@ -2,6 +2,7 @@ package gostc
 
 import (
 	"fmt"
+	"net/http"
 	"path/filepath"
 	"strings"
 )
@@ -15,6 +16,32 @@ const (
 	ImmutableAsset                 // Versioned assets - very long cache
 )
 
+// CacheRule sets the Cache-Control header for URL paths under Prefix
+type CacheRule struct {
+	Prefix       string // normalized URL prefix ("/api"); "" matches every path
+	CacheControl string
+}
+
+// matches reports whether urlPath is the rule's prefix or lies below it
+func (r CacheRule) matches(urlPath string) bool {
+	return r.Prefix == "" || urlPath == r.Prefix || strings.HasPrefix(urlPath, r.Prefix+"/")
+}
+
+// cacheRuleFor returns the Cache-Control value of the rule with the longest
+// prefix matching urlPath
+func (c *Config) cacheRuleFor(urlPath string) (string, bool) {
+	best := -1
+	for i, rule := range c.CacheRules {
+		if rule.matches(urlPath) && (best < 0 || len(rule.Prefix) > len(c.CacheRules[best].Prefix)) {
+			best = i
+		}
+	}
+	if best < 0 {
+		return "", false
+	}
+	return c.CacheRules[best].CacheControl, true
+}
+
 // getCacheControl returns the appropriate Cache-Control header value based on file type
 func getCacheControl(path string, config *Config, isVersioned bool) string {
 	if isVersioned {
@@ -22,6 +49,10 @@ func getCacheControl(path string, config *Config, isVersioned bool) string {
 		return "public, max-age=31536000, immutable"
 	}
 
+	if value, ok := config.cacheRuleFor(path); ok {
+		return value
+	}
+
 	fileType := getFileType(path)
 
 	switch fileType {
@@ -33,12 +64,26 @@ func getCacheControl(path string, config *Config, isVersioned bool) string {
 		return "public, max-age=31536000, immutable"
 	case DynamicAsset:
 		// HTML and JSON files should have shorter cache
+		if config.StaleWhileRevalidate > 0 {
+			return fmt.Sprintf("public, max-age=%d, stale-while-revalidate=%d", config.DynamicAssetMaxAge, int(config.StaleWhileRevalidate.Seconds()))
+		}
 		return fmt.Sprintf("public, max-age=%d, must-revalidate", config.DynamicAssetMaxAge)
 	default:
 		return fmt.Sprintf("public, max-age=%d", config.DynamicAssetMaxAge)
 	}
 }
 
+// cacheControl returns the Cache-Control header for r, letting
+// CacheControlFunc override the file-type rules
+func (s *Server) cacheControl(r *http.Request, isVersioned bool) string {
+	if s.config.CacheControlFunc != nil {
+		if value := s.config.CacheControlFunc(r, r.URL.Path, isVersioned); value != "" {
+			return value
+		}
+	}
+	return getCacheControl(r.URL.Path, s.config, isVersioned)
+}
+
 // getFileType determines the type of file for caching purposes
 func getFileType(path string) FileType {
 	ext := strings.ToLower(filepath.Ext(path))
@@ -0,0 +1,95 @@
+package gostc
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCacheControlFunc(t *testing.T) {
+	tmpDir := t.TempDir()
+	os.MkdirAll(filepath.Join(tmpDir, "private"), 0755)
+	os.WriteFile(filepath.Join(tmpDir, "private", "report.html"), []byte("<html>secret</html>"), 0644)
+	os.WriteFile(filepath.Join(tmpDir, "page.html"), []byte("<html>public</html>"), 0644)
+
+	server, err := New(
+		WithRoot(tmpDir),
+		WithWatcher(false),
+		WithCacheControlFunc(func(r *http.Request, path string, isVersioned bool) string {
+			if strings.HasPrefix(path, "/private/") {
+				return "no-store"
+			}
+			return ""
+		}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		path string
+		want string
+	}{
+		{"/private/report.html", "no-store"},
+		{"/page.html", getCacheControl("/page.html", server.config, false)},
+	}
+
+	// The second pass is served from the cache
+	for pass := 0; pass < 2; pass++ {
+		for _, tt := range tests {
+			req := httptest.NewRequest("GET", tt.path, nil)
+			w := httptest.NewRecorder()
+			server.ServeHTTP(w, req)
+
+			if got := w.Header().Get("Cache-Control"); got != tt.want {
+				t.Errorf("%s: expected Cache-Control %q, got %q", tt.path, tt.want, got)
+			}
+		}
+	}
+}
+
+func TestCacheRules(t *testing.T) {
+	tmpDir := t.TempDir()
+	for _, name := range []string{"api/users.json", "api/public/status.json", "feed/latest.xml", "feeds.xml", "page.html"} {
+		os.MkdirAll(filepath.Join(tmpDir, filepath.Dir(name)), 0755)
+		os.WriteFile(filepath.Join(tmpDir, name), []byte("content"), 0644)
+	}
+
+	server, err := New(
+		WithRoot(tmpDir),
+		WithWatcher(false),
+		WithCacheRule("/api/", "no-store"),
+		WithCacheRule("/api/public", "public, max-age=5"),
+		WithCacheRule("/feed", "public, max-age=60"),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		path string
+		want string
+	}{
+		{"/api/users.json", "no-store"},
+		{"/api/public/status.json", "public, max-age=5"}, // longest prefix wins
+		{"/feed/latest.xml", "public, max-age=60"},
+		{"/feeds.xml", getCacheControl("/feeds.xml", DefaultConfig(), false)}, // not under /feed
+		{"/page.html", getCacheControl("/page.html", DefaultConfig(), false)},
+	}
+
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, httptest.NewRequest("GET", tt.path, nil))
+
+		if got := w.Header().Get("Cache-Control"); got != tt.want {
+			t.Errorf("%s: expected Cache-Control %q, got %q", tt.path, tt.want, got)
+		}
+	}
+
+	if _, err := New(WithRoot(tmpDir), WithCacheRule("/api/", "")); err == nil {
+		t.Error("Expected an empty Cache-Control rule to be rejected")
+	}
+}
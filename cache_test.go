@@ -1,6 +1,16 @@
 package gostc
 
 import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 )
@@ -190,6 +200,137 @@ func TestLFUCacheEviction(t *testing.T) {
 	}
 }
 
+func TestLFUCacheDecay(t *testing.T) {
+	cache := NewLFUCache(60, 5*time.Minute)
+	defer cache.Stop()
+
+	// Hot at startup, then cold
+	old := CacheKey{Path: "/old.js"}
+	cache.Set(old, &CacheEntry{Size: 20})
+	for i := 0; i < 20; i++ {
+		cache.Get(old)
+	}
+
+	cache.mu.Lock()
+	for i := 0; i < 3; i++ {
+		cache.decayFrequencies()
+	}
+	cache.mu.Unlock()
+
+	// Newly hot entries overtake it
+	for _, key := range []CacheKey{{Path: "/new1.js"}, {Path: "/new2.js"}} {
+		cache.Set(key, &CacheEntry{Size: 20})
+		for i := 0; i < 3; i++ {
+			cache.Get(key)
+		}
+	}
+
+	cache.Set(CacheKey{Path: "/new3.js"}, &CacheEntry{Size: 20})
+
+	if _, ok := cache.Get(old); ok {
+		t.Error("Expected the decayed entry to be evicted")
+	}
+	for _, key := range []CacheKey{{Path: "/new1.js"}, {Path: "/new2.js"}, {Path: "/new3.js"}} {
+		if _, ok := cache.Get(key); !ok {
+			t.Errorf("Expected %s to stay cached", key.Path)
+		}
+	}
+}
+
+func TestLFUCacheDecayTicker(t *testing.T) {
+	cache := NewLFUCacheWithDecay(1024, 5*time.Minute, 10*time.Millisecond)
+	defer cache.Stop()
+
+	key := CacheKey{Path: "/hot.js"}
+	cache.Set(key, &CacheEntry{Size: 20})
+	for i := 0; i < 15; i++ {
+		cache.Get(key)
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		cache.mu.RLock()
+		freq := cache.items[key].freq
+		cache.mu.RUnlock()
+
+		if freq == 0 {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected access count to decay to 0, still %d", freq)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestGetOrSet(t *testing.T) {
+	cache, err := NewLRUCache(1024*1024, 5*time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cache.Stop()
+
+	key := CacheKey{Path: "/app.js", Compression: Gzip}
+	fills := 0
+	fill := func() (*CacheEntry, error) {
+		fills++
+		return &CacheEntry{Data: []byte("filled"), Size: 6}, nil
+	}
+
+	// Miss: fill runs and its entry is cached
+	entry, err := GetOrSet(cache, key, fill)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(entry.Data) != "filled" || fills != 1 {
+		t.Fatalf("Expected filled entry after 1 fill, got %q after %d", entry.Data, fills)
+	}
+	if _, ok := cache.Get(key); !ok {
+		t.Error("Expected the filled entry to be cached")
+	}
+
+	// Hit: fill is not called again
+	entry, err = GetOrSet(cache, key, fill)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(entry.Data) != "filled" || fills != 1 {
+		t.Errorf("Expected cached entry without refilling, got %q after %d fills", entry.Data, fills)
+	}
+
+	// Failed fills are not cached
+	failKey := CacheKey{Path: "/missing.js"}
+	errFill := errors.New("read failed")
+	if _, err := GetOrSet(cache, failKey, func() (*CacheEntry, error) { return nil, errFill }); !errors.Is(err, errFill) {
+		t.Errorf("Expected fill error, got %v", err)
+	}
+	if _, ok := cache.Get(failKey); ok {
+		t.Error("Expected nothing cached after a failed fill")
+	}
+}
+
+func TestInvalidateAllVariants(t *testing.T) {
+	cache, err := NewLRUCache(1024*1024, 5*time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cache.Stop()
+
+	for _, isVersioned := range []bool{false, true} {
+		for _, compression := range []CompressionType{NoCompression, Gzip, Brotli} {
+			cache.Set(CacheKey{Path: "/app.js", Compression: compression, IsVersioned: isVersioned}, &CacheEntry{Size: 1})
+		}
+	}
+	other := CacheKey{Path: "/other.js"}
+	cache.Set(other, &CacheEntry{Size: 1})
+
+	invalidateAllVariants(cache, "/app.js")
+
+	if keys := cache.Keys(); len(keys) != 1 || keys[0] != other {
+		t.Errorf("Expected only %v to remain, got %v", other, keys)
+	}
+}
+
 func TestCacheKeyEquality(t *testing.T) {
 	cache, err := NewLRUCache(1024*1024, 5*time.Minute)
 	if err != nil {
@@ -288,4 +429,488 @@ func BenchmarkLFUCacheGet(b *testing.B) {
 			cache.Get(key)
 		}
 	})
-}
\ No newline at end of file
+}
+func TestNegativeCache(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	server, err := New(
+		WithRoot(tmpDir),
+		WithWatcher(false),
+		WithNegativeCache(time.Minute),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var stats int32
+	server.stat = func(name string) (os.FileInfo, error) {
+		atomic.AddInt32(&stats, 1)
+		return os.Stat(name)
+	}
+
+	for i := 0; i < 2; i++ {
+		req := httptest.NewRequest("GET", "/missing.txt", nil)
+		req.Header.Set("Accept-Encoding", "gzip")
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, req)
+
+		if w.Code != http.StatusNotFound {
+			t.Fatalf("Request %d: expected 404, got %d", i, w.Code)
+		}
+	}
+
+	if n := atomic.LoadInt32(&stats); n != 1 {
+		t.Errorf("Expected a single os.Stat for repeated 404s, got %d", n)
+	}
+
+	// Once the path is invalidated the file is served
+	os.WriteFile(filepath.Join(tmpDir, "missing.txt"), []byte("found"), 0644)
+	server.InvalidatePath("/missing.txt")
+
+	req := httptest.NewRequest("GET", "/missing.txt", nil)
+	w := httptest.NewRecorder()
+	server.ServeHTTP(w, req)
+	if w.Code != http.StatusOK || w.Body.String() != "found" {
+		t.Errorf("Expected 200 'found' after invalidation, got %d %q", w.Code, w.Body.String())
+	}
+}
+
+func TestNegativeCacheExpiry(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	server, err := New(
+		WithRoot(tmpDir),
+		WithWatcher(false),
+		WithNegativeCache(20*time.Millisecond),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req := httptest.NewRequest("GET", "/later.txt", nil)
+	server.ServeHTTP(httptest.NewRecorder(), req)
+
+	os.WriteFile(filepath.Join(tmpDir, "later.txt"), []byte("now here"), 0644)
+	time.Sleep(30 * time.Millisecond)
+
+	w := httptest.NewRecorder()
+	server.ServeHTTP(w, httptest.NewRequest("GET", "/later.txt", nil))
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected 200 after negative entry expired, got %d", w.Code)
+	}
+}
+
+func TestNegativeCacheWatcherInvalidation(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	server, err := New(
+		WithRoot(tmpDir),
+		WithNegativeCache(time.Minute),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := server.invalidator.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer server.invalidator.Stop()
+
+	w := httptest.NewRecorder()
+	server.ServeHTTP(w, httptest.NewRequest("GET", "/new.txt", nil))
+	if w.Code != http.StatusNotFound {
+		t.Fatalf("Expected 404, got %d", w.Code)
+	}
+
+	os.WriteFile(filepath.Join(tmpDir, "new.txt"), []byte("created"), 0644)
+
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		w = httptest.NewRecorder()
+		server.ServeHTTP(w, httptest.NewRequest("GET", "/new.txt", nil))
+		if w.Code == http.StatusOK {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Errorf("Expected watcher to clear the negative entry, last status %d", w.Code)
+}
+
+func TestNegativeCacheKeepsHotFiles(t *testing.T) {
+	tmpDir := t.TempDir()
+	os.WriteFile(filepath.Join(tmpDir, "hot.css"), []byte("body { color: red; }"), 0644)
+
+	server, err := New(
+		WithRoot(tmpDir),
+		WithWatcher(false),
+		WithRateLimit(0),
+		WithCompression(NoCompression),
+		WithCache(1024*1024), // room for about 100 entries
+		WithNegativeCache(time.Minute),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/hot.css", nil))
+
+	// A scanner probing far more missing paths than the cache holds
+	for i := 0; i < 300; i++ {
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, httptest.NewRequest("GET", fmt.Sprintf("/probe-%d.php", i), nil))
+		if w.Code != http.StatusNotFound {
+			t.Fatalf("Expected 404 for a missing path, got %d", w.Code)
+		}
+	}
+
+	if _, ok := server.cache.Get(CacheKey{Path: "/hot.css"}); !ok {
+		t.Error("Expected missing paths not to evict a cached file")
+	}
+	if n := server.cache.Stats().ItemCount; n != 1 {
+		t.Errorf("Expected only the file in the main cache, got %d entries", n)
+	}
+	if n := server.notFound.Len(); n != 300 {
+		t.Errorf("Expected 300 remembered missing paths, got %d", n)
+	}
+}
+
+func TestConcurrentMissesShareLoad(t *testing.T) {
+	tmpDir := t.TempDir()
+	content := strings.Repeat("body { color: red; }\n", 200)
+	os.WriteFile(filepath.Join(tmpDir, "style.css"), []byte(content), 0644)
+
+	server, err := New(
+		WithRoot(tmpDir),
+		WithWatcher(false),
+		WithCompression(Gzip),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var opens int32
+	server.open = func(name string) (*os.File, error) {
+		atomic.AddInt32(&opens, 1)
+		// Hold the load open long enough for the other requests to pile up
+		time.Sleep(50 * time.Millisecond)
+		return os.Open(name)
+	}
+
+	const requests = 50
+	var wg sync.WaitGroup
+	codes := make([]int, requests)
+	bodies := make([]int, requests)
+	for i := 0; i < requests; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			req := httptest.NewRequest("GET", "/style.css", nil)
+			req.Header.Set("Accept-Encoding", "gzip")
+			w := httptest.NewRecorder()
+			server.ServeHTTP(w, req)
+			codes[i] = w.Code
+			bodies[i] = w.Body.Len()
+		}(i)
+	}
+	wg.Wait()
+
+	if n := atomic.LoadInt32(&opens); n != 1 {
+		t.Errorf("Expected the file to be opened once, got %d", n)
+	}
+	for i := 0; i < requests; i++ {
+		if codes[i] != http.StatusOK {
+			t.Fatalf("Request %d: expected 200, got %d", i, codes[i])
+		}
+		if bodies[i] == 0 || bodies[i] != bodies[0] {
+			t.Errorf("Request %d: body length %d differs from %d", i, bodies[i], bodies[0])
+		}
+	}
+}
+
+func TestStaleWhileRevalidate(t *testing.T) {
+	tmpDir := t.TempDir()
+	pagePath := filepath.Join(tmpDir, "page.html")
+	os.WriteFile(pagePath, []byte("<p>v1</p>"), 0644)
+
+	server, err := New(
+		WithRoot(tmpDir),
+		WithWatcher(false),
+		WithCacheTTL(50*time.Millisecond),
+		WithStaleWhileRevalidate(10*time.Second),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Stop()
+
+	var opens int32
+	server.open = func(name string) (*os.File, error) {
+		atomic.AddInt32(&opens, 1)
+		// Keep the refresh running while the stale requests arrive
+		time.Sleep(20 * time.Millisecond)
+		return os.Open(name)
+	}
+
+	get := func() *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, httptest.NewRequest("GET", "/page.html", nil))
+		return w
+	}
+
+	if w := get(); w.Body.String() != "<p>v1</p>" {
+		t.Fatalf("Expected v1, got %q", w.Body.String())
+	}
+
+	os.WriteFile(pagePath, []byte("<p>v2</p>"), 0644)
+	time.Sleep(80 * time.Millisecond)
+
+	// Past TTL: the stale copy is served immediately by every request
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			w := get()
+			if w.Body.String() != "<p>v1</p>" {
+				t.Errorf("Expected the stale body, got %q", w.Body.String())
+			}
+			if cc := w.Header().Get("Cache-Control"); !strings.Contains(cc, "stale-while-revalidate=10") {
+				t.Errorf("Expected stale-while-revalidate in Cache-Control, got %q", cc)
+			}
+		}()
+	}
+	wg.Wait()
+
+	// The background refresh updates the entry shortly after
+	deadline := time.Now().Add(2 * time.Second)
+	for get().Body.String() != "<p>v2</p>" {
+		if time.Now().After(deadline) {
+			t.Fatal("Expected the entry to be refreshed to v2")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if n := atomic.LoadInt32(&opens); n != 2 {
+		t.Errorf("Expected one initial load and one refresh, got %d opens", n)
+	}
+}
+
+func TestStaleWhileRevalidateSkipsStaticAssets(t *testing.T) {
+	tmpDir := t.TempDir()
+	cssPath := filepath.Join(tmpDir, "app.css")
+	os.WriteFile(cssPath, []byte("a{}"), 0644)
+
+	server, err := New(
+		WithRoot(tmpDir),
+		WithWatcher(false),
+		WithCacheTTL(50*time.Millisecond),
+		WithStaleWhileRevalidate(10*time.Second),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Stop()
+
+	server.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/app.css", nil))
+	os.WriteFile(cssPath, []byte("b{}"), 0644)
+	time.Sleep(80 * time.Millisecond)
+
+	w := httptest.NewRecorder()
+	server.ServeHTTP(w, httptest.NewRequest("GET", "/app.css", nil))
+	if w.Body.String() != "b{}" {
+		t.Errorf("Expected expired static asset to be reloaded synchronously, got %q", w.Body.String())
+	}
+}
+
+// mapCache is an in-memory Cache backend standing in for a shared cache
+type mapCache struct {
+	mu      sync.Mutex
+	entries map[CacheKey]*CacheEntry
+	gets    int
+	sets    int
+	stopped bool
+}
+
+func newMapCache() *mapCache {
+	return &mapCache{entries: make(map[CacheKey]*CacheEntry)}
+}
+
+func (m *mapCache) Get(key CacheKey) (*CacheEntry, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.gets++
+	entry, ok := m.entries[key]
+	return entry, ok
+}
+
+func (m *mapCache) Set(key CacheKey, entry *CacheEntry) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.sets++
+	m.entries[key] = entry
+}
+
+func (m *mapCache) Delete(key CacheKey) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.entries, key)
+}
+
+func (m *mapCache) Clear() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.entries = make(map[CacheKey]*CacheEntry)
+}
+
+func (m *mapCache) Stats() CacheStats {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return CacheStats{ItemCount: len(m.entries)}
+}
+
+func (m *mapCache) Stop() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.stopped = true
+}
+
+func (m *mapCache) Keys() []CacheKey {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	keys := make([]CacheKey, 0, len(m.entries))
+	for key := range m.entries {
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+func (m *mapCache) Entries() []CacheEntryInfo {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := time.Now()
+	infos := make([]CacheEntryInfo, 0, len(m.entries))
+	for key, entry := range m.entries {
+		infos = append(infos, entryInfo(key, entry, now))
+	}
+	return infos
+}
+
+func TestCacheBackend(t *testing.T) {
+	tmpDir := t.TempDir()
+	os.WriteFile(filepath.Join(tmpDir, "app.txt"), []byte("from disk"), 0644)
+
+	backend := newMapCache()
+	server, err := New(
+		WithRoot(tmpDir),
+		WithWatcher(false),
+		WithCacheBackend(backend),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Writes go through to the backend
+	w := httptest.NewRecorder()
+	server.ServeHTTP(w, httptest.NewRequest("GET", "/app.txt", nil))
+	if w.Body.String() != "from disk" {
+		t.Fatalf("Expected file contents, got %q", w.Body.String())
+	}
+	if _, ok := backend.entries[CacheKey{Path: "/app.txt"}]; !ok {
+		t.Fatal("Expected the response to be stored in the backend")
+	}
+
+	// Reads come from the backend, e.g. entries written by another node
+	backend.Set(CacheKey{Path: "/shared.txt"}, &CacheEntry{
+		Data:         []byte("from another node"),
+		ContentType:  "text/plain; charset=utf-8",
+		ETag:         `"shared"`,
+		LastModified: time.Now(),
+		CreatedAt:    time.Now(),
+		Size:         17,
+	})
+	w = httptest.NewRecorder()
+	server.ServeHTTP(w, httptest.NewRequest("GET", "/shared.txt", nil))
+	if w.Code != http.StatusOK || w.Body.String() != "from another node" {
+		t.Errorf("Expected the backend entry to be served, got %d %q", w.Code, w.Body.String())
+	}
+
+	// The backend survives Reload and Stop; its owner stops it
+	if err := server.Reload(WithCacheTTL(time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	if server.cache != backend {
+		t.Error("Expected Reload to keep the configured backend")
+	}
+	server.Stop()
+	if backend.stopped {
+		t.Error("Expected the server not to stop a backend it was given")
+	}
+}
+
+func TestStatCache(t *testing.T) {
+	tmpDir := t.TempDir()
+	filePath := filepath.Join(tmpDir, "large.bin")
+	os.WriteFile(filePath, bytes.Repeat([]byte("x"), 4096), 0644)
+
+	server, err := New(
+		WithRoot(tmpDir),
+		WithWatcher(true),
+		WithCache(1024), // smaller than the file, so it is never cached
+		WithStatCache(time.Minute),
+		WithAddr("127.0.0.1:0"),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var stats int32
+	server.stat = func(name string) (os.FileInfo, error) {
+		if name == filePath {
+			atomic.AddInt32(&stats, 1)
+		}
+		return os.Stat(name)
+	}
+
+	if err := server.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer server.Stop()
+
+	get := func() *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/large.bin", nil)
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, req)
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected 200, got %d", w.Code)
+		}
+		return w
+	}
+
+	get()
+	get()
+	if n := atomic.LoadInt32(&stats); n != 1 {
+		t.Errorf("Expected a single os.Stat for two requests within the TTL, got %d", n)
+	}
+
+	invalidated := make(chan struct{}, 1)
+	server.OnInvalidate(func(path string) {
+		if path == "/large.bin" {
+			select {
+			case invalidated <- struct{}{}:
+			default:
+			}
+		}
+	})
+
+	os.WriteFile(filePath, bytes.Repeat([]byte("y"), 2048), 0644)
+	select {
+	case <-invalidated:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Watcher did not report the change")
+	}
+
+	if w := get(); w.Body.Len() != 2048 {
+		t.Errorf("Expected the rewritten file after the watcher event, got %d bytes", w.Body.Len())
+	}
+	if n := atomic.LoadInt32(&stats); n != 2 {
+		t.Errorf("Expected the watcher event to evict the stat entry, got %d stats", n)
+	}
+}
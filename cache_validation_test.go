@@ -1,10 +1,13 @@
 package gostc
 
 import (
+	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"os"
 	"path/filepath"
+	"strconv"
+	"strings"
 	"testing"
 	"time"
 )
@@ -294,3 +297,226 @@ func TestCacheInvalidation(t *testing.T) {
 		t.Error("Expected cache miss after invalidation")
 	}
 }
+
+func TestIfModifiedSinceSubSecond(t *testing.T) {
+	tmpDir := t.TempDir()
+	testFile := filepath.Join(tmpDir, "page.html")
+	os.WriteFile(testFile, []byte("<p>fresh</p>"), 0644)
+
+	// A modification time with sub-second precision, as most filesystems record
+	modTime := time.Now().Add(-time.Minute).Truncate(time.Second).Add(750 * time.Millisecond)
+	if err := os.Chtimes(testFile, modTime, modTime); err != nil {
+		t.Fatal(err)
+	}
+
+	server, err := New(WithRoot(tmpDir), WithWatcher(false))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w := httptest.NewRecorder()
+	server.ServeHTTP(w, httptest.NewRequest("GET", "/page.html", nil))
+	lastModified := w.Header().Get("Last-Modified")
+	etag := w.Header().Get("ETag")
+	if w.Code != http.StatusOK || lastModified == "" {
+		t.Fatalf("Expected 200 with Last-Modified, got %d %q", w.Code, lastModified)
+	}
+
+	req := httptest.NewRequest("GET", "/page.html", nil)
+	req.Header.Set("If-Modified-Since", lastModified)
+	w = httptest.NewRecorder()
+	server.ServeHTTP(w, req)
+
+	if w.Code != http.StatusNotModified {
+		t.Fatalf("Expected 304 for the exact Last-Modified value, got %d", w.Code)
+	}
+	if w.Header().Get("ETag") != etag {
+		t.Errorf("Expected ETag %q on 304, got %q", etag, w.Header().Get("ETag"))
+	}
+	if w.Header().Get("Last-Modified") != lastModified {
+		t.Errorf("Expected Last-Modified %q on 304, got %q", lastModified, w.Header().Get("Last-Modified"))
+	}
+	if w.Header().Get("Cache-Control") == "" {
+		t.Error("Expected Cache-Control on 304")
+	}
+	if w.Body.Len() != 0 {
+		t.Error("Expected an empty body on 304")
+	}
+
+	// If-None-Match takes precedence over If-Modified-Since
+	req = httptest.NewRequest("GET", "/page.html", nil)
+	req.Header.Set("If-Modified-Since", lastModified)
+	req.Header.Set("If-None-Match", `"stale"`)
+	w = httptest.NewRecorder()
+	server.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected a mismatched If-None-Match to override If-Modified-Since, got %d", w.Code)
+	}
+}
+
+func TestHeadConditionalRequest(t *testing.T) {
+	tmpDir := t.TempDir()
+	content := []byte(strings.Repeat("head content ", 100))
+	os.WriteFile(filepath.Join(tmpDir, "test.txt"), content, 0644)
+
+	server, err := New(WithRoot(tmpDir))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// HEAD without validators: headers and length, no body
+	w := httptest.NewRecorder()
+	server.ServeHTTP(w, httptest.NewRequest("HEAD", "/test.txt", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d", w.Code)
+	}
+	if w.Body.Len() != 0 {
+		t.Errorf("HEAD response should have empty body, got %d bytes", w.Body.Len())
+	}
+	if cl := w.Header().Get("Content-Length"); cl != strconv.Itoa(len(content)) {
+		t.Errorf("Expected Content-Length %d, got %q", len(content), cl)
+	}
+	etag := w.Header().Get("ETag")
+	lastModified := w.Header().Get("Last-Modified")
+
+	// HEAD with a matching validator: 304 without a body or length
+	for name, header := range map[string][2]string{
+		"If-None-Match":     {"If-None-Match", etag},
+		"If-Modified-Since": {"If-Modified-Since", lastModified},
+	} {
+		req := httptest.NewRequest("HEAD", "/test.txt", nil)
+		req.Header.Set(header[0], header[1])
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, req)
+
+		if w.Code != http.StatusNotModified {
+			t.Errorf("%s: Expected 304, got %d", name, w.Code)
+		}
+		if w.Body.Len() != 0 {
+			t.Errorf("%s: Expected no body, got %d bytes", name, w.Body.Len())
+		}
+		if cl := w.Header().Get("Content-Length"); cl != "" {
+			t.Errorf("%s: Expected no Content-Length on 304, got %q", name, cl)
+		}
+	}
+
+	// A compressed variant reports its own length on HEAD
+	req := httptest.NewRequest("HEAD", "/test.txt", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	w = httptest.NewRecorder()
+	server.ServeHTTP(w, req)
+
+	get := httptest.NewRequest("GET", "/test.txt", nil)
+	get.Header.Set("Accept-Encoding", "gzip")
+	gw := httptest.NewRecorder()
+	server.ServeHTTP(gw, get)
+
+	if cl := w.Header().Get("Content-Length"); cl != strconv.Itoa(gw.Body.Len()) {
+		t.Errorf("Expected HEAD Content-Length %d to match GET body, got %q", gw.Body.Len(), cl)
+	}
+}
+
+func TestHeadContentLengthWithoutRecompressing(t *testing.T) {
+	tmpDir := t.TempDir()
+	// Varied enough that even the gzip body outgrows the cache
+	var b strings.Builder
+	for i := 0; i < 2000; i++ {
+		fmt.Fprintf(&b, ".item-%d { width: %dpx; color: #%06x; }\n", i, i*i%997, i*7919)
+	}
+	content := b.String()
+	os.WriteFile(filepath.Join(tmpDir, "style.css"), []byte(content), 0644)
+
+	server, err := New(
+		WithRoot(tmpDir),
+		WithWatcher(false),
+		WithCompression(Gzip),
+		WithCache(1024), // smaller than the file, so bodies are never cached
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, encoding := range []string{"gzip", ""} {
+		get := httptest.NewRequest("GET", "/style.css", nil)
+		get.Header.Set("Accept-Encoding", encoding)
+		getW := httptest.NewRecorder()
+		server.ServeHTTP(getW, get)
+
+		if got := getW.Header().Get("Content-Encoding"); got != encoding {
+			t.Fatalf("encoding %q: GET was served with Content-Encoding %q", encoding, got)
+		}
+		before := server.CompressionStats().Count
+
+		head := httptest.NewRequest("HEAD", "/style.css", nil)
+		head.Header.Set("Accept-Encoding", encoding)
+		headW := httptest.NewRecorder()
+		server.ServeHTTP(headW, head)
+
+		if headW.Body.Len() != 0 {
+			t.Errorf("encoding %q: HEAD returned a body", encoding)
+		}
+		if got, want := headW.Header().Get("Content-Length"), strconv.Itoa(getW.Body.Len()); got != want {
+			t.Errorf("encoding %q: HEAD Content-Length %s, GET body is %s bytes", encoding, got, want)
+		}
+		if got, want := headW.Header().Get("ETag"), getW.Header().Get("ETag"); got != want {
+			t.Errorf("encoding %q: HEAD ETag %q, GET ETag %q", encoding, got, want)
+		}
+		if after := server.CompressionStats().Count; after != before {
+			t.Errorf("encoding %q: HEAD compressed the body again (%d -> %d compressions)", encoding, before, after)
+		}
+	}
+
+	// A changed file is read again rather than described from memory
+	os.WriteFile(filepath.Join(tmpDir, "style.css"), []byte(content+content), 0644)
+	head := httptest.NewRequest("HEAD", "/style.css", nil)
+	w := httptest.NewRecorder()
+	server.ServeHTTP(w, head)
+	if got, want := w.Header().Get("Content-Length"), strconv.Itoa(2*len(content)); got != want {
+		t.Errorf("Expected Content-Length %s after the file changed, got %s", want, got)
+	}
+}
+
+func TestHeadAfterCompressionFallback(t *testing.T) {
+	tmpDir := t.TempDir()
+	var b strings.Builder
+	for i := 0; i < 2000; i++ {
+		fmt.Fprintf(&b, ".item-%d { width: %dpx; color: #%06x; }\n", i, i*i%997, i*7919)
+	}
+	os.WriteFile(filepath.Join(tmpDir, "style.css"), []byte(b.String()), 0644)
+
+	server, err := New(
+		WithRoot(tmpDir),
+		WithWatcher(false),
+		WithCompression(Gzip),
+		WithCache(1024), // smaller than the file, so bodies are never cached
+		WithMaxConcurrentCompressions(1, 0),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	request := func(method string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, "/style.css", nil)
+		req.Header.Set("Accept-Encoding", "gzip")
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, req)
+		return w
+	}
+
+	// With the only slot taken, the first HEAD falls back to identity
+	server.compression.slots <- struct{}{}
+	if got := request("HEAD").Header().Get("Content-Encoding"); got != "" {
+		t.Fatalf("Expected an identity fallback while compression is busy, got %q", got)
+	}
+	<-server.compression.slots
+
+	head := request("HEAD")
+	get := request("GET")
+	if got, want := head.Header().Get("Content-Encoding"), get.Header().Get("Content-Encoding"); got != want || want != "gzip" {
+		t.Errorf("HEAD Content-Encoding %q, GET Content-Encoding %q", got, want)
+	}
+	if got, want := head.Header().Get("Content-Length"), strconv.Itoa(get.Body.Len()); got != want {
+		t.Errorf("HEAD Content-Length %s, GET body is %s bytes", got, want)
+	}
+}
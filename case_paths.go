@@ -0,0 +1,78 @@
+package gostc
+
+import (
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	// caseLookupCacheSize bounds the number of remembered case resolutions
+	caseLookupCacheSize = 1024
+
+	// caseLookupMaxDepth bounds the number of directories read per lookup
+	caseLookupMaxDepth = 16
+)
+
+// resolveCaseInsensitive finds the file under Root (or the matching mount)
+// whose path matches urlPath ignoring case. It returns the correctly cased
+// URL path, or false when nothing matches or a segment matches several case
+// variants.
+func (s *Server) resolveCaseInsensitive(urlPath string) (string, bool) {
+	if canonical, ok := s.caseLookups.Get(urlPath); ok {
+		// Drop resolutions whose target has since been removed or renamed
+		if fullPath, err := securePath(s.config.resolveRoot(canonical)); err == nil {
+			if _, err := s.stat(fullPath); err == nil {
+				return canonical, true
+			}
+		}
+		s.caseLookups.Remove(urlPath)
+	}
+
+	dir, relPath := s.config.resolveRoot(urlPath)
+	mountPrefix := strings.TrimSuffix(urlPath, relPath)
+
+	segments := strings.Split(strings.Trim(relPath, "/"), "/")
+	if len(segments) > caseLookupMaxDepth {
+		return "", false
+	}
+
+	resolved := make([]string, 0, len(segments))
+	for _, segment := range segments {
+		name, ok := matchCaseInsensitive(dir, segment)
+		if !ok {
+			return "", false
+		}
+		resolved = append(resolved, name)
+		dir = filepath.Join(dir, name)
+	}
+
+	canonical := mountPrefix + "/" + path.Join(resolved...)
+	s.caseLookups.Add(urlPath, canonical)
+	return canonical, true
+}
+
+// matchCaseInsensitive returns the entry of dir equal to name ignoring case.
+// An exact match always wins; otherwise exactly one variant must exist.
+func matchCaseInsensitive(dir, name string) (string, bool) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return "", false
+	}
+
+	match := ""
+	for _, entry := range entries {
+		if entry.Name() == name {
+			return name, true
+		}
+		if strings.EqualFold(entry.Name(), name) {
+			if match != "" {
+				return "", false // ambiguous
+			}
+			match = entry.Name()
+		}
+	}
+
+	return match, match != ""
+}
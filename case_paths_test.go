@@ -0,0 +1,131 @@
+package gostc
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCaseInsensitivePathRedirect(t *testing.T) {
+	tmpDir := t.TempDir()
+	os.MkdirAll(filepath.Join(tmpDir, "Static"), 0755)
+	os.WriteFile(filepath.Join(tmpDir, "Static", "App.JS"), []byte("console.log(1)"), 0644)
+
+	server, err := New(
+		WithRoot(tmpDir),
+		WithWatcher(false),
+		WithCaseInsensitivePaths(true),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Twice, so the second lookup comes from the resolution cache
+	for i := 0; i < 2; i++ {
+		req := httptest.NewRequest("GET", "/static/app.js?v=1", nil)
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, req)
+
+		if w.Code != http.StatusMovedPermanently {
+			t.Fatalf("Request %d: expected 301, got %d", i, w.Code)
+		}
+
+		location, err := req.URL.Parse(w.Header().Get("Location"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if location.Path != "/Static/App.JS" || location.RawQuery != "v=1" {
+			t.Errorf("Request %d: expected redirect to /Static/App.JS?v=1, got %s", i, location)
+		}
+	}
+
+	req := httptest.NewRequest("GET", "/Static/App.JS", nil)
+	w := httptest.NewRecorder()
+	server.ServeHTTP(w, req)
+	if w.Code != http.StatusOK || w.Body.String() != "console.log(1)" {
+		t.Errorf("Expected the canonical path to serve the file, got %d %q", w.Code, w.Body.String())
+	}
+}
+
+func TestCaseInsensitivePathRedirectUnderPrefix(t *testing.T) {
+	tmpDir := t.TempDir()
+	os.WriteFile(filepath.Join(tmpDir, "Logo.PNG"), []byte("png"), 0644)
+
+	server, err := New(
+		WithRoot(tmpDir),
+		WithWatcher(false),
+		WithCaseInsensitivePaths(true),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	handler := http.StripPrefix("/assets", server)
+	req := httptest.NewRequest("GET", "/assets/logo.png", nil)
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	if w.Code != http.StatusMovedPermanently {
+		t.Fatalf("Expected 301, got %d", w.Code)
+	}
+	base, _ := url.Parse("http://example.com/assets/logo.png")
+	location, err := base.Parse(w.Header().Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if location.Path != "/assets/Logo.PNG" {
+		t.Errorf("Expected redirect to keep the stripped prefix, got %s", location.Path)
+	}
+}
+
+func TestCaseInsensitivePathAmbiguous(t *testing.T) {
+	tmpDir := t.TempDir()
+	os.WriteFile(filepath.Join(tmpDir, "readme.txt"), []byte("lower"), 0644)
+	os.WriteFile(filepath.Join(tmpDir, "README.txt"), []byte("upper"), 0644)
+
+	server, err := New(
+		WithRoot(tmpDir),
+		WithWatcher(false),
+		WithCaseInsensitivePaths(true),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req := httptest.NewRequest("GET", "/Readme.txt", nil)
+	w := httptest.NewRecorder()
+	server.ServeHTTP(w, req)
+
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 for an ambiguous case match, got %d", w.Code)
+	}
+
+	// Exact matches are still served directly
+	req = httptest.NewRequest("GET", "/README.txt", nil)
+	w = httptest.NewRecorder()
+	server.ServeHTTP(w, req)
+	if w.Code != http.StatusOK || w.Body.String() != "upper" {
+		t.Errorf("Expected exact match to be served, got %d %q", w.Code, w.Body.String())
+	}
+}
+
+func TestCaseInsensitivePathsDisabled(t *testing.T) {
+	tmpDir := t.TempDir()
+	os.WriteFile(filepath.Join(tmpDir, "App.js"), []byte("x"), 0644)
+
+	server, err := New(WithRoot(tmpDir), WithWatcher(false))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req := httptest.NewRequest("GET", "/app.js", nil)
+	w := httptest.NewRecorder()
+	server.ServeHTTP(w, req)
+
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 without CaseInsensitivePaths, got %d", w.Code)
+	}
+}
@@ -0,0 +1,67 @@
+package gostc
+
+import (
+	"net/http"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// clientHintImageExts lists the image types eligible for variant negotiation
+var clientHintImageExts = map[string]bool{
+	".jpg":  true,
+	".jpeg": true,
+	".png":  true,
+	".webp": true,
+	".avif": true,
+	".gif":  true,
+}
+
+func isClientHintImage(urlPath string) bool {
+	return clientHintImageExts[strings.ToLower(filepath.Ext(urlPath))]
+}
+
+// requestedImageWidth returns the physical pixel width requested through the
+// Width client hint, or 0 if absent. Browsers already fold DPR into Width,
+// which is why DPR is only advertised and varied on.
+func requestedImageWidth(r *http.Request) int {
+	width, err := strconv.Atoi(strings.TrimSpace(r.Header.Get("Width")))
+	if err != nil || width <= 0 {
+		return 0
+	}
+	return width
+}
+
+// imageVariantPath names the pre-rendered variant of path at width,
+// e.g. /img/hero.jpg -> /img/hero-640.jpg
+func imageVariantPath(path string, width int) string {
+	ext := filepath.Ext(path)
+	return strings.TrimSuffix(path, ext) + "-" + strconv.Itoa(width) + ext
+}
+
+// resolveImageVariant picks the smallest configured variant at least as wide
+// as the hinted width that exists on disk. It returns the variant's URL path
+// and filesystem path, or ok=false to serve the original.
+func (s *Server) resolveImageVariant(r *http.Request, urlPath, fullPath string) (variantURL, variantPath string, ok bool) {
+	target := requestedImageWidth(r)
+	if target == 0 {
+		return "", "", false
+	}
+
+	widths := append([]int(nil), s.config.ClientHintWidths...)
+	sort.Ints(widths)
+
+	for _, width := range widths {
+		if width < target {
+			continue
+		}
+
+		candidate := imageVariantPath(fullPath, width)
+		if info, err := s.cachedStat(candidate); err == nil && !info.IsDir() {
+			return imageVariantPath(urlPath, width), candidate, true
+		}
+	}
+
+	return "", "", false
+}
@@ -0,0 +1,86 @@
+package gostc
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestClientHintImageVariants(t *testing.T) {
+	tmpDir := t.TempDir()
+	imgDir := filepath.Join(tmpDir, "img")
+	os.MkdirAll(imgDir, 0755)
+	os.WriteFile(filepath.Join(imgDir, "hero.jpg"), []byte("original"), 0644)
+	os.WriteFile(filepath.Join(imgDir, "hero-640.jpg"), []byte("variant-640"), 0644)
+	os.WriteFile(filepath.Join(imgDir, "hero-1280.jpg"), []byte("variant-1280"), 0644)
+
+	server, err := New(
+		WithRoot(tmpDir),
+		WithClientHints(320, 640, 1280),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		width    string
+		expected string
+	}{
+		{"NoHints", "", "original"},
+		{"SmallWidthSkipsMissingVariant", "300", "variant-640"},
+		{"ExactWidth", "640", "variant-640"},
+		{"BetweenWidths", "700", "variant-1280"},
+		{"LargerThanAllVariants", "2000", "original"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/img/hero.jpg", nil)
+			if tt.width != "" {
+				req.Header.Set("Width", tt.width)
+				req.Header.Set("DPR", "2")
+			}
+			w := httptest.NewRecorder()
+			server.ServeHTTP(w, req)
+
+			if w.Code != http.StatusOK {
+				t.Fatalf("Expected 200, got %d", w.Code)
+			}
+			if body := w.Body.String(); body != tt.expected {
+				t.Errorf("Expected %q, got %q", tt.expected, body)
+			}
+			if w.Header().Get("Accept-CH") != "DPR, Width" {
+				t.Errorf("Expected Accept-CH header, got %q", w.Header().Get("Accept-CH"))
+			}
+			if w.Header().Get("Vary") != "DPR, Width" {
+				t.Errorf("Expected Vary: DPR, Width, got %q", w.Header().Get("Vary"))
+			}
+		})
+	}
+}
+
+func TestClientHintsDisabledByDefault(t *testing.T) {
+	tmpDir := t.TempDir()
+	os.WriteFile(filepath.Join(tmpDir, "hero.jpg"), []byte("original"), 0644)
+	os.WriteFile(filepath.Join(tmpDir, "hero-640.jpg"), []byte("variant"), 0644)
+
+	server, err := New(WithRoot(tmpDir))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req := httptest.NewRequest("GET", "/hero.jpg", nil)
+	req.Header.Set("Width", "640")
+	w := httptest.NewRecorder()
+	server.ServeHTTP(w, req)
+
+	if w.Body.String() != "original" {
+		t.Errorf("Expected original without client hints enabled, got %q", w.Body.String())
+	}
+	if w.Header().Get("Accept-CH") != "" {
+		t.Error("Accept-CH should not be set when client hints are disabled")
+	}
+}
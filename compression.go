@@ -3,10 +3,16 @@ package gostc
 import (
 	"bytes"
 	"compress/gzip"
+	"context"
+	"fmt"
 	"io"
 	"net/http"
+	"path/filepath"
+	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/andybalholm/brotli"
 )
@@ -16,30 +22,97 @@ type Compressor interface {
 	ContentEncoding() string
 }
 
+// ContextCompressor is a Compressor that gives up with ctx.Err() once ctx
+// is done, so a timed-out request doesn't keep a slow compression running
+type ContextCompressor interface {
+	Compressor
+	CompressContext(ctx context.Context, data []byte, level int) ([]byte, error)
+}
+
+// compressChunkSize is how much input is compressed between cancellation checks
+const compressChunkSize = 64 * 1024
+
+// compressContext compresses data with compressor, honoring ctx when the
+// compressor supports cancellation
+func compressContext(ctx context.Context, compressor Compressor, data []byte, level int) ([]byte, error) {
+	if cc, ok := compressor.(ContextCompressor); ok {
+		return cc.CompressContext(ctx, data, level)
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return compressor.Compress(data, level)
+}
+
+// writeChunks writes data to w in compressChunkSize pieces, stopping with
+// ctx.Err() once ctx is done
+func writeChunks(ctx context.Context, w io.Writer, data []byte) error {
+	for len(data) > 0 {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		n := min(len(data), compressChunkSize)
+		if _, err := w.Write(data[:n]); err != nil {
+			return err
+		}
+		data = data[n:]
+	}
+	return nil
+}
+
+// GzipStrategy selects how gzip output is produced. compress/gzip has no
+// memory-level setting; the strategy is the speed/ratio knob it offers.
+type GzipStrategy int
+
+const (
+	GzipDefaultStrategy GzipStrategy = iota // LZ77 matching at the configured level
+	GzipHuffmanOnly                         // Huffman coding only: far faster, larger output
+)
+
 type GzipCompressor struct {
-	writerPool sync.Pool
-	bufferPool sync.Pool
+	writerPools [gzip.BestCompression + 1]sync.Pool // indexed by level
+	bufferPool  sync.Pool
+	huffmanOnly bool // every level compresses with gzip.HuffmanOnly
 }
 
 func NewGzipCompressor() *GzipCompressor {
-	return &GzipCompressor{
-		writerPool: sync.Pool{
-			New: func() interface{} {
-				w, _ := gzip.NewWriterLevel(nil, gzip.DefaultCompression)
-				return w
-			},
-		},
+	return NewGzipCompressorWithStrategy(GzipDefaultStrategy)
+}
+
+// NewGzipCompressorWithStrategy returns a gzip compressor using strategy;
+// with GzipHuffmanOnly the level passed to Compress is ignored
+func NewGzipCompressorWithStrategy(strategy GzipStrategy) *GzipCompressor {
+	g := &GzipCompressor{
 		bufferPool: sync.Pool{
 			New: func() interface{} {
 				return new(bytes.Buffer)
 			},
 		},
+		huffmanOnly: strategy == GzipHuffmanOnly,
 	}
+
+	for level := gzip.BestSpeed; level <= gzip.BestCompression; level++ {
+		level := level
+		writerLevel := level
+		if g.huffmanOnly {
+			writerLevel = gzip.HuffmanOnly
+		}
+		g.writerPools[level].New = func() interface{} {
+			w, _ := gzip.NewWriterLevel(nil, writerLevel)
+			return w
+		}
+	}
+
+	return g
 }
 
 func (g *GzipCompressor) Compress(data []byte, level int) ([]byte, error) {
-	if level < 1 || level > 9 {
-		level = gzip.DefaultCompression
+	return g.CompressContext(context.Background(), data, level)
+}
+
+func (g *GzipCompressor) CompressContext(ctx context.Context, data []byte, level int) ([]byte, error) {
+	if level < gzip.BestSpeed || level > gzip.BestCompression {
+		level = DefaultCompressionLevel
 	}
 
 	buf := g.bufferPool.Get().(*bytes.Buffer)
@@ -48,12 +121,13 @@ func (g *GzipCompressor) Compress(data []byte, level int) ([]byte, error) {
 		g.bufferPool.Put(buf)
 	}()
 
-	gw := g.writerPool.Get().(*gzip.Writer)
-	defer g.writerPool.Put(gw)
+	pool := &g.writerPools[level]
+	gw := pool.Get().(*gzip.Writer)
+	defer pool.Put(gw)
 
 	gw.Reset(buf)
 
-	if _, err := gw.Write(data); err != nil {
+	if err := writeChunks(ctx, gw, data); err != nil {
 		return nil, err
 	}
 
@@ -73,26 +147,41 @@ func (g *GzipCompressor) ContentEncoding() string {
 }
 
 type BrotliCompressor struct {
-	bufferPool sync.Pool
-	writerPool sync.Pool
+	bufferPool  sync.Pool
+	writerPools [brotli.BestCompression + 1]sync.Pool // indexed by level
 }
 
 func NewBrotliCompressor() *BrotliCompressor {
-	return &BrotliCompressor{
+	return NewBrotliCompressorWithWindow(0)
+}
+
+// NewBrotliCompressorWithWindow returns a brotli compressor whose sliding
+// window is 2^lgwin bytes (10-24). Larger windows find repeats further back
+// in big files; 0 lets the library choose from the level.
+func NewBrotliCompressorWithWindow(lgwin int) *BrotliCompressor {
+	b := &BrotliCompressor{
 		bufferPool: sync.Pool{
 			New: func() interface{} {
 				return new(bytes.Buffer)
 			},
 		},
-		writerPool: sync.Pool{
-			New: func() interface{} {
-				return brotli.NewWriterLevel(nil, brotli.DefaultCompression)
-			},
-		},
 	}
+
+	for level := brotli.BestSpeed; level <= brotli.BestCompression; level++ {
+		level := level
+		b.writerPools[level].New = func() interface{} {
+			return brotli.NewWriterOptions(nil, brotli.WriterOptions{Quality: level, LGWin: lgwin})
+		}
+	}
+
+	return b
 }
 
 func (b *BrotliCompressor) Compress(data []byte, level int) ([]byte, error) {
+	return b.CompressContext(context.Background(), data, level)
+}
+
+func (b *BrotliCompressor) CompressContext(ctx context.Context, data []byte, level int) ([]byte, error) {
 	if level < 0 || level > 11 {
 		level = brotli.DefaultCompression
 	}
@@ -103,12 +192,13 @@ func (b *BrotliCompressor) Compress(data []byte, level int) ([]byte, error) {
 		b.bufferPool.Put(buf)
 	}()
 
-	bw := b.writerPool.Get().(*brotli.Writer)
-	defer b.writerPool.Put(bw)
+	pool := &b.writerPools[level]
+	bw := pool.Get().(*brotli.Writer)
+	defer pool.Put(bw)
 
 	bw.Reset(buf)
 
-	if _, err := bw.Write(data); err != nil {
+	if err := writeChunks(ctx, bw, data); err != nil {
 		return nil, err
 	}
 
@@ -127,23 +217,189 @@ func (b *BrotliCompressor) ContentEncoding() string {
 	return "br"
 }
 
+// CompressionStats totals the compressions a CompressionManager has run
+type CompressionStats struct {
+	Count      int64                    `json:"count"`
+	BytesIn    int64                    `json:"bytesIn"`
+	BytesOut   int64                    `json:"bytesOut"`
+	Ratio      float64                  `json:"ratio"` // BytesOut / BytesIn, 0 before any compression
+	ByEncoding map[string]EncodingStats `json:"byEncoding"`
+}
+
+// EncodingStats totals the compressions run for one encoding
+type EncodingStats struct {
+	Count    int64   `json:"count"`
+	BytesIn  int64   `json:"bytesIn"`
+	BytesOut int64   `json:"bytesOut"`
+	Ratio    float64 `json:"ratio"`
+}
+
+// compressionCounters accumulates EncodingStats without locking
+type compressionCounters struct {
+	count, bytesIn, bytesOut atomic.Int64
+}
+
+func (c *compressionCounters) stats() EncodingStats {
+	stats := EncodingStats{Count: c.count.Load(), BytesIn: c.bytesIn.Load(), BytesOut: c.bytesOut.Load()}
+	if stats.BytesIn > 0 {
+		stats.Ratio = float64(stats.BytesOut) / float64(stats.BytesIn)
+	}
+	return stats
+}
+
+// statsCompressor records every successful Compress in counters
+type statsCompressor struct {
+	Compressor
+	counters *compressionCounters
+}
+
+func (c statsCompressor) Compress(data []byte, level int) ([]byte, error) {
+	return c.CompressContext(context.Background(), data, level)
+}
+
+func (c statsCompressor) CompressContext(ctx context.Context, data []byte, level int) ([]byte, error) {
+	compressed, err := compressContext(ctx, c.Compressor, data, level)
+	if err == nil {
+		c.counters.count.Add(1)
+		c.counters.bytesIn.Add(int64(len(data)))
+		c.counters.bytesOut.Add(int64(len(compressed)))
+	}
+	return compressed, err
+}
+
 type CompressionManager struct {
 	config *Config
-	gzip   *GzipCompressor
-	brotli *BrotliCompressor
+	gzip   Compressor
+	brotli Compressor
+	slots  chan struct{} // nil when compressions are unlimited
 	mu     sync.RWMutex
+
+	gzipCounters   compressionCounters
+	brotliCounters compressionCounters
 }
 
 func NewCompressionManager(config *Config) *CompressionManager {
-	return &CompressionManager{
-		config: config,
-		gzip:   NewGzipCompressor(),
-		brotli: NewBrotliCompressor(),
+	cm := &CompressionManager{config: config}
+	cm.gzip = statsCompressor{NewGzipCompressorWithStrategy(config.GzipStrategy), &cm.gzipCounters}
+	cm.brotli = statsCompressor{NewBrotliCompressorWithWindow(config.BrotliLGWin), &cm.brotliCounters}
+
+	if config.MaxConcurrentCompressions > 0 {
+		cm.slots = make(chan struct{}, config.MaxConcurrentCompressions)
 	}
+
+	return cm
+}
+
+// Stats returns the totals of every compression run so far, overall and
+// per encoding
+func (cm *CompressionManager) Stats() CompressionStats {
+	byEncoding := map[string]EncodingStats{
+		"gzip": cm.gzipCounters.stats(),
+		"br":   cm.brotliCounters.stats(),
+	}
+
+	stats := CompressionStats{ByEncoding: byEncoding}
+	for _, e := range byEncoding {
+		stats.Count += e.Count
+		stats.BytesIn += e.BytesIn
+		stats.BytesOut += e.BytesOut
+	}
+	if stats.BytesIn > 0 {
+		stats.Ratio = float64(stats.BytesOut) / float64(stats.BytesIn)
+	}
+	return stats
+}
+
+// Acquire reserves a compression slot, waiting up to CompressionWait or until
+// ctx is done. It returns false if no slot became available; callers should
+// then serve the response uncompressed. Every successful Acquire must be
+// paired with Release.
+func (cm *CompressionManager) Acquire(ctx context.Context) bool {
+	if cm.slots == nil {
+		return true
+	}
+
+	select {
+	case cm.slots <- struct{}{}:
+		return true
+	default:
+	}
+
+	if cm.config.CompressionWait <= 0 {
+		return false
+	}
+
+	timer := time.NewTimer(cm.config.CompressionWait)
+	defer timer.Stop()
+
+	select {
+	case cm.slots <- struct{}{}:
+		return true
+	case <-timer.C:
+		return false
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// Release frees a slot reserved by Acquire
+func (cm *CompressionManager) Release() {
+	if cm.slots != nil {
+		<-cm.slots
+	}
+}
+
+// compressedExtensions are formats whose data is already compressed, so
+// compressing it again costs CPU without shrinking it
+var compressedExtensions = map[string]bool{
+	".png": true, ".jpg": true, ".jpeg": true, ".gif": true, ".webp": true, ".avif": true,
+	".woff": true, ".woff2": true,
+	".zip": true, ".gz": true, ".tgz": true, ".br": true, ".zst": true, ".bz2": true, ".xz": true, ".7z": true,
+	".mp3": true, ".mp4": true, ".webm": true, ".ogg": true, ".mov": true,
+}
+
+// compressedTypes are media types of already-compressed formats, skipped
+// even when a broad CompressTypes entry such as "image/" matches them
+var compressedTypes = map[string]bool{
+	"image/png": true, "image/jpeg": true, "image/gif": true, "image/webp": true, "image/avif": true,
+	"font/woff": true, "font/woff2": true,
+	"application/zip": true, "application/gzip": true, "application/x-gzip": true, "application/zstd": true,
+	"audio/mpeg": true, "video/mp4": true, "video/webm": true,
+}
+
+// ShouldCompressFile is ShouldCompress with per-extension overrides:
+// NoCompressExtensions always skip and CompressExtensions always compress,
+// regardless of content type. Otherwise already-compressed formats, such
+// as .png or a mislabeled .svg.gz, are skipped. MinSizeToCompress still
+// applies.
+func (cm *CompressionManager) ShouldCompressFile(name, contentType string, size int64) bool {
+	ext := strings.ToLower(filepath.Ext(name))
+	if ext != "" {
+		for _, e := range cm.config.NoCompressExtensions {
+			if ext == e {
+				return false
+			}
+		}
+		for _, e := range cm.config.CompressExtensions {
+			if ext == e {
+				return size >= cm.MinSizeFor(contentType)
+			}
+		}
+		if compressedExtensions[ext] {
+			return false
+		}
+	}
+
+	return cm.ShouldCompress(contentType, size)
 }
 
 func (cm *CompressionManager) ShouldCompress(contentType string, size int64) bool {
-	if size < cm.config.MinSizeToCompress {
+	if size < cm.MinSizeFor(contentType) {
+		return false
+	}
+
+	mediaType, _, _ := strings.Cut(contentType, ";")
+	if compressedTypes[strings.ToLower(strings.TrimSpace(mediaType))] {
 		return false
 	}
 
@@ -156,34 +412,157 @@ func (cm *CompressionManager) ShouldCompress(contentType string, size int64) boo
 	return false
 }
 
+// MinSizeFor returns the smallest compressible size for contentType,
+// preferring a per-type override over the global minimum
+func (cm *CompressionManager) MinSizeFor(contentType string) int64 {
+	mediaType, _, _ := strings.Cut(contentType, ";")
+	if size, ok := cm.config.MinCompressSizes[strings.ToLower(strings.TrimSpace(mediaType))]; ok {
+		return size
+	}
+	return cm.config.MinSizeToCompress
+}
+
+// LevelFor returns the compression level for contentType, preferring a
+// per-type override over the global level
+func (cm *CompressionManager) LevelFor(contentType string) int {
+	mediaType, _, _ := strings.Cut(contentType, ";")
+	if level, ok := cm.config.CompressionLevels[strings.ToLower(strings.TrimSpace(mediaType))]; ok {
+		return level
+	}
+	return cm.config.CompressionLevel
+}
+
+// WorthCompressing reports whether a compressed body of compressedSize bytes
+// is at least MinCompressionSavings percent smaller than originalSize
+func (cm *CompressionManager) WorthCompressing(originalSize, compressedSize int) bool {
+	if compressedSize >= originalSize {
+		return false
+	}
+	return int64(compressedSize)*100 <= int64(originalSize)*int64(100-cm.config.MinCompressionSavings)
+}
+
+// GetCompressor picks the supported encoding with the highest q-value in
+// acceptEncoding, preferring brotli on ties. Codings with q=0 are never
+// chosen, and an explicit identity with a higher q disables compression. A
+// wildcard only stands in for gzip.
 func (cm *CompressionManager) GetCompressor(acceptEncoding string) (Compressor, CompressionType) {
-	acceptEncoding = strings.ToLower(acceptEncoding)
+	qvalues := parseAcceptEncodingQ(acceptEncoding)
 
-	if cm.config.Compression&Brotli != 0 && strings.Contains(acceptEncoding, "br") {
-		return cm.brotli, Brotli
+	var brQ, gzipQ float64
+	if cm.config.Compression&Brotli != 0 {
+		brQ = qvalues["br"]
+	}
+	if cm.config.Compression&Gzip != 0 {
+		if q, ok := qvalues["gzip"]; ok {
+			gzipQ = q
+		} else {
+			gzipQ = qvalues["*"]
+		}
 	}
 
-	if cm.config.Compression&Gzip != 0 &&
-		(strings.Contains(acceptEncoding, "gzip") || strings.Contains(acceptEncoding, "*")) {
-		return cm.gzip, Gzip
+	best := brQ
+	if gzipQ > best {
+		best = gzipQ
+	}
+	if best <= 0 || qvalues["identity"] > best {
+		return nil, NoCompression
 	}
 
-	return nil, NoCompression
+	if brQ == best {
+		return cm.brotli, Brotli
+	}
+	return cm.gzip, Gzip
 }
 
 func (cm *CompressionManager) Compress(data []byte, compressionType CompressionType) ([]byte, error) {
-	var compressor Compressor
+	compressor := cm.compressorFor(compressionType)
+	if compressor == nil {
+		return data, nil
+	}
+
+	return compressor.Compress(data, cm.config.CompressionLevel)
+}
 
+// compressorFor returns the compressor for a single encoding, or nil for
+// identity
+func (cm *CompressionManager) compressorFor(compressionType CompressionType) Compressor {
 	switch compressionType {
 	case Gzip:
-		compressor = cm.gzip
+		return cm.gzip
+	case Brotli:
+		return cm.brotli
+	default:
+		return nil
+	}
+}
+
+// Decompress reverses Compress for the given compression type
+func Decompress(data []byte, compressionType CompressionType) ([]byte, error) {
+	switch compressionType {
+	case Gzip:
+		gr, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		defer gr.Close()
+		return io.ReadAll(gr)
 	case Brotli:
-		compressor = cm.brotli
+		return io.ReadAll(brotli.NewReader(bytes.NewReader(data)))
 	default:
 		return data, nil
 	}
+}
 
-	return compressor.Compress(data, cm.config.CompressionLevel)
+// VerifyCompressed decompresses compressed and checks it round-trips to original
+func VerifyCompressed(original, compressed []byte, compressionType CompressionType) error {
+	decompressed, err := Decompress(compressed, compressionType)
+	if err != nil {
+		return fmt.Errorf("%w: decompression failed: %v", ErrCompressionFailed, err)
+	}
+	if !bytes.Equal(decompressed, original) {
+		return fmt.Errorf("%w: round-trip mismatch (%d bytes in, %d bytes out)", ErrCompressionFailed, len(original), len(decompressed))
+	}
+	return nil
+}
+
+// identityRefused reports whether acceptEncoding rules out an unencoded
+// response: "identity;q=0", or "*;q=0" without identity listed
+func identityRefused(acceptEncoding string) bool {
+	qvalues := parseAcceptEncodingQ(acceptEncoding)
+	if q, ok := qvalues["identity"]; ok {
+		return q == 0
+	}
+	q, ok := qvalues["*"]
+	return ok && q == 0
+}
+
+// parseAcceptEncodingQ maps each coding in an Accept-Encoding header to its
+// q-value. Codings without a valid q default to 1.
+func parseAcceptEncodingQ(header string) map[string]float64 {
+	qvalues := make(map[string]float64)
+
+	for _, part := range strings.Split(header, ",") {
+		name, params, _ := strings.Cut(part, ";")
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+
+		q := 1.0
+		for _, param := range strings.Split(params, ";") {
+			key, value, ok := strings.Cut(strings.TrimSpace(param), "=")
+			if !ok || !strings.EqualFold(strings.TrimSpace(key), "q") {
+				continue
+			}
+			if parsed, err := strconv.ParseFloat(strings.TrimSpace(value), 64); err == nil && parsed >= 0 && parsed <= 1 {
+				q = parsed
+			}
+		}
+
+		qvalues[name] = q
+	}
+
+	return qvalues
 }
 
 func ParseAcceptEncoding(header string) []string {
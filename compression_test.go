@@ -3,9 +3,20 @@ package gostc
 import (
 	"bytes"
 	"compress/gzip"
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
 	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/andybalholm/brotli"
 )
@@ -125,6 +136,86 @@ func TestCompressionManager(t *testing.T) {
 	})
 }
 
+func TestGetCompressorQValues(t *testing.T) {
+	manager := NewCompressionManager(DefaultConfig())
+
+	tests := []struct {
+		acceptEncoding string
+		want           CompressionType
+	}{
+		{"br;q=0, gzip", Gzip},
+		{"gzip;q=1.0, br;q=0", Gzip},
+		{"identity;q=1, gzip;q=0", NoCompression},
+		{"gzip;q=0.5, br;q=0.8", Brotli},
+		{"gzip;q=0.9, br;q=0.5", Gzip},
+		{"gzip;q=0.7, br;q=0.7", Brotli},
+		{"GZIP; Q=0.5, identity;q=0.9", NoCompression},
+		{"br;q=0, gzip;q=0", NoCompression},
+		{"*", Gzip},
+		{"*, gzip;q=0", NoCompression},
+		{"", NoCompression},
+	}
+
+	for _, tt := range tests {
+		_, got := manager.GetCompressor(tt.acceptEncoding)
+		if got != tt.want {
+			t.Errorf("%q: expected %v, got %v", tt.acceptEncoding, tt.want, got)
+		}
+	}
+
+	gzipOnly := DefaultConfig()
+	gzipOnly.Compression = Gzip
+	if _, got := NewCompressionManager(gzipOnly).GetCompressor("br;q=1, gzip;q=0.1"); got != Gzip {
+		t.Errorf("Expected gzip when brotli is disabled, got %v", got)
+	}
+}
+
+func TestIdentityEncoding(t *testing.T) {
+	tmpDir := t.TempDir()
+	content := strings.Repeat("identity negotiation ", 200)
+	os.WriteFile(filepath.Join(tmpDir, "page.html"), []byte(content), 0644)
+
+	server, err := New(
+		WithRoot(tmpDir),
+		WithWatcher(false),
+		WithCompression(Gzip),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		acceptEncoding string
+		code           int
+		encoding       string
+	}{
+		{"identity", http.StatusOK, ""},
+		{"identity;q=1, gzip;q=0", http.StatusOK, ""},
+		{"identity;q=0, gzip", http.StatusOK, "gzip"},
+		{"identity;q=0, br", http.StatusNotAcceptable, ""},
+		{"*;q=0", http.StatusNotAcceptable, ""},
+		{"*;q=0, identity", http.StatusOK, ""},
+	}
+
+	for _, tt := range tests {
+		req := httptest.NewRequest("GET", "/page.html", nil)
+		req.Header.Set("Accept-Encoding", tt.acceptEncoding)
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, req)
+
+		if w.Code != tt.code {
+			t.Errorf("%q: expected %d, got %d", tt.acceptEncoding, tt.code, w.Code)
+			continue
+		}
+		if got := w.Header().Get("Content-Encoding"); got != tt.encoding {
+			t.Errorf("%q: expected Content-Encoding %q, got %q", tt.acceptEncoding, tt.encoding, got)
+		}
+		if tt.code == http.StatusOK && tt.encoding == "" && w.Body.String() != content {
+			t.Errorf("%q: expected the unencoded body", tt.acceptEncoding)
+		}
+	}
+}
+
 func TestCompressionLevels(t *testing.T) {
 	testData := []byte(strings.Repeat("compress this data ", 100))
 
@@ -261,4 +352,744 @@ func BenchmarkCompressionWithPooling(b *testing.B) {
 			}
 		}
 	})
-}
\ No newline at end of file
+}
+
+// brokenCompressor produces valid gzip output of the wrong content
+type brokenCompressor struct{}
+
+func (brokenCompressor) Compress(data []byte, level int) ([]byte, error) {
+	return NewGzipCompressor().Compress(data[:len(data)/2], level)
+}
+
+func (brokenCompressor) ContentEncoding() string {
+	return "gzip"
+}
+
+func TestCompressionVerification(t *testing.T) {
+	tmpDir := t.TempDir()
+	content := bytes.Repeat([]byte("body { color: red; } "), 100)
+	os.WriteFile(filepath.Join(tmpDir, "style.css"), content, 0644)
+
+	for _, verify := range []bool{true, false} {
+		server, err := New(
+			WithRoot(tmpDir),
+			WithCompression(Gzip),
+			WithCompressionVerification(verify),
+		)
+		if err != nil {
+			t.Fatal(err)
+		}
+		server.compression.gzip = brokenCompressor{}
+
+		req := httptest.NewRequest("GET", "/style.css", nil)
+		req.Header.Set("Accept-Encoding", "gzip")
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, req)
+
+		if verify && w.Code != http.StatusInternalServerError {
+			t.Errorf("Expected 500 when verification trips, got %d", w.Code)
+		}
+		if !verify && w.Code != http.StatusOK {
+			t.Errorf("Expected 200 with verification disabled, got %d", w.Code)
+		}
+	}
+}
+
+func TestVerifyCompressedRoundTrip(t *testing.T) {
+	data := []byte(strings.Repeat("round trip ", 200))
+
+	for _, ct := range []CompressionType{Gzip, Brotli} {
+		var compressor Compressor = NewGzipCompressor()
+		if ct == Brotli {
+			compressor = NewBrotliCompressor()
+		}
+
+		compressed, err := compressor.Compress(data, 6)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := VerifyCompressed(data, compressed, ct); err != nil {
+			t.Errorf("%s: unexpected verification error: %v", compressor.ContentEncoding(), err)
+		}
+		if err := VerifyCompressed(data[1:], compressed, ct); !errors.Is(err, ErrCompressionFailed) {
+			t.Errorf("%s: expected ErrCompressionFailed for mismatch, got %v", compressor.ContentEncoding(), err)
+		}
+	}
+}
+
+// trackingCompressor records the peak number of concurrent Compress calls
+type trackingCompressor struct {
+	Compressor
+	delay   time.Duration
+	current int32
+	peak    int32
+}
+
+func (tc *trackingCompressor) Compress(data []byte, level int) ([]byte, error) {
+	n := atomic.AddInt32(&tc.current, 1)
+	defer atomic.AddInt32(&tc.current, -1)
+
+	for {
+		peak := atomic.LoadInt32(&tc.peak)
+		if n <= peak || atomic.CompareAndSwapInt32(&tc.peak, peak, n) {
+			break
+		}
+	}
+
+	time.Sleep(tc.delay)
+	return tc.Compressor.Compress(data, level)
+}
+
+func TestMaxConcurrentCompressions(t *testing.T) {
+	tmpDir := t.TempDir()
+	content := bytes.Repeat([]byte("console.log('concurrency'); "), 100)
+	const files = 12
+	for i := 0; i < files; i++ {
+		os.WriteFile(filepath.Join(tmpDir, fmt.Sprintf("app%d.js", i)), content, 0644)
+	}
+
+	t.Run("WaitsForSlot", func(t *testing.T) {
+		server, err := New(
+			WithRoot(tmpDir),
+			WithCompression(Gzip),
+			WithRateLimit(0),
+			WithMaxConcurrentCompressions(2, 5*time.Second),
+		)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tracker := &trackingCompressor{Compressor: NewGzipCompressor(), delay: 20 * time.Millisecond}
+		server.compression.gzip = tracker
+
+		var wg sync.WaitGroup
+		for i := 0; i < files; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				req := httptest.NewRequest("GET", fmt.Sprintf("/app%d.js", i), nil)
+				req.Header.Set("Accept-Encoding", "gzip")
+				w := httptest.NewRecorder()
+				server.ServeHTTP(w, req)
+
+				if w.Header().Get("Content-Encoding") != "gzip" {
+					t.Errorf("app%d.js: expected gzip response", i)
+					return
+				}
+				decompressed, err := Decompress(w.Body.Bytes(), Gzip)
+				if err != nil || !bytes.Equal(decompressed, content) {
+					t.Errorf("app%d.js: corrupted response body", i)
+				}
+			}(i)
+		}
+		wg.Wait()
+
+		if peak := atomic.LoadInt32(&tracker.peak); peak > 2 {
+			t.Errorf("Expected at most 2 concurrent compressions, saw %d", peak)
+		}
+	})
+
+	t.Run("FallsBackToIdentity", func(t *testing.T) {
+		server, err := New(
+			WithRoot(tmpDir),
+			WithCompression(Gzip),
+			WithRateLimit(0),
+			WithMaxConcurrentCompressions(1, 0),
+		)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tracker := &trackingCompressor{Compressor: NewGzipCompressor(), delay: 50 * time.Millisecond}
+		server.compression.gzip = tracker
+
+		var wg sync.WaitGroup
+		var identity int32
+		for i := 0; i < files; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				req := httptest.NewRequest("GET", fmt.Sprintf("/app%d.js", i), nil)
+				req.Header.Set("Accept-Encoding", "gzip")
+				w := httptest.NewRecorder()
+				server.ServeHTTP(w, req)
+
+				if w.Header().Get("Content-Encoding") == "" {
+					atomic.AddInt32(&identity, 1)
+					if !bytes.Equal(w.Body.Bytes(), content) {
+						t.Errorf("app%d.js: identity body mismatch", i)
+					}
+				}
+			}(i)
+		}
+		wg.Wait()
+
+		if peak := atomic.LoadInt32(&tracker.peak); peak > 1 {
+			t.Errorf("Expected at most 1 concurrent compression, saw %d", peak)
+		}
+		if identity == 0 {
+			t.Error("Expected some responses to fall back to identity while saturated")
+		}
+	})
+
+	t.Run("GivesUpWhenRequestEnds", func(t *testing.T) {
+		server, err := New(
+			WithRoot(tmpDir),
+			WithCompression(Gzip),
+			WithRateLimit(0),
+			WithMaxConcurrentCompressions(1, 5*time.Second),
+		)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer server.Stop()
+
+		// Hold the only slot so the request has to wait for it
+		server.compression.slots <- struct{}{}
+		defer server.compression.Release()
+
+		// The client goes away while the request waits
+		ctx, cancel := context.WithCancel(context.Background())
+		time.AfterFunc(20*time.Millisecond, cancel)
+		req := httptest.NewRequest("GET", "/app0.js", nil).WithContext(ctx)
+
+		entry := &CacheEntry{Data: content, ContentType: "application/javascript", Size: int64(len(content))}
+		persistent, err := server.compressEntry(req, entry, NewGzipCompressor(), Gzip, "/app0.js")
+		if !errors.Is(err, context.Canceled) {
+			t.Fatalf("Expected context.Canceled, got %v", err)
+		}
+		if persistent || entry.Encoding != NoCompression {
+			t.Error("Expected the entry to be left untouched")
+		}
+	})
+}
+
+func TestCompressionWorkers(t *testing.T) {
+	tmpDir := t.TempDir()
+	content := bytes.Repeat([]byte("body { margin: 0; padding: 0; } "), 1024)
+	os.WriteFile(filepath.Join(tmpDir, "a.css"), content, 0644)
+	os.WriteFile(filepath.Join(tmpDir, "b.css"), content, 0644)
+
+	server, err := New(
+		WithRoot(tmpDir),
+		WithWatcher(false),
+		WithCompression(Brotli),
+		WithCompressionWorkers(1),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	const delay = 30 * time.Millisecond
+	tracker := &trackingCompressor{Compressor: NewBrotliCompressor(), delay: delay}
+	server.compression.brotli = tracker
+
+	start := time.Now()
+	var wg sync.WaitGroup
+	for _, name := range []string{"/a.css", "/b.css"} {
+		wg.Add(1)
+		go func(name string) {
+			defer wg.Done()
+			req := httptest.NewRequest("GET", name, nil)
+			req.Header.Set("Accept-Encoding", "br")
+			w := httptest.NewRecorder()
+			server.ServeHTTP(w, req)
+
+			// The second request waits for the worker rather than skipping compression
+			if w.Header().Get("Content-Encoding") != "br" {
+				t.Errorf("%s: expected br response, got %q", name, w.Header().Get("Content-Encoding"))
+			}
+		}(name)
+	}
+	wg.Wait()
+
+	if peak := atomic.LoadInt32(&tracker.peak); peak != 1 {
+		t.Errorf("Expected compressions to run one at a time, saw %d at once", peak)
+	}
+	if elapsed := time.Since(start); elapsed < 2*delay {
+		t.Errorf("Expected serialized compressions to take at least %v, took %v", 2*delay, elapsed)
+	}
+}
+
+// countingCompressor counts Compress calls on the wrapped compressor
+type countingCompressor struct {
+	Compressor
+	calls int32
+}
+
+func (cc *countingCompressor) Compress(data []byte, level int) ([]byte, error) {
+	atomic.AddInt32(&cc.calls, 1)
+	return cc.Compressor.Compress(data, level)
+}
+
+func TestIncompressibleServedIdentity(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	// Random bytes are well over MinSizeToCompress but gzip cannot shrink them
+	content := make([]byte, 8*1024)
+	if _, err := rand.Read(content); err != nil {
+		t.Fatal(err)
+	}
+	os.WriteFile(filepath.Join(tmpDir, "noise.txt"), content, 0644)
+
+	server, err := New(
+		WithRoot(tmpDir),
+		WithWatcher(false),
+		WithCompression(Gzip),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	counter := &countingCompressor{Compressor: server.compression.gzip}
+	server.compression.gzip = counter
+
+	for i := 0; i < 2; i++ {
+		req := httptest.NewRequest("GET", "/noise.txt", nil)
+		req.Header.Set("Accept-Encoding", "gzip")
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, req)
+
+		if w.Code != http.StatusOK {
+			t.Fatalf("Request %d: expected 200, got %d", i, w.Code)
+		}
+		if enc := w.Header().Get("Content-Encoding"); enc != "" {
+			t.Errorf("Request %d: expected identity, got Content-Encoding %q", i, enc)
+		}
+		if w.Header().Get("Vary") != "Accept-Encoding" {
+			t.Errorf("Request %d: expected Vary: Accept-Encoding, got %q", i, w.Header().Get("Vary"))
+		}
+		if !bytes.Equal(w.Body.Bytes(), content) {
+			t.Errorf("Request %d: body does not match the original", i)
+		}
+	}
+
+	if n := atomic.LoadInt32(&counter.calls); n != 1 {
+		t.Errorf("Expected the skip decision to be cached after one compression, got %d calls", n)
+	}
+}
+
+func TestWorthCompressing(t *testing.T) {
+	cm := NewCompressionManager(&Config{MinCompressionSavings: 10})
+
+	tests := []struct {
+		original, compressed int
+		want                 bool
+	}{
+		{1000, 500, true},
+		{1000, 900, true},
+		{1000, 901, false},
+		{1000, 1000, false},
+		{1000, 1200, false},
+	}
+	for _, tt := range tests {
+		if got := cm.WorthCompressing(tt.original, tt.compressed); got != tt.want {
+			t.Errorf("WorthCompressing(%d, %d) = %v, want %v", tt.original, tt.compressed, got, tt.want)
+		}
+	}
+}
+
+func TestCompressionLevelFor(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	// Varied text so that the level makes a visible difference
+	var buf bytes.Buffer
+	for i := 0; i < 2000; i++ {
+		fmt.Fprintf(&buf, "item-%d value-%d label-%x;\n", i, i*i%997, i*31)
+	}
+	content := buf.Bytes()
+	os.WriteFile(filepath.Join(tmpDir, "app.css"), content, 0644)
+	os.WriteFile(filepath.Join(tmpDir, "data.json"), content, 0644)
+
+	server, err := New(
+		WithRoot(tmpDir),
+		WithWatcher(false),
+		WithCompression(Brotli),
+		WithCompressionLevel(0),
+		WithCompressionLevelFor("text/css", 11),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if level := server.compression.LevelFor("text/css; charset=utf-8"); level != 11 {
+		t.Errorf("Expected override level 11 for text/css, got %d", level)
+	}
+	if level := server.compression.LevelFor("application/json"); level != 0 {
+		t.Errorf("Expected global level 0 for application/json, got %d", level)
+	}
+
+	sizes := map[string]int{}
+	for _, name := range []string{"app.css", "data.json"} {
+		req := httptest.NewRequest("GET", "/"+name, nil)
+		req.Header.Set("Accept-Encoding", "br")
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, req)
+
+		if w.Header().Get("Content-Encoding") != "br" {
+			t.Fatalf("%s: expected brotli encoding, got %q", name, w.Header().Get("Content-Encoding"))
+		}
+		sizes[name] = w.Body.Len()
+	}
+
+	if sizes["app.css"] >= sizes["data.json"] {
+		t.Errorf("Expected level 11 CSS (%d bytes) to be smaller than level 0 JSON (%d bytes)", sizes["app.css"], sizes["data.json"])
+	}
+}
+
+func TestMinCompressSizeFor(t *testing.T) {
+	tmpDir := t.TempDir()
+	os.WriteFile(filepath.Join(tmpDir, "small.css"), bytes.Repeat([]byte("body { margin: 0; }\n"), 30), 0644)
+	os.WriteFile(filepath.Join(tmpDir, "tiny.css"), bytes.Repeat([]byte("p{}\n"), 25), 0644)
+	os.WriteFile(filepath.Join(tmpDir, "small.js"), bytes.Repeat([]byte("var a = 1;\n"), 55), 0644)
+
+	server, err := New(
+		WithRoot(tmpDir),
+		WithWatcher(false),
+		WithCompression(Gzip),
+		WithMinCompressSize(1024),
+		WithMinCompressSizeFor("text/css", 200),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if size := server.compression.MinSizeFor("text/css; charset=utf-8"); size != 200 {
+		t.Errorf("Expected override minimum 200 for text/css, got %d", size)
+	}
+	if size := server.compression.MinSizeFor("application/javascript"); size != 1024 {
+		t.Errorf("Expected global minimum 1024 for application/javascript, got %d", size)
+	}
+
+	tests := []struct {
+		path     string
+		encoding string
+	}{
+		{"/small.css", "gzip"}, // 600 bytes, above the CSS minimum
+		{"/tiny.css", ""},      // 100 bytes, below the CSS minimum
+		{"/small.js", ""},      // 605 bytes, below the global minimum
+	}
+
+	for _, tt := range tests {
+		req := httptest.NewRequest("GET", tt.path, nil)
+		req.Header.Set("Accept-Encoding", "gzip")
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, req)
+
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s: expected 200, got %d", tt.path, w.Code)
+		}
+		if got := w.Header().Get("Content-Encoding"); got != tt.encoding {
+			t.Errorf("%s: expected Content-Encoding %q, got %q", tt.path, tt.encoding, got)
+		}
+	}
+}
+
+func TestCompressExtensionOverrides(t *testing.T) {
+	tmpDir := t.TempDir()
+	csv := strings.Repeat("id,name,value\n1,alpha,100\n", 200)
+	svg := `<svg xmlns="http://www.w3.org/2000/svg">` + strings.Repeat(`<rect width="10" height="10"/>`, 100) + `</svg>`
+	os.WriteFile(filepath.Join(tmpDir, "data.csv"), []byte(csv), 0644)
+	os.WriteFile(filepath.Join(tmpDir, "icon.svg"), []byte(svg), 0644)
+
+	fetch := func(server *Server, path string) string {
+		req := httptest.NewRequest("GET", path, nil)
+		req.Header.Set("Accept-Encoding", "gzip")
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, req)
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s: expected 200, got %d", path, w.Code)
+		}
+		return w.Header().Get("Content-Encoding")
+	}
+
+	// Content-type heuristics alone: CSV is not in CompressTypes, SVG is
+	plain, err := New(WithRoot(tmpDir), WithWatcher(false), WithCompression(Gzip))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if enc := fetch(plain, "/data.csv"); enc != "" {
+		t.Fatalf("Expected CSV to be uncompressed by default, got %q", enc)
+	}
+	if enc := fetch(plain, "/icon.svg"); enc != "gzip" {
+		t.Fatalf("Expected SVG to be compressed by default, got %q", enc)
+	}
+
+	server, err := New(
+		WithRoot(tmpDir),
+		WithWatcher(false),
+		WithCompression(Gzip),
+		WithCompressExtensions("csv"),
+		WithNoCompressExtensions(".SVG"),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if enc := fetch(server, "/data.csv"); enc != "gzip" {
+		t.Errorf("Expected forced gzip for .csv, got %q", enc)
+	}
+	if enc := fetch(server, "/icon.svg"); enc != "" {
+		t.Errorf("Expected .svg to be forced uncompressed, got %q", enc)
+	}
+}
+
+func TestAlreadyCompressedFormatsSkipped(t *testing.T) {
+	tmpDir := t.TempDir()
+	// Highly repetitive, so only the format check keeps it uncompressed
+	png := append([]byte("\x89PNG\r\n\x1a\n"), bytes.Repeat([]byte{0}, 4096)...)
+	svg := `<svg xmlns="http://www.w3.org/2000/svg">` + strings.Repeat(`<rect width="10" height="10"/>`, 100) + `</svg>`
+	os.WriteFile(filepath.Join(tmpDir, "logo.png"), png, 0644)
+	os.WriteFile(filepath.Join(tmpDir, "icon.svg.gz"), []byte(svg), 0644)
+	os.WriteFile(filepath.Join(tmpDir, "icon.svg"), []byte(svg), 0644)
+
+	server, err := New(
+		WithRoot(tmpDir),
+		WithWatcher(false),
+		WithCompression(Gzip),
+		WithAdditionalCompressTypes("image/"),
+		WithMimeType(".gz", "image/svg+xml"), // mislabeled precompressed SVG
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for path, want := range map[string]string{
+		"/logo.png":    "",
+		"/icon.svg.gz": "",
+		"/icon.svg":    "gzip",
+	} {
+		req := httptest.NewRequest("GET", path, nil)
+		req.Header.Set("Accept-Encoding", "gzip")
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, req)
+
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s: expected 200, got %d", path, w.Code)
+		}
+		if enc := w.Header().Get("Content-Encoding"); enc != want {
+			t.Errorf("%s: expected Content-Encoding %q, got %q", path, want, enc)
+		}
+	}
+
+	if server.compression.ShouldCompress("image/png", 1<<20) {
+		t.Error("Expected image/png to be skipped even when a CompressTypes entry matches it")
+	}
+}
+
+func TestEagerCompression(t *testing.T) {
+	tmpDir := t.TempDir()
+	content := strings.Repeat("body { color: red; }\n", 200)
+	os.WriteFile(filepath.Join(tmpDir, "style.css"), []byte(content), 0644)
+
+	server, err := New(
+		WithRoot(tmpDir),
+		WithWatcher(false),
+		WithCompression(Gzip|Brotli),
+		WithEagerCompression(true),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req := httptest.NewRequest("GET", "/style.css", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	w := httptest.NewRecorder()
+	server.ServeHTTP(w, req)
+
+	if w.Header().Get("Content-Encoding") != "gzip" {
+		t.Fatalf("Expected gzip response, got %q", w.Header().Get("Content-Encoding"))
+	}
+
+	for _, compressionType := range []CompressionType{NoCompression, Gzip, Brotli} {
+		entry, ok := server.cache.Get(CacheKey{Path: "/style.css", Compression: compressionType})
+		if !ok {
+			t.Errorf("Expected %s variant to be cached after one request", getEncodingName(compressionType))
+			continue
+		}
+		if entry.Encoding != compressionType {
+			t.Errorf("Expected %s variant to be encoded as such, got %s",
+				getEncodingName(compressionType), getEncodingName(entry.Encoding))
+		}
+	}
+
+	// A brotli client is now served straight from the cache
+	req = httptest.NewRequest("GET", "/style.css", nil)
+	req.Header.Set("Accept-Encoding", "br")
+	w = httptest.NewRecorder()
+	server.ServeHTTP(w, req)
+
+	if w.Header().Get("Content-Encoding") != "br" {
+		t.Errorf("Expected br response, got %q", w.Header().Get("Content-Encoding"))
+	}
+	decoded, err := io.ReadAll(brotli.NewReader(w.Body))
+	if err != nil || string(decoded) != content {
+		t.Errorf("Brotli body does not decode to the original: %v", err)
+	}
+}
+
+func TestCompressTypesOptions(t *testing.T) {
+	tmpDir := t.TempDir()
+	content := bytes.Repeat([]byte("compressible payload "), 200)
+	os.WriteFile(filepath.Join(tmpDir, "module.wasm"), content, 0644)
+	os.WriteFile(filepath.Join(tmpDir, "app.js"), content, 0644)
+
+	encodingOf := func(server *Server, path string) string {
+		req := httptest.NewRequest("GET", path, nil)
+		req.Header.Set("Accept-Encoding", "gzip")
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, req)
+		return w.Header().Get("Content-Encoding")
+	}
+
+	t.Run("Replace", func(t *testing.T) {
+		server, err := New(
+			WithRoot(tmpDir),
+			WithWatcher(false),
+			WithCompression(Gzip),
+			WithCompressTypes("text/css", "application/wasm"),
+		)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if enc := encodingOf(server, "/module.wasm"); enc != "gzip" {
+			t.Errorf("Expected added type to be compressed, got %q", enc)
+		}
+		if enc := encodingOf(server, "/app.js"); enc != "" {
+			t.Errorf("Expected removed type to be served identity, got %q", enc)
+		}
+	})
+
+	t.Run("Append", func(t *testing.T) {
+		server, err := New(
+			WithRoot(tmpDir),
+			WithWatcher(false),
+			WithCompression(Gzip),
+			WithAdditionalCompressTypes("Application/WASM"),
+		)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if enc := encodingOf(server, "/module.wasm"); enc != "gzip" {
+			t.Errorf("Expected added type to be compressed, got %q", enc)
+		}
+		if enc := encodingOf(server, "/app.js"); enc != "gzip" {
+			t.Errorf("Expected default types to stay compressed, got %q", enc)
+		}
+	})
+
+	t.Run("Validation", func(t *testing.T) {
+		if _, err := New(WithCompression(Gzip), WithCompressTypes()); err == nil {
+			t.Error("Expected an empty compress type list to be rejected")
+		}
+		if _, err := New(WithAdditionalCompressTypes(" ")); err == nil {
+			t.Error("Expected a blank compress type to be rejected")
+		}
+	})
+}
+
+func TestCompressorTuning(t *testing.T) {
+	// A 64KB random block repeated: only a window wider than the block can
+	// refer back to the earlier copy
+	block := make([]byte, 64*1024)
+	if _, err := rand.Read(block); err != nil {
+		t.Fatal(err)
+	}
+	data := bytes.Repeat(block, 4)
+
+	small, err := NewBrotliCompressorWithWindow(10).Compress(data, 6)
+	if err != nil {
+		t.Fatal(err)
+	}
+	large, err := NewBrotliCompressorWithWindow(24).Compress(data, 6)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(large) > len(small) {
+		t.Errorf("Expected a 2^24 window to compress at least as well as 2^10, got %d > %d bytes", len(large), len(small))
+	}
+
+	cm := NewCompressionManager(&Config{Compression: Gzip | Brotli, BrotliLGWin: 24, GzipStrategy: GzipHuffmanOnly})
+	fromConfig, err := cm.compressorFor(Brotli).Compress(data, 6)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(fromConfig) != len(large) {
+		t.Errorf("Expected BrotliLGWin to reach the compressor, got %d bytes, want %d", len(fromConfig), len(large))
+	}
+
+	// Huffman-only can't use repeats at all, even ones deflate's 32KB window sees
+	text := []byte(strings.Repeat("body { margin: 0; padding: 0; }\n", 2000))
+	huffman, err := cm.compressorFor(Gzip).Compress(text, 9)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reader, err := gzip.NewReader(bytes.NewReader(huffman))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if decoded, err := io.ReadAll(reader); err != nil || !bytes.Equal(decoded, text) {
+		t.Fatalf("Huffman-only gzip output did not round-trip: %v", err)
+	}
+	standard, _ := NewGzipCompressor().Compress(text, 9)
+	if len(huffman) <= len(standard) {
+		t.Errorf("Expected Huffman-only output to be larger than LZ77, got %d <= %d", len(huffman), len(standard))
+	}
+
+	if _, err := New(WithRoot(t.TempDir()), WithBrotliLGWin(30)); err == nil {
+		t.Error("Expected an out-of-range brotli window to be rejected")
+	}
+}
+
+func TestCompressionStats(t *testing.T) {
+	tmpDir := t.TempDir()
+	files := map[string]string{
+		"a.css": strings.Repeat("body { margin: 0; }\n", 200),
+		"b.js":  strings.Repeat("console.log('hello');\n", 200),
+		"c.txt": strings.Repeat("plain text line\n", 200),
+	}
+	var total int64
+	for name, content := range files {
+		os.WriteFile(filepath.Join(tmpDir, name), []byte(content), 0644)
+		total += int64(len(content))
+	}
+
+	server, err := New(WithRoot(tmpDir), WithWatcher(false), WithCompressionStatsEndpoint("/debug/compression"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name := range files {
+		for _, encoding := range []string{"gzip", "br"} {
+			req := httptest.NewRequest("GET", "/"+name, nil)
+			req.Header.Set("Accept-Encoding", encoding)
+			server.ServeHTTP(httptest.NewRecorder(), req)
+		}
+	}
+
+	stats := server.CompressionStats()
+	if stats.Count != 6 || stats.BytesIn != 2*total {
+		t.Errorf("Expected 6 compressions of %d bytes, got %d of %d", 2*total, stats.Count, stats.BytesIn)
+	}
+	if stats.BytesOut <= 0 || stats.BytesOut >= stats.BytesIn || stats.Ratio <= 0 || stats.Ratio >= 0.5 {
+		t.Errorf("Expected repetitive text to shrink well, got %d -> %d bytes (ratio %.3f)", stats.BytesIn, stats.BytesOut, stats.Ratio)
+	}
+	for _, encoding := range []string{"gzip", "br"} {
+		if e := stats.ByEncoding[encoding]; e.Count != 3 || e.BytesIn != total {
+			t.Errorf("%s: expected 3 compressions of %d bytes, got %d of %d", encoding, total, e.Count, e.BytesIn)
+		}
+	}
+
+	// Cached responses don't compress again
+	req := httptest.NewRequest("GET", "/a.css", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	server.ServeHTTP(httptest.NewRecorder(), req)
+	if server.CompressionStats().Count != 6 {
+		t.Error("Expected a cache hit not to count as a compression")
+	}
+
+	req = httptest.NewRequest("GET", "/debug/compression", nil)
+	req.RemoteAddr = "127.0.0.1:1234"
+	w := httptest.NewRecorder()
+	server.ServeHTTP(w, req)
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"byEncoding"`) {
+		t.Errorf("Expected the stats endpoint to report JSON, got %d", w.Code)
+	}
+}
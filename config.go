@@ -1,9 +1,15 @@
 package gostc
 
 import (
+	"context"
+	"crypto/tls"
 	"fmt"
+	"html/template"
+	"net/http"
 	"os"
+	"path"
 	"path/filepath"
+	"slices"
 	"strings"
 	"time"
 )
@@ -16,6 +22,16 @@ const (
 	Brotli
 )
 
+// compressionTypes lists every CompressionType, identity first. Cache keys
+// carry one of these, so code touching every cached variant of a path
+// iterates this list and a new encoding only has to be added here.
+var compressionTypes = []CompressionType{NoCompression, Gzip, Brotli}
+
+// allCompressionTypes returns every CompressionType, identity first
+func allCompressionTypes() []CompressionType {
+	return compressionTypes
+}
+
 type CacheStrategy int
 
 const (
@@ -24,7 +40,35 @@ const (
 	ARC
 )
 
+// HashAlgorithm selects the content hash used for asset versions
+type HashAlgorithm int
+
+const (
+	HashSHA256 HashAlgorithm = iota
+	HashMD5
+	HashXXH64
+)
+
+// ETagAlgorithm selects how file ETags are derived
+type ETagAlgorithm int
+
+const (
+	ETagContent ETagAlgorithm = iota // hash of the uncompressed body
+	ETagModTime                      // modification time and size; no hashing
+)
+
+// VersioningMode selects how asset versions appear in URLs
+type VersioningMode int
+
+const (
+	VersionFilename VersioningMode = iota // /static/app.<hash>.js
+	VersionQuery                          // /static/app.js?v=<hash>
+)
+
 const (
+	DefaultAddr             = ":8080"
+	DefaultServerHeader     = "7424"
+	DefaultMetricsNamespace = "gostc"
 	DefaultReadTimeout      = 15 * time.Second
 	DefaultWriteTimeout     = 15 * time.Second
 	DefaultIdleTimeout      = 60 * time.Second
@@ -35,8 +79,12 @@ const (
 	DefaultMaxFileSize      = 100 << 20 // 100MB
 	DefaultCacheSize        = 100 << 20 // 100MB
 	DefaultCacheTTL         = 5 * time.Minute
+	DefaultCacheDecay       = 10 * time.Minute
 	DefaultMinCompressSize  = 1024 // 1KB
 	DefaultCompressionLevel = 6
+	DefaultCompressionWait  = 100 * time.Millisecond
+	DefaultWatcherDebounce  = 100 * time.Millisecond
+	DefaultMinSavings       = 10 // percent
 	DefaultMaxConnections   = 1000
 	DefaultRateLimitPerIP   = 100 // requests per second
 )
@@ -46,15 +94,119 @@ type Config struct {
 	IndexFile     string
 	AllowBrowsing bool
 
+	// IndexFiles are tried in order when a directory is requested; the
+	// first that exists is served. IndexFile is tried first if not listed.
+	IndexFiles []string
+
+	// DefaultFiles are served from memory for their URL paths (e.g.
+	// "/robots.txt") ahead of any lookup on disk
+	DefaultFiles map[string]DefaultFile `json:"-"`
+
+	// Mounts serve other directories under URL prefixes; the longest
+	// matching prefix wins and everything else is served from Root
+	Mounts []Mount
+
+	// CanonicalRedirects 301-redirects directories requested without a
+	// trailing slash to the slash form, and index files to their directory
+	CanonicalRedirects bool
+
+	// CaseInsensitivePaths redirects requests that only miss because of
+	// letter case to the uniquely matching file under Root
+	CaseInsensitivePaths bool
+
+	// DirectoryTemplate renders directory listings when AllowBrowsing is set
+	// (nil = built-in table layout). It receives a *DirectoryListing.
+	DirectoryTemplate *template.Template `json:"-"`
+
+	// CacheDirectoryListings caches rendered (and compressed) listings until
+	// the directory's modification time changes or the watcher sees a change
+	CacheDirectoryListings bool
+
 	Compression       CompressionType
 	CompressionLevel  int
 	MinSizeToCompress int64
 	CompressTypes     []string
 
+	// CompressExtensions and NoCompressExtensions force the compression
+	// decision for file extensions (".csv"), overriding CompressTypes.
+	// NoCompressExtensions wins when an extension is in both.
+	CompressExtensions   []string
+	NoCompressExtensions []string
+
+	// CompressionLevels overrides CompressionLevel per media type
+	// (e.g. "application/json"); unlisted types use CompressionLevel
+	CompressionLevels map[string]int
+
+	// MinCompressSizes overrides MinSizeToCompress per media type
+	MinCompressSizes map[string]int64
+
+	// BrotliLGWin is the base 2 log of brotli's window size, 10-24
+	// (0 = library default). GzipStrategy trades gzip ratio for speed.
+	BrotliLGWin  int
+	GzipStrategy GzipStrategy
+
+	// MimeTypes maps file extensions (".wasm") to the Content-Type served
+	// for them, ahead of the built-in defaults and the OS mime database
+	MimeTypes map[string]string
+
+	// DotfilePolicy decides whether paths with a segment starting with "."
+	// are served (default: DenyDotfiles)
+	DotfilePolicy DotfilePolicy
+
+	// DownloadPrefixes are normalized URL prefixes ("/downloads") whose files
+	// are served with Content-Disposition: attachment
+	DownloadPrefixes []string
+
+	// EagerCompression compresses a compressible file for every enabled
+	// encoding on its first miss and caches all variants
+	EagerCompression bool
+
+	// WarmPaths are URL paths loaded into the cache, in every enabled
+	// encoding, when the server is created and after each Reload
+	WarmPaths []string
+
+	// WarmOnStart has Start and Serve warm every versionable asset, as
+	// WarmDirectory does, before accepting connections
+	WarmOnStart bool
+
+	// MinCompressionSavings is how much smaller, in percent, a compressed body
+	// must be than the original to be served; otherwise the original is sent
+	// and that decision is cached
+	MinCompressionSavings int
+
+	// MaxConcurrentCompressions caps compressions running at once (0 = unlimited).
+	// Requests wait up to CompressionWait for a slot, then are served uncompressed.
+	MaxConcurrentCompressions int
+	CompressionWait           time.Duration
+
 	CacheSize     int64
 	CacheTTL      time.Duration
 	CacheStrategy CacheStrategy
 
+	// CacheDecayInterval halves LFU access counts this often, so entries
+	// that were hot long ago become evictable (0 = never)
+	CacheDecayInterval time.Duration
+
+	// CacheBackend replaces the built-in LRU/LFU cache, e.g. with a cache
+	// shared by several servers. CacheSize and CacheStrategy then don't apply.
+	CacheBackend Cache `json:"-"`
+
+	// ETagAlgorithm derives ETags from file content (default) or from
+	// modification time and size
+	ETagAlgorithm ETagAlgorithm
+
+	// NegativeCacheTTL caches 404s for missing paths for this long (0 = disabled)
+	NegativeCacheTTL time.Duration
+
+	// StatCacheTTL remembers file metadata for this long so hot files that
+	// aren't cached (too large, say) skip os.Stat; watcher events evict
+	// entries early (0 = disabled)
+	StatCacheTTL time.Duration
+
+	// StaleWhileRevalidate keeps dynamic assets (HTML, JSON, ...) servable for
+	// this long past CacheTTL while a background refresh runs (0 = disabled)
+	StaleWhileRevalidate time.Duration
+
 	ReadTimeout       time.Duration
 	ReadHeaderTimeout time.Duration
 	WriteTimeout      time.Duration
@@ -64,41 +216,200 @@ type Config struct {
 	MaxBodySize       int64
 	MaxFileSize       int64 // Maximum file size to serve
 
-	MaxConnections     int
+	// ShutdownHooks run in order when Stop has drained the server, with the
+	// shutdown context
+	ShutdownHooks []func(ctx context.Context) error `json:"-"`
+
+	// DecompressRequests decodes gzip, deflate and br request bodies before
+	// they reach handlers, capping the decoded size at MaxBodySize
+	DecompressRequests bool
+
+	MaxConnections     int // Open connections past this are closed on accept (0 = unlimited)
 	MaxRequestsPerConn int
 	RateLimitPerIP     int
+	RateLimitBurst     int // Requests an idle client may send at once (0 = 10x RateLimitPerIP)
+
+	// MaxConcurrency caps requests handled at once (0 = unlimited). Excess
+	// requests get 503 with Retry-After, or wait for a slot until their
+	// context ends when QueueRequests is set.
+	MaxConcurrency int
+	QueueRequests  bool
 
 	AllowedOrigins []string
+	// AllowedMethods are the methods file routes accept, out of GET, HEAD
+	// and OPTIONS, and are advertised to CORS clients. OPTIONS is always
+	// accepted so preflight requests keep working.
 	AllowedMethods []string
 	CSPHeader      string
-	EnableHTTPS    bool
-	TLSCert        string
-	TLSKey         string
-	HTTP2          bool
 
-	EnableMetrics   bool
-	MetricsEndpoint string
-	EnablePprof     bool
-	Debug           bool // Enable debug mode with detailed errors
+	// CORS settings beyond AllowedOrigins and AllowedMethods; see WithCORS.
+	// With CORSAllowCredentials, AllowedOrigins must list explicit origins.
+	CORSAllowedHeaders   []string      // Access-Control-Allow-Headers (nil = Content-Type, Authorization)
+	CORSExposedHeaders   []string      // Access-Control-Expose-Headers
+	CORSAllowCredentials bool          // Access-Control-Allow-Credentials: true
+	CORSMaxAge           time.Duration // Access-Control-Max-Age (0 = one hour)
+
+	// ServerHeader is sent as the Server response header ("" = omitted)
+	ServerHeader string
+
+	// ResponseHeaders are set on every response after the security headers,
+	// so they can override them; an empty value removes the header
+	ResponseHeaders map[string]string
+
+	// BasicAuthCredentials maps usernames to the hex SHA-256 of their
+	// password; when non-empty every endpoint except /health requires HTTP
+	// Basic auth in BasicAuthRealm
+	BasicAuthRealm       string
+	BasicAuthCredentials map[string]string
+
+	Addr string // Address Start listens on (default ":8080"; ":0" picks a free port)
+
+	EnableHTTPS bool
+	TLSCert     string
+	TLSKey      string
+	HTTP2       bool
+
+	// TLSConfig is the base for the HTTPS listener's TLS settings (minimum
+	// version, cipher suites, ...). NextProtos is filled from HTTP2 unless
+	// it is already set.
+	TLSConfig *tls.Config `json:"-"`
+
+	// AutoTLSDomains, when set, enables HTTPS with certificates obtained
+	// from Let's Encrypt over ACME and stored in AutoTLSCacheDir, in place
+	// of TLSCert and TLSKey
+	AutoTLSDomains  []string
+	AutoTLSCacheDir string
+
+	// HTTPSRedirectAddr, when set with TLS, is a plain HTTP address (":80")
+	// Start also listens on to redirect every request to HTTPS
+	HTTPSRedirectAddr string
+
+	EnableMetrics    bool
+	MetricsEndpoint  string
+	MetricsNamespace string // Prefix of metric names, as in "<ns>_requests_total" (default "gostc")
+	EnablePprof      bool   // Mount net/http/pprof at /debug/pprof/ for loopback clients
+	Debug            bool   // Enable debug mode with detailed errors
+
+	// RequestObserver runs as each file request starts; a non-nil context it
+	// returns, e.g. one carrying a tracing span, replaces the request's.
+	// ResponseObserver runs once the response is written, with that request.
+	RequestObserver  func(r *http.Request) context.Context                                  `json:"-"`
+	ResponseObserver func(r *http.Request, status int, bytes int64, duration time.Duration) `json:"-"`
+
+	// HealthEndpoint reports status, cache size and uptime as JSON, and 503
+	// once Stop has been called (empty = disabled)
+	HealthEndpoint string
+
+	// LivenessEndpoint always answers 200 while the process is serving;
+	// ReadinessEndpoint answers 503 until Start has finished, during Reload
+	// and after Stop (empty = disabled)
+	LivenessEndpoint  string
+	ReadinessEndpoint string
+
+	// ConfigEndpoint serves the effective configuration as JSON with secrets
+	// redacted, to loopback clients only (empty = disabled)
+	ConfigEndpoint string
+
+	// CacheDebugEndpoint lists cached entries as JSON to loopback clients
+	// only (empty = disabled)
+	CacheDebugEndpoint string
+
+	// ErrorsEndpoint lists recently handled errors as JSON to loopback
+	// clients only (empty = disabled)
+	ErrorsEndpoint string
+
+	// ImportMapEndpoint serves an import map of the versioned JavaScript
+	// modules (empty = disabled)
+	ImportMapEndpoint string
+
+	// CompressionStatsEndpoint reports CompressionStats as JSON to loopback
+	// clients only (empty = disabled)
+	CompressionStatsEndpoint string
+
+	// ErrorLogCapacity is how many recent errors are kept in memory for
+	// RecentErrors; older ones are overwritten (0 = DefaultErrorLogCapacity)
+	ErrorLogCapacity int
+
+	// VerifyCompression decompresses every freshly compressed response and
+	// compares it with the source before sending. Debug aid, keep off in production.
+	VerifyCompression bool
 
 	EnableWatcher bool
 
+	// WatcherDebounce coalesces file events for the same path arriving
+	// within this window into one invalidation (0 = no debouncing)
+	WatcherDebounce time.Duration
+
+	// WatcherIgnore lists filepath.Match globs for directories the watcher
+	// doesn't descend into. A pattern without a "/" matches a directory's
+	// name at any depth; one with a "/" matches its path relative to Root
+	// or the mount root ("build/cache"). Defaults to .git and node_modules.
+	WatcherIgnore []string
+
 	// Cache control settings per file type
 	StaticAssetMaxAge  int // Max age for static assets (images, fonts) in seconds
 	DynamicAssetMaxAge int // Max age for dynamic assets (HTML, JSON) in seconds
 
+	// CacheRules set Cache-Control for URL paths under a prefix, the longest
+	// matching prefix winning over the per-type max ages above
+	CacheRules []CacheRule
+
+	// CacheControlFunc overrides the Cache-Control header per request; an
+	// empty result falls back to the rules above
+	CacheControlFunc func(r *http.Request, path string, isVersioned bool) string `json:"-"`
+
 	// Asset versioning settings
 	EnableVersioning  bool
 	VersioningPattern string   // Pattern for versioned files (empty = default: base.hash.ext)
 	VersionHashLength int      // Length of version hash (default: 16)
 	StaticPrefixes    []string // Prefixes that should be versioned
 	URLPrefix         string   // URL prefix for serving (e.g., "/static")
+
+	// VersioningExclude lists path.Match globs ("/static/vendor/*.js") for
+	// URL paths that keep their original name. A pattern ending in "/"
+	// excludes everything below that directory.
+	VersioningExclude []string
+
+	// VersionableExtensions replaces the built-in set of extensions that
+	// are versioned under StaticPrefixes (nil = built-in set)
+	VersionableExtensions []string
+
+	// HashAlgorithm computes version hashes (default: HashSHA256)
+	HashAlgorithm HashAlgorithm
+
+	// VersionCacheFile persists version hashes across restarts so unchanged
+	// files are not re-hashed at startup (empty = disabled)
+	VersionCacheFile string
+
+	// PreloadHeaders adds Link rel=preload headers to HTML responses for the
+	// stylesheets and scripts rewritten to versioned URLs
+	PreloadHeaders bool
+
+	// VersioningMode puts the hash in the filename (default) or in a ?v=
+	// query parameter. Query mode ignores VersioningPattern and
+	// VersionedPathFunc.
+	VersioningMode VersioningMode
+
+	// VersionedPathFunc builds the versioned URL for an asset and overrides
+	// VersioningPattern. VersionedPathReverse maps such a URL back to the
+	// original path and hash.
+	VersionedPathFunc    func(original, hash, ext string) string                 `json:"-"`
+	VersionedPathReverse func(versioned string) (original, hash string, ok bool) `json:"-"`
+
+	// ContentNegotiation serves name.<lang>.html in place of name.html for
+	// the client's preferred Accept-Language, when such a file exists
+	ContentNegotiation bool
+
+	// ClientHintWidths lists widths of pre-rendered image variants
+	// (name-<width>.ext) selectable via Width/DPR client hints (empty = disabled)
+	ClientHintWidths []int
 }
 
 func DefaultConfig() *Config {
 	return &Config{
 		Root:          "./static",
 		IndexFile:     "index.html",
+		IndexFiles:    []string{"index.html"},
 		AllowBrowsing: false,
 
 		Compression:       Gzip | Brotli,
@@ -115,11 +426,17 @@ func DefaultConfig() *Config {
 			"text/plain",
 			"image/svg+xml",
 		},
+		CompressionWait:       DefaultCompressionWait,
+		MinCompressionSavings: DefaultMinSavings,
 
 		CacheSize:     DefaultCacheSize,
 		CacheTTL:      DefaultCacheTTL,
 		CacheStrategy: LRU,
 
+		CacheDecayInterval: DefaultCacheDecay,
+
+		Addr: DefaultAddr,
+
 		ReadTimeout:       DefaultReadTimeout,
 		ReadHeaderTimeout: DefaultHeaderTimeout,
 		WriteTimeout:      DefaultWriteTimeout,
@@ -134,13 +451,23 @@ func DefaultConfig() *Config {
 
 		AllowedOrigins: []string{"*"},
 		AllowedMethods: []string{"GET", "HEAD", "OPTIONS"},
+		ServerHeader:   DefaultServerHeader,
 		HTTP2:          true,
 
-		EnableMetrics:   false,
-		MetricsEndpoint: "/metrics",
-		EnablePprof:     false,
-		Debug:           false,
-		EnableWatcher:   true,
+		EnableMetrics:    false,
+		MetricsEndpoint:  "/metrics",
+		MetricsNamespace: DefaultMetricsNamespace,
+		EnablePprof:      false,
+		Debug:            false,
+		EnableWatcher:    true,
+		WatcherDebounce:  DefaultWatcherDebounce,
+		WatcherIgnore:    []string{".git", "node_modules"},
+
+		ErrorLogCapacity: DefaultErrorLogCapacity,
+		HealthEndpoint:   "/health",
+
+		LivenessEndpoint:  "/livez",
+		ReadinessEndpoint: "/readyz",
 
 		StaticAssetMaxAge:  86400, // 24 hours for static assets
 		DynamicAssetMaxAge: 3600,  // 1 hour for dynamic content
@@ -154,12 +481,190 @@ func DefaultConfig() *Config {
 
 type Option func(*Config)
 
+// redactedValue replaces secrets in Redacted configs
+const redactedValue = "[REDACTED]"
+
+// Clone returns a copy of c whose slices can be modified independently
+func (c *Config) Clone() *Config {
+	clone := *c
+	clone.CompressTypes = append([]string(nil), c.CompressTypes...)
+	clone.CompressExtensions = append([]string(nil), c.CompressExtensions...)
+	clone.NoCompressExtensions = append([]string(nil), c.NoCompressExtensions...)
+	clone.AllowedOrigins = append([]string(nil), c.AllowedOrigins...)
+	clone.CORSAllowedHeaders = append([]string(nil), c.CORSAllowedHeaders...)
+	clone.CORSExposedHeaders = append([]string(nil), c.CORSExposedHeaders...)
+	clone.AllowedMethods = append([]string(nil), c.AllowedMethods...)
+	clone.StaticPrefixes = append([]string(nil), c.StaticPrefixes...)
+	clone.VersioningExclude = append([]string(nil), c.VersioningExclude...)
+	clone.WatcherIgnore = append([]string(nil), c.WatcherIgnore...)
+	if c.VersionableExtensions != nil {
+		clone.VersionableExtensions = append([]string{}, c.VersionableExtensions...)
+	}
+	clone.ClientHintWidths = append([]int(nil), c.ClientHintWidths...)
+	clone.Mounts = append([]Mount(nil), c.Mounts...)
+	clone.IndexFiles = append([]string(nil), c.IndexFiles...)
+	clone.ShutdownHooks = append([]func(context.Context) error(nil), c.ShutdownHooks...)
+	clone.DownloadPrefixes = append([]string(nil), c.DownloadPrefixes...)
+	clone.CacheRules = append([]CacheRule(nil), c.CacheRules...)
+	clone.WarmPaths = append([]string(nil), c.WarmPaths...)
+	clone.AutoTLSDomains = append([]string(nil), c.AutoTLSDomains...)
+	if c.TLSConfig != nil {
+		clone.TLSConfig = c.TLSConfig.Clone()
+	}
+	if c.CompressionLevels != nil {
+		clone.CompressionLevels = make(map[string]int, len(c.CompressionLevels))
+		for contentType, level := range c.CompressionLevels {
+			clone.CompressionLevels[contentType] = level
+		}
+	}
+	if c.MinCompressSizes != nil {
+		clone.MinCompressSizes = make(map[string]int64, len(c.MinCompressSizes))
+		for contentType, size := range c.MinCompressSizes {
+			clone.MinCompressSizes[contentType] = size
+		}
+	}
+	if c.ResponseHeaders != nil {
+		clone.ResponseHeaders = make(map[string]string, len(c.ResponseHeaders))
+		for name, value := range c.ResponseHeaders {
+			clone.ResponseHeaders[name] = value
+		}
+	}
+	if c.DefaultFiles != nil {
+		clone.DefaultFiles = make(map[string]DefaultFile, len(c.DefaultFiles))
+		for urlPath, file := range c.DefaultFiles {
+			clone.DefaultFiles[urlPath] = file
+		}
+	}
+	if c.MimeTypes != nil {
+		clone.MimeTypes = make(map[string]string, len(c.MimeTypes))
+		for ext, contentType := range c.MimeTypes {
+			clone.MimeTypes[ext] = contentType
+		}
+	}
+	if c.BasicAuthCredentials != nil {
+		clone.BasicAuthCredentials = make(map[string]string, len(c.BasicAuthCredentials))
+		for user, hash := range c.BasicAuthCredentials {
+			clone.BasicAuthCredentials[user] = hash
+		}
+	}
+	return &clone
+}
+
+// Redacted returns a copy of c with secrets such as TLS key paths blanked,
+// suitable for logging or exposing on an admin endpoint
+func (c *Config) Redacted() *Config {
+	redacted := c.Clone()
+	if redacted.TLSKey != "" {
+		redacted.TLSKey = redactedValue
+	}
+	for user := range redacted.BasicAuthCredentials {
+		redacted.BasicAuthCredentials[user] = redactedValue
+	}
+	return redacted
+}
+
 func WithRoot(root string) Option {
 	return func(c *Config) {
 		c.Root = root
 	}
 }
 
+// WithIndexFiles sets the file names served for a directory, in order of
+// preference, e.g. WithIndexFiles("index.html", "index.htm", "default.html")
+func WithIndexFiles(names ...string) Option {
+	return func(c *Config) {
+		if len(names) == 0 {
+			return
+		}
+		c.IndexFile = names[0]
+		c.IndexFiles = append([]string(nil), names...)
+	}
+}
+
+// WithDefaultFile serves content for urlPath from memory instead of disk,
+// e.g. a fallback /favicon.ico or /robots.txt. An empty contentType is
+// inferred from the extension or the content.
+func WithDefaultFile(urlPath string, content []byte, contentType string) Option {
+	return func(c *Config) {
+		if c.DefaultFiles == nil {
+			c.DefaultFiles = make(map[string]DefaultFile)
+		}
+		c.DefaultFiles[normalizeDefaultFilePath(urlPath)] = DefaultFile{Content: content, ContentType: contentType}
+	}
+}
+
+// indexFiles returns the index file names to try, in order
+func (c *Config) indexFiles() []string {
+	if c.IndexFile == "" {
+		return c.IndexFiles
+	}
+	for _, name := range c.IndexFiles {
+		if name == c.IndexFile {
+			return c.IndexFiles
+		}
+	}
+	return append([]string{c.IndexFile}, c.IndexFiles...)
+}
+
+// WithMount serves root at URL paths under urlPrefix. It may be repeated;
+// mounting the same prefix again replaces the earlier root.
+func WithMount(urlPrefix, root string) Option {
+	return func(c *Config) {
+		m := Mount{Prefix: normalizeMountPrefix(urlPrefix), Root: root}
+		for i := range c.Mounts {
+			if c.Mounts[i].Prefix == m.Prefix {
+				c.Mounts[i] = m
+				return
+			}
+		}
+		c.Mounts = append(c.Mounts, m)
+	}
+}
+
+// WithDirectoryTemplate sets a custom template for directory listings
+func WithDirectoryTemplate(tmpl *template.Template) Option {
+	return func(c *Config) {
+		c.DirectoryTemplate = tmpl
+	}
+}
+
+// WithBasicAuth requires HTTP Basic auth for every endpoint except /health.
+// creds maps usernames to plaintext passwords; only their SHA-256 hashes are
+// kept in the configuration.
+func WithBasicAuth(realm string, creds map[string]string) Option {
+	return func(c *Config) {
+		c.BasicAuthRealm = realm
+		c.BasicAuthCredentials = make(map[string]string, len(creds))
+		for user, password := range creds {
+			c.BasicAuthCredentials[user] = HashPassword(password)
+		}
+	}
+}
+
+// WithCanonicalRedirects redirects /docs to /docs/ and /docs/index.html to
+// /docs/ so every page has one URL. Query strings are preserved.
+func WithCanonicalRedirects(enable bool) Option {
+	return func(c *Config) {
+		c.CanonicalRedirects = enable
+	}
+}
+
+// WithCaseInsensitivePaths redirects mis-cased requests such as /Static/App.JS
+// to the file that exists on disk
+func WithCaseInsensitivePaths(enable bool) Option {
+	return func(c *Config) {
+		c.CaseInsensitivePaths = enable
+	}
+}
+
+// WithDirectoryListingCache caches generated directory listings, compressed
+// like regular files, instead of rendering them on every request
+func WithDirectoryListingCache(enable bool) Option {
+	return func(c *Config) {
+		c.CacheDirectoryListings = enable
+	}
+}
+
 func WithCompression(types CompressionType) Option {
 	return func(c *Config) {
 		c.Compression = types
@@ -172,6 +677,175 @@ func WithCompressionLevel(level int) Option {
 	}
 }
 
+// WithCompressTypes replaces the media types eligible for compression.
+// A type matches any Content-Type containing it, e.g. "text/" covers all
+// text types.
+func WithCompressTypes(types ...string) Option {
+	return func(c *Config) {
+		c.CompressTypes = normalizeCompressTypes(types)
+	}
+}
+
+// WithAdditionalCompressTypes adds media types such as "application/wasm"
+// to those already eligible for compression
+func WithAdditionalCompressTypes(types ...string) Option {
+	return func(c *Config) {
+		c.CompressTypes = append(c.CompressTypes, normalizeCompressTypes(types)...)
+	}
+}
+
+// normalizeCompressTypes lower-cases and trims types into a new slice
+func normalizeCompressTypes(types []string) []string {
+	normalized := make([]string, len(types))
+	for i, t := range types {
+		normalized[i] = strings.ToLower(strings.TrimSpace(t))
+	}
+	return normalized
+}
+
+// WithCompressExtensions always compresses files with these extensions,
+// e.g. ".geojson" or ".csv", whatever their content type
+func WithCompressExtensions(exts ...string) Option {
+	return func(c *Config) {
+		c.CompressExtensions = append(c.CompressExtensions, normalizeExtensions(exts)...)
+	}
+}
+
+// WithNoCompressExtensions never compresses files with these extensions
+func WithNoCompressExtensions(exts ...string) Option {
+	return func(c *Config) {
+		c.NoCompressExtensions = append(c.NoCompressExtensions, normalizeExtensions(exts)...)
+	}
+}
+
+// normalizeExtensions lowercases exts and adds a missing leading dot
+func normalizeExtensions(exts []string) []string {
+	normalized := make([]string, 0, len(exts))
+	for _, ext := range exts {
+		ext = strings.ToLower(strings.TrimSpace(ext))
+		if ext == "" {
+			continue
+		}
+		if !strings.HasPrefix(ext, ".") {
+			ext = "." + ext
+		}
+		normalized = append(normalized, ext)
+	}
+	return normalized
+}
+
+// WithCompressionLevelFor sets the compression level for one media type,
+// overriding the global level. Parameters such as charset are ignored.
+func WithCompressionLevelFor(contentType string, level int) Option {
+	return func(c *Config) {
+		if c.CompressionLevels == nil {
+			c.CompressionLevels = make(map[string]int)
+		}
+		c.CompressionLevels[strings.ToLower(contentType)] = level
+	}
+}
+
+// WithMinCompressSize sets the smallest response size, in bytes, that is
+// compressed
+func WithMinCompressSize(n int64) Option {
+	return func(c *Config) {
+		c.MinSizeToCompress = n
+	}
+}
+
+// WithMinCompressSizeFor sets the minimum compressible size for one media
+// type, overriding the global minimum. Parameters such as charset are ignored.
+func WithMinCompressSizeFor(contentType string, n int64) Option {
+	return func(c *Config) {
+		if c.MinCompressSizes == nil {
+			c.MinCompressSizes = make(map[string]int64)
+		}
+		c.MinCompressSizes[strings.ToLower(contentType)] = n
+	}
+}
+
+// WithMimeType serves files with extension ext as contentType, overriding
+// the built-in defaults and the OS mime database. It may be repeated.
+func WithMimeType(ext, contentType string) Option {
+	return func(c *Config) {
+		exts := normalizeExtensions([]string{ext})
+		if len(exts) == 0 {
+			return
+		}
+		if c.MimeTypes == nil {
+			c.MimeTypes = make(map[string]string)
+		}
+		c.MimeTypes[exts[0]] = contentType
+	}
+}
+
+// WithBrotliLGWin sets brotli's window to 2^bits bytes (10-24). Larger
+// windows compress very large text assets better at some memory cost.
+func WithBrotliLGWin(bits int) Option {
+	return func(c *Config) {
+		c.BrotliLGWin = bits
+	}
+}
+
+// WithGzipStrategy selects the gzip strategy, e.g. GzipHuffmanOnly for
+// speed over ratio
+func WithGzipStrategy(strategy GzipStrategy) Option {
+	return func(c *Config) {
+		c.GzipStrategy = strategy
+	}
+}
+
+// WithWarmPaths loads these URL paths into the cache in every enabled
+// encoding when the server is created and after each Reload
+func WithWarmPaths(paths ...string) Option {
+	return func(c *Config) {
+		c.WarmPaths = append(c.WarmPaths, paths...)
+	}
+}
+
+// WithWarmOnStart warms every versionable asset under Root and the mounts,
+// up to CacheSize, when the server starts
+func WithWarmOnStart(enable bool) Option {
+	return func(c *Config) {
+		c.WarmOnStart = enable
+	}
+}
+
+// WithEagerCompression makes the first request for a compressible file
+// cache it in every enabled encoding (and identity), instead of compressing
+// once per encoding as clients with different Accept-Encoding arrive
+func WithEagerCompression(enable bool) Option {
+	return func(c *Config) {
+		c.EagerCompression = enable
+	}
+}
+
+// WithCompressionWorkers runs at most n gzip/brotli compressions at once.
+// Other requests wait up to CompressionWait for a worker, then are served
+// uncompressed. It is WithMaxConcurrentCompressions keeping the current wait.
+func WithCompressionWorkers(n int) Option {
+	return func(c *Config) {
+		c.MaxConcurrentCompressions = n
+	}
+}
+
+// WithMaxConcurrentCompressions limits how many responses are compressed at
+// once. A request waits up to wait for a slot before being served uncompressed.
+func WithMaxConcurrentCompressions(n int, wait time.Duration) Option {
+	return func(c *Config) {
+		c.MaxConcurrentCompressions = n
+		c.CompressionWait = wait
+	}
+}
+
+// WithMinCompressionSavings sets the percentage by which compression must
+// shrink a body for the compressed form to be served
+func WithMinCompressionSavings(percent int) Option {
+	return func(c *Config) {
+		c.MinCompressionSavings = percent
+	}
+}
+
 func WithCache(size int64) Option {
 	return func(c *Config) {
 		c.CacheSize = size
@@ -184,12 +858,142 @@ func WithCacheTTL(ttl time.Duration) Option {
 	}
 }
 
+// WithStaleWhileRevalidate serves dynamic assets up to window past CacheTTL
+// from cache, refreshing them in the background instead of blocking on disk
+func WithStaleWhileRevalidate(window time.Duration) Option {
+	return func(c *Config) {
+		c.StaleWhileRevalidate = window
+	}
+}
+
+// CORSConfig configures cross-origin requests for WithCORS
+type CORSConfig struct {
+	AllowedOrigins   []string      // Origins allowed, or "*" for any (without credentials)
+	AllowedMethods   []string      // Methods advertised and accepted, out of GET, HEAD and OPTIONS
+	AllowedHeaders   []string      // Request headers a preflight may ask for
+	AllowCredentials bool          // Allow cookies and Authorization on cross-origin requests
+	MaxAge           time.Duration // How long preflight results may be cached
+	ExposedHeaders   []string      // Response headers scripts may read
+}
+
+// WithCORS configures cross-origin access. Empty fields keep their current
+// settings. With AllowCredentials the request's Origin is echoed back, never
+// "*", so AllowedOrigins must list the origins explicitly.
+func WithCORS(cors CORSConfig) Option {
+	return func(c *Config) {
+		if len(cors.AllowedOrigins) > 0 {
+			c.AllowedOrigins = append([]string(nil), cors.AllowedOrigins...)
+		}
+		if len(cors.AllowedMethods) > 0 {
+			WithMethods(cors.AllowedMethods...)(c)
+		}
+		if cors.AllowedHeaders != nil {
+			c.CORSAllowedHeaders = append([]string(nil), cors.AllowedHeaders...)
+		}
+		if cors.ExposedHeaders != nil {
+			c.CORSExposedHeaders = append([]string(nil), cors.ExposedHeaders...)
+		}
+		if cors.MaxAge > 0 {
+			c.CORSMaxAge = cors.MaxAge
+		}
+		c.CORSAllowCredentials = cors.AllowCredentials
+	}
+}
+
+// WithServerHeader sets the Server response header; "" leaves it out
+func WithServerHeader(value string) Option {
+	return func(c *Config) {
+		c.ServerHeader = value
+	}
+}
+
+// WithResponseHeaders adds headers to every response, e.g.
+// Cross-Origin-Opener-Policy. They override the default security headers
+// ("" removes one), but headers set per response such as Content-Type and
+// Content-Encoding take precedence.
+func WithResponseHeaders(headers map[string]string) Option {
+	return func(c *Config) {
+		if c.ResponseHeaders == nil {
+			c.ResponseHeaders = make(map[string]string, len(headers))
+		}
+		for name, value := range headers {
+			c.ResponseHeaders[http.CanonicalHeaderKey(name)] = value
+		}
+	}
+}
+
+// WithCacheControlFunc lets fn choose the Cache-Control header for each
+// response, e.g. "no-store" under /private/. Returning "" keeps the default
+// for the file type.
+func WithCacheControlFunc(fn func(r *http.Request, path string, isVersioned bool) string) Option {
+	return func(c *Config) {
+		c.CacheControlFunc = fn
+	}
+}
+
+// WithCacheRule sends cacheControl for URL paths under prefix, e.g.
+// WithCacheRule("/api/", "no-store"). It may be repeated; the longest
+// matching prefix wins and CacheControlFunc still takes precedence.
+func WithCacheRule(prefix, cacheControl string) Option {
+	return func(c *Config) {
+		c.CacheRules = append(c.CacheRules, CacheRule{
+			Prefix:       normalizeMountPrefix(prefix),
+			CacheControl: cacheControl,
+		})
+	}
+}
+
+// WithNegativeCache remembers missing paths for ttl so repeated 404s skip
+// the filesystem. The file watcher clears entries when the file appears.
+// Up to 1024 paths are kept, apart from the file cache, so probes for
+// missing paths never evict cached files.
+func WithNegativeCache(ttl time.Duration) Option {
+	return func(c *Config) {
+		c.NegativeCacheTTL = ttl
+	}
+}
+
+// WithStatCache caches os.Stat results for ttl, evicting entries when the
+// watcher (or InvalidatePath) reports a change
+func WithStatCache(ttl time.Duration) Option {
+	return func(c *Config) {
+		c.StatCacheTTL = ttl
+	}
+}
+
 func WithCacheStrategy(strategy CacheStrategy) Option {
 	return func(c *Config) {
 		c.CacheStrategy = strategy
 	}
 }
 
+// WithCacheDecay sets how often the LFU strategy halves access counts.
+// Shorter intervals favour recent popularity; 0 disables decay.
+func WithCacheDecay(interval time.Duration) Option {
+	return func(c *Config) {
+		c.CacheDecayInterval = interval
+	}
+}
+
+// WithCacheBackend stores entries in cache instead of the built-in
+// in-memory cache. The server never stops a backend it was given; its owner
+// does, after the server has stopped.
+func WithCacheBackend(cache Cache) Option {
+	return func(c *Config) {
+		c.CacheBackend = cache
+	}
+}
+
+// WithShutdownHook registers fn to run when Stop has drained the server,
+// e.g. to close clients or deregister from service discovery. Hooks run in
+// registration order with a context bounded by the shutdown timeout; their
+// errors are returned from Stop.
+func WithShutdownHook(fn func(ctx context.Context) error) Option {
+	return func(c *Config) {
+		c.ShutdownHooks = append(c.ShutdownHooks, fn)
+	}
+}
+
 type TimeoutConfig struct {
 	Read     time.Duration
 	Write    time.Duration
@@ -218,30 +1022,255 @@ func WithTimeouts(tc TimeoutConfig) Option {
 	}
 }
 
+// WithMaxConnections caps concurrently open client connections. Connections
+// accepted over the cap are closed immediately.
+func WithMaxConnections(n int) Option {
+	return func(c *Config) {
+		c.MaxConnections = n
+	}
+}
+
+// WithMaxFileSize sets the largest file, in bytes, that is read and served.
+// Larger files are refused rather than loaded into memory.
+func WithMaxFileSize(bytes int64) Option {
+	return func(c *Config) {
+		c.MaxFileSize = bytes
+	}
+}
+
+// WithRequestDecompression decodes request bodies sent with a gzip,
+// deflate or br Content-Encoding before handlers see them
+func WithRequestDecompression(enable bool) Option {
+	return func(c *Config) {
+		c.DecompressRequests = enable
+	}
+}
+
+// WithMaxConcurrency caps the number of requests handled at once, to
+// protect a slow disk. Requests over the cap are rejected with 503 unless
+// WithRequestQueueing is enabled.
+func WithMaxConcurrency(n int) Option {
+	return func(c *Config) {
+		c.MaxConcurrency = n
+	}
+}
+
+// WithRequestQueueing makes requests over MaxConcurrency wait for a slot
+// instead of being rejected. ReadTimeout bounds the wait.
+func WithRequestQueueing(enable bool) Option {
+	return func(c *Config) {
+		c.QueueRequests = enable
+	}
+}
+
 func WithRateLimit(limit int) Option {
 	return func(c *Config) {
 		c.RateLimitPerIP = limit
 	}
 }
 
+// WithRateLimitBurst lets a client send up to burst requests at once before
+// being held to the sustained WithRateLimit rate
+func WithRateLimitBurst(burst int) Option {
+	return func(c *Config) {
+		c.RateLimitBurst = burst
+	}
+}
+
+// rateLimitBurst returns the configured burst, defaulting to ten seconds'
+// worth of requests at the sustained rate
+func (c *Config) rateLimitBurst() int {
+	if c.RateLimitBurst > 0 {
+		return c.RateLimitBurst
+	}
+	return c.RateLimitPerIP * 10
+}
+
+// WithMethods sets the methods file routes accept, e.g. WithMethods("HEAD")
+// to answer only HEAD. Other methods get 405.
+func WithMethods(methods ...string) Option {
+	return func(c *Config) {
+		c.AllowedMethods = make([]string, 0, len(methods))
+		for _, m := range methods {
+			c.AllowedMethods = append(c.AllowedMethods, strings.ToUpper(strings.TrimSpace(m)))
+		}
+	}
+}
+
+// methodAllowed reports whether file routes accept method
+func (c *Config) methodAllowed(method string) bool {
+	if method == http.MethodOptions {
+		return true
+	}
+	for _, m := range c.AllowedMethods {
+		if m == method {
+			return true
+		}
+	}
+	return false
+}
+
+// allowHeader lists the accepted methods for the Allow header
+func (c *Config) allowHeader() string {
+	methods := make([]string, 0, len(c.AllowedMethods)+1)
+	for _, m := range c.AllowedMethods {
+		if m != http.MethodOptions {
+			methods = append(methods, m)
+		}
+	}
+	return strings.Join(append(methods, http.MethodOptions), ", ")
+}
+
 func WithHTTP2(enable bool) Option {
 	return func(c *Config) {
 		c.HTTP2 = enable
 	}
 }
 
+// WithHealthEndpoint moves the health check from /health to path; an
+// empty path disables it
+func WithHealthEndpoint(path string) Option {
+	return func(c *Config) {
+		c.HealthEndpoint = path
+	}
+}
+
+// WithProbeEndpoints sets the Kubernetes-style liveness and readiness probe
+// paths (default "/livez" and "/readyz"); an empty path disables that probe
+func WithProbeEndpoints(liveness, readiness string) Option {
+	return func(c *Config) {
+		c.LivenessEndpoint = liveness
+		c.ReadinessEndpoint = readiness
+	}
+}
+
+// WithMetricsNamespace sets the prefix of metric names, e.g. "cdn" for
+// cdn_requests_total, to tell instances apart or follow naming policy
+func WithMetricsNamespace(ns string) Option {
+	return func(c *Config) {
+		c.MetricsNamespace = ns
+	}
+}
+
+// WithRequestObserver calls fn at the start of every file request, e.g. to
+// start a tracing span; the context it returns is passed down the chain
+func WithRequestObserver(fn func(r *http.Request) context.Context) Option {
+	return func(c *Config) {
+		c.RequestObserver = fn
+	}
+}
+
+// WithResponseObserver calls fn after every file request with the status,
+// body bytes written and time taken, e.g. to end a tracing span
+func WithResponseObserver(fn func(r *http.Request, status int, bytes int64, duration time.Duration)) Option {
+	return func(c *Config) {
+		c.ResponseObserver = fn
+	}
+}
+
+// WithPprof mounts the net/http/pprof handlers at /debug/pprof/. Like the
+// cache debug endpoint they answer loopback clients only.
+func WithPprof(enable bool) Option {
+	return func(c *Config) {
+		c.EnablePprof = enable
+	}
+}
+
 func WithMetrics(enable bool) Option {
 	return func(c *Config) {
 		c.EnableMetrics = enable
 	}
 }
 
+// WithCompressionVerification enables round-trip checks of compressed output
+func WithCompressionVerification(enable bool) Option {
+	return func(c *Config) {
+		c.VerifyCompression = enable
+	}
+}
+
+// WithCacheDebugEndpoint lists cached keys with their sizes, ages and access
+// counts as JSON at path. Only requests from the loopback interface without
+// proxy headers are answered; everyone else gets a 404.
+func WithCacheDebugEndpoint(path string) Option {
+	return func(c *Config) {
+		c.CacheDebugEndpoint = path
+	}
+}
+
+// WithImportMapEndpoint serves ImportMap at path, e.g. "/importmap.json"
+func WithImportMapEndpoint(path string) Option {
+	return func(c *Config) {
+		c.ImportMapEndpoint = path
+	}
+}
+
+// WithCompressionStatsEndpoint reports compression totals, ratios and
+// per-encoding counts as JSON at path, to loopback clients only like the
+// cache debug endpoint
+func WithCompressionStatsEndpoint(path string) Option {
+	return func(c *Config) {
+		c.CompressionStatsEndpoint = path
+	}
+}
+
+// WithErrorLogCapacity sets how many recent errors are kept in memory
+// (default DefaultErrorLogCapacity)
+func WithErrorLogCapacity(n int) Option {
+	return func(c *Config) {
+		c.ErrorLogCapacity = n
+	}
+}
+
+// WithErrorsEndpoint lists the most recently handled errors as JSON at path,
+// e.g. "/debug/errors". Like the cache debug endpoint it only answers
+// loopback requests.
+func WithErrorsEndpoint(path string) Option {
+	return func(c *Config) {
+		c.ErrorsEndpoint = path
+	}
+}
+
+// WithConfigEndpoint serves the redacted effective configuration as JSON at
+// path to loopback clients
+func WithConfigEndpoint(path string) Option {
+	return func(c *Config) {
+		c.ConfigEndpoint = path
+	}
+}
+
 func WithWatcher(enable bool) Option {
 	return func(c *Config) {
 		c.EnableWatcher = enable
 	}
 }
 
+// WithWatcherDebounce sets how long the file watcher waits for more events
+// on a path before invalidating it, so one editor save is handled once
+func WithWatcherDebounce(d time.Duration) Option {
+	return func(c *Config) {
+		c.WatcherDebounce = d
+	}
+}
+
+// WithWatcherIgnore adds directories the file watcher skips, on top of the
+// default .git and node_modules, e.g. a build cache that churns constantly.
+// Files below an ignored directory are still served but never invalidated
+// by the watcher. See Config.WatcherIgnore for the pattern syntax.
+func WithWatcherIgnore(patterns ...string) Option {
+	return func(c *Config) {
+		c.WatcherIgnore = append(c.WatcherIgnore, patterns...)
+	}
+}
+
+// WithAddr sets the TCP address Start listens on, e.g. ":443" or
+// "127.0.0.1:8080"
+func WithAddr(addr string) Option {
+	return func(c *Config) {
+		c.Addr = addr
+	}
+}
+
 func WithTLS(certFile, keyFile string) Option {
 	return func(c *Config) {
 		c.EnableHTTPS = true
@@ -250,6 +1279,38 @@ func WithTLS(certFile, keyFile string) Option {
 	}
 }
 
+// WithHTTPSRedirect makes Start also listen on httpAddr (e.g. ":80") and
+// redirect every plain HTTP request to the same host and URI over HTTPS.
+// It requires WithTLS.
+func WithHTTPSRedirect(httpAddr string) Option {
+	return func(c *Config) {
+		c.HTTPSRedirectAddr = httpAddr
+	}
+}
+
+// WithAutoTLS enables HTTPS for domains with certificates issued over ACME
+// and cached in cacheDir, superseding WithTLS. The HTTP-01 challenge is
+// answered on the HTTPS redirect listener, which defaults to ":80".
+func WithAutoTLS(cacheDir string, domains ...string) Option {
+	return func(c *Config) {
+		c.EnableHTTPS = true
+		c.AutoTLSDomains = domains
+		c.AutoTLSCacheDir = cacheDir
+		if c.HTTPSRedirectAddr == "" {
+			c.HTTPSRedirectAddr = ":80"
+		}
+	}
+}
+
+// WithTLSConfig sets the TLS settings for HTTPS, e.g. to require TLS 1.3
+// or restrict cipher suites. Certificates still come from WithTLS unless
+// cfg provides them.
+func WithTLSConfig(cfg *tls.Config) Option {
+	return func(c *Config) {
+		c.TLSConfig = cfg
+	}
+}
+
 func WithVersioning(enable bool) Option {
 	return func(c *Config) {
 		c.EnableVersioning = enable
@@ -262,6 +1323,58 @@ func WithVersioningPattern(pattern string) Option {
 	}
 }
 
+// WithHashAlgorithm selects the hash behind asset versions: HashSHA256
+// (default), HashMD5 or the much faster HashXXH64. VersionHashLength still
+// truncates the hex output.
+func WithHashAlgorithm(algorithm HashAlgorithm) Option {
+	return func(c *Config) {
+		c.HashAlgorithm = algorithm
+	}
+}
+
+// WithETagAlgorithm selects how ETags are derived. ETagModTime skips hashing
+// file bodies; HTML and CSS rewritten for versioning are still hashed, as
+// their output changes with the assets they reference.
+func WithETagAlgorithm(algorithm ETagAlgorithm) Option {
+	return func(c *Config) {
+		c.ETagAlgorithm = algorithm
+	}
+}
+
+// WithVersionCacheFile saves the version manifest to path after the startup
+// scan and on Stop, and reuses its hashes for unchanged files on the next start
+func WithVersionCacheFile(path string) Option {
+	return func(c *Config) {
+		c.VersionCacheFile = path
+	}
+}
+
+// WithPreloadHeaders announces a page's versioned CSS and JS with
+// Link: <url>; rel=preload headers so browsers fetch them early
+func WithPreloadHeaders(enable bool) Option {
+	return func(c *Config) {
+		c.PreloadHeaders = enable
+	}
+}
+
+// WithVersioningMode chooses between filename hashing (VersionFilename) and
+// query-string versioning (VersionQuery)
+func WithVersioningMode(mode VersioningMode) Option {
+	return func(c *Config) {
+		c.VersioningMode = mode
+	}
+}
+
+// WithVersionedPathFunc gives full control over versioned URLs, e.g. to put
+// the hash in a directory (/assets/<hash>/app.js). build receives the original
+// path, the content hash and the extension; reverse undoes it for resolution.
+func WithVersionedPathFunc(build func(original, hash, ext string) string, reverse func(versioned string) (original, hash string, ok bool)) Option {
+	return func(c *Config) {
+		c.VersionedPathFunc = build
+		c.VersionedPathReverse = reverse
+	}
+}
+
 func WithVersionHashLength(length int) Option {
 	return func(c *Config) {
 		if length < 4 {
@@ -269,6 +1382,9 @@ func WithVersionHashLength(length int) Option {
 		} else if length > 16 {
 			length = 16 // Maximum hash length
 		}
+		if length%2 != 0 {
+			length++ // Hashes are hex-encoded bytes, so round up to even
+		}
 		c.VersionHashLength = length
 	}
 }
@@ -279,12 +1395,78 @@ func WithStaticPrefixes(prefixes ...string) Option {
 	}
 }
 
+// WithVersioningExclude keeps matching assets out of versioning, e.g. a
+// third-party script loaded by its fixed name. Patterns are path.Match
+// globs against the URL path; a trailing "/" excludes a whole directory.
+// Excluded files are still served, just never renamed or rewritten.
+func WithVersioningExclude(patterns ...string) Option {
+	return func(c *Config) {
+		c.VersioningExclude = append(c.VersioningExclude, patterns...)
+	}
+}
+
+// WithVersionableExtensions replaces the extensions versioned under
+// StaticPrefixes, e.g. ".js", ".wasm"
+func WithVersionableExtensions(exts ...string) Option {
+	return func(c *Config) {
+		c.VersionableExtensions = normalizeExtensions(exts)
+	}
+}
+
+// WithAdditionalVersionableExtensions adds extensions such as ".wasm" or
+// ".json" to those already versioned
+func WithAdditionalVersionableExtensions(exts ...string) Option {
+	return func(c *Config) {
+		if c.VersionableExtensions == nil {
+			c.VersionableExtensions = append([]string{}, defaultVersionableExtensions...)
+		}
+		c.VersionableExtensions = append(c.VersionableExtensions, normalizeExtensions(exts)...)
+	}
+}
+
+// WithDotfilePolicy sets whether dotfiles are served. By default they 404;
+// AllowWellKnown opens /.well-known/ for ACME challenges and security.txt.
+func WithDotfilePolicy(policy DotfilePolicy) Option {
+	return func(c *Config) {
+		c.DotfilePolicy = policy
+	}
+}
+
+// WithDownloadPrefixes serves files below the given URL prefixes as
+// attachments, so browsers download them instead of rendering them
+func WithDownloadPrefixes(prefixes ...string) Option {
+	return func(c *Config) {
+		c.DownloadPrefixes = make([]string, 0, len(prefixes))
+		for _, prefix := range prefixes {
+			c.DownloadPrefixes = append(c.DownloadPrefixes, normalizeMountPrefix(prefix))
+		}
+	}
+}
+
 func WithURLPrefix(prefix string) Option {
 	return func(c *Config) {
 		c.URLPrefix = prefix
 	}
 }
 
+// WithContentNegotiation picks localized pages by Accept-Language: a request
+// for /index.html with "Accept-Language: fr-FR" gets index.fr-fr.html or
+// index.fr.html when present, and index.html otherwise. A directory request
+// such as /docs/ is negotiated by its index file.
+func WithContentNegotiation(enable bool) Option {
+	return func(c *Config) {
+		c.ContentNegotiation = enable
+	}
+}
+
+// WithClientHints enables serving pre-rendered image variants such as
+// hero-640.jpg for requests carrying Width or DPR client hints
+func WithClientHints(widths ...int) Option {
+	return func(c *Config) {
+		c.ClientHintWidths = widths
+	}
+}
+
 type Preset int
 
 const (
@@ -468,10 +1650,43 @@ func NewSimple(sc SimpleConfig) (*Config, error) {
 	return config, nil
 }
 
+// fixedSettingsChanged names the settings that differ between c and next
+// but are only read when the server is created or started: the listener,
+// TLS, connection timeouts and metrics registration. TLSConfig is compared
+// by the caller, since Clone copies it.
+func (c *Config) fixedSettingsChanged(next *Config) []string {
+	var changed []string
+	check := func(name string, differs bool) {
+		if differs {
+			changed = append(changed, name)
+		}
+	}
+
+	check("Addr", c.Addr != next.Addr)
+	check("ReadTimeout", c.ReadTimeout != next.ReadTimeout)
+	check("ReadHeaderTimeout", c.ReadHeaderTimeout != next.ReadHeaderTimeout)
+	check("WriteTimeout", c.WriteTimeout != next.WriteTimeout)
+	check("IdleTimeout", c.IdleTimeout != next.IdleTimeout)
+	check("MaxHeaderBytes", c.MaxHeaderBytes != next.MaxHeaderBytes)
+	check("MaxConnections", c.MaxConnections != next.MaxConnections)
+	check("HTTP2", c.HTTP2 != next.HTTP2)
+	check("EnableHTTPS", c.EnableHTTPS != next.EnableHTTPS)
+	check("TLSCert", c.TLSCert != next.TLSCert)
+	check("TLSKey", c.TLSKey != next.TLSKey)
+	check("AutoTLSDomains", !slices.Equal(c.AutoTLSDomains, next.AutoTLSDomains))
+	check("AutoTLSCacheDir", c.AutoTLSCacheDir != next.AutoTLSCacheDir)
+	check("HTTPSRedirectAddr", c.HTTPSRedirectAddr != next.HTTPSRedirectAddr)
+	check("EnableMetrics", c.EnableMetrics != next.EnableMetrics)
+	check("MetricsNamespace", c.MetricsNamespace != next.MetricsNamespace)
+	return changed
+}
+
 // ValidateConfig validates the configuration and returns an error if invalid
 func (c *Config) Validate() error {
-	// Validate hash length
-	if c.VersionHashLength < 4 || c.VersionHashLength > 16 {
+	// Validate hash length. Zero means "use the default" (see
+	// NewAssetVersionManager); WithVersionHashLength already clamps and rounds,
+	// so only hand-built configs can trip these checks.
+	if c.VersionHashLength != 0 && (c.VersionHashLength < 4 || c.VersionHashLength > 16) {
 		return fmt.Errorf("version hash length must be between 4 and 16 characters, got %d", c.VersionHashLength)
 	}
 
@@ -480,6 +1695,127 @@ func (c *Config) Validate() error {
 		return fmt.Errorf("version hash length must be even, got %d", c.VersionHashLength)
 	}
 
+	if c.HashAlgorithm < HashSHA256 || c.HashAlgorithm > HashXXH64 {
+		return fmt.Errorf("unknown hash algorithm %d", c.HashAlgorithm)
+	}
+
+	if c.DotfilePolicy < DenyDotfiles || c.DotfilePolicy > AllowDotfiles {
+		return fmt.Errorf("unknown dotfile policy %d", c.DotfilePolicy)
+	}
+
+	if c.ETagAlgorithm < ETagContent || c.ETagAlgorithm > ETagModTime {
+		return fmt.Errorf("unknown ETag algorithm %d", c.ETagAlgorithm)
+	}
+
+	for _, pattern := range c.VersioningExclude {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid versioning exclude pattern %q: %w", pattern, err)
+		}
+	}
+
+	for _, pattern := range c.WatcherIgnore {
+		if _, err := filepath.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid watcher ignore pattern %q: %w", pattern, err)
+		}
+	}
+
+	for _, m := range c.Mounts {
+		if m.Prefix == "" || m.Prefix != normalizeMountPrefix(m.Prefix) {
+			return fmt.Errorf("mount prefix must be a non-root path like \"/docs\", got %q", m.Prefix)
+		}
+		if m.Root == "" {
+			return fmt.Errorf("mount %s has no root directory", m.Prefix)
+		}
+	}
+
+	for _, m := range c.AllowedMethods {
+		switch m {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+		default:
+			return fmt.Errorf("unsupported method %q; file routes serve only GET, HEAD and OPTIONS", m)
+		}
+	}
+
+	if c.ErrorLogCapacity < 0 {
+		return fmt.Errorf("error log capacity must not be negative, got %d", c.ErrorLogCapacity)
+	}
+
+	for _, rule := range c.CacheRules {
+		if rule.CacheControl == "" {
+			return fmt.Errorf("cache rule for %q has an empty Cache-Control value", rule.Prefix)
+		}
+	}
+
+	if len(c.AutoTLSDomains) > 0 && c.AutoTLSCacheDir == "" {
+		return fmt.Errorf("automatic TLS for %v needs a certificate cache directory", c.AutoTLSDomains)
+	}
+
+	if c.HTTPSRedirectAddr != "" && !c.EnableHTTPS {
+		return fmt.Errorf("HTTPS redirect on %s requires TLS to be enabled", c.HTTPSRedirectAddr)
+	}
+
+	if c.BrotliLGWin != 0 && (c.BrotliLGWin < 10 || c.BrotliLGWin > 24) {
+		return fmt.Errorf("brotli window must be between 10 and 24 bits, got %d", c.BrotliLGWin)
+	}
+
+	if c.GzipStrategy != GzipDefaultStrategy && c.GzipStrategy != GzipHuffmanOnly {
+		return fmt.Errorf("unknown gzip strategy %d", c.GzipStrategy)
+	}
+
+	if !isMetricNamespace(c.MetricsNamespace) {
+		return fmt.Errorf("metrics namespace %q must be letters, digits and underscores, not starting with a digit", c.MetricsNamespace)
+	}
+
+	if c.MaxFileSize <= 0 {
+		return fmt.Errorf("max file size must be positive, got %d", c.MaxFileSize)
+	}
+
+	if c.CacheDecayInterval < 0 {
+		return fmt.Errorf("cache decay interval must not be negative, got %v", c.CacheDecayInterval)
+	}
+
+	if c.RateLimitBurst < 0 {
+		return fmt.Errorf("rate limit burst must not be negative, got %d", c.RateLimitBurst)
+	}
+
+	if c.MaxConcurrency < 0 {
+		return fmt.Errorf("max concurrency must not be negative, got %d", c.MaxConcurrency)
+	}
+
+	if c.CORSAllowCredentials {
+		for _, origin := range c.AllowedOrigins {
+			if origin == "*" {
+				return fmt.Errorf("CORS credentials need explicit allowed origins, not \"*\"")
+			}
+		}
+	}
+
+	if c.StatCacheTTL < 0 {
+		return fmt.Errorf("stat cache TTL must not be negative, got %v", c.StatCacheTTL)
+	}
+
+	if c.WatcherDebounce < 0 {
+		return fmt.Errorf("watcher debounce must not be negative, got %v", c.WatcherDebounce)
+	}
+
+	if c.StaleWhileRevalidate < 0 {
+		return fmt.Errorf("stale-while-revalidate window must not be negative, got %v", c.StaleWhileRevalidate)
+	}
+
+	if c.Compression != NoCompression && len(c.CompressTypes) == 0 {
+		return fmt.Errorf("compression is enabled but no compress types are configured")
+	}
+	for _, t := range c.CompressTypes {
+		if t == "" {
+			// An empty type would match every Content-Type
+			return fmt.Errorf("compress types must not contain an empty entry")
+		}
+	}
+
+	if c.MinCompressionSavings < 0 || c.MinCompressionSavings > 100 {
+		return fmt.Errorf("minimum compression savings must be between 0 and 100 percent, got %d", c.MinCompressionSavings)
+	}
+
 	// Validate URL prefix and static prefixes compatibility
 	if c.EnableVersioning && c.URLPrefix != "" && len(c.StaticPrefixes) > 0 {
 		hasCompatiblePrefix := false
@@ -496,3 +1832,14 @@ func (c *Config) Validate() error {
 
 	return nil
 }
+
+// isMetricNamespace reports whether ns can prefix Prometheus metric names.
+// Empty is allowed and means the default.
+func isMetricNamespace(ns string) bool {
+	for i, c := range ns {
+		if !(c == '_' || 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || i > 0 && '0' <= c && c <= '9') {
+			return false
+		}
+	}
+	return true
+}
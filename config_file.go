@@ -0,0 +1,152 @@
+package gostc
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// LoadConfigFile reads a YAML (.yaml, .yml) or JSON (.json) file into a
+// Config. Keys are Config field names, matched case-insensitively; fields
+// left out keep their DefaultConfig values. Durations accept strings such as
+// "5m", Compression accepts "gzip", "brotli", "gzip|brotli" or "none",
+// CacheStrategy accepts "lru" or "lfu", VersioningMode accepts "filename"
+// or "query", and HashAlgorithm accepts "sha256", "md5" or "xxh64". The
+// result is validated.
+func LoadConfigFile(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	var raw map[string]interface{}
+	switch ext := strings.ToLower(filepath.Ext(path)); ext {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &raw)
+	case ".json":
+		err = json.Unmarshal(data, &raw)
+	default:
+		return nil, fmt.Errorf("unsupported config file extension %q", ext)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse config file %s: %w", path, err)
+	}
+
+	if err := normalizeConfigValues(raw); err != nil {
+		return nil, fmt.Errorf("invalid config file %s: %w", path, err)
+	}
+
+	// Round-trip through JSON so encoding/json fills the defaults in place
+	normalized, err := json.Marshal(raw)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode config: %w", err)
+	}
+
+	config := DefaultConfig()
+	if err := json.Unmarshal(normalized, config); err != nil {
+		return nil, fmt.Errorf("invalid config file %s: %w", path, err)
+	}
+
+	if err := config.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid configuration: %w", err)
+	}
+
+	return config, nil
+}
+
+var (
+	durationType        = reflect.TypeOf(time.Duration(0))
+	compressionTypeType = reflect.TypeOf(CompressionType(0))
+	cacheStrategyType   = reflect.TypeOf(CacheStrategy(0))
+	versioningModeType  = reflect.TypeOf(VersioningMode(0))
+	hashAlgorithmType   = reflect.TypeOf(HashAlgorithm(0))
+)
+
+// normalizeConfigValues rewrites human-friendly string values in raw into
+// the numeric forms encoding/json expects for the matching Config fields
+func normalizeConfigValues(raw map[string]interface{}) error {
+	configType := reflect.TypeOf(Config{})
+
+	for key, value := range raw {
+		str, ok := value.(string)
+		if !ok {
+			continue
+		}
+
+		field, found := configType.FieldByNameFunc(func(name string) bool {
+			return strings.EqualFold(name, key)
+		})
+		if !found {
+			continue
+		}
+
+		switch field.Type {
+		case durationType:
+			d, err := time.ParseDuration(str)
+			if err != nil {
+				return fmt.Errorf("%s: %w", key, err)
+			}
+			raw[key] = int64(d)
+		case compressionTypeType:
+			c, err := parseCompressionType(str)
+			if err != nil {
+				return fmt.Errorf("%s: %w", key, err)
+			}
+			raw[key] = int(c)
+		case cacheStrategyType:
+			switch strings.ToLower(str) {
+			case "lru":
+				raw[key] = int(LRU)
+			case "lfu":
+				raw[key] = int(LFU)
+			default:
+				return fmt.Errorf("%s: unknown cache strategy %q", key, str)
+			}
+		case versioningModeType:
+			switch strings.ToLower(str) {
+			case "filename":
+				raw[key] = int(VersionFilename)
+			case "query":
+				raw[key] = int(VersionQuery)
+			default:
+				return fmt.Errorf("%s: unknown versioning mode %q", key, str)
+			}
+		case hashAlgorithmType:
+			switch strings.ToLower(str) {
+			case "sha256":
+				raw[key] = int(HashSHA256)
+			case "md5":
+				raw[key] = int(HashMD5)
+			case "xxh64", "xxhash":
+				raw[key] = int(HashXXH64)
+			default:
+				return fmt.Errorf("%s: unknown hash algorithm %q", key, str)
+			}
+		}
+	}
+
+	return nil
+}
+
+// parseCompressionType parses names such as "gzip|brotli" or "gzip, br"
+func parseCompressionType(s string) (CompressionType, error) {
+	var c CompressionType
+	for _, name := range strings.FieldsFunc(s, func(r rune) bool { return r == '|' || r == ',' }) {
+		switch strings.ToLower(strings.TrimSpace(name)) {
+		case "none", "":
+		case "gzip":
+			c |= Gzip
+		case "brotli", "br":
+			c |= Brotli
+		default:
+			return 0, fmt.Errorf("unknown compression %q", name)
+		}
+	}
+	return c, nil
+}
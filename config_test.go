@@ -191,6 +191,43 @@ func TestConfigurationValidation(t *testing.T) {
 		}
 	})
 
+	t.Run("NewWithConfigRejectsInvalidHashLength", func(t *testing.T) {
+		for _, length := range []int{2, 7, 20} {
+			config := DefaultConfig()
+			config.Root = t.TempDir()
+			config.VersionHashLength = length
+
+			if _, err := NewWithConfig(config); err == nil {
+				t.Errorf("Expected validation error for hash length %d", length)
+			}
+		}
+	})
+
+	t.Run("NewWithConfigRejectsIncompatibleURLPrefix", func(t *testing.T) {
+		config := DefaultConfig()
+		config.Root = t.TempDir()
+		config.EnableVersioning = true
+		config.URLPrefix = "/cdn"
+		config.StaticPrefixes = []string{"/static/"}
+
+		if _, err := NewWithConfig(config); err == nil {
+			t.Error("Expected validation error for incompatible URL prefix")
+		}
+	})
+
+	t.Run("OptionClampingPassesValidation", func(t *testing.T) {
+		for input, expected := range map[int]int{2: 4, 7: 8, 15: 16, 40: 16} {
+			server, err := New(WithRoot(t.TempDir()), WithVersionHashLength(input))
+			if err != nil {
+				t.Errorf("WithVersionHashLength(%d) should not fail validation: %v", input, err)
+				continue
+			}
+			if server.config.VersionHashLength != expected {
+				t.Errorf("WithVersionHashLength(%d): expected %d, got %d", input, expected, server.config.VersionHashLength)
+			}
+		}
+	})
+
 	t.Run("EmptyStaticPrefixes", func(t *testing.T) {
 		tempDir, err := os.MkdirTemp("", "gostc-test-*")
 		if err != nil {
@@ -617,3 +654,85 @@ func TestNewPresets(t *testing.T) {
 		}
 	})
 }
+
+func TestLoadConfigFile(t *testing.T) {
+	tmpDir := t.TempDir()
+	root := filepath.Join(tmpDir, "public")
+	os.MkdirAll(root, 0755)
+
+	t.Run("YAML", func(t *testing.T) {
+		path := filepath.Join(tmpDir, "gostc.yaml")
+		os.WriteFile(path, []byte(`
+root: `+root+`
+cacheTTL: 5m
+readTimeout: 2s
+compression: gzip
+compressionLevel: 4
+cacheStrategy: lfu
+versioningMode: query
+enableWatcher: false
+`), 0644)
+
+		config, err := LoadConfigFile(path)
+		if err != nil {
+			t.Fatalf("LoadConfigFile failed: %v", err)
+		}
+
+		server, err := NewWithConfig(config)
+		if err != nil {
+			t.Fatalf("NewWithConfig failed: %v", err)
+		}
+
+		if server.config.Root != root {
+			t.Errorf("Expected root %s, got %s", root, server.config.Root)
+		}
+		if server.config.CacheTTL != 5*time.Minute {
+			t.Errorf("Expected CacheTTL 5m, got %v", server.config.CacheTTL)
+		}
+		if server.config.ReadTimeout != 2*time.Second {
+			t.Errorf("Expected ReadTimeout 2s, got %v", server.config.ReadTimeout)
+		}
+		if server.config.Compression != Gzip || server.config.CompressionLevel != 4 {
+			t.Errorf("Expected gzip at level 4, got %v at %d", server.config.Compression, server.config.CompressionLevel)
+		}
+		if server.config.CacheStrategy != LFU {
+			t.Errorf("Expected LFU, got %v", server.config.CacheStrategy)
+		}
+		if server.config.VersioningMode != VersionQuery {
+			t.Errorf("Expected query versioning, got %v", server.config.VersioningMode)
+		}
+
+		// Unset fields keep their defaults
+		if server.config.IndexFile != "index.html" || server.config.WriteTimeout != DefaultWriteTimeout {
+			t.Errorf("Expected defaults for unset fields, got IndexFile=%q WriteTimeout=%v", server.config.IndexFile, server.config.WriteTimeout)
+		}
+	})
+
+	t.Run("JSON", func(t *testing.T) {
+		path := filepath.Join(tmpDir, "gostc.json")
+		os.WriteFile(path, []byte(`{"Root": "`+root+`", "CacheTTL": "90s", "Compression": "gzip|brotli"}`), 0644)
+
+		config, err := LoadConfigFile(path)
+		if err != nil {
+			t.Fatalf("LoadConfigFile failed: %v", err)
+		}
+		if config.CacheTTL != 90*time.Second || config.Compression != Gzip|Brotli {
+			t.Errorf("Expected 90s TTL with gzip|brotli, got %v and %v", config.CacheTTL, config.Compression)
+		}
+	})
+
+	t.Run("Errors", func(t *testing.T) {
+		cases := map[string]string{
+			"bad.yaml": "cacheTTL: soon\n",
+			"bad.toml": "root = 'x'\n",
+			"bad.json": `{"VersionHashLength": 3}`,
+		}
+		for name, content := range cases {
+			path := filepath.Join(tmpDir, name)
+			os.WriteFile(path, []byte(content), 0644)
+			if _, err := LoadConfigFile(path); err == nil {
+				t.Errorf("%s: expected an error", name)
+			}
+		}
+	})
+}
@@ -0,0 +1,80 @@
+package gostc
+
+import (
+	"net/http"
+	"path"
+	"strings"
+)
+
+// isDownloadPath reports whether urlPath lies under one of DownloadPrefixes
+func (c *Config) isDownloadPath(urlPath string) bool {
+	for _, prefix := range c.DownloadPrefixes {
+		if prefix == "" || urlPath == prefix || strings.HasPrefix(urlPath, prefix+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// setContentDisposition marks files under DownloadPrefixes as attachments
+// named after the last segment of urlPath
+func (s *Server) setContentDisposition(w http.ResponseWriter, urlPath string) {
+	if !s.config.isDownloadPath(urlPath) {
+		return
+	}
+	w.Header().Set("Content-Disposition", attachmentDisposition(path.Base(urlPath)))
+}
+
+// attachmentDisposition builds an RFC 6266 attachment value for filename.
+// Names that are not plain ASCII also get an RFC 5987 filename* parameter,
+// with an ASCII approximation in filename for older clients.
+func attachmentDisposition(filename string) string {
+	var fallback strings.Builder
+	plain := true
+	for _, r := range filename {
+		switch {
+		case r == '"' || r == '\\':
+			fallback.WriteByte('\\')
+			fallback.WriteRune(r)
+		case r < 0x20 || r >= 0x7f:
+			fallback.WriteByte('_')
+			plain = false
+		default:
+			fallback.WriteRune(r)
+		}
+	}
+
+	value := `attachment; filename="` + fallback.String() + `"`
+	if plain {
+		return value
+	}
+	return value + "; filename*=UTF-8''" + encodeExtValue(filename)
+}
+
+// encodeExtValue percent-encodes s as an RFC 5987 ext-value, leaving only
+// attr-char bytes unescaped
+func encodeExtValue(s string) string {
+	const hex = "0123456789ABCDEF"
+
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if isAttrChar(c) {
+			b.WriteByte(c)
+			continue
+		}
+		b.WriteByte('%')
+		b.WriteByte(hex[c>>4])
+		b.WriteByte(hex[c&0x0f])
+	}
+	return b.String()
+}
+
+// isAttrChar reports whether c may appear unescaped in an ext-value
+func isAttrChar(c byte) bool {
+	switch {
+	case 'a' <= c && c <= 'z', 'A' <= c && c <= 'Z', '0' <= c && c <= '9':
+		return true
+	}
+	return strings.IndexByte("!#$&+-.^_`|~", c) >= 0
+}
@@ -0,0 +1,73 @@
+package gostc
+
+import (
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDownloadPrefixes(t *testing.T) {
+	tmpDir := t.TempDir()
+	os.MkdirAll(filepath.Join(tmpDir, "downloads"), 0755)
+	os.WriteFile(filepath.Join(tmpDir, "downloads", "report.pdf"), []byte("%PDF"), 0644)
+	os.WriteFile(filepath.Join(tmpDir, "downloads", "Résumé final.txt"), []byte("cv"), 0644)
+	os.WriteFile(filepath.Join(tmpDir, "page.txt"), []byte("page"), 0644)
+
+	server, err := New(
+		WithRoot(tmpDir),
+		WithWatcher(false),
+		WithDownloadPrefixes("/downloads/"),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		path     string
+		expected string
+	}{
+		{
+			name:     "ascii filename",
+			path:     "/downloads/report.pdf",
+			expected: `attachment; filename="report.pdf"`,
+		},
+		{
+			name:     "spaces and unicode",
+			path:     "/downloads/" + url.PathEscape("Résumé final.txt"),
+			expected: `attachment; filename="R_sum_ final.txt"; filename*=UTF-8''R%C3%A9sum%C3%A9%20final.txt`,
+		},
+		{
+			name:     "outside download prefix",
+			path:     "/page.txt",
+			expected: "",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// The second request is served from the cache
+			for i := 0; i < 2; i++ {
+				w := httptest.NewRecorder()
+				server.ServeHTTP(w, httptest.NewRequest("GET", tt.path, nil))
+
+				if w.Code != 200 {
+					t.Fatalf("Expected 200, got %d", w.Code)
+				}
+				if got := w.Header().Get("Content-Disposition"); got != tt.expected {
+					t.Errorf("Request %d: expected Content-Disposition %q, got %q", i, tt.expected, got)
+				}
+			}
+		})
+	}
+}
+
+func TestAttachmentDispositionEscapesQuotes(t *testing.T) {
+	got := attachmentDisposition(`say "hi".txt`)
+	expected := `attachment; filename="say \"hi\".txt"`
+	if got != expected {
+		t.Errorf("Expected %q, got %q", expected, got)
+	}
+}
@@ -0,0 +1,76 @@
+package gostc
+
+import (
+	"net/http"
+	"path"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultFile is an in-memory response for a fixed URL path, such as a
+// fallback favicon.ico or robots.txt
+type DefaultFile struct {
+	Content     []byte
+	ContentType string
+}
+
+// normalizeDefaultFilePath cleans urlPath the way serveFile cleans request
+// paths, so registrations match the paths they're looked up by
+func normalizeDefaultFilePath(urlPath string) string {
+	return path.Clean("/" + strings.TrimPrefix(urlPath, "/"))
+}
+
+// defaultFileEntries holds the prepared, possibly compressed, cache entries
+// for Config.DefaultFiles. They live outside the cache so invalidation and
+// eviction never send these paths back to disk.
+type defaultFileEntries struct {
+	entries sync.Map  // CacheKey -> *CacheEntry
+	modTime time.Time // Last-Modified for every default file, set per config
+}
+
+// serveDefaultFile answers a request for a path registered with
+// WithDefaultFile from memory, with the usual validators, Cache-Control and
+// negotiated compression
+func (s *Server) serveDefaultFile(w http.ResponseWriter, r *http.Request, urlPath string, file DefaultFile, compressor Compressor, compressionType CompressionType) {
+	key := CacheKey{Path: urlPath, Compression: compressionType}
+
+	if entry, ok := s.defaultFiles.entries.Load(key); ok {
+		s.serveFromCache(w, r, entry.(*CacheEntry), compressionType, false)
+		return
+	}
+
+	entry, keep := s.prepareDefaultFile(r, urlPath, file, compressor, compressionType)
+	if keep {
+		s.defaultFiles.entries.Store(key, entry)
+	}
+	s.serveFromCache(w, r, entry, compressionType, false)
+}
+
+// prepareDefaultFile builds the entry for file in compressionType, falling
+// back to identity when compression doesn't apply or fails. keep is false
+// for a transient fallback that shouldn't be reused.
+func (s *Server) prepareDefaultFile(r *http.Request, urlPath string, file DefaultFile, compressor Compressor, compressionType CompressionType) (entry *CacheEntry, keep bool) {
+	contentType := file.ContentType
+	if contentType == "" {
+		contentType = s.config.contentTypeByExtension(urlPath)
+	}
+	if contentType == "" {
+		contentType = http.DetectContentType(file.Content)
+	}
+
+	entry = &CacheEntry{
+		Data:         file.Content,
+		ContentType:  contentType,
+		ETag:         generateETag(file.Content),
+		LastModified: s.defaultFiles.modTime,
+		Size:         int64(len(file.Content)),
+	}
+
+	if compressor != nil && compressionType != NoCompression && s.compression.ShouldCompress(contentType, entry.Size) {
+		persistent, err := s.compressEntry(r, entry, compressor, compressionType, urlPath)
+		return entry, persistent && err == nil
+	}
+
+	return entry, true
+}
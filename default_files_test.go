@@ -0,0 +1,72 @@
+package gostc
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestWithDefaultFile(t *testing.T) {
+	robots := []byte(strings.Repeat("User-agent: *\nDisallow: /private/\n", 50))
+
+	server, err := New(
+		WithRoot(t.TempDir()),
+		WithWatcher(false),
+		WithDefaultFile("robots.txt", robots, "text/plain; charset=utf-8"),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	diskErr := errors.New("disk touched")
+	server.stat = func(name string) (os.FileInfo, error) { return nil, diskErr }
+	server.open = func(name string) (*os.File, error) { return nil, diskErr }
+
+	w := httptest.NewRecorder()
+	server.ServeHTTP(w, httptest.NewRequest("GET", "/robots.txt", nil))
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d", w.Code)
+	}
+	if ct := w.Header().Get("Content-Type"); ct != "text/plain; charset=utf-8" {
+		t.Errorf("Expected the registered Content-Type, got %q", ct)
+	}
+	if w.Body.String() != string(robots) {
+		t.Error("Expected the registered body")
+	}
+
+	etag := w.Header().Get("ETag")
+	if etag == "" {
+		t.Fatal("Expected an ETag")
+	}
+
+	// Revalidation and compression work as for files on disk
+	req := httptest.NewRequest("GET", "/robots.txt", nil)
+	req.Header.Set("If-None-Match", etag)
+	w = httptest.NewRecorder()
+	server.ServeHTTP(w, req)
+	if w.Code != http.StatusNotModified {
+		t.Errorf("Expected 304 for a matching ETag, got %d", w.Code)
+	}
+
+	req = httptest.NewRequest("GET", "/robots.txt", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	w = httptest.NewRecorder()
+	server.ServeHTTP(w, req)
+	if w.Code != http.StatusOK || w.Header().Get("Content-Encoding") != "gzip" {
+		t.Errorf("Expected a gzip response, got %d %q", w.Code, w.Header().Get("Content-Encoding"))
+	}
+	if w.Body.Len() >= len(robots) {
+		t.Error("Expected the gzip body to be smaller than the original")
+	}
+
+	// Other paths still go to disk
+	w = httptest.NewRecorder()
+	server.ServeHTTP(w, httptest.NewRequest("GET", "/favicon.ico", nil))
+	if w.Code == http.StatusOK {
+		t.Error("Expected unregistered paths to be looked up on disk")
+	}
+}
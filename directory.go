@@ -0,0 +1,217 @@
+package gostc
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DirectoryEntry describes a single item in a directory listing
+type DirectoryEntry struct {
+	Name    string
+	URL     string
+	IsDir   bool
+	Size    int64
+	ModTime time.Time
+}
+
+// DirectoryListing is the data passed to a custom directory template
+type DirectoryListing struct {
+	Path      string
+	HasParent bool
+	Entries   []DirectoryEntry
+}
+
+// listingKeyPrefix separates cached directory listings from files. URL
+// paths always start with "/", so the keys cannot collide.
+const listingKeyPrefix = "dir:"
+
+// listingCacheKey is where the rendered listing of the directory at urlPath
+// is cached
+func listingCacheKey(urlPath string, compression CompressionType) CacheKey {
+	return CacheKey{Path: listingKeyPrefix + urlPath, Compression: compression}
+}
+
+// invalidateListing drops every cached rendering of the listing of the
+// directory at dirPath, requested with or without a trailing slash
+func invalidateListing(cache Cache, dirPath string) {
+	dirPath = strings.TrimSuffix(dirPath, "/")
+	for _, urlPath := range []string{dirPath, dirPath + "/"} {
+		for _, compression := range allCompressionTypes() {
+			cache.Delete(listingCacheKey(urlPath, compression))
+		}
+	}
+}
+
+// serveDirectory renders the listing of dirPath. With CacheDirectoryListings
+// the rendered (and possibly compressed) page is cached per request path
+// until the directory's modification time changes or the watcher
+// invalidates it.
+func (s *Server) serveDirectory(w http.ResponseWriter, r *http.Request, dirPath string, info os.FileInfo, compressor Compressor, compressionType CompressionType) {
+	if !s.config.CacheDirectoryListings {
+		s.recordCacheLookup(false)
+		s.writeDirectoryListing(w, r, dirPath)
+		return
+	}
+
+	// Keyed by the raw path: links and the title differ with a trailing slash
+	key := listingCacheKey(r.URL.Path, compressionType)
+	if entry, ok := s.cache.Get(key); ok && entry.LastModified.Equal(info.ModTime()) {
+		s.recordCacheLookup(true)
+		s.serveFromCache(w, r, entry, compressionType, false)
+		return
+	}
+	s.recordCacheLookup(false)
+
+	var buf bytes.Buffer
+	if err := s.renderDirectory(&buf, r, dirPath); err != nil {
+		s.errorHandler.HandleError(w, r, err)
+		return
+	}
+
+	entry := &CacheEntry{
+		Data:         buf.Bytes(),
+		ContentType:  "text/html; charset=utf-8",
+		ETag:         generateETag(buf.Bytes()),
+		LastModified: info.ModTime(),
+		Size:         int64(buf.Len()),
+	}
+
+	if compressor != nil && compressionType != NoCompression &&
+		s.compression.ShouldCompress(entry.ContentType, entry.Size) {
+		persistent, err := s.compressEntry(r, entry, compressor, compressionType, dirPath)
+		if err != nil {
+			s.errorHandler.HandleError(w, r, err)
+			return
+		}
+		if !persistent {
+			key.Compression = NoCompression
+		}
+	}
+
+	s.cache.Set(key, entry)
+	s.serveFromCache(w, r, entry, compressionType, false)
+}
+
+// writeDirectoryListing renders and writes the listing of dirPath uncached
+func (s *Server) writeDirectoryListing(w http.ResponseWriter, r *http.Request, dirPath string) {
+	var buf bytes.Buffer
+	if err := s.renderDirectory(&buf, r, dirPath); err != nil {
+		s.errorHandler.HandleError(w, r, err)
+		return
+	}
+
+	s.writeGenerated(w, r, http.StatusOK, "text/html; charset=utf-8", buf.Bytes())
+}
+
+// renderDirectory renders the listing of dirPath into buf using the
+// configured template or the built-in table
+func (s *Server) renderDirectory(buf *bytes.Buffer, r *http.Request, dirPath string) error {
+	listing, err := readDirectoryListing(dirPath, r.URL.Path)
+	if err != nil {
+		return NewServerError(ErrorTypeServerError, "server.readDir", err).
+			WithPath(r.URL.Path)
+	}
+
+	// Hide entries the dotfile policy would refuse to serve
+	visible := listing.Entries[:0]
+	for _, entry := range listing.Entries {
+		if s.config.dotfileAllowed(path.Join(r.URL.Path, entry.Name)) {
+			visible = append(visible, entry)
+		}
+	}
+	listing.Entries = visible
+
+	if s.config.DirectoryTemplate != nil {
+		if err := s.config.DirectoryTemplate.Execute(buf, listing); err != nil {
+			return NewServerError(ErrorTypeServerError, "server.renderDirectory", err).
+				WithPath(r.URL.Path)
+		}
+		return nil
+	}
+
+	renderDirectoryListing(buf, listing)
+	return nil
+}
+
+// readDirectoryListing reads dirPath and returns its entries sorted with
+// directories first, then files, each group alphabetically
+func readDirectoryListing(dirPath, urlPath string) (*DirectoryListing, error) {
+	dirEntries, err := os.ReadDir(dirPath)
+	if err != nil {
+		return nil, err
+	}
+
+	listing := &DirectoryListing{
+		Path:      urlPath,
+		HasParent: urlPath != "/",
+		Entries:   make([]DirectoryEntry, 0, len(dirEntries)),
+	}
+
+	for _, de := range dirEntries {
+		info, err := de.Info()
+		if err != nil {
+			// Entry vanished between ReadDir and Info
+			continue
+		}
+
+		entry := DirectoryEntry{
+			Name:    de.Name(),
+			URL:     (&url.URL{Path: de.Name()}).String(),
+			IsDir:   de.IsDir(),
+			ModTime: info.ModTime(),
+		}
+		if entry.IsDir {
+			entry.Name += "/"
+			entry.URL += "/"
+		} else {
+			entry.Size = info.Size()
+		}
+		listing.Entries = append(listing.Entries, entry)
+	}
+
+	sort.Slice(listing.Entries, func(i, j int) bool {
+		a, b := listing.Entries[i], listing.Entries[j]
+		if a.IsDir != b.IsDir {
+			return a.IsDir
+		}
+		return strings.ToLower(a.Name) < strings.ToLower(b.Name)
+	})
+
+	return listing, nil
+}
+
+func renderDirectoryListing(buf *bytes.Buffer, listing *DirectoryListing) {
+	title := html.EscapeString(listing.Path)
+
+	fmt.Fprintf(buf, "<html><head><title>Directory listing for %s</title></head><body>", title)
+	fmt.Fprintf(buf, "<h1>Directory listing for %s</h1>", title)
+	buf.WriteString("<table><thead><tr><th>Name</th><th>Size</th><th>Modified</th></tr></thead><tbody>")
+
+	if listing.HasParent {
+		buf.WriteString(`<tr><td><a href="../">../</a></td><td></td><td></td></tr>`)
+	}
+
+	for _, entry := range listing.Entries {
+		size := "-"
+		if !entry.IsDir {
+			size = strconv.FormatInt(entry.Size, 10)
+		}
+		fmt.Fprintf(buf, `<tr><td><a href="%s">%s</a></td><td>%s</td><td>%s</td></tr>`,
+			html.EscapeString(entry.URL),
+			html.EscapeString(entry.Name),
+			size,
+			entry.ModTime.UTC().Format(time.RFC3339),
+		)
+	}
+
+	buf.WriteString("</tbody></table></body></html>")
+}
@@ -0,0 +1,313 @@
+package gostc
+
+import (
+	"compress/gzip"
+	"fmt"
+	"html/template"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDirectoryListingEscapesNames(t *testing.T) {
+	tmpDir := t.TempDir()
+	malicious := `"><img src=x onerror=alert(1)>.txt`
+	if err := os.WriteFile(filepath.Join(tmpDir, malicious), []byte("x"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	server, err := New(
+		WithRoot(tmpDir),
+		func(c *Config) { c.AllowBrowsing = true },
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req := httptest.NewRequest("GET", "/", nil)
+	w := httptest.NewRecorder()
+	server.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d", w.Code)
+	}
+
+	body := w.Body.String()
+	if strings.Contains(body, "<img") {
+		t.Errorf("Directory listing contains unescaped file name: %s", body)
+	}
+	if !strings.Contains(body, "&lt;img src=x onerror=alert(1)&gt;.txt") {
+		t.Errorf("Expected escaped file name in listing, got: %s", body)
+	}
+}
+
+func TestDirectoryListingSchemeLikeNames(t *testing.T) {
+	tmpDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(tmpDir, "javascript:alert(1)"), []byte("x"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	server, err := New(
+		WithRoot(tmpDir),
+		func(c *Config) { c.AllowBrowsing = true },
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w := httptest.NewRecorder()
+	server.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d", w.Code)
+	}
+
+	body := w.Body.String()
+	if strings.Contains(body, `href="javascript:`) {
+		t.Errorf("Directory listing links to a javascript: URL: %s", body)
+	}
+	if !strings.Contains(body, `href="./javascript:alert%281%29"`) {
+		t.Errorf("Expected a relative link for the file, got: %s", body)
+	}
+}
+
+func TestDirectoryListingSorted(t *testing.T) {
+	tmpDir := t.TempDir()
+	os.WriteFile(filepath.Join(tmpDir, "b.txt"), []byte("bb"), 0644)
+	os.WriteFile(filepath.Join(tmpDir, "A.txt"), []byte("a"), 0644)
+	os.Mkdir(filepath.Join(tmpDir, "zdir"), 0755)
+	os.Mkdir(filepath.Join(tmpDir, "adir"), 0755)
+
+	listing, err := readDirectoryListing(tmpDir, "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var names []string
+	for _, entry := range listing.Entries {
+		names = append(names, entry.Name)
+	}
+
+	expected := []string{"adir/", "zdir/", "A.txt", "b.txt"}
+	if strings.Join(names, ",") != strings.Join(expected, ",") {
+		t.Errorf("Expected order %v, got %v", expected, names)
+	}
+
+	if listing.Entries[3].Size != 2 {
+		t.Errorf("Expected size 2 for b.txt, got %d", listing.Entries[3].Size)
+	}
+	if listing.HasParent {
+		t.Error("Root listing should not have a parent link")
+	}
+}
+
+func TestDirectoryListingCustomTemplate(t *testing.T) {
+	tmpDir := t.TempDir()
+	os.WriteFile(filepath.Join(tmpDir, "file1.txt"), []byte("1"), 0644)
+
+	tmpl := template.Must(template.New("dir").Parse(
+		`<ul>{{range .Entries}}<li data-size="{{.Size}}">{{.Name}}</li>{{end}}</ul>`))
+
+	server, err := New(
+		WithRoot(tmpDir),
+		WithDirectoryTemplate(tmpl),
+		func(c *Config) { c.AllowBrowsing = true },
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req := httptest.NewRequest("GET", "/", nil)
+	w := httptest.NewRecorder()
+	server.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d", w.Code)
+	}
+
+	if body := w.Body.String(); body != `<ul><li data-size="1">file1.txt</li></ul>` {
+		t.Errorf("Unexpected custom listing output: %s", body)
+	}
+}
+
+func TestDirectoryListingCache(t *testing.T) {
+	tmpDir := t.TempDir()
+	docs := filepath.Join(tmpDir, "docs")
+	os.MkdirAll(docs, 0755)
+	for i := 0; i < 40; i++ {
+		os.WriteFile(filepath.Join(docs, fmt.Sprintf("file-%02d.txt", i)), []byte("x"), 0644)
+	}
+	dirTime := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	os.Chtimes(docs, dirTime, dirTime)
+
+	server, err := New(
+		WithRoot(tmpDir),
+		WithCompression(Gzip),
+		WithDirectoryListingCache(true),
+		func(c *Config) { c.AllowBrowsing = true },
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	get := func() *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/docs/", nil)
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, req)
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected 200, got %d", w.Code)
+		}
+		return w
+	}
+
+	first := get()
+	if first.Header().Get("ETag") == "" {
+		t.Error("Expected cached listings to carry an ETag")
+	}
+
+	req := httptest.NewRequest("GET", "/docs/", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	w := httptest.NewRecorder()
+	server.ServeHTTP(w, req)
+	if w.Header().Get("Content-Encoding") != "gzip" {
+		t.Errorf("Expected a gzip listing, got Content-Encoding %q", w.Header().Get("Content-Encoding"))
+	}
+
+	// A new file with the directory mtime restored stays hidden: the
+	// listing is served from cache
+	os.WriteFile(filepath.Join(docs, "added.txt"), []byte("x"), 0644)
+	os.Chtimes(docs, dirTime, dirTime)
+
+	hitsBefore := server.CacheStats().Hits
+	if body := get().Body.String(); strings.Contains(body, "added.txt") {
+		t.Error("Expected the repeated listing to come from cache")
+	}
+	if server.CacheStats().Hits <= hitsBefore {
+		t.Error("Expected a cache hit for the repeated listing")
+	}
+
+	// The watcher invalidates the parent directory's listing
+	server.invalidator.InvalidatePath(filepath.Join(docs, "added.txt"))
+	if body := get().Body.String(); !strings.Contains(body, "added.txt") {
+		t.Error("Expected the listing to be regenerated after invalidation")
+	}
+
+	// A changed directory mtime also regenerates it
+	os.WriteFile(filepath.Join(docs, "later.txt"), []byte("x"), 0644)
+	os.Chtimes(docs, dirTime.Add(time.Hour), dirTime.Add(time.Hour))
+	if body := get().Body.String(); !strings.Contains(body, "later.txt") {
+		t.Error("Expected the listing to be regenerated after the directory changed")
+	}
+}
+
+func TestDirectoryListingCompressed(t *testing.T) {
+	tmpDir := t.TempDir()
+	for i := 0; i < 200; i++ {
+		if err := os.WriteFile(filepath.Join(tmpDir, fmt.Sprintf("file-%03d.txt", i)), []byte("x"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, cached := range []bool{false, true} {
+		server, err := New(
+			WithRoot(tmpDir),
+			WithCompression(Gzip),
+			func(c *Config) {
+				c.AllowBrowsing = true
+				c.CacheDirectoryListings = cached
+			},
+		)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Set("Accept-Encoding", "gzip")
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, req)
+
+		if w.Code != http.StatusOK {
+			t.Fatalf("cached=%v: Expected 200, got %d", cached, w.Code)
+		}
+		if enc := w.Header().Get("Content-Encoding"); enc != "gzip" {
+			t.Fatalf("cached=%v: Expected gzip listing, got Content-Encoding %q", cached, enc)
+		}
+		if cl := w.Header().Get("Content-Length"); cl != strconv.Itoa(w.Body.Len()) {
+			t.Errorf("cached=%v: Content-Length %s does not match body of %d bytes", cached, cl, w.Body.Len())
+		}
+
+		gr, err := gzip.NewReader(w.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, err := io.ReadAll(gr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(string(body), "file-199.txt") {
+			t.Errorf("cached=%v: Expected listing to include file-199.txt", cached)
+		}
+	}
+}
+
+func TestIndexFilesFallback(t *testing.T) {
+	tmpDir := t.TempDir()
+	os.MkdirAll(filepath.Join(tmpDir, "legacy"), 0755)
+	os.MkdirAll(filepath.Join(tmpDir, "both"), 0755)
+	os.WriteFile(filepath.Join(tmpDir, "legacy", "index.htm"), []byte("<html>legacy</html>"), 0644)
+	os.WriteFile(filepath.Join(tmpDir, "both", "index.htm"), []byte("<html>htm</html>"), 0644)
+	os.WriteFile(filepath.Join(tmpDir, "both", "index.html"), []byte("<html>html</html>"), 0644)
+
+	server, err := New(
+		WithRoot(tmpDir),
+		WithWatcher(false),
+		WithIndexFiles("index.html", "index.htm", "default.html"),
+		WithCanonicalRedirects(true),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		path string
+		code int
+		body string
+	}{
+		{"/legacy/", http.StatusOK, "<html>legacy</html>"},
+		{"/both/", http.StatusOK, "<html>html</html>"},         // earlier names win
+		{"/legacy/index.htm", http.StatusMovedPermanently, ""}, // the served index is canonical as its directory
+		{"/both/index.htm", http.StatusOK, "<html>htm</html>"}, // not the index served here, so no redirect
+	}
+
+	for _, tt := range tests {
+		req := httptest.NewRequest("GET", tt.path, nil)
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, req)
+
+		if w.Code != tt.code {
+			t.Errorf("%s: expected %d, got %d", tt.path, tt.code, w.Code)
+			continue
+		}
+		if tt.body != "" && w.Body.String() != tt.body {
+			t.Errorf("%s: expected %q, got %q", tt.path, tt.body, w.Body.String())
+		}
+	}
+
+	// The default list still serves index.html only
+	server, err = New(WithRoot(tmpDir), WithWatcher(false))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := httptest.NewRequest("GET", "/legacy/", nil)
+	w := httptest.NewRecorder()
+	server.ServeHTTP(w, req)
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 without a fallback list, got %d", w.Code)
+	}
+}
@@ -0,0 +1,37 @@
+package gostc
+
+import "strings"
+
+// DotfilePolicy controls access to paths with a segment starting with "."
+type DotfilePolicy int
+
+const (
+	DenyDotfiles   DotfilePolicy = iota // 404 for every dotfile and dot directory (default)
+	AllowWellKnown                      // serve /.well-known/ (RFC 8615), deny other dotfiles
+	AllowDotfiles                       // serve dotfiles like any other file
+)
+
+// wellKnownPrefix is the RFC 8615 directory for site-wide metadata, e.g.
+// ACME challenges and security.txt
+const wellKnownPrefix = "/.well-known"
+
+// dotfileAllowed reports whether the cleaned URL path may be served under
+// the configured DotfilePolicy
+func (c *Config) dotfileAllowed(urlPath string) bool {
+	if c.DotfilePolicy == AllowDotfiles {
+		return true
+	}
+
+	if c.DotfilePolicy == AllowWellKnown &&
+		(urlPath == wellKnownPrefix || strings.HasPrefix(urlPath, wellKnownPrefix+"/")) {
+		// Only the .well-known segment itself is exempt
+		urlPath = strings.TrimPrefix(urlPath, wellKnownPrefix)
+	}
+
+	for _, segment := range strings.Split(urlPath, "/") {
+		if strings.HasPrefix(segment, ".") {
+			return false
+		}
+	}
+	return true
+}
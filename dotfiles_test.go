@@ -0,0 +1,122 @@
+package gostc
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDotfilePolicy(t *testing.T) {
+	tmpDir := t.TempDir()
+	os.MkdirAll(filepath.Join(tmpDir, ".well-known", "acme-challenge"), 0755)
+	os.WriteFile(filepath.Join(tmpDir, ".env"), []byte("SECRET=1"), 0644)
+	os.WriteFile(filepath.Join(tmpDir, ".well-known", "security.txt"), []byte("Contact: security@example.com"), 0644)
+	os.WriteFile(filepath.Join(tmpDir, ".well-known", "acme-challenge", "token123"), []byte("token123.key"), 0644)
+	os.WriteFile(filepath.Join(tmpDir, ".well-known", ".secret"), []byte("hidden"), 0644)
+
+	tests := []struct {
+		name   string
+		policy DotfilePolicy
+		codes  map[string]int
+	}{
+		{
+			name:   "Default",
+			policy: DenyDotfiles,
+			codes: map[string]int{
+				"/.env":                         http.StatusNotFound,
+				"/.well-known/security.txt":     http.StatusNotFound,
+				"/.well-known/acme-challenge/x": http.StatusNotFound,
+			},
+		},
+		{
+			name:   "AllowWellKnown",
+			policy: AllowWellKnown,
+			codes: map[string]int{
+				"/.env":                                http.StatusNotFound,
+				"/.well-known/security.txt":            http.StatusOK,
+				"/.well-known/acme-challenge/token123": http.StatusOK,
+				"/.well-known/.secret":                 http.StatusNotFound,
+			},
+		},
+		{
+			name:   "AllowDotfiles",
+			policy: AllowDotfiles,
+			codes: map[string]int{
+				"/.env":                     http.StatusOK,
+				"/.well-known/security.txt": http.StatusOK,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := []Option{WithRoot(tmpDir), WithWatcher(false)}
+			if tt.policy != DenyDotfiles {
+				opts = append(opts, WithDotfilePolicy(tt.policy))
+			}
+			server, err := New(opts...)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			for urlPath, code := range tt.codes {
+				w := httptest.NewRecorder()
+				server.ServeHTTP(w, httptest.NewRequest("GET", urlPath, nil))
+				if w.Code != code {
+					t.Errorf("%s: expected %d, got %d", urlPath, code, w.Code)
+				}
+			}
+		})
+	}
+}
+
+func TestDotfilePolicyBlocksTraversal(t *testing.T) {
+	root := t.TempDir()
+	siteDir := filepath.Join(root, "site")
+	os.MkdirAll(filepath.Join(siteDir, ".well-known"), 0755)
+	os.WriteFile(filepath.Join(root, "outside.txt"), []byte("outside"), 0644)
+	os.WriteFile(filepath.Join(siteDir, ".env"), []byte("SECRET=1"), 0644)
+
+	server, err := New(WithRoot(siteDir), WithWatcher(false), WithDotfilePolicy(AllowWellKnown))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, urlPath := range []string{
+		"/.well-known/../.env",
+		"/.well-known/../../outside.txt",
+		"/.well-known/..%2f..%2foutside.txt",
+	} {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.URL.Path = urlPath
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, req)
+
+		if w.Code == http.StatusOK {
+			t.Errorf("%s: expected traversal to be rejected, got 200 %q", urlPath, w.Body.String())
+		}
+	}
+}
+
+func TestDirectoryListingHidesDotfiles(t *testing.T) {
+	tmpDir := t.TempDir()
+	os.WriteFile(filepath.Join(tmpDir, ".env"), []byte("SECRET=1"), 0644)
+	os.WriteFile(filepath.Join(tmpDir, "visible.txt"), []byte("ok"), 0644)
+
+	server, err := New(WithRoot(tmpDir), WithWatcher(false), func(c *Config) { c.AllowBrowsing = true })
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w := httptest.NewRecorder()
+	server.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+	if !strings.Contains(w.Body.String(), "visible.txt") {
+		t.Fatalf("Expected the listing to show visible.txt, got %q", w.Body.String())
+	}
+	if strings.Contains(w.Body.String(), ".env") {
+		t.Error("Expected the listing to hide .env")
+	}
+}
@@ -543,3 +543,43 @@ func TestErrorRecovery(t *testing.T) {
 		}
 	})
 }
+
+func TestMaxFileSize(t *testing.T) {
+	const limit = 1024
+
+	tmpDir := t.TempDir()
+	sizes := map[string]int{
+		"under.txt": limit - 1,
+		"at.txt":    limit,
+		"over.txt":  limit + 1,
+	}
+	for name, size := range sizes {
+		if err := os.WriteFile(filepath.Join(tmpDir, name), []byte(strings.Repeat("x", size)), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	server, err := New(WithRoot(tmpDir), WithMaxFileSize(limit))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name, size := range sizes {
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, httptest.NewRequest("GET", "/"+name, nil))
+
+		if size <= limit {
+			if w.Code != http.StatusOK || w.Body.Len() != size {
+				t.Errorf("%s: Expected 200 with %d bytes, got %d with %d bytes", name, size, w.Code, w.Body.Len())
+			}
+		} else if w.Code == http.StatusOK {
+			t.Errorf("%s: Expected a file over the limit to be refused", name)
+		}
+	}
+
+	for _, size := range []int64{0, -1} {
+		if _, err := New(WithRoot(tmpDir), WithMaxFileSize(size)); err == nil {
+			t.Errorf("Expected MaxFileSize %d to be rejected", size)
+		}
+	}
+}
@@ -24,6 +24,9 @@ var (
 	ErrRateLimitExceeded = errors.New("rate limit exceeded")
 	ErrInvalidCSRFToken  = errors.New("invalid CSRF token")
 	ErrTimeout           = errors.New("operation timed out")
+	ErrNotAcceptable     = errors.New("no acceptable content encoding")
+	ErrScanInProgress    = errors.New("asset version scan in progress")
+	ErrNotReloadable     = errors.New("setting cannot be changed by Reload")
 )
 
 // ErrorType represents the category of error
@@ -194,6 +197,16 @@ func NewErrorHandler(debug bool) *ErrorHandler {
 	}
 }
 
+// newErrorHandlerWithCapacity creates an error handler whose logger keeps
+// the last logCapacity errors (0 = DefaultErrorLogCapacity)
+func newErrorHandlerWithCapacity(debug bool, logCapacity int) *ErrorHandler {
+	eh := NewErrorHandler(debug)
+	if logCapacity > 0 {
+		eh.logger = NewErrorLoggerWithCapacity(logCapacity)
+	}
+	return eh
+}
+
 // HandleError processes an error and sends appropriate response
 func (eh *ErrorHandler) HandleError(w http.ResponseWriter, r *http.Request, err error) {
 	// Extract or create ServerError
@@ -245,11 +258,13 @@ func (eh *ErrorHandler) sendErrorResponse(w http.ResponseWriter, r *http.Request
 	http.Error(w, message, statusCode)
 }
 
-// ErrorLogger handles structured error logging
+// ErrorLogger handles structured error logging. It keeps the most recent
+// errors in a fixed-size ring buffer, overwriting the oldest when full.
 type ErrorLogger struct {
 	mu       sync.Mutex
-	errors   []LoggedError
-	maxLogs  int
+	errors   []LoggedError // ring buffer, grows up to capacity
+	next     int           // index the next error is written to
+	capacity int
 }
 
 // LoggedError represents an error with metadata
@@ -262,11 +277,23 @@ type LoggedError struct {
 	UserAgent string
 }
 
-// NewErrorLogger creates a new error logger
+// DefaultErrorLogCapacity is how many errors an ErrorLogger keeps by default
+const DefaultErrorLogCapacity = 1000
+
+// NewErrorLogger creates a new error logger keeping the last
+// DefaultErrorLogCapacity errors
 func NewErrorLogger() *ErrorLogger {
+	return NewErrorLoggerWithCapacity(DefaultErrorLogCapacity)
+}
+
+// NewErrorLoggerWithCapacity creates an error logger keeping the last
+// capacity errors (at least one)
+func NewErrorLoggerWithCapacity(capacity int) *ErrorLogger {
+	if capacity < 1 {
+		capacity = 1
+	}
 	return &ErrorLogger{
-		errors:  make([]LoggedError, 0, 1000),
-		maxLogs: 1000, // Keep last 1000 error logs
+		capacity: capacity,
 	}
 }
 
@@ -284,13 +311,13 @@ func (el *ErrorLogger) LogError(err *ServerError, r *http.Request) {
 		UserAgent: r.UserAgent(),
 	}
 
-	el.errors = append(el.errors, loggedErr)
-
-	// Prevent unbounded growth
-	if len(el.errors) > el.maxLogs {
-		// Keep the last el.maxLogs entries
-		el.errors = el.errors[len(el.errors)-el.maxLogs:]
+	// Overwrite the oldest entry once the buffer is full
+	if len(el.errors) < el.capacity {
+		el.errors = append(el.errors, loggedErr)
+	} else {
+		el.errors[el.next] = loggedErr
 	}
+	el.next = (el.next + 1) % el.capacity
 
 	// Log to stdout/stderr
 	if err.Type == ErrorTypeServerError || err.Type == ErrorTypeConfiguration {
@@ -319,11 +346,20 @@ func (el *ErrorLogger) GetRecentErrors(limit int) []LoggedError {
 	el.mu.Lock()
 	defer el.mu.Unlock()
 
-	if len(el.errors) <= limit {
-		return append([]LoggedError{}, el.errors...)
+	if limit <= 0 {
+		return []LoggedError{}
+	}
+	if limit > len(el.errors) {
+		limit = len(el.errors)
 	}
 
-	return append([]LoggedError{}, el.errors[len(el.errors)-limit:]...)
+	// Copy the newest limit entries, oldest first
+	recent := make([]LoggedError, limit)
+	start := el.next - limit + len(el.errors)
+	for i := range recent {
+		recent[i] = el.errors[(start+i)%len(el.errors)]
+	}
+	return recent
 }
 
 // RetryableError wraps an error that can be retried
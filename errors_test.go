@@ -0,0 +1,57 @@
+package gostc
+
+import (
+	"fmt"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestErrorLoggerRingBuffer(t *testing.T) {
+	const capacity, total = 1000, 5000
+
+	el := NewErrorLoggerWithCapacity(capacity)
+	for i := 0; i < total; i++ {
+		req := httptest.NewRequest("GET", fmt.Sprintf("/missing-%d", i), nil)
+		el.LogError(NewServerError(ErrorTypeNotFound, "test", nil), req)
+	}
+
+	if len(el.errors) != capacity {
+		t.Fatalf("Expected %d stored errors, got %d", capacity, len(el.errors))
+	}
+
+	all := el.GetRecentErrors(total)
+	if len(all) != capacity {
+		t.Fatalf("Expected %d recent errors, got %d", capacity, len(all))
+	}
+	for i, le := range all {
+		if want := fmt.Sprintf("/missing-%d", total-capacity+i); le.Path != want {
+			t.Fatalf("Entry %d: expected %s, got %s", i, want, le.Path)
+		}
+	}
+
+	newest := el.GetRecentErrors(3)
+	if len(newest) != 3 || newest[0].Path != "/missing-4997" || newest[2].Path != "/missing-4999" {
+		t.Errorf("Expected the three newest errors oldest first, got %v", []string{newest[0].Path, newest[1].Path, newest[2].Path})
+	}
+
+	if got := el.GetRecentErrors(0); len(got) != 0 {
+		t.Errorf("Expected no errors for limit 0, got %d", len(got))
+	}
+}
+
+func TestErrorLogCapacityOption(t *testing.T) {
+	server, err := New(WithRoot(t.TempDir()), WithWatcher(false), WithErrorLogCapacity(2))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 5; i++ {
+		req := httptest.NewRequest("GET", fmt.Sprintf("/missing-%d", i), nil)
+		server.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	recent := server.RecentErrors(10)
+	if len(recent) != 2 || recent[0].Path != "/missing-3" || recent[1].Path != "/missing-4" {
+		t.Errorf("Expected the two newest errors, got %d", len(recent))
+	}
+}
@@ -0,0 +1,38 @@
+package gostc
+
+import (
+	"os"
+	"strconv"
+	"strings"
+)
+
+// modTimeETag derives a strong ETag from a file's modification time and size
+func modTimeETag(info os.FileInfo) string {
+	return `"` + strconv.FormatInt(info.ModTime().UnixNano(), 16) + "-" + strconv.FormatInt(info.Size(), 16) + `"`
+}
+
+// weakETag marks etag weak. Encoded responses use it: their bytes differ
+// from the identity body the strong validator describes, but they are
+// semantically the same representation.
+func weakETag(etag string) string {
+	if etag == "" || strings.HasPrefix(etag, "W/") {
+		return etag
+	}
+	return "W/" + etag
+}
+
+// etagMatches reports whether an If-None-Match header lists etag, using the
+// weak comparison of RFC 7232 2.3.2 so validators from any encoding match
+func etagMatches(header, etag string) bool {
+	if strings.TrimSpace(header) == "*" {
+		return true
+	}
+
+	opaque := strings.TrimPrefix(etag, "W/")
+	for _, candidate := range strings.Split(header, ",") {
+		if strings.TrimPrefix(strings.TrimSpace(candidate), "W/") == opaque {
+			return true
+		}
+	}
+	return false
+}
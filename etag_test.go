@@ -0,0 +1,98 @@
+package gostc
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestETagConsistentAcrossEncodings(t *testing.T) {
+	tmpDir := t.TempDir()
+	os.WriteFile(filepath.Join(tmpDir, "app.js"), []byte(strings.Repeat("console.log('etag');\n", 100)), 0644)
+
+	server, err := New(WithRoot(tmpDir), WithWatcher(false), WithCompression(Gzip))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	get := func(acceptEncoding, ifNoneMatch string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/app.js", nil)
+		req.Header.Set("Accept-Encoding", acceptEncoding)
+		if ifNoneMatch != "" {
+			req.Header.Set("If-None-Match", ifNoneMatch)
+		}
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, req)
+		return w
+	}
+
+	identity := get("", "")
+	gzipped := get("gzip", "")
+	if gzipped.Header().Get("Content-Encoding") != "gzip" {
+		t.Fatal("Expected a gzip response")
+	}
+
+	strong := identity.Header().Get("ETag")
+	weak := gzipped.Header().Get("ETag")
+	if strings.HasPrefix(strong, "W/") {
+		t.Errorf("Expected a strong ETag for identity, got %s", strong)
+	}
+	if weak != "W/"+strong {
+		t.Errorf("Expected the gzip ETag to be the weak form of %s, got %s", strong, weak)
+	}
+
+	// Either validator revalidates either encoding
+	for _, tt := range []struct{ acceptEncoding, ifNoneMatch string }{
+		{"gzip", strong},
+		{"gzip", weak},
+		{"", weak},
+		{"", `"other", ` + strong},
+		{"gzip", "*"},
+	} {
+		if w := get(tt.acceptEncoding, tt.ifNoneMatch); w.Code != http.StatusNotModified {
+			t.Errorf("Accept-Encoding %q, If-None-Match %q: expected 304, got %d", tt.acceptEncoding, tt.ifNoneMatch, w.Code)
+		}
+	}
+	if w := get("gzip", `"other"`); w.Code != http.StatusOK {
+		t.Errorf("Expected 200 for a non-matching ETag, got %d", w.Code)
+	}
+}
+
+func TestETagModTime(t *testing.T) {
+	tmpDir := t.TempDir()
+	path := filepath.Join(tmpDir, "data.bin")
+	os.WriteFile(path, []byte("payload"), 0644)
+
+	server, err := New(WithRoot(tmpDir), WithWatcher(false), WithETagAlgorithm(ETagModTime))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w := httptest.NewRecorder()
+	server.ServeHTTP(w, httptest.NewRequest("GET", "/data.bin", nil))
+
+	info, _ := os.Stat(path)
+	if got := w.Header().Get("ETag"); got != modTimeETag(info) {
+		t.Errorf("Expected the mtime ETag %s, got %s", modTimeETag(info), got)
+	}
+
+	// Touching the file changes the validator even though the content doesn't
+	later := info.ModTime().Add(time.Second)
+	os.Chtimes(path, later, later)
+	info, _ = os.Stat(path)
+	server.InvalidateAll()
+
+	w = httptest.NewRecorder()
+	server.ServeHTTP(w, httptest.NewRequest("GET", "/data.bin", nil))
+	if got := w.Header().Get("ETag"); got != modTimeETag(info) {
+		t.Errorf("Expected the ETag to follow the new mtime, got %s", got)
+	}
+
+	if _, err := New(WithETagAlgorithm(ETagAlgorithm(9))); err == nil {
+		t.Error("Expected an unknown ETag algorithm to be rejected")
+	}
+}
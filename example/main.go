@@ -61,6 +61,8 @@ func main() {
 		opts = append(opts, gostc.WithTLS(*certFile, *keyFile))
 	}
 
+	opts = append(opts, gostc.WithAddr(*addr))
+
 	server, err := gostc.New(opts...)
 	if err != nil {
 		log.Fatalf("Failed to create server: %v", err)
@@ -70,7 +72,7 @@ func main() {
 		log.Fatalf("Failed to start server: %v", err)
 	}
 
-	log.Printf("Server started on %s", *addr)
+	log.Printf("Server started on %s", server.Addr())
 	log.Printf("Serving files from: %s", *root)
 	log.Printf("Compression: %s", *compress)
 	log.Printf("Cache size: %d bytes, TTL: %v", *cacheSize, *cacheTTL)
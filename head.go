@@ -0,0 +1,49 @@
+package gostc
+
+import (
+	"os"
+	"time"
+
+	lru "github.com/hashicorp/golang-lru/v2"
+)
+
+// headEntryCacheSize bounds the number of remembered HEAD responses
+const headEntryCacheSize = 1024
+
+// headEntry is a bodiless copy of a loaded entry, kept so a HEAD for a file
+// whose body isn't in the cache (too large, or evicted) can report the
+// exact Content-Length without reading and compressing the file again
+type headEntry struct {
+	entry   *CacheEntry // Data is nil; Size is the length a GET sends
+	modTime time.Time   // file state the entry was built from
+	size    int64
+}
+
+// newHeadEntries returns the HEAD metadata cache, emptied on every
+// invalidation since rewritten HTML and CSS change with other files
+func newHeadEntries(invalidator Invalidator) *lru.Cache[CacheKey, headEntry] {
+	entries, _ := lru.New[CacheKey, headEntry](headEntryCacheSize)
+	invalidator.RegisterCallback(func(string) {
+		entries.Purge()
+	})
+	return entries
+}
+
+// rememberHead records entry's headers and length for later HEAD requests.
+// key must be the one entry was cached under, so a transient identity
+// fallback is never described as the compressed variant.
+func (s *Server) rememberHead(key CacheKey, info os.FileInfo, entry *CacheEntry) {
+	meta := *entry
+	meta.Data = nil
+	meta.Size = int64(len(entry.Data))
+	s.headEntries.Add(key, headEntry{entry: &meta, modTime: info.ModTime(), size: info.Size()})
+}
+
+// headFor returns the remembered HEAD entry for key, if the file is unchanged
+func (s *Server) headFor(key CacheKey, info os.FileInfo) (*CacheEntry, bool) {
+	head, ok := s.headEntries.Get(key)
+	if !ok || !head.modTime.Equal(info.ModTime()) || head.size != info.Size() {
+		return nil, false
+	}
+	return head.entry, true
+}
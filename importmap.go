@@ -0,0 +1,51 @@
+package gostc
+
+import (
+	"encoding/json"
+	"net/http"
+	"path/filepath"
+	"strings"
+)
+
+// importMap is the JSON shape of an import map document
+type importMap struct {
+	Imports map[string]string `json:"imports"`
+}
+
+// versionedModules returns the original -> versioned URL of every
+// registered JavaScript module
+func (avm *AssetVersionManager) versionedModules() map[string]string {
+	avm.mu.RLock()
+	defer avm.mu.RUnlock()
+
+	modules := make(map[string]string)
+	for original, versioned := range avm.versionedPaths {
+		switch strings.ToLower(filepath.Ext(original)) {
+		case ".js", ".mjs":
+			modules[original] = versioned
+		}
+	}
+	return modules
+}
+
+// ImportMap returns an import map ({"imports": {...}}) from each versioned
+// .js and .mjs asset's original URL to its versioned URL, so pages can
+// import stable specifiers and still get cache-busted files
+func (s *Server) ImportMap() string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return string(s.importMap())
+}
+
+func (s *Server) importMap() []byte {
+	data, _ := json.Marshal(importMap{Imports: s.versionManager.versionedModules()})
+	return data
+}
+
+// serveImportMap answers the import map endpoint
+func (s *Server) serveImportMap(w http.ResponseWriter, r *http.Request) {
+	// Revalidate every time, since the map changes whenever an asset does
+	w.Header().Set("Cache-Control", "no-cache")
+	s.writeGenerated(w, r, http.StatusOK, "application/importmap+json", s.importMap())
+}
@@ -0,0 +1,68 @@
+package gostc
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestImportMap(t *testing.T) {
+	tmpDir := t.TempDir()
+	os.MkdirAll(filepath.Join(tmpDir, "static"), 0755)
+	os.WriteFile(filepath.Join(tmpDir, "static", "app.js"), []byte("import './util.mjs';"), 0644)
+	os.WriteFile(filepath.Join(tmpDir, "static", "util.mjs"), []byte("export const x = 1;"), 0644)
+	os.WriteFile(filepath.Join(tmpDir, "static", "style.css"), []byte("body { margin: 0; }"), 0644)
+
+	server, err := New(
+		WithRoot(tmpDir),
+		WithWatcher(false),
+		WithVersioning(true),
+		WithStaticPrefixes("/static/"),
+		WithImportMapEndpoint("/importmap.json"),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var fromMethod importMap
+	if err := json.Unmarshal([]byte(server.ImportMap()), &fromMethod); err != nil {
+		t.Fatalf("ImportMap is not valid JSON: %v", err)
+	}
+
+	req := httptest.NewRequest("GET", "/importmap.json", nil)
+	w := httptest.NewRecorder()
+	server.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d", w.Code)
+	}
+	if ct := w.Header().Get("Content-Type"); ct != "application/importmap+json" {
+		t.Errorf("Expected import map content type, got %q", ct)
+	}
+
+	var served importMap
+	if err := json.Unmarshal(w.Body.Bytes(), &served); err != nil {
+		t.Fatalf("Endpoint did not return valid JSON: %v", err)
+	}
+
+	for _, m := range []importMap{fromMethod, served} {
+		if len(m.Imports) != 2 {
+			t.Errorf("Expected 2 modules, got %v", m.Imports)
+		}
+		for _, original := range []string{"/static/app.js", "/static/util.mjs"} {
+			want, ok := server.versionManager.GetVersionedPath(original)
+			if !ok {
+				t.Fatalf("%s was not versioned", original)
+			}
+			if got := m.Imports[original]; got != want {
+				t.Errorf("Import map maps %s to %q, want %q", original, got, want)
+			}
+		}
+		if _, ok := m.Imports["/static/style.css"]; ok {
+			t.Error("Stylesheets should not appear in the import map")
+		}
+	}
+}
@@ -16,6 +16,47 @@ type Invalidator interface {
 	Stop() error
 	InvalidatePath(path string)
 	InvalidateAll()
+	RegisterCallback(fn func(path string))
+}
+
+// InvalidateAllPath is passed to invalidation callbacks by InvalidateAll
+const InvalidateAllPath = "*"
+
+// invalidateAllVariants drops every cached encoding of path, versioned or not
+func invalidateAllVariants(cache Cache, path string) {
+	for _, isVersioned := range []bool{false, true} {
+		for _, compression := range allCompressionTypes() {
+			cache.Delete(CacheKey{Path: path, Compression: compression, IsVersioned: isVersioned})
+		}
+	}
+}
+
+// invalidationCallbacks holds the callbacks registered on an invalidator.
+// fire runs them without holding any invalidator lock, so a callback may
+// safely call back into the invalidator or the server.
+type invalidationCallbacks struct {
+	mu  sync.Mutex
+	fns []func(path string)
+}
+
+// RegisterCallback adds fn to be called with the URL path of every
+// invalidation, or InvalidateAllPath when the whole cache is cleared
+func (ic *invalidationCallbacks) RegisterCallback(fn func(path string)) {
+	ic.mu.Lock()
+	defer ic.mu.Unlock()
+
+	ic.fns = append(ic.fns, fn)
+}
+
+func (ic *invalidationCallbacks) fire(path string) {
+	ic.mu.Lock()
+	fns := make([]func(path string), len(ic.fns))
+	copy(fns, ic.fns)
+	ic.mu.Unlock()
+
+	for _, fn := range fns {
+		fn(path)
+	}
 }
 
 type FileWatcher struct {
@@ -26,6 +67,15 @@ type FileWatcher struct {
 	stopChan       chan struct{}
 	compression    *CompressionManager
 	versionManager *AssetVersionManager
+	mounts         []Mount  // extra roots served under URL prefixes
+	ignore         []string // directory globs watchDir skips
+	invalidationCallbacks
+
+	// debounce coalesces events for a path arriving within this window
+	// into one invalidation (0 = invalidate on every event)
+	debounce  time.Duration
+	pending   map[string]*time.Timer
+	pendingMu sync.Mutex
 }
 
 func NewFileWatcher(root string, cache Cache, compression *CompressionManager) (*FileWatcher, error) {
@@ -41,6 +91,7 @@ func NewFileWatcher(root string, cache Cache, compression *CompressionManager) (
 		stopChan:       make(chan struct{}),
 		compression:    compression,
 		versionManager: nil, // Will be set by server if versioning is enabled
+		pending:        make(map[string]*time.Timer),
 	}
 
 	return fw, nil
@@ -59,6 +110,7 @@ func NewVersionedFileWatcher(root string, cache Cache, compression *CompressionM
 		stopChan:       make(chan struct{}),
 		compression:    compression,
 		versionManager: versionManager,
+		pending:        make(map[string]*time.Timer),
 	}
 
 	return fw, nil
@@ -69,23 +121,121 @@ func (fw *FileWatcher) Start() error {
 		return err
 	}
 
+	for _, m := range fw.mounts {
+		if err := fw.watchDir(m.Root); err != nil {
+			return err
+		}
+	}
+
 	go fw.watch()
 	return nil
 }
 
 func (fw *FileWatcher) Stop() error {
 	close(fw.stopChan)
+
+	fw.pendingMu.Lock()
+	for path, timer := range fw.pending {
+		timer.Stop()
+		delete(fw.pending, path)
+	}
+	fw.pendingMu.Unlock()
+
 	return fw.watcher.Close()
 }
 
+// SetMounts makes the watcher also watch each mount's root, reporting its
+// files under the mount's URL prefix. Call it before Start.
+func (fw *FileWatcher) SetMounts(mounts []Mount) {
+	fw.mounts = append([]Mount(nil), mounts...)
+}
+
+// SetIgnore sets the directory patterns watchDir skips, see
+// Config.WatcherIgnore. Call it before Start.
+func (fw *FileWatcher) SetIgnore(patterns []string) {
+	fw.ignore = append([]string(nil), patterns...)
+}
+
+// isIgnored reports whether dir matches an ignore pattern. Watched roots
+// are never ignored.
+func (fw *FileWatcher) isIgnored(dir string) bool {
+	if len(fw.ignore) == 0 {
+		return false
+	}
+
+	root, _ := fw.rootFor(dir)
+	rel, err := filepath.Rel(root, dir)
+	if err != nil || rel == "." {
+		return false
+	}
+	rel = filepath.ToSlash(rel)
+	name := filepath.Base(dir)
+
+	for _, pattern := range fw.ignore {
+		target := name
+		if strings.Contains(pattern, "/") {
+			target = rel
+		}
+		if ok, _ := filepath.Match(pattern, target); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// SetDebounce sets the window in which events for the same path are
+// coalesced into a single invalidation
+func (fw *FileWatcher) SetDebounce(d time.Duration) {
+	fw.pendingMu.Lock()
+	defer fw.pendingMu.Unlock()
+
+	fw.debounce = d
+}
+
+// scheduleInvalidation invalidates path once no further event for it has
+// arrived within the debounce window. Each path has its own timer, so
+// edits to different files don't delay each other.
+func (fw *FileWatcher) scheduleInvalidation(path string) {
+	fw.pendingMu.Lock()
+
+	if fw.debounce <= 0 {
+		fw.pendingMu.Unlock()
+		fw.InvalidatePath(path)
+		return
+	}
+
+	if timer, ok := fw.pending[path]; ok {
+		timer.Reset(fw.debounce)
+	} else {
+		fw.pending[path] = time.AfterFunc(fw.debounce, func() {
+			fw.pendingMu.Lock()
+			delete(fw.pending, path)
+			fw.pendingMu.Unlock()
+
+			fw.InvalidatePath(path)
+		})
+	}
+
+	fw.pendingMu.Unlock()
+}
+
 func (fw *FileWatcher) InvalidatePath(path string) {
+	if relPath, ok := fw.invalidatePath(path); ok {
+		fw.fire(relPath)
+	}
+}
+
+// invalidatePath drops the cache entries for the file at path and returns
+// its URL path
+func (fw *FileWatcher) invalidatePath(path string) (string, bool) {
 	fw.mu.Lock()
 	defer fw.mu.Unlock()
 
-	relPath, err := filepath.Rel(fw.root, path)
+	root, mountPrefix := fw.rootFor(path)
+	relPath, err := filepath.Rel(root, path)
 	if err != nil {
 		log.Printf("Error calculating relative path for %s: %v", path, err)
-		return
+		return "", false
 	}
 
 	// Normalize path to use forward slashes
@@ -93,22 +243,25 @@ func (fw *FileWatcher) InvalidatePath(path string) {
 	if !strings.HasPrefix(relPath, "/") {
 		relPath = "/" + relPath
 	}
+	relPath = mountPrefix + relPath
 
-	// Invalidate all cache entries for this path (both versioned and non-versioned)
-	fw.cache.Delete(CacheKey{Path: relPath, Compression: NoCompression, IsVersioned: false})
-	fw.cache.Delete(CacheKey{Path: relPath, Compression: Gzip, IsVersioned: false})
-	fw.cache.Delete(CacheKey{Path: relPath, Compression: Brotli, IsVersioned: false})
-	fw.cache.Delete(CacheKey{Path: relPath, Compression: NoCompression, IsVersioned: true})
-	fw.cache.Delete(CacheKey{Path: relPath, Compression: Gzip, IsVersioned: true})
-	fw.cache.Delete(CacheKey{Path: relPath, Compression: Brotli, IsVersioned: true})
+	// Files under root that a mount shadows are never served
+	if m, ok := findMount(fw.mounts, relPath); ok && m.Prefix != mountPrefix {
+		return "", false
+	}
+
+	invalidateAllVariants(fw.cache, relPath)
+
+	// The parent's listing shows this entry's name, size and mtime
+	invalidateListing(fw.cache, filepath.ToSlash(filepath.Dir(relPath)))
 
 	// If versioning is enabled, update the asset version with retry
 	if fw.versionManager != nil && fw.versionManager.shouldVersionFile(relPath) {
-		fullPath := filepath.Join(fw.root, strings.TrimPrefix(relPath, "/"))
+		fullPath := filepath.Join(root, strings.TrimPrefix(relPath, mountPrefix+"/"))
 
 		// Try to read file with retry logic
 		err := RetryOperation(func() error {
-			content, err := os.ReadFile(fullPath)
+			content, err := fw.versionManager.readFile(fullPath)
 			if err != nil {
 				if os.IsNotExist(err) {
 					// File was deleted, remove from version manager
@@ -125,10 +278,32 @@ func (fw *FileWatcher) InvalidatePath(path string) {
 			log.Printf("Failed to update version for %s after retries: %v", relPath, err)
 		}
 	}
+
+	return relPath, true
+}
+
+// rootFor returns the watched root containing path and the URL prefix its
+// files are served under. The deepest containing root wins, so a mount
+// nested inside Root is attributed to the mount.
+func (fw *FileWatcher) rootFor(path string) (root, mountPrefix string) {
+	root = fw.root
+	depth := -1
+	if isWithin(path, fw.root) {
+		depth = len(filepath.Clean(fw.root))
+	}
+
+	for _, m := range fw.mounts {
+		mountRoot := filepath.Clean(m.Root)
+		if isWithin(path, mountRoot) && len(mountRoot) > depth {
+			root, mountPrefix, depth = mountRoot, m.Prefix, len(mountRoot)
+		}
+	}
+	return root, mountPrefix
 }
 
 func (fw *FileWatcher) InvalidateAll() {
 	fw.cache.Clear()
+	fw.fire(InvalidateAllPath)
 }
 
 func (fw *FileWatcher) watch() {
@@ -144,7 +319,7 @@ func (fw *FileWatcher) watch() {
 				event.Op&fsnotify.Remove == fsnotify.Remove ||
 				event.Op&fsnotify.Rename == fsnotify.Rename {
 
-				fw.InvalidatePath(event.Name)
+				fw.scheduleInvalidation(event.Name)
 
 				if event.Op&fsnotify.Create == fsnotify.Create {
 					// Check if it's a directory with retry
@@ -187,6 +362,10 @@ func (fw *FileWatcher) watchDir(dir string) error {
 		}
 
 		if info.IsDir() {
+			if fw.isIgnored(path) {
+				return filepath.SkipDir
+			}
+
 			// Add directory to watcher with retry
 			retryErr := RetryOperation(func() error {
 				return fw.watcher.Add(path)
@@ -206,6 +385,7 @@ type TTLInvalidator struct {
 	interval time.Duration
 	stopChan chan struct{}
 	mu       sync.RWMutex
+	invalidationCallbacks
 }
 
 func NewTTLInvalidator(cache Cache, interval time.Duration) *TTLInvalidator {
@@ -227,16 +407,13 @@ func (ti *TTLInvalidator) Stop() error {
 }
 
 func (ti *TTLInvalidator) InvalidatePath(path string) {
-	ti.cache.Delete(CacheKey{Path: path, Compression: NoCompression, IsVersioned: false})
-	ti.cache.Delete(CacheKey{Path: path, Compression: Gzip, IsVersioned: false})
-	ti.cache.Delete(CacheKey{Path: path, Compression: Brotli, IsVersioned: false})
-	ti.cache.Delete(CacheKey{Path: path, Compression: NoCompression, IsVersioned: true})
-	ti.cache.Delete(CacheKey{Path: path, Compression: Gzip, IsVersioned: true})
-	ti.cache.Delete(CacheKey{Path: path, Compression: Brotli, IsVersioned: true})
+	invalidateAllVariants(ti.cache, path)
+	ti.fire(path)
 }
 
 func (ti *TTLInvalidator) InvalidateAll() {
 	ti.cache.Clear()
+	ti.fire(InvalidateAllPath)
 }
 
 func (ti *TTLInvalidator) run() {
@@ -307,6 +484,17 @@ func (ci *CompositeInvalidator) InvalidateAll() {
 	}
 }
 
+// RegisterCallback registers fn with every child invalidator, so fn runs
+// once per child for each invalidation
+func (ci *CompositeInvalidator) RegisterCallback(fn func(path string)) {
+	ci.mu.RLock()
+	defer ci.mu.RUnlock()
+
+	for _, inv := range ci.invalidators {
+		inv.RegisterCallback(fn)
+	}
+}
+
 func (ci *CompositeInvalidator) Add(invalidator Invalidator) {
 	ci.mu.Lock()
 	defer ci.mu.Unlock()
@@ -317,6 +505,7 @@ func (ci *CompositeInvalidator) Add(invalidator Invalidator) {
 type ManualInvalidator struct {
 	cache Cache
 	mu    sync.RWMutex
+	invalidationCallbacks
 }
 
 func NewManualInvalidator(cache Cache) *ManualInvalidator {
@@ -335,19 +524,16 @@ func (mi *ManualInvalidator) Stop() error {
 
 func (mi *ManualInvalidator) InvalidatePath(path string) {
 	mi.mu.Lock()
-	defer mi.mu.Unlock()
+	invalidateAllVariants(mi.cache, path)
+	mi.mu.Unlock()
 
-	mi.cache.Delete(CacheKey{Path: path, Compression: NoCompression, IsVersioned: false})
-	mi.cache.Delete(CacheKey{Path: path, Compression: Gzip, IsVersioned: false})
-	mi.cache.Delete(CacheKey{Path: path, Compression: Brotli, IsVersioned: false})
-	mi.cache.Delete(CacheKey{Path: path, Compression: NoCompression, IsVersioned: true})
-	mi.cache.Delete(CacheKey{Path: path, Compression: Gzip, IsVersioned: true})
-	mi.cache.Delete(CacheKey{Path: path, Compression: Brotli, IsVersioned: true})
+	mi.fire(path)
 }
 
 func (mi *ManualInvalidator) InvalidateAll() {
 	mi.mu.Lock()
-	defer mi.mu.Unlock()
-
 	mi.cache.Clear()
+	mi.mu.Unlock()
+
+	mi.fire(InvalidateAllPath)
 }
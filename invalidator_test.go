@@ -0,0 +1,259 @@
+package gostc
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestOnInvalidateWatcher(t *testing.T) {
+	tmpDir := t.TempDir()
+	os.MkdirAll(filepath.Join(tmpDir, "css"), 0755)
+	stylePath := filepath.Join(tmpDir, "css", "style.css")
+	os.WriteFile(stylePath, []byte("a{}"), 0644)
+
+	server, err := New(WithRoot(tmpDir))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	paths := make(chan string, 16)
+	server.OnInvalidate(func(path string) {
+		// Calling back into the server must not deadlock
+		server.CacheStats()
+		paths <- path
+	})
+
+	if err := server.invalidator.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer server.invalidator.Stop()
+
+	os.WriteFile(stylePath, []byte("b{}"), 0644)
+
+	timeout := time.After(2 * time.Second)
+	for {
+		select {
+		case path := <-paths:
+			if path == "/css/style.css" {
+				return
+			}
+		case <-timeout:
+			t.Fatal("Expected the callback to fire with /css/style.css")
+		}
+	}
+}
+
+func TestOnInvalidateManual(t *testing.T) {
+	server, err := New(WithRoot(t.TempDir()), WithWatcher(false))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var paths []string
+	server.OnInvalidate(func(path string) { paths = append(paths, path) })
+
+	server.InvalidatePath("/app.js")
+	server.InvalidateAll()
+
+	// Callbacks are carried over to the rebuilt invalidator
+	if err := server.Reload(WithCacheTTL(time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	server.InvalidatePath("/index.html")
+
+	want := []string{"/app.js", InvalidateAllPath, "/index.html"}
+	if len(paths) != len(want) {
+		t.Fatalf("Expected callbacks %v, got %v", want, paths)
+	}
+	for i := range want {
+		if paths[i] != want[i] {
+			t.Errorf("Callback %d: expected %q, got %q", i, want[i], paths[i])
+		}
+	}
+}
+
+func TestWatcherDebounceCoalescesWrites(t *testing.T) {
+	tmpDir := t.TempDir()
+	os.MkdirAll(filepath.Join(tmpDir, "static"), 0755)
+	appPath := filepath.Join(tmpDir, "static", "app.js")
+	otherPath := filepath.Join(tmpDir, "static", "other.js")
+	os.WriteFile(appPath, []byte("let a = 0"), 0644)
+	os.WriteFile(otherPath, []byte("let b = 0"), 0644)
+
+	server, err := New(
+		WithRoot(tmpDir),
+		WithVersioning(true),
+		WithStaticPrefixes("/static/"),
+		WithWatcherDebounce(150*time.Millisecond),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var mu sync.Mutex
+	reads := map[string]int{}
+	server.versionManager.readFile = func(name string) ([]byte, error) {
+		mu.Lock()
+		reads[filepath.Base(name)]++
+		mu.Unlock()
+		return os.ReadFile(name)
+	}
+
+	if err := server.invalidator.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer server.invalidator.Stop()
+
+	for i := 1; i <= 3; i++ {
+		os.WriteFile(appPath, []byte(fmt.Sprintf("let a = %d", i)), 0644)
+		time.Sleep(10 * time.Millisecond)
+	}
+	os.WriteFile(otherPath, []byte("let b = 1"), 0644)
+
+	time.Sleep(500 * time.Millisecond)
+
+	mu.Lock()
+	defer mu.Unlock()
+	if reads["app.js"] != 1 {
+		t.Errorf("Expected app.js to be re-registered once, got %d", reads["app.js"])
+	}
+	if reads["other.js"] != 1 {
+		t.Errorf("Expected other.js to be re-registered once, got %d", reads["other.js"])
+	}
+}
+
+func TestInvalidatePathCoversNewEncodings(t *testing.T) {
+	// A hypothetical encoding added after Gzip and Brotli, e.g. zstd
+	zstd := Brotli << 1
+	saved := compressionTypes
+	compressionTypes = append(append([]CompressionType(nil), saved...), zstd)
+	defer func() { compressionTypes = saved }()
+
+	tmpDir := t.TempDir()
+	watcher, err := NewFileWatcher(tmpDir, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer watcher.Stop()
+
+	invalidators := map[string]func(cache Cache) func(){
+		"FileWatcher": func(cache Cache) func() {
+			watcher.cache = cache
+			return func() { watcher.InvalidatePath(filepath.Join(tmpDir, "app.js")) }
+		},
+		"TTLInvalidator": func(cache Cache) func() {
+			ti := NewTTLInvalidator(cache, time.Minute)
+			return func() { ti.InvalidatePath("/app.js") }
+		},
+		"ManualInvalidator": func(cache Cache) func() {
+			mi := NewManualInvalidator(cache)
+			return func() { mi.InvalidatePath("/app.js") }
+		},
+	}
+
+	for name, setup := range invalidators {
+		cache, err := NewLRUCache(1024*1024, time.Minute)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, isVersioned := range []bool{false, true} {
+			cache.Set(CacheKey{Path: "/app.js", Compression: zstd, IsVersioned: isVersioned}, &CacheEntry{Size: 1})
+		}
+
+		setup(cache)()
+
+		if keys := cache.Keys(); len(keys) != 0 {
+			t.Errorf("%s: Expected the new encoding's variants to be invalidated, still cached: %v", name, keys)
+		}
+		cache.Stop()
+	}
+}
+
+func TestWatcherIgnore(t *testing.T) {
+	tmpDir := t.TempDir()
+	for _, dir := range []string{"css", "node_modules/pkg", "build/cache"} {
+		os.MkdirAll(filepath.Join(tmpDir, dir), 0755)
+	}
+	stylePath := filepath.Join(tmpDir, "css", "style.css")
+	modulePath := filepath.Join(tmpDir, "node_modules", "pkg", "index.js")
+	cachePath := filepath.Join(tmpDir, "build", "cache", "chunk.js")
+	os.WriteFile(stylePath, []byte("a{}"), 0644)
+	os.WriteFile(modulePath, []byte("let v = 1"), 0644)
+	os.WriteFile(cachePath, []byte("let c = 1"), 0644)
+
+	server, err := New(
+		WithRoot(tmpDir),
+		WithCompression(NoCompression),
+		WithWatcherDebounce(10*time.Millisecond),
+		WithWatcherIgnore("build/cache"),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var mu sync.Mutex
+	var invalidated []string
+	styleChanged := make(chan struct{}, 1)
+	server.OnInvalidate(func(path string) {
+		mu.Lock()
+		invalidated = append(invalidated, path)
+		mu.Unlock()
+		if path == "/css/style.css" {
+			select {
+			case styleChanged <- struct{}{}:
+			default:
+			}
+		}
+	})
+
+	if err := server.invalidator.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer server.invalidator.Stop()
+
+	get := func(urlPath string) string {
+		rec := httptest.NewRecorder()
+		server.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, urlPath, nil))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("GET %s: expected 200, got %d", urlPath, rec.Code)
+		}
+		return rec.Body.String()
+	}
+
+	get("/node_modules/pkg/index.js")
+	get("/build/cache/chunk.js")
+
+	os.WriteFile(modulePath, []byte("let v = 2"), 0644)
+	os.WriteFile(cachePath, []byte("let c = 2"), 0644)
+	os.WriteFile(stylePath, []byte("b{}"), 0644)
+
+	select {
+	case <-styleChanged:
+	case <-time.After(2 * time.Second):
+		t.Fatal("Expected a change outside the ignored directories to invalidate")
+	}
+	time.Sleep(100 * time.Millisecond)
+
+	mu.Lock()
+	for _, path := range invalidated {
+		if strings.HasPrefix(path, "/node_modules/") || strings.HasPrefix(path, "/build/cache/") {
+			t.Errorf("Expected no invalidation inside ignored directories, got %s", path)
+		}
+	}
+	mu.Unlock()
+
+	if body := get("/node_modules/pkg/index.js"); body != "let v = 1" {
+		t.Errorf("Expected node_modules to stay cached, got %q", body)
+	}
+	if body := get("/build/cache/chunk.js"); body != "let c = 1" {
+		t.Errorf("Expected build/cache to stay cached, got %q", body)
+	}
+}
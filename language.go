@@ -0,0 +1,138 @@
+package gostc
+
+import (
+	"net/http"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// isLocalizableDocument reports whether urlPath may have per-language
+// variants. Only HTML pages are negotiated, which keeps the extra stats off
+// asset requests.
+func isLocalizableDocument(urlPath string) bool {
+	switch strings.ToLower(filepath.Ext(urlPath)) {
+	case ".html", ".htm":
+		return true
+	}
+	return false
+}
+
+// maxAcceptLanguageTags caps the tags tried per request. Each can cost two
+// stats, so a long header mustn't turn into unbounded filesystem work.
+const maxAcceptLanguageTags = 10
+
+// parseAcceptLanguage returns up to maxAcceptLanguageTags language tags in
+// header, lowercased and ordered by preference. Tags with q=0, the "*"
+// wildcard and anything that isn't a plausible language tag are dropped.
+func parseAcceptLanguage(header string) []string {
+	type weighted struct {
+		tag string
+		q   float64
+	}
+
+	var tags []weighted
+	for _, part := range strings.Split(header, ",") {
+		tag, params, _ := strings.Cut(part, ";")
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if !isLanguageTag(tag) {
+			continue
+		}
+
+		q := 1.0
+		for _, param := range strings.Split(params, ";") {
+			key, value, ok := strings.Cut(strings.TrimSpace(param), "=")
+			if !ok || !strings.EqualFold(strings.TrimSpace(key), "q") {
+				continue
+			}
+			if parsed, err := strconv.ParseFloat(strings.TrimSpace(value), 64); err == nil && parsed >= 0 && parsed <= 1 {
+				q = parsed
+			}
+		}
+		if q > 0 {
+			tags = append(tags, weighted{tag, q})
+		}
+	}
+
+	sort.SliceStable(tags, func(i, j int) bool { return tags[i].q > tags[j].q })
+	if len(tags) > maxAcceptLanguageTags {
+		tags = tags[:maxAcceptLanguageTags]
+	}
+
+	ordered := make([]string, len(tags))
+	for i, t := range tags {
+		ordered[i] = t.tag
+	}
+	return ordered
+}
+
+// isLanguageTag reports whether tag looks like a BCP 47 tag ("fr", "pt-br").
+// Tags end up in file names, so nothing else is let through.
+func isLanguageTag(tag string) bool {
+	if tag == "" || len(tag) > 35 || tag[0] == '-' || tag[len(tag)-1] == '-' {
+		return false
+	}
+	for i := 0; i < len(tag); i++ {
+		c := tag[i]
+		if !('a' <= c && c <= 'z' || '0' <= c && c <= '9' || c == '-') {
+			return false
+		}
+	}
+	return true
+}
+
+// localizableDocument returns the URL and file path of the page a request
+// for urlPath would serve, resolving a directory to its index file, or
+// ok=false when the page isn't negotiated. Only extensionless paths are
+// checked for a directory, and one missing its slash is left to the
+// canonical redirect.
+func (s *Server) localizableDocument(r *http.Request, urlPath, fullPath string) (docURL, docPath string, ok bool) {
+	if isLocalizableDocument(urlPath) {
+		return urlPath, fullPath, true
+	}
+	if path.Ext(urlPath) != "" || s.config.CanonicalRedirects && !strings.HasSuffix(r.URL.Path, "/") {
+		return "", "", false
+	}
+
+	if info, err := s.cachedStat(fullPath); err != nil || !info.IsDir() {
+		return "", "", false
+	}
+	name, _, found := s.findIndexFile(fullPath)
+	if !found || !isLocalizableDocument(name) {
+		return "", "", false
+	}
+	return path.Join(urlPath, name), filepath.Join(fullPath, name), true
+}
+
+// languageVariantPath names the variant of path in lang,
+// e.g. /docs/index.html -> /docs/index.fr.html
+func languageVariantPath(path, lang string) string {
+	ext := filepath.Ext(path)
+	return strings.TrimSuffix(path, ext) + "." + lang + ext
+}
+
+// resolveLanguageVariant picks the most preferred language in the request's
+// Accept-Language with a variant on disk, trying a regional tag ("fr-fr")
+// before its primary language ("fr"). It returns the variant's URL path,
+// filesystem path and language, or ok=false to serve the original.
+func (s *Server) resolveLanguageVariant(r *http.Request, urlPath, fullPath string) (variantURL, variantPath, lang string, ok bool) {
+	tried := make(map[string]bool)
+	for _, tag := range parseAcceptLanguage(r.Header.Get("Accept-Language")) {
+		primary, _, _ := strings.Cut(tag, "-")
+		for _, candidate := range []string{tag, primary} {
+			if tried[candidate] {
+				continue
+			}
+			tried[candidate] = true
+
+			path := languageVariantPath(fullPath, candidate)
+			if info, err := s.cachedStat(path); err == nil && !info.IsDir() {
+				return languageVariantPath(urlPath, candidate), path, candidate, true
+			}
+		}
+	}
+
+	return "", "", "", false
+}
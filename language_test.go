@@ -0,0 +1,171 @@
+package gostc
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+func TestAcceptLanguageVariants(t *testing.T) {
+	tmpDir := t.TempDir()
+	os.WriteFile(filepath.Join(tmpDir, "index.html"), []byte("<p>default</p>"), 0644)
+	os.WriteFile(filepath.Join(tmpDir, "index.en.html"), []byte("<p>english</p>"), 0644)
+	os.WriteFile(filepath.Join(tmpDir, "index.fr.html"), []byte("<p>français</p>"), 0644)
+
+	server, err := New(
+		WithRoot(tmpDir),
+		WithContentNegotiation(true),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name           string
+		acceptLanguage string
+		expected       string
+		language       string
+	}{
+		{"RegionFallsBackToPrimary", "fr-FR", "<p>français</p>", "fr"},
+		{"PreferenceOrder", "de;q=0.9, en;q=0.5, fr;q=0.8", "<p>français</p>", "fr"},
+		{"UnsupportedLanguage", "ja", "<p>default</p>", ""},
+		{"NoHeader", "", "<p>default</p>", ""},
+		{"PathTraversalIgnored", "../../etc", "<p>default</p>", ""},
+	}
+
+	// The second pass is served from the cache
+	for pass := 0; pass < 2; pass++ {
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				req := httptest.NewRequest("GET", "/index.html", nil)
+				if tt.acceptLanguage != "" {
+					req.Header.Set("Accept-Language", tt.acceptLanguage)
+				}
+				w := httptest.NewRecorder()
+				server.ServeHTTP(w, req)
+
+				if w.Code != http.StatusOK {
+					t.Fatalf("Expected 200, got %d", w.Code)
+				}
+				if body := w.Body.String(); body != tt.expected {
+					t.Errorf("Expected %q, got %q", tt.expected, body)
+				}
+				if lang := w.Header().Get("Content-Language"); lang != tt.language {
+					t.Errorf("Expected Content-Language %q, got %q", tt.language, lang)
+				}
+				if vary := w.Header().Get("Vary"); vary != "Accept-Language" {
+					t.Errorf("Expected Vary: Accept-Language, got %q", vary)
+				}
+			})
+		}
+	}
+}
+
+func TestAcceptLanguageIndexFile(t *testing.T) {
+	tmpDir := t.TempDir()
+	os.MkdirAll(filepath.Join(tmpDir, "docs"), 0755)
+	os.WriteFile(filepath.Join(tmpDir, "docs", "index.html"), []byte("<p>default</p>"), 0644)
+	os.WriteFile(filepath.Join(tmpDir, "docs", "index.fr.html"), []byte("<p>français</p>"), 0644)
+
+	server, err := New(
+		WithRoot(tmpDir),
+		WithContentNegotiation(true),
+		WithCanonicalRedirects(true),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	get := func(urlPath, acceptLanguage string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", urlPath, nil)
+		req.Header.Set("Accept-Language", acceptLanguage)
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, req)
+		return w
+	}
+
+	// The second pass is served from the cache
+	for pass := 0; pass < 2; pass++ {
+		for _, tt := range []struct {
+			acceptLanguage string
+			expected       string
+			language       string
+		}{
+			{"fr-FR", "<p>français</p>", "fr"},
+			{"ja", "<p>default</p>", ""},
+		} {
+			w := get("/docs/", tt.acceptLanguage)
+			if w.Code != http.StatusOK {
+				t.Fatalf("%s: expected 200, got %d", tt.acceptLanguage, w.Code)
+			}
+			if body := w.Body.String(); body != tt.expected {
+				t.Errorf("%s: expected %q, got %q", tt.acceptLanguage, tt.expected, body)
+			}
+			if lang := w.Header().Get("Content-Language"); lang != tt.language {
+				t.Errorf("%s: expected Content-Language %q, got %q", tt.acceptLanguage, tt.language, lang)
+			}
+			if vary := w.Header().Get("Vary"); !strings.Contains(vary, "Accept-Language") {
+				t.Errorf("%s: expected Vary to include Accept-Language, got %q", tt.acceptLanguage, vary)
+			}
+		}
+	}
+
+	// The slashless directory is still redirected before negotiation
+	if w := get("/docs", "fr"); w.Code != http.StatusMovedPermanently {
+		t.Errorf("Expected a redirect to /docs/, got %d", w.Code)
+	}
+}
+
+func TestAcceptLanguageLongHeader(t *testing.T) {
+	tmpDir := t.TempDir()
+	os.WriteFile(filepath.Join(tmpDir, "page.html"), []byte("<p>default</p>"), 0644)
+
+	server, err := New(
+		WithRoot(tmpDir),
+		WithContentNegotiation(true),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var stats atomic.Int64
+	server.stat = func(name string) (os.FileInfo, error) {
+		stats.Add(1)
+		return os.Stat(name)
+	}
+
+	tags := make([]string, 200)
+	for i := range tags {
+		tags[i] = fmt.Sprintf("x%d-yy", i)
+	}
+	if got := parseAcceptLanguage(strings.Join(tags, ", ")); len(got) != maxAcceptLanguageTags {
+		t.Errorf("Expected %d tags, got %d", maxAcceptLanguageTags, len(got))
+	}
+
+	req := httptest.NewRequest("GET", "/page.html", nil)
+	req.Header.Set("Accept-Language", strings.Join(tags, ", "))
+	w := httptest.NewRecorder()
+	server.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d", w.Code)
+	}
+	// Two candidates per tag, plus the page itself
+	if n := stats.Load(); n > 2*maxAcceptLanguageTags+1 {
+		t.Errorf("Expected at most %d stats, got %d", 2*maxAcceptLanguageTags+1, n)
+	}
+}
+
+func TestParseAcceptLanguage(t *testing.T) {
+	got := parseAcceptLanguage("en-US;q=0.8, fr, *;q=0.5, de;q=0, pt-BR;q=0.8")
+	want := []string{"fr", "en-us", "pt-br"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected %v, got %v", want, got)
+	}
+}
@@ -0,0 +1,51 @@
+package gostc
+
+import (
+	"net"
+	"sync"
+	"sync/atomic"
+)
+
+// limitListener closes connections accepted while max connections are
+// already open, instead of queueing them like netutil.LimitListener
+type limitListener struct {
+	net.Listener
+	max    int64
+	active atomic.Int64
+}
+
+func newLimitListener(l net.Listener, max int) *limitListener {
+	return &limitListener{Listener: l, max: int64(max)}
+}
+
+func (l *limitListener) Accept() (net.Conn, error) {
+	for {
+		conn, err := l.Listener.Accept()
+		if err != nil {
+			return nil, err
+		}
+
+		if l.active.Add(1) > l.max {
+			l.active.Add(-1)
+			conn.Close()
+			continue
+		}
+
+		return &limitConn{Conn: conn, listener: l}, nil
+	}
+}
+
+// limitConn releases its slot in the listener when closed
+type limitConn struct {
+	net.Conn
+	listener  *limitListener
+	closeOnce sync.Once
+}
+
+func (c *limitConn) Close() error {
+	err := c.Conn.Close()
+	c.closeOnce.Do(func() {
+		c.listener.active.Add(-1)
+	})
+	return err
+}
@@ -0,0 +1,248 @@
+package gostc
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"golang.org/x/net/http2"
+)
+
+// getOverConn sends a keep-alive GET on conn and returns the status code
+func getOverConn(t *testing.T, conn net.Conn, reader *bufio.Reader) int {
+	t.Helper()
+	conn.SetDeadline(time.Now().Add(2 * time.Second))
+	if _, err := io.WriteString(conn, "GET /a.txt HTTP/1.1\r\nHost: test\r\n\r\n"); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+	resp, err := http.ReadResponse(reader, nil)
+	if err != nil {
+		t.Fatalf("ReadResponse failed: %v", err)
+	}
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+	return resp.StatusCode
+}
+
+func TestMaxConnectionsRejectsExcess(t *testing.T) {
+	tmpDir := t.TempDir()
+	os.WriteFile(filepath.Join(tmpDir, "a.txt"), []byte("a"), 0644)
+
+	server, err := New(
+		WithRoot(tmpDir),
+		WithWatcher(false),
+		WithMaxConnections(2),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go server.Serve(ln)
+	defer server.Stop()
+
+	addr := ln.Addr().String()
+	var conns []net.Conn
+	var readers []*bufio.Reader
+	for i := 0; i < 2; i++ {
+		conn, err := net.Dial("tcp", addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer conn.Close()
+		conns = append(conns, conn)
+		readers = append(readers, bufio.NewReader(conn))
+
+		if code := getOverConn(t, conn, readers[i]); code != http.StatusOK {
+			t.Fatalf("Connection %d: expected 200, got %d", i, code)
+		}
+	}
+
+	// A third connection is accepted by the kernel and then closed by the server
+	extra, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	extra.SetDeadline(time.Now().Add(2 * time.Second))
+	io.WriteString(extra, "GET /a.txt HTTP/1.1\r\nHost: test\r\n\r\n")
+	if _, err := http.ReadResponse(bufio.NewReader(extra), nil); err == nil {
+		t.Error("Expected the connection over the limit to be closed without a response")
+	}
+	extra.Close()
+
+	// Existing connections keep working
+	for i, conn := range conns {
+		if code := getOverConn(t, conn, readers[i]); code != http.StatusOK {
+			t.Errorf("Existing connection %d: expected 200, got %d", i, code)
+		}
+	}
+
+	// Closing a connection frees its slot
+	conns[0].Close()
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		conn, err := net.Dial("tcp", addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		conn.SetDeadline(time.Now().Add(time.Second))
+		io.WriteString(conn, "GET /a.txt HTTP/1.1\r\nHost: test\r\n\r\n")
+		resp, err := http.ReadResponse(bufio.NewReader(conn), nil)
+		conn.Close()
+		if err == nil {
+			resp.Body.Close()
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("Expected a new connection to be accepted after one was closed")
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+func TestWithAddr(t *testing.T) {
+	tmpDir := t.TempDir()
+	os.WriteFile(filepath.Join(tmpDir, "test.txt"), []byte("bound"), 0644)
+
+	server, err := New(WithRoot(tmpDir), WithAddr("127.0.0.1:0"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if server.Addr() != nil {
+		t.Errorf("Expected no address before Start, got %v", server.Addr())
+	}
+
+	if err := server.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer server.Stop()
+
+	addr, ok := server.Addr().(*net.TCPAddr)
+	if !ok {
+		t.Fatalf("Expected a TCP address after Start, got %v", server.Addr())
+	}
+	if addr.Port == 0 || addr.Port == 8080 {
+		t.Fatalf("Expected an ephemeral port, got %d", addr.Port)
+	}
+
+	resp, err := http.Get("http://" + addr.String() + "/test.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK || string(body) != "bound" {
+		t.Errorf("Expected 200 %q, got %d %q", "bound", resp.StatusCode, body)
+	}
+}
+
+func TestTLSConfigMinVersionAndALPN(t *testing.T) {
+	certFile, keyFile := writeTestCertificate(t, t.TempDir())
+
+	// TLS 1.3 rather than 1.2, since Go servers already refuse older
+	// versions by default and wouldn't show the config being applied
+	server, err := New(
+		WithRoot(t.TempDir()),
+		WithTLS(certFile, keyFile),
+		WithTLSConfig(&tls.Config{MinVersion: tls.VersionTLS13}),
+		WithHTTP2(false),
+		WithAddr("127.0.0.1:0"),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := server.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer server.Stop()
+
+	addr := server.Addr().String()
+
+	for _, version := range []uint16{tls.VersionTLS11, tls.VersionTLS12} {
+		conn, err := tls.Dial("tcp", addr, &tls.Config{
+			InsecureSkipVerify: true,
+			MinVersion:         tls.VersionTLS10,
+			MaxVersion:         version,
+		})
+		if err == nil {
+			conn.Close()
+			t.Errorf("Expected a %s handshake to be rejected", tls.VersionName(version))
+		}
+	}
+
+	// TLS 1.3 is accepted, and HTTP/2 isn't offered over ALPN
+	conn, err := tls.Dial("tcp", addr, &tls.Config{
+		InsecureSkipVerify: true,
+		NextProtos:         []string{"h2", "http/1.1"},
+	})
+	if err != nil {
+		t.Fatalf("Expected a TLS 1.3 handshake to succeed: %v", err)
+	}
+	defer conn.Close()
+
+	if proto := conn.ConnectionState().NegotiatedProtocol; proto != "http/1.1" {
+		t.Errorf("Expected http/1.1 with HTTP2 disabled, got %q", proto)
+	}
+}
+
+func TestH2C(t *testing.T) {
+	root := t.TempDir()
+	os.WriteFile(filepath.Join(root, "test.txt"), []byte("over h2c"), 0644)
+
+	// Speaks HTTP/2 with prior knowledge over plain TCP
+	h2cClient := &http.Client{Transport: &http2.Transport{
+		AllowHTTP: true,
+		DialTLSContext: func(ctx context.Context, network, addr string, _ *tls.Config) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, network, addr)
+		},
+	}}
+
+	for _, enabled := range []bool{true, false} {
+		server, err := New(WithRoot(root), WithHTTP2(enabled), WithAddr("127.0.0.1:0"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := server.Start(); err != nil {
+			t.Fatal(err)
+		}
+		url := "http://" + server.Addr().String() + "/test.txt"
+
+		resp, err := h2cClient.Get(url)
+		if enabled {
+			if err != nil {
+				t.Fatalf("Expected an h2c request to succeed: %v", err)
+			}
+			body, _ := io.ReadAll(resp.Body)
+			resp.Body.Close()
+			if resp.ProtoMajor != 2 || string(body) != "over h2c" {
+				t.Errorf("Expected %q over HTTP/2, got %q over %s", "over h2c", body, resp.Proto)
+			}
+		} else if err == nil {
+			resp.Body.Close()
+			t.Errorf("Expected h2c to be refused with HTTP2 disabled, got %s", resp.Proto)
+		}
+
+		resp, err = http.Get(url)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.ProtoMajor != 1 || resp.StatusCode != http.StatusOK {
+			t.Errorf("HTTP2=%v: Expected HTTP/1.1 clients to keep working, got %d over %s", enabled, resp.StatusCode, resp.Proto)
+		}
+
+		server.Stop()
+	}
+}
@@ -0,0 +1,117 @@
+package gostc
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// manifestFormat is bumped whenever the manifest layout changes
+const manifestFormat = 1
+
+// fileState identifies the version of a file that was hashed
+type fileState struct {
+	ModTime time.Time
+	Size    int64
+}
+
+// manifestAsset is one asset in a saved version manifest
+type manifestAsset struct {
+	Hash    string    `json:"hash"`
+	ModTime time.Time `json:"modTime"`
+	Size    int64     `json:"size"`
+}
+
+// versionManifest is the on-disk form of an AssetVersionManager's state.
+// Versioned paths are rebuilt from the hashes on load, so a changed
+// VersioningPattern or VersioningMode takes effect without re-hashing.
+type versionManifest struct {
+	Format     int                      `json:"format"`
+	Algorithm  HashAlgorithm            `json:"algorithm"`
+	HashLength int                      `json:"hashLength"`
+	Assets     map[string]manifestAsset `json:"assets"`
+}
+
+// SaveState writes the hashes and file mod times of the scanned assets to
+// path, so a later LoadState can skip re-hashing unchanged files
+func (avm *AssetVersionManager) SaveState(path string) error {
+	avm.mu.RLock()
+	manifest := versionManifest{
+		Format:     manifestFormat,
+		Algorithm:  avm.config.HashAlgorithm,
+		HashLength: avm.hashLength,
+		Assets:     make(map[string]manifestAsset, len(avm.fileStates)),
+	}
+	for originalPath, state := range avm.fileStates {
+		if hash, ok := avm.contentHashes[originalPath]; ok {
+			manifest.Assets[originalPath] = manifestAsset{Hash: hash, ModTime: state.ModTime, Size: state.Size}
+		}
+	}
+	avm.mu.RUnlock()
+
+	data, err := json.Marshal(manifest)
+	if err != nil {
+		return fmt.Errorf("failed to encode version manifest: %w", err)
+	}
+
+	// Write to a temporary file and rename so readers never see a partial file
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp*")
+	if err != nil {
+		return fmt.Errorf("failed to write version manifest: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write version manifest: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write version manifest: %w", err)
+	}
+
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("failed to write version manifest: %w", err)
+	}
+	return nil
+}
+
+// LoadState reads a manifest written by SaveState. The next ScanDirectory
+// reuses its hashes for files whose mod time and size are unchanged. A
+// manifest built with a different hash algorithm or length is ignored.
+func (avm *AssetVersionManager) LoadState(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	var manifest versionManifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return fmt.Errorf("invalid version manifest %s: %w", path, err)
+	}
+
+	if manifest.Format != manifestFormat ||
+		manifest.Algorithm != avm.config.HashAlgorithm ||
+		manifest.HashLength != avm.hashLength {
+		return nil
+	}
+
+	avm.mu.Lock()
+	avm.restored = manifest.Assets
+	avm.mu.Unlock()
+	return nil
+}
+
+// restoredHash returns the hash from a loaded manifest for originalPath if
+// the file still matches state
+func (avm *AssetVersionManager) restoredHash(originalPath string, state fileState) (string, bool) {
+	avm.mu.RLock()
+	defer avm.mu.RUnlock()
+
+	asset, ok := avm.restored[originalPath]
+	if !ok || asset.Size != state.Size || !asset.ModTime.Equal(state.ModTime) {
+		return "", false
+	}
+	return asset.Hash, true
+}
@@ -0,0 +1,137 @@
+package gostc
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestVersionManifestSkipsUnchangedFiles(t *testing.T) {
+	rootDir := t.TempDir()
+	os.MkdirAll(filepath.Join(rootDir, "static"), 0755)
+	files := map[string]string{
+		"/static/a.js":     "console.log('a');",
+		"/static/b.js":     "console.log('b');",
+		"/static/site.css": "body{}",
+	}
+	for name, content := range files {
+		os.WriteFile(filepath.Join(rootDir, filepath.FromSlash(name)), []byte(content), 0644)
+	}
+
+	config := &Config{
+		EnableVersioning:  true,
+		VersionHashLength: 16,
+		StaticPrefixes:    []string{"/static/"},
+	}
+	manifestPath := filepath.Join(t.TempDir(), "versions.json")
+
+	first := NewAssetVersionManager(config)
+	if err := first.ScanDirectory(rootDir); err != nil {
+		t.Fatal(err)
+	}
+	if err := first.SaveState(manifestPath); err != nil {
+		t.Fatalf("SaveState failed: %v", err)
+	}
+
+	// Touch b.js with new content and a new mod time
+	bPath := filepath.Join(rootDir, "static", "b.js")
+	os.WriteFile(bPath, []byte("console.log('b2');"), 0644)
+	later := time.Now().Add(time.Minute)
+	os.Chtimes(bPath, later, later)
+
+	second := NewAssetVersionManager(config)
+	var hashed []string
+	second.readFile = func(name string) ([]byte, error) {
+		hashed = append(hashed, name)
+		return os.ReadFile(name)
+	}
+	if err := second.LoadState(manifestPath); err != nil {
+		t.Fatalf("LoadState failed: %v", err)
+	}
+	if err := second.ScanDirectory(rootDir); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(hashed) != 1 || hashed[0] != bPath {
+		t.Errorf("Expected only b.js to be re-hashed, got %v", hashed)
+	}
+
+	for _, name := range []string{"/static/a.js", "/static/site.css"} {
+		before, _ := first.GetVersionedPath(name)
+		after, _ := second.GetVersionedPath(name)
+		if before == "" || before != after {
+			t.Errorf("%s: expected restored path %q, got %q", name, before, after)
+		}
+	}
+
+	before, _ := first.GetContentHash("/static/b.js")
+	after, _ := second.GetContentHash("/static/b.js")
+	if after == before || after != second.hashContent([]byte("console.log('b2');")) {
+		t.Errorf("Expected b.js to be re-hashed from its new content, got %s (was %s)", after, before)
+	}
+}
+
+func TestVersionManifestIgnoredForOtherAlgorithm(t *testing.T) {
+	rootDir := t.TempDir()
+	os.MkdirAll(filepath.Join(rootDir, "static"), 0755)
+	os.WriteFile(filepath.Join(rootDir, "static", "a.js"), []byte("a"), 0644)
+	manifestPath := filepath.Join(t.TempDir(), "versions.json")
+
+	first := NewAssetVersionManager(&Config{EnableVersioning: true, StaticPrefixes: []string{"/static/"}})
+	first.ScanDirectory(rootDir)
+	first.SaveState(manifestPath)
+
+	second := NewAssetVersionManager(&Config{EnableVersioning: true, StaticPrefixes: []string{"/static/"}, HashAlgorithm: HashXXH64})
+	reads := 0
+	second.readFile = func(name string) ([]byte, error) {
+		reads++
+		return os.ReadFile(name)
+	}
+	second.LoadState(manifestPath)
+	second.ScanDirectory(rootDir)
+
+	if reads != 1 {
+		t.Errorf("Expected a manifest from another algorithm to be ignored, got %d reads", reads)
+	}
+}
+
+func TestWithVersionCacheFile(t *testing.T) {
+	rootDir := t.TempDir()
+	os.MkdirAll(filepath.Join(rootDir, "static"), 0755)
+	os.WriteFile(filepath.Join(rootDir, "static", "a.js"), []byte("a"), 0644)
+	manifestPath := filepath.Join(t.TempDir(), "versions.json")
+
+	server, err := New(
+		WithRoot(rootDir),
+		WithWatcher(false),
+		WithVersioning(true),
+		WithStaticPrefixes("/static/"),
+		WithVersionCacheFile(manifestPath),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Stop()
+
+	if _, err := os.Stat(manifestPath); err != nil {
+		t.Fatalf("Expected the manifest to be written at startup: %v", err)
+	}
+
+	restarted := NewAssetVersionManager(server.config)
+	if err := restarted.LoadState(manifestPath); err != nil {
+		t.Fatal(err)
+	}
+	if hash, ok := restarted.restoredHash("/static/a.js", fileStateOf(t, filepath.Join(rootDir, "static", "a.js"))); !ok || hash == "" {
+		t.Error("Expected the manifest to record a.js")
+	}
+}
+
+func fileStateOf(t *testing.T, name string) fileState {
+	t.Helper()
+	info, err := os.Stat(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return fileState{ModTime: info.ModTime(), Size: info.Size()}
+}
@@ -1,14 +1,24 @@
 package gostc
 
 import (
+	"compress/gzip"
+	"compress/zlib"
 	"context"
+	"errors"
 	"fmt"
+	"io"
 	"log"
+	"math"
+	"net"
 	"net/http"
 	"runtime"
+	"strconv"
 	"strings"
+	"sync"
 	"sync/atomic"
 	"time"
+
+	"github.com/andybalholm/brotli"
 )
 
 type Middleware func(http.Handler) http.Handler
@@ -20,16 +30,42 @@ func ChainMiddleware(handler http.Handler, middlewares ...Middleware) http.Handl
 	return handler
 }
 
+// RateLimitMiddleware limits each client IP to perIP requests per second
+// with a burst of ten times that, using a limiter of its own
 func RateLimitMiddleware(perIP int) Middleware {
-	rateLimiter := NewIPRateLimiter(perIP, perIP*10, 5*time.Minute)
+	return RateLimiterMiddleware(NewIPRateLimiter(perIP, perIP*10, 5*time.Minute))
+}
 
+// RateLimiterMiddleware rejects requests from client IPs that rateLimiter
+// does not allow. Middlewares sharing a limiter share its buckets. Every
+// response carries X-RateLimit-Limit (the burst), X-RateLimit-Remaining and
+// X-RateLimit-Reset (Unix time the bucket is full again); rejections get
+// Retry-After and, for clients accepting JSON, a JSON body.
+func RateLimiterMiddleware(rateLimiter *IPRateLimiter) Middleware {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			ip := getClientIP(r)
 
-			if !rateLimiter.Allow(ip) {
-				w.Header().Set("Retry-After", "60")
-				w.Header().Set("X-RateLimit-Limit", fmt.Sprintf("%d", perIP))
+			allowed, remaining, resetAt := rateLimiter.take(ip)
+			w.Header().Set("X-RateLimit-Limit", strconv.Itoa(rateLimiter.burst))
+			w.Header().Set("X-RateLimit-Remaining", strconv.Itoa(int(remaining)))
+			w.Header().Set("X-RateLimit-Reset", strconv.FormatInt(ceilUnix(resetAt), 10))
+
+			if !allowed {
+				retryAfter := int64(math.Ceil(rateLimiter.nextTokenIn(remaining).Seconds()))
+				if retryAfter < 1 {
+					retryAfter = 1
+				}
+				w.Header().Set("Retry-After", strconv.FormatInt(retryAfter, 10))
+
+				if acceptsJSON(r) {
+					writeJSON(w, r, http.StatusTooManyRequests, rateLimitJSON{
+						Error:      "rate_limit_exceeded",
+						Message:    "Too many requests",
+						RetryAfter: retryAfter,
+					})
+					return
+				}
 				http.Error(w, "Too many requests", http.StatusTooManyRequests)
 				return
 			}
@@ -39,26 +75,107 @@ func RateLimitMiddleware(perIP int) Middleware {
 	}
 }
 
+// rateLimitJSON is the 429 body sent to clients that accept JSON
+type rateLimitJSON struct {
+	Error      string `json:"error"`
+	Message    string `json:"message"`
+	RetryAfter int64  `json:"retry_after_sec"`
+}
+
+// acceptsJSON reports whether the request's Accept header lists JSON
+func acceptsJSON(r *http.Request) bool {
+	accept := strings.ToLower(r.Header.Get("Accept"))
+	return strings.Contains(accept, "application/json") || strings.Contains(accept, "+json")
+}
+
+// ceilUnix returns t as Unix seconds, rounded up
+func ceilUnix(t time.Time) int64 {
+	if t.Nanosecond() > 0 {
+		return t.Unix() + 1
+	}
+	return t.Unix()
+}
+
+// addVary merges fields into the Vary header, skipping any already listed,
+// so middleware and the file handler can each contribute without clobbering
+func addVary(h http.Header, fields ...string) {
+	existing := h.Values("Vary")
+	var listed []string
+	for _, v := range existing {
+		for _, field := range strings.Split(v, ",") {
+			if field = strings.TrimSpace(field); field != "" {
+				listed = append(listed, field)
+			}
+		}
+	}
+
+	merged := listed
+	for _, field := range fields {
+		found := false
+		for _, l := range merged {
+			if l == "*" || strings.EqualFold(l, field) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			merged = append(merged, field)
+		}
+	}
+
+	if len(merged) == len(listed) && len(existing) == 1 {
+		return
+	}
+	h.Set("Vary", strings.Join(merged, ", "))
+}
+
 func CORSMiddleware(config *Config) Middleware {
+	allowHeaders := "Content-Type, Authorization"
+	if config.CORSAllowedHeaders != nil {
+		allowHeaders = strings.Join(config.CORSAllowedHeaders, ", ")
+	}
+	maxAge := time.Hour
+	if config.CORSMaxAge > 0 {
+		maxAge = config.CORSMaxAge
+	}
+	wildcard := len(config.AllowedOrigins) == 1 && config.AllowedOrigins[0] == "*"
+
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			origin := r.Header.Get("Origin")
 
-			if isOriginAllowed(origin, config.AllowedOrigins) {
+			switch {
+			case origin != "" && isOriginAllowed(origin, config.AllowedOrigins):
+				// Echoed rather than "*", which browsers refuse with credentials
 				w.Header().Set("Access-Control-Allow-Origin", origin)
-			} else if len(config.AllowedOrigins) == 1 && config.AllowedOrigins[0] == "*" {
+				// The response now depends on the request's Origin
+				addVary(w.Header(), "Origin")
+				if config.CORSAllowCredentials {
+					w.Header().Set("Access-Control-Allow-Credentials", "true")
+				}
+			case origin == "" && wildcard && !config.CORSAllowCredentials:
 				w.Header().Set("Access-Control-Allow-Origin", "*")
+			default:
+				// Disallowed origins get no CORS headers, so browsers block them
+				next.ServeHTTP(w, r)
+				return
 			}
 
-			w.Header().Set("Access-Control-Allow-Methods", strings.Join(config.AllowedMethods, ", "))
-			w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
-			w.Header().Set("Access-Control-Max-Age", "3600")
-
-			if r.Method == "OPTIONS" {
-				w.WriteHeader(http.StatusOK)
+			// Preflights are answered here, with the security headers already
+			// set by the middleware outside this one. Other OPTIONS requests
+			// reach the file handler, which reports the allowed methods.
+			if r.Method == "OPTIONS" && origin != "" && r.Header.Get("Access-Control-Request-Method") != "" {
+				w.Header().Set("Access-Control-Allow-Methods", config.allowHeader())
+				w.Header().Set("Access-Control-Allow-Headers", allowHeaders)
+				w.Header().Set("Access-Control-Max-Age", strconv.Itoa(int(maxAge/time.Second)))
+				w.WriteHeader(http.StatusNoContent)
 				return
 			}
 
+			if len(config.CORSExposedHeaders) > 0 {
+				w.Header().Set("Access-Control-Expose-Headers", strings.Join(config.CORSExposedHeaders, ", "))
+			}
+
 			next.ServeHTTP(w, r)
 		})
 	}
@@ -67,8 +184,11 @@ func CORSMiddleware(config *Config) Middleware {
 func SecurityHeadersMiddleware(config *Config) Middleware {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if config.ServerHeader != "" {
+				w.Header().Set("Server", config.ServerHeader)
+			}
+
 			// Basic security headers
-			w.Header().Set("Server", "7424")
 			w.Header().Set("X-Content-Type-Options", "nosniff")
 			w.Header().Set("X-Frame-Options", "DENY")
 			w.Header().Set("X-XSS-Protection", "1; mode=block")
@@ -97,6 +217,25 @@ func SecurityHeadersMiddleware(config *Config) Middleware {
 	}
 }
 
+// ResponseHeadersMiddleware sets headers on every response before the
+// handler runs, so the handler's own headers win. An empty value removes
+// the header.
+func ResponseHeadersMiddleware(headers map[string]string) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			for name, value := range headers {
+				if value == "" {
+					w.Header().Del(name)
+				} else {
+					w.Header().Set(name, value)
+				}
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
 func LoggingMiddleware() Middleware {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -119,6 +258,30 @@ func LoggingMiddleware() Middleware {
 	}
 }
 
+// ObserverMiddleware calls onRequest before the rest of the chain, using a
+// non-nil context it returns for the request, and onResponse with the final
+// status, bytes written and duration. Either may be nil.
+func ObserverMiddleware(onRequest func(r *http.Request) context.Context, onResponse func(r *http.Request, status int, bytes int64, duration time.Duration)) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+
+			if onRequest != nil {
+				if ctx := onRequest(r); ctx != nil {
+					r = r.WithContext(ctx)
+				}
+			}
+
+			wrapped := wrapResponseWriter(w)
+			next.ServeHTTP(wrapped, r)
+
+			if onResponse != nil {
+				onResponse(r, wrapped.status, wrapped.written, time.Since(start))
+			}
+		})
+	}
+}
+
 func TimeoutMiddleware(timeout time.Duration) Middleware {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -127,8 +290,7 @@ func TimeoutMiddleware(timeout time.Duration) Middleware {
 
 			r = r.WithContext(ctx)
 
-			// Create a wrapped response writer to track if response was written
-			wrapped := wrapResponseWriter(w)
+			tw := newTimeoutWriter(w)
 			done := make(chan struct{})
 			panicChan := make(chan interface{}, 1)
 
@@ -139,7 +301,7 @@ func TimeoutMiddleware(timeout time.Duration) Middleware {
 					}
 					close(done)
 				}()
-				next.ServeHTTP(wrapped, r)
+				next.ServeHTTP(tw, r)
 			}()
 
 			select {
@@ -150,9 +312,11 @@ func TimeoutMiddleware(timeout time.Duration) Middleware {
 					panic(p) // Re-panic to be caught by recovery middleware
 				default:
 				}
+				tw.finish()
 			case <-ctx.Done():
-				// Only send timeout error if response hasn't been written
-				if wrapped.status == 0 {
+				// The handler sees the cancelled context and stops reading and
+				// compressing; anything it still writes is dropped
+				if tw.timeout() {
 					http.Error(w, "Request timeout", http.StatusRequestTimeout)
 				}
 			}
@@ -160,6 +324,121 @@ func TimeoutMiddleware(timeout time.Duration) Middleware {
 	}
 }
 
+// timeoutWriter is the ResponseWriter a handler under TimeoutMiddleware
+// writes to. Headers are staged in a copy until WriteHeader so the timeout
+// response never races the handler, and once the request has timed out
+// every write is dropped with http.ErrHandlerTimeout.
+type timeoutWriter struct {
+	w      http.ResponseWriter
+	header http.Header
+
+	mu          sync.Mutex
+	wroteHeader bool
+	timedOut    bool
+}
+
+func newTimeoutWriter(w http.ResponseWriter) *timeoutWriter {
+	return &timeoutWriter{w: w, header: w.Header().Clone()}
+}
+
+func (tw *timeoutWriter) Header() http.Header {
+	return tw.header
+}
+
+func (tw *timeoutWriter) WriteHeader(code int) {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+
+	if tw.timedOut || tw.wroteHeader {
+		return
+	}
+	tw.writeHeaderLocked(code)
+}
+
+func (tw *timeoutWriter) writeHeaderLocked(code int) {
+	tw.copyHeaderLocked()
+	tw.wroteHeader = true
+	tw.w.WriteHeader(code)
+}
+
+// copyHeaderLocked makes the real header match the staged one
+func (tw *timeoutWriter) copyHeaderLocked() {
+	dst := tw.w.Header()
+	for k := range dst {
+		if _, ok := tw.header[k]; !ok {
+			delete(dst, k)
+		}
+	}
+	for k, v := range tw.header {
+		dst[k] = v
+	}
+}
+
+func (tw *timeoutWriter) Write(b []byte) (int, error) {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+
+	if tw.timedOut {
+		return 0, http.ErrHandlerTimeout
+	}
+	if !tw.wroteHeader {
+		tw.writeHeaderLocked(http.StatusOK)
+	}
+	return tw.w.Write(b)
+}
+
+// finish hands over the staged headers of a handler that returned without
+// writing, e.g. for a HEAD request
+func (tw *timeoutWriter) finish() {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+
+	if !tw.wroteHeader && !tw.timedOut {
+		tw.copyHeaderLocked()
+	}
+}
+
+// timeout stops further writes and reports whether the response is still
+// untouched, so the caller may answer with a timeout error
+func (tw *timeoutWriter) timeout() bool {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+
+	tw.timedOut = true
+	return !tw.wroteHeader
+}
+
+// ConcurrencyLimitMiddleware lets at most n requests through at once. When
+// all slots are taken a request gets 503 with Retry-After, or with queue set
+// waits for a slot until its context ends (e.g. via TimeoutMiddleware).
+func ConcurrencyLimitMiddleware(n int, queue bool) Middleware {
+	slots := make(chan struct{}, n)
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if queue {
+				select {
+				case slots <- struct{}{}:
+				case <-r.Context().Done():
+					// TimeoutMiddleware, if any, answers the request
+					return
+				}
+			} else {
+				select {
+				case slots <- struct{}{}:
+				default:
+					w.Header().Set("Retry-After", "1")
+					http.Error(w, "Server busy", http.StatusServiceUnavailable)
+					return
+				}
+			}
+			defer func() { <-slots }()
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
 func MaxBytesMiddleware(maxBytes int64) Middleware {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -169,6 +448,95 @@ func MaxBytesMiddleware(maxBytes int64) Middleware {
 	}
 }
 
+// DecompressRequestMiddleware decodes request bodies sent with
+// Content-Encoding gzip, deflate or br, so handlers read plain bytes. The
+// header is removed and the decoded body is capped at maxBytes (0 = no cap)
+// to guard against decompression bombs. Other encodings get 415.
+func DecompressRequestMiddleware(maxBytes int64) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			encoding := r.Header.Get("Content-Encoding")
+			if encoding == "" || r.Body == nil || r.Body == http.NoBody {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			body, err := decodeRequestBody(r.Body, encoding)
+			if err == errUnsupportedEncoding {
+				http.Error(w, "Unsupported Content-Encoding", http.StatusUnsupportedMediaType)
+				return
+			}
+			if err != nil {
+				http.Error(w, "Malformed request body", http.StatusBadRequest)
+				return
+			}
+
+			r = r.Clone(r.Context())
+			r.Header.Del("Content-Encoding")
+			r.Header.Del("Content-Length")
+			r.ContentLength = -1
+			r.Body = body
+			if maxBytes > 0 {
+				r.Body = http.MaxBytesReader(w, body, maxBytes)
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+var errUnsupportedEncoding = errors.New("unsupported content encoding")
+
+// decodeRequestBody undoes the comma-separated encodings, which are listed
+// in the order they were applied
+func decodeRequestBody(body io.ReadCloser, encoding string) (io.ReadCloser, error) {
+	encodings := strings.Split(encoding, ",")
+	decoded := &decodedBody{Reader: body, closers: []io.Closer{body}}
+
+	for i := len(encodings) - 1; i >= 0; i-- {
+		switch strings.ToLower(strings.TrimSpace(encodings[i])) {
+		case "gzip", "x-gzip":
+			zr, err := gzip.NewReader(decoded.Reader)
+			if err != nil {
+				return nil, err
+			}
+			decoded.Reader = zr
+			decoded.closers = append(decoded.closers, zr)
+		case "deflate":
+			zr, err := zlib.NewReader(decoded.Reader)
+			if err != nil {
+				return nil, err
+			}
+			decoded.Reader = zr
+			decoded.closers = append(decoded.closers, zr)
+		case "br":
+			decoded.Reader = brotli.NewReader(decoded.Reader)
+		case "identity", "":
+		default:
+			return nil, errUnsupportedEncoding
+		}
+	}
+
+	return decoded, nil
+}
+
+// decodedBody reads through the decoders and closes them and the original
+// body together
+type decodedBody struct {
+	io.Reader
+	closers []io.Closer
+}
+
+func (db *decodedBody) Close() error {
+	var firstErr error
+	for i := len(db.closers) - 1; i >= 0; i-- {
+		if err := db.closers[i].Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
 func RecoveryMiddleware() Middleware {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -247,6 +615,34 @@ func (rw *responseWriter) Write(b []byte) (int, error) {
 	return n, err
 }
 
+// LoopbackOnlyMiddleware rejects requests that don't come directly from the
+// local machine. Requests carrying proxy headers are rejected too, since a
+// local reverse proxy would otherwise make remote clients look local.
+func LoopbackOnlyMiddleware() Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !isLoopbackRequest(r) {
+				http.NotFound(w, r)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func isLoopbackRequest(r *http.Request) bool {
+	if r.Header.Get("X-Forwarded-For") != "" || r.Header.Get("X-Real-IP") != "" || r.Header.Get("Forwarded") != "" {
+		return false
+	}
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
 func getClientIP(r *http.Request) string {
 	// Validate and sanitize X-Forwarded-For header
 	if xff := r.Header.Get("X-Forwarded-For"); xff != "" {
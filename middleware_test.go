@@ -0,0 +1,210 @@
+package gostc
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/andybalholm/brotli"
+)
+
+func TestDecompressRequestMiddleware(t *testing.T) {
+	payload := strings.Repeat(`{"event":"click"}`, 100)
+
+	encode := map[string]func(w io.Writer) io.WriteCloser{
+		"gzip":    func(w io.Writer) io.WriteCloser { return gzip.NewWriter(w) },
+		"deflate": func(w io.Writer) io.WriteCloser { return zlib.NewWriter(w) },
+		"br":      func(w io.Writer) io.WriteCloser { return brotli.NewWriter(w) },
+	}
+
+	var seen string
+	var seenEncoding string
+	var readErr error
+	handler := ChainMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body []byte
+		body, readErr = io.ReadAll(r.Body)
+		seen = string(body)
+		seenEncoding = r.Header.Get("Content-Encoding")
+	}), DecompressRequestMiddleware(int64(len(payload))))
+
+	for encoding, newWriter := range encode {
+		t.Run(encoding, func(t *testing.T) {
+			var buf bytes.Buffer
+			zw := newWriter(&buf)
+			zw.Write([]byte(payload))
+			zw.Close()
+
+			req := httptest.NewRequest("POST", "/collect", &buf)
+			req.Header.Set("Content-Encoding", encoding)
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, req)
+
+			if readErr != nil || seen != payload {
+				t.Fatalf("Expected the handler to read the decoded body, got %d bytes, err %v", len(seen), readErr)
+			}
+			if seenEncoding != "" {
+				t.Errorf("Expected Content-Encoding to be removed, got %q", seenEncoding)
+			}
+		})
+	}
+
+	t.Run("Stacked", func(t *testing.T) {
+		var inner, outer bytes.Buffer
+		zw := gzip.NewWriter(&inner)
+		zw.Write([]byte(payload))
+		zw.Close()
+		bw := brotli.NewWriter(&outer)
+		bw.Write(inner.Bytes())
+		bw.Close()
+
+		req := httptest.NewRequest("POST", "/collect", &outer)
+		req.Header.Set("Content-Encoding", "gzip, br")
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+
+		if readErr != nil || seen != payload {
+			t.Fatalf("Expected stacked encodings to be undone, got %d bytes, err %v", len(seen), readErr)
+		}
+	})
+
+	t.Run("DecodedSizeLimit", func(t *testing.T) {
+		var buf bytes.Buffer
+		zw := gzip.NewWriter(&buf)
+		zw.Write([]byte(payload + payload))
+		zw.Close()
+
+		req := httptest.NewRequest("POST", "/collect", &buf)
+		req.Header.Set("Content-Encoding", "gzip")
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+
+		if readErr == nil {
+			t.Error("Expected reading past the decoded size limit to fail")
+		}
+	})
+
+	t.Run("Unsupported", func(t *testing.T) {
+		req := httptest.NewRequest("POST", "/collect", strings.NewReader("data"))
+		req.Header.Set("Content-Encoding", "compress")
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+
+		if w.Code != http.StatusUnsupportedMediaType {
+			t.Errorf("Expected 415, got %d", w.Code)
+		}
+	})
+
+	t.Run("Malformed", func(t *testing.T) {
+		req := httptest.NewRequest("POST", "/collect", strings.NewReader("not gzip"))
+		req.Header.Set("Content-Encoding", "gzip")
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("Expected 400, got %d", w.Code)
+		}
+	})
+}
+
+func TestRequestAndResponseObservers(t *testing.T) {
+	tmpDir := t.TempDir()
+	content := strings.Repeat("observed ", 10)
+	if err := os.WriteFile(filepath.Join(tmpDir, "page.txt"), []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	type spanKey struct{}
+	type observed struct {
+		span   string
+		status int
+		bytes  int64
+	}
+	var got []observed
+
+	server, err := New(
+		WithRoot(tmpDir),
+		WithRequestObserver(func(r *http.Request) context.Context {
+			return context.WithValue(r.Context(), spanKey{}, "span:"+r.URL.Path)
+		}),
+		WithResponseObserver(func(r *http.Request, status int, bytes int64, duration time.Duration) {
+			span, _ := r.Context().Value(spanKey{}).(string)
+			got = append(got, observed{span, status, bytes})
+		}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ok := httptest.NewRecorder()
+	server.ServeHTTP(ok, httptest.NewRequest("GET", "/page.txt", nil))
+	missing := httptest.NewRecorder()
+	server.ServeHTTP(missing, httptest.NewRequest("GET", "/missing.txt", nil))
+
+	want := []observed{
+		{"span:/page.txt", http.StatusOK, int64(ok.Body.Len())},
+		{"span:/missing.txt", http.StatusNotFound, int64(missing.Body.Len())},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("Expected %d observations, got %d", len(want), len(got))
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("Observation %d: expected %+v, got %+v", i, want[i], got[i])
+		}
+	}
+	if got[0].bytes != int64(len(content)) {
+		t.Errorf("Expected %d bytes for the file, got %d", len(content), got[0].bytes)
+	}
+}
+
+func TestTimeoutCancelsCompression(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	// Varied text that reads in milliseconds but takes gzip at level 9 over
+	// a second to compress
+	var buf bytes.Buffer
+	for buf.Len() < 8<<20 {
+		fmt.Fprintf(&buf, "item-%d value-%d label-%x;\n", buf.Len(), buf.Len()*31%997, buf.Len()*7)
+	}
+	os.WriteFile(filepath.Join(tmpDir, "large.txt"), buf.Bytes(), 0644)
+
+	server, err := New(
+		WithRoot(tmpDir),
+		WithWatcher(false),
+		WithCompression(Gzip),
+		WithCompressionLevel(9),
+		WithTimeouts(TimeoutConfig{Read: 100 * time.Millisecond}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req := httptest.NewRequest("GET", "/large.txt", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	w := httptest.NewRecorder()
+	server.ServeHTTP(w, req)
+
+	if w.Code != http.StatusRequestTimeout {
+		t.Fatalf("Expected 408, got %d", w.Code)
+	}
+	if w.Header().Get("Content-Encoding") != "" {
+		t.Errorf("Timeout response should not carry the handler's headers, got Content-Encoding %q", w.Header().Get("Content-Encoding"))
+	}
+
+	// The abandoned handler notices the cancelled context and returns
+	deadline := time.Now().Add(500 * time.Millisecond)
+	for server.activeRequests.Load() > 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("Handler kept running after the request timed out")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
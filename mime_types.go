@@ -0,0 +1,35 @@
+package gostc
+
+import (
+	"mime"
+	"path/filepath"
+	"strings"
+)
+
+// defaultMimeTypes covers extensions that OS mime databases often get wrong
+// or lack, so they are served consistently everywhere
+var defaultMimeTypes = map[string]string{
+	".js":          "text/javascript; charset=utf-8",
+	".mjs":         "text/javascript; charset=utf-8",
+	".wasm":        "application/wasm",
+	".webmanifest": "application/manifest+json",
+	".map":         "application/json; charset=utf-8",
+}
+
+// contentTypeByExtension returns the Content-Type for name from MimeTypes,
+// the built-in defaults, then the OS mime database. It returns "" when the
+// extension is unknown.
+func (c *Config) contentTypeByExtension(name string) string {
+	ext := strings.ToLower(filepath.Ext(name))
+	if ext == "" {
+		return ""
+	}
+
+	if contentType, ok := c.MimeTypes[ext]; ok {
+		return contentType
+	}
+	if contentType, ok := defaultMimeTypes[ext]; ok {
+		return contentType
+	}
+	return mime.TypeByExtension(ext)
+}
@@ -0,0 +1,55 @@
+package gostc
+
+import (
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestMimeTypes(t *testing.T) {
+	tmpDir := t.TempDir()
+	files := map[string]string{
+		"module.wasm":          "\x00asm\x01\x00\x00\x00",
+		"app.mjs":              "export default 1",
+		"site.webmanifest":     `{"name":"site"}`,
+		"app.js.map":           `{"version":3}`,
+		"data.custom":          "custom",
+		"override.wasm.br.txt": "text",
+	}
+	for name, content := range files {
+		os.WriteFile(filepath.Join(tmpDir, name), []byte(content), 0644)
+	}
+
+	server, err := New(
+		WithRoot(tmpDir),
+		WithWatcher(false),
+		WithMimeType("custom", "application/x-custom"),
+		WithMimeType(".TXT", "text/x-overridden"),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		path string
+		want string
+	}{
+		{"/module.wasm", "application/wasm"},
+		{"/app.mjs", "text/javascript; charset=utf-8"},
+		{"/site.webmanifest", "application/manifest+json"},
+		{"/app.js.map", "application/json; charset=utf-8"},
+		{"/data.custom", "application/x-custom"},
+		{"/override.wasm.br.txt", "text/x-overridden"}, // only the final extension counts
+	}
+
+	for _, tt := range tests {
+		req := httptest.NewRequest("GET", tt.path, nil)
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, req)
+
+		if got := w.Header().Get("Content-Type"); got != tt.want {
+			t.Errorf("%s: expected Content-Type %q, got %q", tt.path, tt.want, got)
+		}
+	}
+}
@@ -0,0 +1,59 @@
+package gostc
+
+import (
+	"path"
+	"strings"
+)
+
+// Mount serves the directory Root at URL paths beginning with Prefix
+type Mount struct {
+	Prefix string // normalized URL prefix without a trailing slash, e.g. "/docs"
+	Root   string
+}
+
+// normalizeMountPrefix cleans prefix to the "/name" form used for matching
+func normalizeMountPrefix(prefix string) string {
+	prefix = path.Clean("/" + strings.Trim(prefix, "/"))
+	if prefix == "/" {
+		return ""
+	}
+	return prefix
+}
+
+// matches reports whether urlPath is the mount prefix or lies below it
+func (m Mount) matches(urlPath string) bool {
+	return urlPath == m.Prefix || strings.HasPrefix(urlPath, m.Prefix+"/")
+}
+
+// relativePath returns urlPath relative to the mount's root, starting with "/"
+func (m Mount) relativePath(urlPath string) string {
+	rel := strings.TrimPrefix(urlPath, m.Prefix)
+	if rel == "" {
+		return "/"
+	}
+	return rel
+}
+
+// findMount returns the mount with the longest prefix matching urlPath
+func findMount(mounts []Mount, urlPath string) (Mount, bool) {
+	var best Mount
+	found := false
+
+	for _, m := range mounts {
+		if m.matches(urlPath) && (!found || len(m.Prefix) > len(best.Prefix)) {
+			best = m
+			found = true
+		}
+	}
+
+	return best, found
+}
+
+// resolveRoot returns the directory serving urlPath and urlPath relative to
+// it: the longest matching mount, or Root when no mount matches
+func (c *Config) resolveRoot(urlPath string) (root, relPath string) {
+	if m, ok := findMount(c.Mounts, urlPath); ok {
+		return m.Root, m.relativePath(urlPath)
+	}
+	return c.Root, urlPath
+}
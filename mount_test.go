@@ -0,0 +1,178 @@
+package gostc
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func writeTestFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestMountsServeSeparateRoots(t *testing.T) {
+	rootDir := t.TempDir()
+	appDir := t.TempDir()
+	docsDir := t.TempDir()
+	apiDir := t.TempDir()
+
+	writeTestFile(t, filepath.Join(rootDir, "page.txt"), "root page")
+	writeTestFile(t, filepath.Join(rootDir, "app", "page.txt"), "shadowed by mount")
+	writeTestFile(t, filepath.Join(appDir, "page.txt"), "app page")
+	writeTestFile(t, filepath.Join(appDir, "index.html"), "<html>app</html>")
+	writeTestFile(t, filepath.Join(docsDir, "page.txt"), "docs page")
+	writeTestFile(t, filepath.Join(apiDir, "page.txt"), "api page")
+
+	server, err := New(
+		WithRoot(rootDir),
+		WithMount("/app", appDir),
+		WithMount("/docs/", docsDir),
+		WithMount("docs/api", apiDir),
+		WithWatcher(false),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		path string
+		want string
+	}{
+		{"/page.txt", "root page"},
+		{"/app/page.txt", "app page"},
+		{"/app/", "<html>app</html>"},
+		{"/docs/page.txt", "docs page"},
+		{"/docs/api/page.txt", "api page"},
+		{"/application/page.txt", ""}, // a prefix only matches whole segments
+	}
+
+	// Twice, so the second pass is served from the cache
+	for pass := 0; pass < 2; pass++ {
+		for _, tt := range tests {
+			req := httptest.NewRequest("GET", tt.path, nil)
+			w := httptest.NewRecorder()
+			server.ServeHTTP(w, req)
+
+			if tt.want == "" {
+				if w.Code != http.StatusNotFound {
+					t.Errorf("%s: expected 404, got %d", tt.path, w.Code)
+				}
+				continue
+			}
+			if w.Code != http.StatusOK {
+				t.Errorf("%s: expected 200, got %d", tt.path, w.Code)
+				continue
+			}
+			if body := w.Body.String(); body != tt.want {
+				t.Errorf("%s: expected %q, got %q", tt.path, tt.want, body)
+			}
+		}
+	}
+}
+
+func TestMountsVersionAssetsPerMount(t *testing.T) {
+	appDir := t.TempDir()
+	docsDir := t.TempDir()
+	writeTestFile(t, filepath.Join(appDir, "static", "main.js"), "console.log('app')")
+	writeTestFile(t, filepath.Join(docsDir, "static", "main.js"), "console.log('docs')")
+
+	server, err := New(
+		WithRoot(t.TempDir()),
+		WithMount("/app", appDir),
+		WithMount("/docs", docsDir),
+		WithVersioning(true),
+		WithStaticPrefixes("/static/"),
+		WithWatcher(false),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	appVersioned, ok := server.versionManager.GetVersionedPath("/app/static/main.js")
+	if !ok {
+		t.Fatal("Expected /app/static/main.js to be versioned")
+	}
+	docsVersioned, ok := server.versionManager.GetVersionedPath("/docs/static/main.js")
+	if !ok {
+		t.Fatal("Expected /docs/static/main.js to be versioned")
+	}
+	if !strings.HasPrefix(appVersioned, "/app/static/main.") || !strings.HasPrefix(docsVersioned, "/docs/static/main.") {
+		t.Fatalf("Versioned paths should keep their mount prefix, got %s and %s", appVersioned, docsVersioned)
+	}
+
+	for versioned, want := range map[string]string{
+		appVersioned:  "console.log('app')",
+		docsVersioned: "console.log('docs')",
+	} {
+		req := httptest.NewRequest("GET", versioned, nil)
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, req)
+
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s: expected 200, got %d", versioned, w.Code)
+		}
+		if body, _ := io.ReadAll(w.Body); string(body) != want {
+			t.Errorf("%s: expected %q, got %q", versioned, want, body)
+		}
+		if cc := w.Header().Get("Cache-Control"); !strings.Contains(cc, "immutable") {
+			t.Errorf("%s: expected immutable caching, got %q", versioned, cc)
+		}
+	}
+}
+
+func TestMountWatcherInvalidatesMountPath(t *testing.T) {
+	docsDir := t.TempDir()
+	pagePath := filepath.Join(docsDir, "page.txt")
+	writeTestFile(t, pagePath, "v1")
+
+	server, err := New(
+		WithRoot(t.TempDir()),
+		WithMount("/docs", docsDir),
+		WithWatcherDebounce(0),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	paths := make(chan string, 16)
+	server.OnInvalidate(func(path string) { paths <- path })
+
+	if err := server.invalidator.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer server.invalidator.Stop()
+
+	writeTestFile(t, pagePath, "v2")
+
+	timeout := time.After(2 * time.Second)
+	for {
+		select {
+		case path := <-paths:
+			if path == "/docs/page.txt" {
+				return
+			}
+		case <-timeout:
+			t.Fatal("Expected /docs/page.txt to be invalidated")
+		}
+	}
+}
+
+func TestMountValidation(t *testing.T) {
+	if _, err := New(WithRoot(t.TempDir()), WithMount("/", t.TempDir()), WithWatcher(false)); err == nil {
+		t.Error("Expected mounting at / to be rejected")
+	}
+	if _, err := New(WithRoot(t.TempDir()), WithMount("/docs", ""), WithWatcher(false)); err == nil {
+		t.Error("Expected a mount without a root to be rejected")
+	}
+}
@@ -0,0 +1,54 @@
+package gostc
+
+import (
+	"strings"
+
+	"github.com/hashicorp/golang-lru/v2/expirable"
+)
+
+// notFoundCacheSize bounds the number of remembered missing paths. They
+// live apart from the main cache so a scan for missing paths can't evict
+// the files actually being served.
+const notFoundCacheSize = 1024
+
+// newNotFoundCache returns the negative cache of URL paths known to be
+// missing, each remembered for NegativeCacheTTL. It is registered with
+// invalidator, since a created file or directory makes its paths servable.
+func newNotFoundCache(config *Config, invalidator Invalidator) *expirable.LRU[string, struct{}] {
+	notFound := expirable.NewLRU[string, struct{}](notFoundCacheSize, nil, config.NegativeCacheTTL)
+
+	invalidator.RegisterCallback(func(urlPath string) {
+		if urlPath == InvalidateAllPath {
+			notFound.Purge()
+			return
+		}
+
+		prefix := strings.TrimSuffix(urlPath, "/") + "/"
+		for _, missing := range notFound.Keys() {
+			if missing == urlPath || strings.HasPrefix(missing, prefix) {
+				notFound.Remove(missing)
+			}
+		}
+	})
+
+	return notFound
+}
+
+// isCachedNotFound reports whether urlPath was recently found missing
+func (s *Server) isCachedNotFound(urlPath string) bool {
+	if s.notFound == nil {
+		return false
+	}
+
+	_, ok := s.notFound.Get(urlPath)
+	return ok
+}
+
+// cacheNotFound records urlPath as missing when negative caching is enabled
+func (s *Server) cacheNotFound(urlPath string) {
+	if s.notFound == nil {
+		return
+	}
+
+	s.notFound.Add(urlPath, struct{}{})
+}
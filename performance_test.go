@@ -3,11 +3,14 @@ package gostc
 import (
 	"bytes"
 	"fmt"
+	"io"
+	"net"
 	"net/http"
 	"net/http/httptest"
 	"os"
 	"path/filepath"
 	"runtime"
+	"sync/atomic"
 	"testing"
 	"time"
 )
@@ -296,3 +299,70 @@ func TestPerformanceMetrics(t *testing.T) {
 		}
 	}
 }
+
+// countingListener counts Write calls on accepted connections, which map
+// one-to-one onto write syscalls for TCP connections
+type countingListener struct {
+	net.Listener
+	writes *int64
+}
+
+func (l *countingListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	return &countingConn{Conn: conn, writes: l.writes}, nil
+}
+
+type countingConn struct {
+	net.Conn
+	writes *int64
+}
+
+func (c *countingConn) Write(b []byte) (int, error) {
+	atomic.AddInt64(c.writes, 1)
+	return c.Conn.Write(b)
+}
+
+// BenchmarkSmallFileWrites reports connection writes per small-file
+// response. Headers and body leave in one write while they fit net/http's
+// 4KB connection buffer, and in two past it whatever the handler does, so
+// buffering bodies in the handler saves nothing.
+func BenchmarkSmallFileWrites(b *testing.B) {
+	for _, size := range []int{512, 2048, 6000} {
+		b.Run(fmt.Sprintf("body=%d", size), func(b *testing.B) {
+			tmpDir := b.TempDir()
+			os.WriteFile(filepath.Join(tmpDir, "small.txt"), bytes.Repeat([]byte("a"), size), 0644)
+
+			server, err := New(
+				WithRoot(tmpDir),
+				WithCompression(NoCompression),
+				WithRateLimit(0),
+			)
+			if err != nil {
+				b.Fatal(err)
+			}
+			defer server.Stop()
+
+			var writes int64
+			ts := httptest.NewUnstartedServer(server)
+			ts.Listener = &countingListener{Listener: ts.Listener, writes: &writes}
+			ts.Start()
+			defer ts.Close()
+
+			client := ts.Client()
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				resp, err := client.Get(ts.URL + "/small.txt")
+				if err != nil {
+					b.Fatal(err)
+				}
+				io.Copy(io.Discard, resp.Body)
+				resp.Body.Close()
+			}
+			b.ReportMetric(float64(atomic.LoadInt64(&writes))/float64(b.N), "writes/op")
+		})
+	}
+}
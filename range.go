@@ -0,0 +1,108 @@
+package gostc
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// byteRange is a resolved span of a response body
+type byteRange struct {
+	start  int64
+	length int64
+}
+
+// parseRange parses a single "bytes=" range against a body of size bytes.
+// ok is false when the header should be ignored (malformed, another unit or
+// several ranges); satisfiable is false when the range lies past the body.
+func parseRange(header string, size int64) (br byteRange, ok, satisfiable bool) {
+	spec, found := strings.CutPrefix(header, "bytes=")
+	if !found || strings.Contains(spec, ",") {
+		return byteRange{}, false, false
+	}
+
+	first, last, found := strings.Cut(strings.TrimSpace(spec), "-")
+	if !found {
+		return byteRange{}, false, false
+	}
+
+	if first == "" {
+		// Suffix range: the final n bytes
+		n, err := strconv.ParseInt(last, 10, 64)
+		if err != nil || n < 0 {
+			return byteRange{}, false, false
+		}
+		if n == 0 || size == 0 {
+			return byteRange{}, true, false
+		}
+		if n > size {
+			n = size
+		}
+		return byteRange{start: size - n, length: n}, true, true
+	}
+
+	start, err := strconv.ParseInt(first, 10, 64)
+	if err != nil || start < 0 {
+		return byteRange{}, false, false
+	}
+
+	end := size - 1
+	if last != "" {
+		end, err = strconv.ParseInt(last, 10, 64)
+		if err != nil || end < start {
+			return byteRange{}, false, false
+		}
+		if end >= size {
+			end = size - 1
+		}
+	}
+
+	if start >= size {
+		return byteRange{}, true, false
+	}
+	return byteRange{start: start, length: end - start + 1}, true, true
+}
+
+// ifRangeMatches reports whether the Range header should be honored given
+// the request's If-Range validator. If-Range holds either a strong ETag or
+// an HTTP date; a date matches only the exact Last-Modified second.
+func ifRangeMatches(r *http.Request, entry *CacheEntry) bool {
+	ifRange := r.Header.Get("If-Range")
+	if ifRange == "" {
+		return true
+	}
+
+	if strings.HasPrefix(ifRange, `"`) {
+		return ifRange == entry.ETag
+	}
+
+	t, err := http.ParseTime(ifRange)
+	if err != nil {
+		return false
+	}
+	return entry.LastModified.Truncate(time.Second).Equal(t)
+}
+
+// serveRange writes the part of entry selected by the Range header. It
+// returns false when the header is unusable and the full body should be sent.
+func (s *Server) serveRange(w http.ResponseWriter, entry *CacheEntry, header string) bool {
+	size := int64(len(entry.Data))
+	br, ok, satisfiable := parseRange(header, size)
+	if !ok {
+		return false
+	}
+
+	if !satisfiable {
+		w.Header().Set("Content-Range", fmt.Sprintf("bytes */%d", size))
+		w.WriteHeader(http.StatusRequestedRangeNotSatisfiable)
+		return true
+	}
+
+	w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", br.start, br.start+br.length-1, size))
+	w.Header().Set("Content-Length", strconv.FormatInt(br.length, 10))
+	w.WriteHeader(http.StatusPartialContent)
+	s.writeBody(w, entry.Data[br.start:br.start+br.length])
+	return true
+}
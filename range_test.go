@@ -0,0 +1,111 @@
+package gostc
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestParseRange(t *testing.T) {
+	tests := []struct {
+		header      string
+		ok          bool
+		satisfiable bool
+		start, len  int64
+	}{
+		{"bytes=0-4", true, true, 0, 5},
+		{"bytes=5-", true, true, 5, 5},
+		{"bytes=-3", true, true, 7, 3},
+		{"bytes=8-100", true, true, 8, 2},
+		{"bytes=-100", true, true, 0, 10},
+		{"bytes=10-", true, false, 0, 0},
+		{"bytes=0-1,4-5", false, false, 0, 0},
+		{"items=0-4", false, false, 0, 0},
+		{"bytes=4-2", false, false, 0, 0},
+		{"bytes=x-", false, false, 0, 0},
+	}
+
+	for _, tt := range tests {
+		br, ok, satisfiable := parseRange(tt.header, 10)
+		if ok != tt.ok || satisfiable != tt.satisfiable {
+			t.Errorf("%s: got ok=%v satisfiable=%v, want %v %v", tt.header, ok, satisfiable, tt.ok, tt.satisfiable)
+			continue
+		}
+		if satisfiable && (br.start != tt.start || br.length != tt.len) {
+			t.Errorf("%s: got start=%d length=%d, want %d %d", tt.header, br.start, br.length, tt.start, tt.len)
+		}
+	}
+}
+
+func TestIfRange(t *testing.T) {
+	tmpDir := t.TempDir()
+	filePath := filepath.Join(tmpDir, "video.bin")
+	os.WriteFile(filePath, []byte("0123456789"), 0644)
+	modTime := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	os.Chtimes(filePath, modTime, modTime)
+
+	server, err := New(WithRoot(tmpDir), WithWatcher(false))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Prime the cache and learn the current ETag
+	w := httptest.NewRecorder()
+	server.ServeHTTP(w, httptest.NewRequest("GET", "/video.bin", nil))
+	etag := w.Header().Get("ETag")
+	if w.Header().Get("Accept-Ranges") != "bytes" {
+		t.Errorf("Expected Accept-Ranges: bytes, got %q", w.Header().Get("Accept-Ranges"))
+	}
+
+	tests := []struct {
+		name    string
+		ifRange string
+		code    int
+		body    string
+	}{
+		{"NoValidator", "", http.StatusPartialContent, "23456"},
+		{"MatchingETag", etag, http.StatusPartialContent, "23456"},
+		{"StaleETag", `"stale"`, http.StatusOK, "0123456789"},
+		{"MatchingDate", modTime.Format(http.TimeFormat), http.StatusPartialContent, "23456"},
+		{"StaleDate", modTime.Add(-time.Hour).Format(http.TimeFormat), http.StatusOK, "0123456789"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/video.bin", nil)
+			req.Header.Set("Range", "bytes=2-6")
+			if tt.ifRange != "" {
+				req.Header.Set("If-Range", tt.ifRange)
+			}
+			w := httptest.NewRecorder()
+			server.ServeHTTP(w, req)
+
+			if w.Code != tt.code {
+				t.Fatalf("Expected %d, got %d", tt.code, w.Code)
+			}
+			if w.Body.String() != tt.body {
+				t.Errorf("Expected body %q, got %q", tt.body, w.Body.String())
+			}
+			if tt.code == http.StatusPartialContent && w.Header().Get("Content-Range") != "bytes 2-6/10" {
+				t.Errorf("Expected Content-Range bytes 2-6/10, got %q", w.Header().Get("Content-Range"))
+			}
+		})
+	}
+
+	t.Run("Unsatisfiable", func(t *testing.T) {
+		req := httptest.NewRequest("GET", "/video.bin", nil)
+		req.Header.Set("Range", "bytes=50-")
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, req)
+
+		if w.Code != http.StatusRequestedRangeNotSatisfiable {
+			t.Fatalf("Expected 416, got %d", w.Code)
+		}
+		if w.Header().Get("Content-Range") != "bytes */10" {
+			t.Errorf("Expected Content-Range bytes */10, got %q", w.Header().Get("Content-Range"))
+		}
+	})
+}
@@ -0,0 +1,55 @@
+package gostc
+
+import (
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// redirectRelative sends a permanent redirect to target, a path relative to
+// Root, preserving the query string. The Location is relative to the
+// request so it survives prefixes stripped by an outer mux.
+func redirectRelative(w http.ResponseWriter, r *http.Request, target string) {
+	// Climb out of every directory the client sees in the request path
+	depth := strings.Count(r.URL.Path, "/") - 1
+	relative := strings.Repeat("../", depth) + strings.TrimPrefix(target, "/")
+	if relative == "" {
+		relative = "./"
+	}
+
+	location := &url.URL{Path: relative, RawQuery: r.URL.RawQuery}
+	w.Header().Set("Location", location.String())
+	w.WriteHeader(http.StatusMovedPermanently)
+}
+
+// httpsRedirectHandler sends every request to the same host and URI over
+// HTTPS on httpsPort, which is left out of the URL when it is 443. GET and
+// HEAD get a 301; other methods get a 308 so clients keep the method and
+// body.
+func httpsRedirectHandler(httpsPort string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host := r.Host
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		if host == "" {
+			http.Error(w, "Missing Host header", http.StatusBadRequest)
+			return
+		}
+
+		if httpsPort != "" && httpsPort != "443" {
+			host = net.JoinHostPort(host, httpsPort)
+		} else if strings.Contains(host, ":") {
+			host = "[" + host + "]" // IPv6 literal
+		}
+
+		status := http.StatusPermanentRedirect
+		if r.Method == http.MethodGet || r.Method == http.MethodHead {
+			status = http.StatusMovedPermanently
+		}
+
+		w.Header().Set("Location", "https://"+host+r.URL.RequestURI())
+		w.WriteHeader(status)
+	})
+}
@@ -0,0 +1,285 @@
+package gostc
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestCanonicalRedirects(t *testing.T) {
+	tmpDir := t.TempDir()
+	os.MkdirAll(filepath.Join(tmpDir, "docs"), 0755)
+	os.WriteFile(filepath.Join(tmpDir, "index.html"), []byte("<html>root</html>"), 0644)
+	os.WriteFile(filepath.Join(tmpDir, "docs", "index.html"), []byte("<html>docs</html>"), 0644)
+
+	server, err := New(
+		WithRoot(tmpDir),
+		WithWatcher(false),
+		WithCanonicalRedirects(true),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		path     string
+		location string
+	}{
+		{"DirectoryWithoutSlash", "/docs", "/docs/"},
+		{"DirectoryWithQuery", "/docs?page=2", "/docs/?page=2"},
+		{"IndexFile", "/docs/index.html", "/docs/"},
+		{"IndexFileWithQuery", "/docs/index.html?lang=en", "/docs/?lang=en"},
+		{"RootIndexFile", "/index.html", "/"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", tt.path, nil)
+			w := httptest.NewRecorder()
+			server.ServeHTTP(w, req)
+
+			if w.Code != http.StatusMovedPermanently {
+				t.Fatalf("Expected 301, got %d", w.Code)
+			}
+
+			location, err := req.URL.Parse(w.Header().Get("Location"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if location.RequestURI() != tt.location {
+				t.Errorf("Expected redirect to %s, got %s", tt.location, location.RequestURI())
+			}
+		})
+	}
+
+	for _, path := range []string{"/", "/docs/"} {
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		if w.Code != http.StatusOK {
+			t.Errorf("%s: expected 200, got %d", path, w.Code)
+		}
+	}
+}
+
+func TestCanonicalRedirectsDisabled(t *testing.T) {
+	tmpDir := t.TempDir()
+	os.MkdirAll(filepath.Join(tmpDir, "docs"), 0755)
+	os.WriteFile(filepath.Join(tmpDir, "docs", "index.html"), []byte("<html>docs</html>"), 0644)
+
+	server, err := New(WithRoot(tmpDir), WithWatcher(false))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, path := range []string{"/docs", "/docs/index.html"} {
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		if w.Code != http.StatusOK {
+			t.Errorf("%s: expected 200 without canonical redirects, got %d", path, w.Code)
+		}
+	}
+}
+
+func TestCanonicalRedirectsSkipVersionedPaths(t *testing.T) {
+	tmpDir := t.TempDir()
+	os.WriteFile(filepath.Join(tmpDir, "index.html"), []byte("<html>root</html>"), 0644)
+
+	server, err := New(
+		WithRoot(tmpDir),
+		WithWatcher(false),
+		WithVersioning(true),
+		WithCanonicalRedirects(true),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	content := []byte("<html>root</html>")
+	server.versionManager.RegisterAsset("/index.html", content)
+	versioned, ok := server.versionManager.GetVersionedPath("/index.html")
+	if !ok {
+		t.Fatal("Expected a versioned path for index.html")
+	}
+
+	w := httptest.NewRecorder()
+	server.ServeHTTP(w, httptest.NewRequest("GET", versioned, nil))
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected versioned index to be served directly, got %d", w.Code)
+	}
+}
+
+// writeTestCertificate writes a self-signed certificate for 127.0.0.1 and
+// its key to dir, returning their paths
+func writeTestCertificate(t *testing.T, dir string) (certFile, keyFile string) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "127.0.0.1"},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	certFile = filepath.Join(dir, "cert.pem")
+	keyFile = filepath.Join(dir, "key.pem")
+	os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600)
+	os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600)
+	return certFile, keyFile
+}
+
+func TestHTTPSRedirect(t *testing.T) {
+	tmpDir := t.TempDir()
+	certFile, keyFile := writeTestCertificate(t, t.TempDir())
+
+	server, err := New(
+		WithRoot(tmpDir),
+		WithTLS(certFile, keyFile),
+		WithAddr("127.0.0.1:0"),
+		WithHTTPSRedirect("127.0.0.1:0"),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := server.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer server.Stop()
+
+	httpsPort := strconv.Itoa(server.Addr().(*net.TCPAddr).Port)
+	client := &http.Client{
+		CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+	}
+
+	tests := []struct {
+		method   string
+		status   int
+		location string
+	}{
+		{"GET", http.StatusMovedPermanently, "https://example.com:" + httpsPort + "/docs/page.html?q=1"},
+		{"POST", http.StatusPermanentRedirect, "https://example.com:" + httpsPort + "/docs/page.html?q=1"},
+	}
+
+	for _, tt := range tests {
+		req, _ := http.NewRequest(tt.method, "http://"+server.redirectAddr.String()+"/docs/page.html?q=1", nil)
+		req.Host = "example.com"
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+
+		if resp.StatusCode != tt.status {
+			t.Errorf("%s: Expected %d, got %d", tt.method, tt.status, resp.StatusCode)
+		}
+		if location := resp.Header.Get("Location"); location != tt.location {
+			t.Errorf("%s: Expected Location %q, got %q", tt.method, tt.location, location)
+		}
+		if hsts := resp.Header.Get("Strict-Transport-Security"); hsts != "" {
+			t.Errorf("%s: HSTS must not be sent over plain HTTP, got %q", tt.method, hsts)
+		}
+	}
+}
+
+func TestHTTPSRedirectOmitsDefaultPort(t *testing.T) {
+	req := httptest.NewRequest("GET", "/a?b=c", nil)
+	req.Host = "example.com:80"
+	w := httptest.NewRecorder()
+	httpsRedirectHandler("443").ServeHTTP(w, req)
+
+	if location := w.Header().Get("Location"); location != "https://example.com/a?b=c" {
+		t.Errorf("Expected Location %q, got %q", "https://example.com/a?b=c", location)
+	}
+}
+
+func TestHTTPSRedirectRequiresTLS(t *testing.T) {
+	if _, err := New(WithRoot(t.TempDir()), WithHTTPSRedirect(":80")); err == nil {
+		t.Error("Expected an HTTPS redirect without TLS to be rejected")
+	}
+}
+
+func TestAutoTLSServesHTTP01Challenge(t *testing.T) {
+	cacheDir := t.TempDir()
+
+	// A pending challenge as autocert stores it; issuance itself needs a CA
+	if err := os.WriteFile(filepath.Join(cacheDir, "token123+http-01"), []byte("token123.thumbprint"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	server, err := New(
+		WithRoot(t.TempDir()),
+		WithAutoTLS(cacheDir, "example.com"),
+		WithAddr("127.0.0.1:0"),
+		WithHTTPSRedirect("127.0.0.1:0"),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := server.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer server.Stop()
+
+	client := &http.Client{
+		CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+	}
+	get := func(path string) *http.Response {
+		req, _ := http.NewRequest("GET", "http://"+server.redirectAddr.String()+path, nil)
+		req.Host = "example.com"
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp
+	}
+
+	resp := get("/.well-known/acme-challenge/token123")
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || string(body) != "token123.thumbprint" {
+		t.Errorf("Expected the challenge response, got %d %q", resp.StatusCode, body)
+	}
+
+	// Everything else is still redirected to HTTPS
+	resp = get("/index.html")
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusMovedPermanently {
+		t.Errorf("Expected 301 outside the challenge path, got %d", resp.StatusCode)
+	}
+
+	if server.httpServer.TLSConfig.GetCertificate == nil {
+		t.Error("Expected certificates to come from the ACME manager")
+	}
+}
+
+func TestAutoTLSRequiresCacheDir(t *testing.T) {
+	if _, err := New(WithRoot(t.TempDir()), WithAutoTLS("", "example.com")); err == nil {
+		t.Error("Expected automatic TLS without a cache directory to be rejected")
+	}
+}
@@ -0,0 +1,256 @@
+// Package rediscache is an example gostc.Cache backed by Redis, so a fleet
+// of servers compresses each asset once and shares the result.
+//
+// It reaches Redis through the small Client interface rather than a specific
+// client library. With github.com/redis/go-redis/v9 an adapter looks like:
+//
+//	type goRedis struct{ *redis.Client }
+//
+//	func (c goRedis) Get(ctx context.Context, key string) ([]byte, error) {
+//		data, err := c.Client.Get(ctx, key).Bytes()
+//		if errors.Is(err, redis.Nil) {
+//			return nil, rediscache.ErrNotFound
+//		}
+//		return data, err
+//	}
+//
+//	func (c goRedis) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+//		return c.Client.Set(ctx, key, value, ttl).Err()
+//	}
+//
+//	func (c goRedis) Del(ctx context.Context, keys ...string) error {
+//		return c.Client.Del(ctx, keys...).Err()
+//	}
+//
+//	func (c goRedis) Keys(ctx context.Context, pattern string) ([]string, error) {
+//		var keys []string
+//		iter := c.Client.Scan(ctx, 0, pattern, 0).Iterator()
+//		for iter.Next(ctx) {
+//			keys = append(keys, iter.Val())
+//		}
+//		return keys, iter.Err()
+//	}
+//
+// and the cache is installed with
+//
+//	gostc.WithCacheBackend(rediscache.New(goRedis{rdb}, "gostc:", time.Hour))
+package rediscache
+
+import (
+	"bytes"
+	"context"
+	"encoding/gob"
+	"errors"
+	"log"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/7424labs/gostc"
+)
+
+// DefaultTimeout bounds each Redis round trip made on behalf of a request
+const DefaultTimeout = 100 * time.Millisecond
+
+// ErrNotFound is returned by Client.Get for a missing key
+var ErrNotFound = errors.New("rediscache: key not found")
+
+// Client is the subset of a Redis client the cache uses
+type Client interface {
+	Get(ctx context.Context, key string) ([]byte, error)
+	Set(ctx context.Context, key string, value []byte, ttl time.Duration) error
+	Del(ctx context.Context, keys ...string) error
+	Keys(ctx context.Context, pattern string) ([]string, error)
+}
+
+// Cache stores gob-encoded gostc.CacheEntry values in Redis under a key
+// prefix. Redis errors are logged and treated as misses, so an unreachable
+// Redis degrades to serving from disk.
+type Cache struct {
+	client  Client
+	prefix  string
+	ttl     time.Duration
+	timeout time.Duration
+
+	hits   atomic.Int64
+	misses atomic.Int64
+}
+
+// New returns a cache storing entries under prefix (e.g. "gostc:") that
+// expire after ttl (0 = never)
+func New(client Client, prefix string, ttl time.Duration) *Cache {
+	return &Cache{
+		client:  client,
+		prefix:  prefix,
+		ttl:     ttl,
+		timeout: DefaultTimeout,
+	}
+}
+
+func (c *Cache) context() (context.Context, context.CancelFunc) {
+	return context.WithTimeout(context.Background(), c.timeout)
+}
+
+func (c *Cache) redisKey(key gostc.CacheKey) string {
+	return c.prefix + key.String()
+}
+
+func (c *Cache) Get(key gostc.CacheKey) (*gostc.CacheEntry, bool) {
+	ctx, cancel := c.context()
+	defer cancel()
+
+	entry, err := c.get(ctx, c.redisKey(key))
+	if err != nil {
+		if !errors.Is(err, ErrNotFound) {
+			log.Printf("rediscache: get %s: %v", key, err)
+		}
+		c.misses.Add(1)
+		return nil, false
+	}
+
+	c.hits.Add(1)
+	return entry, true
+}
+
+func (c *Cache) get(ctx context.Context, redisKey string) (*gostc.CacheEntry, error) {
+	data, err := c.client.Get(ctx, redisKey)
+	if err != nil {
+		return nil, err
+	}
+
+	var entry gostc.CacheEntry
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(&entry); err != nil {
+		return nil, err
+	}
+	return &entry, nil
+}
+
+func (c *Cache) Set(key gostc.CacheKey, entry *gostc.CacheEntry) {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(entry); err != nil {
+		log.Printf("rediscache: encode %s: %v", key, err)
+		return
+	}
+
+	ctx, cancel := c.context()
+	defer cancel()
+
+	if err := c.client.Set(ctx, c.redisKey(key), buf.Bytes(), c.ttl); err != nil {
+		log.Printf("rediscache: set %s: %v", key, err)
+	}
+}
+
+func (c *Cache) Delete(key gostc.CacheKey) {
+	ctx, cancel := c.context()
+	defer cancel()
+
+	if err := c.client.Del(ctx, c.redisKey(key)); err != nil {
+		log.Printf("rediscache: delete %s: %v", key, err)
+	}
+}
+
+// Clear deletes every key under the prefix, including those written by
+// other servers sharing it
+func (c *Cache) Clear() {
+	ctx, cancel := c.context()
+	defer cancel()
+
+	keys, err := c.client.Keys(ctx, c.prefix+"*")
+	if err == nil && len(keys) > 0 {
+		err = c.client.Del(ctx, keys...)
+	}
+	if err != nil {
+		log.Printf("rediscache: clear: %v", err)
+	}
+}
+
+// Stats reports this server's hits and misses. Size and item counts would
+// need a scan of Redis and are left at zero.
+func (c *Cache) Stats() gostc.CacheStats {
+	return gostc.CacheStats{
+		Hits:   c.hits.Load(),
+		Misses: c.misses.Load(),
+	}
+}
+
+// Stop is a no-op; the Client is owned and closed by the caller
+func (c *Cache) Stop() {}
+
+func (c *Cache) Keys() []gostc.CacheKey {
+	ctx, cancel := c.context()
+	defer cancel()
+
+	redisKeys, err := c.client.Keys(ctx, c.prefix+"*")
+	if err != nil {
+		log.Printf("rediscache: keys: %v", err)
+		return nil
+	}
+
+	keys := make([]gostc.CacheKey, 0, len(redisKeys))
+	for _, redisKey := range redisKeys {
+		if key, ok := parseKey(strings.TrimPrefix(redisKey, c.prefix)); ok {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+// Entries fetches every entry under the prefix; meant for debugging only
+func (c *Cache) Entries() []gostc.CacheEntryInfo {
+	keys := c.Keys()
+
+	ctx, cancel := c.context()
+	defer cancel()
+
+	now := time.Now()
+	infos := make([]gostc.CacheEntryInfo, 0, len(keys))
+	for _, key := range keys {
+		entry, err := c.get(ctx, c.redisKey(key))
+		if err != nil {
+			continue
+		}
+		infos = append(infos, gostc.CacheEntryInfo{
+			Key:         key,
+			Size:        entry.Size,
+			Age:         now.Sub(entry.CreatedAt),
+			AccessCount: entry.AccessCount,
+		})
+	}
+	return infos
+}
+
+// parseKey reverses gostc.CacheKey.String, "path|compression|versioned".
+// The path itself may contain "|", so the fields are split from the right.
+func parseKey(s string) (gostc.CacheKey, bool) {
+	rest, versioned, ok := cutLast(s, "|")
+	if !ok {
+		return gostc.CacheKey{}, false
+	}
+	path, compression, ok := cutLast(rest, "|")
+	if !ok {
+		return gostc.CacheKey{}, false
+	}
+
+	isVersioned, err := strconv.ParseBool(versioned)
+	if err != nil {
+		return gostc.CacheKey{}, false
+	}
+	compressionType, err := strconv.Atoi(compression)
+	if err != nil {
+		return gostc.CacheKey{}, false
+	}
+
+	return gostc.CacheKey{
+		Path:        path,
+		Compression: gostc.CompressionType(compressionType),
+		IsVersioned: isVersioned,
+	}, true
+}
+
+func cutLast(s, sep string) (before, after string, found bool) {
+	if i := strings.LastIndex(s, sep); i >= 0 {
+		return s[:i], s[i+len(sep):], true
+	}
+	return s, "", false
+}
@@ -0,0 +1,111 @@
+package rediscache
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/7424labs/gostc"
+)
+
+// memoryClient implements Client with a map, ignoring TTLs
+type memoryClient struct {
+	mu   sync.Mutex
+	data map[string][]byte
+}
+
+func newMemoryClient() *memoryClient {
+	return &memoryClient{data: make(map[string][]byte)}
+}
+
+func (m *memoryClient) Get(ctx context.Context, key string) ([]byte, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	value, ok := m.data[key]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return value, nil
+}
+
+func (m *memoryClient) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.data[key] = value
+	return nil
+}
+
+func (m *memoryClient) Del(ctx context.Context, keys ...string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, key := range keys {
+		delete(m.data, key)
+	}
+	return nil
+}
+
+func (m *memoryClient) Keys(ctx context.Context, pattern string) ([]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var keys []string
+	for key := range m.data {
+		// Only prefix patterns ("gostc:*") are used by Cache
+		if strings.HasPrefix(key, strings.TrimSuffix(pattern, "*")) {
+			keys = append(keys, key)
+		}
+	}
+	return keys, nil
+}
+
+func TestCacheRoundTrip(t *testing.T) {
+	client := newMemoryClient()
+	client.Set(context.Background(), "other:key", []byte("untouched"), 0)
+
+	var cache gostc.Cache = New(client, "gostc:", time.Hour)
+
+	key := gostc.CacheKey{Path: "/a|b.css", Compression: gostc.Brotli, IsVersioned: true}
+	entry := &gostc.CacheEntry{
+		Data:         []byte("compressed"),
+		ContentType:  "text/css",
+		ETag:         `"abc"`,
+		LastModified: time.Now().UTC().Truncate(time.Second),
+		Size:         10,
+		Encoding:     gostc.Brotli,
+		Preload:      []string{"/font.woff2"},
+	}
+
+	if _, ok := cache.Get(key); ok {
+		t.Fatal("Expected a miss before Set")
+	}
+
+	cache.Set(key, entry)
+	got, ok := cache.Get(key)
+	if !ok {
+		t.Fatal("Expected a hit after Set")
+	}
+	if !bytes.Equal(got.Data, entry.Data) || got.ETag != entry.ETag || got.Encoding != entry.Encoding ||
+		!got.LastModified.Equal(entry.LastModified) || len(got.Preload) != 1 {
+		t.Errorf("Entry did not survive the round trip: %+v", got)
+	}
+
+	keys := cache.Keys()
+	if len(keys) != 1 || keys[0] != key {
+		t.Errorf("Expected Keys to parse back %v, got %v", key, keys)
+	}
+
+	stats := cache.Stats()
+	if stats.Hits != 1 || stats.Misses != 1 {
+		t.Errorf("Expected 1 hit and 1 miss, got %+v", stats)
+	}
+
+	cache.Clear()
+	if _, ok := cache.Get(key); ok {
+		t.Error("Expected Clear to remove the entry")
+	}
+	if _, err := client.Get(context.Background(), "other:key"); err != nil {
+		t.Error("Expected Clear to leave keys outside the prefix alone")
+	}
+}
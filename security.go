@@ -2,9 +2,12 @@ package gostc
 
 import (
 	"crypto/rand"
+	"crypto/sha256"
 	"crypto/subtle"
 	"encoding/base64"
+	"encoding/hex"
 	"net/http"
+	"strings"
 	"sync"
 	"time"
 )
@@ -148,6 +151,44 @@ func SecureCompare(a, b string) bool {
 	return subtle.ConstantTimeCompare([]byte(a), []byte(b)) == 1
 }
 
+// HashPassword returns the hex SHA-256 of password, the form stored in
+// Config.BasicAuthCredentials
+func HashPassword(password string) string {
+	sum := sha256.Sum256([]byte(password))
+	return hex.EncodeToString(sum[:])
+}
+
+// quotedStringEscaper escapes a value for an HTTP quoted-string, which only
+// needs backslashes and double quotes escaped (RFC 9110, section 5.6.4)
+var quotedStringEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`)
+
+// BasicAuthMiddleware requires credentials matching creds, a map of
+// usernames to HashPassword hashes. Hashes are compared in constant time,
+// and unknown users cost the same as wrong passwords.
+func BasicAuthMiddleware(realm string, creds map[string]string) Middleware {
+	challenge := `Basic realm="` + quotedStringEscaper.Replace(realm) + `", charset="UTF-8"`
+	unknownUser := HashPassword("")
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			user, password, ok := r.BasicAuth()
+			if ok {
+				expected, known := creds[user]
+				if !known {
+					expected = unknownUser
+				}
+				if SecureCompare(HashPassword(password), expected) && known {
+					next.ServeHTTP(w, r)
+					return
+				}
+			}
+
+			w.Header().Set("WWW-Authenticate", challenge)
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		})
+	}
+}
+
 // IPRateLimiter provides more sophisticated rate limiting with burst support
 type IPRateLimiter struct {
 	limiters    map[string]*TokenBucket
@@ -182,6 +223,13 @@ func NewIPRateLimiter(rate, burst int, ttl time.Duration) *IPRateLimiter {
 
 // Allow checks if a request from the given IP is allowed
 func (rl *IPRateLimiter) Allow(ip string) bool {
+	allowed, _, _ := rl.take(ip)
+	return allowed
+}
+
+// take consumes a token for ip when one is available and reports the tokens
+// left afterwards and when the bucket will be full again
+func (rl *IPRateLimiter) take(ip string) (allowed bool, remaining float64, resetAt time.Time) {
 	rl.mu.Lock()
 	limiter, exists := rl.limiters[ip]
 	if !exists {
@@ -197,22 +245,77 @@ func (rl *IPRateLimiter) Allow(ip string) bool {
 	defer limiter.mu.Unlock()
 
 	now := time.Now()
+	rl.refill(limiter, now)
+
+	// Check if request is allowed
+	if limiter.tokens >= 1 {
+		limiter.tokens--
+		allowed = true
+	}
+
+	return allowed, limiter.tokens, rl.fullAt(limiter.tokens, now)
+}
+
+// Peek reports the tokens ip has left and when its bucket will be full
+// again, without consuming a token. Unseen IPs have the full burst.
+func (rl *IPRateLimiter) Peek(ip string) (remaining float64, resetAt time.Time) {
+	now := time.Now()
+
+	rl.mu.RLock()
+	limiter, exists := rl.limiters[ip]
+	rl.mu.RUnlock()
+	if !exists {
+		return float64(rl.burst), now
+	}
+
+	limiter.mu.Lock()
+	defer limiter.mu.Unlock()
+
+	tokens := limiter.tokens + now.Sub(limiter.lastCheck).Seconds()*float64(rl.rate)
+	if tokens > float64(rl.burst) {
+		tokens = float64(rl.burst)
+	}
+	return tokens, rl.fullAt(tokens, now)
+}
+
+// refill adds the tokens earned since the bucket was last checked
+func (rl *IPRateLimiter) refill(limiter *TokenBucket, now time.Time) {
 	elapsed := now.Sub(limiter.lastCheck).Seconds()
 	limiter.lastCheck = now
 
-	// Add tokens based on elapsed time
 	limiter.tokens += elapsed * float64(rl.rate)
 	if limiter.tokens > float64(rl.burst) {
 		limiter.tokens = float64(rl.burst)
 	}
+}
 
-	// Check if request is allowed
-	if limiter.tokens >= 1 {
-		limiter.tokens--
-		return true
+// nextTokenIn returns how long a bucket holding tokens waits for the next
+// whole token
+func (rl *IPRateLimiter) nextTokenIn(tokens float64) time.Duration {
+	if tokens >= 1 {
+		return 0
+	}
+	if rl.rate <= 0 {
+		return time.Minute
 	}
+	return time.Duration((1 - tokens) / float64(rl.rate) * float64(time.Second))
+}
+
+// fullAt returns when a bucket holding tokens will have refilled to burst
+func (rl *IPRateLimiter) fullAt(tokens float64, now time.Time) time.Time {
+	if rl.rate <= 0 || tokens >= float64(rl.burst) {
+		return now
+	}
+	missing := float64(rl.burst) - tokens
+	return now.Add(time.Duration(missing / float64(rl.rate) * float64(time.Second)))
+}
+
+// Reset refills the bucket for ip, as if it had not been seen before
+func (rl *IPRateLimiter) Reset(ip string) {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
 
-	return false
+	delete(rl.limiters, ip)
 }
 
 // cleanup removes inactive IP entries
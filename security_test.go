@@ -0,0 +1,343 @@
+package gostc
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBasicAuth(t *testing.T) {
+	tmpDir := t.TempDir()
+	os.WriteFile(filepath.Join(tmpDir, "dashboard.html"), []byte("<h1>ok</h1>"), 0644)
+
+	server, err := New(
+		WithRoot(tmpDir),
+		WithWatcher(false),
+		WithBasicAuth("internal", map[string]string{"admin": "s3cret"}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		path     string
+		user     string
+		password string
+		code     int
+	}{
+		{"CorrectCredentials", "/dashboard.html", "admin", "s3cret", http.StatusOK},
+		{"WrongPassword", "/dashboard.html", "admin", "wrong", http.StatusUnauthorized},
+		{"UnknownUser", "/dashboard.html", "guest", "s3cret", http.StatusUnauthorized},
+		{"NoCredentials", "/dashboard.html", "", "", http.StatusUnauthorized},
+		{"MetricsProtected", "/metrics", "", "", http.StatusUnauthorized},
+		{"HealthBypass", "/health", "", "", http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", tt.path, nil)
+			if tt.user != "" {
+				req.SetBasicAuth(tt.user, tt.password)
+			}
+			w := httptest.NewRecorder()
+			server.ServeHTTP(w, req)
+
+			if w.Code != tt.code {
+				t.Fatalf("Expected %d, got %d", tt.code, w.Code)
+			}
+			if tt.code == http.StatusUnauthorized {
+				if challenge := w.Header().Get("WWW-Authenticate"); !strings.HasPrefix(challenge, `Basic realm="internal"`) {
+					t.Errorf("Expected a Basic challenge for realm internal, got %q", challenge)
+				}
+			}
+		})
+	}
+}
+
+func TestBasicAuthRealmQuoting(t *testing.T) {
+	tests := []struct {
+		realm string
+		want  string
+	}{
+		{`Équipe "ops"`, `Basic realm="Équipe \"ops\"", charset="UTF-8"`},
+		{`C:\admin`, `Basic realm="C:\\admin", charset="UTF-8"`},
+	}
+
+	for _, tt := range tests {
+		handler := BasicAuthMiddleware(tt.realm, nil)(http.NotFoundHandler())
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+
+		if challenge := w.Header().Get("WWW-Authenticate"); challenge != tt.want {
+			t.Errorf("Realm %q: expected challenge %q, got %q", tt.realm, tt.want, challenge)
+		}
+	}
+}
+
+func TestServeFileHTTPMiddlewares(t *testing.T) {
+	tmpDir := t.TempDir()
+	os.WriteFile(filepath.Join(tmpDir, "dashboard.html"), []byte("<h1>ok</h1>"), 0644)
+
+	server, err := New(
+		WithRoot(tmpDir),
+		WithWatcher(false),
+		WithBasicAuth("internal", map[string]string{"admin": "s3cret"}),
+		WithRequestDecompression(true),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	request := func(body io.Reader, encoding string, auth bool) int {
+		req := httptest.NewRequest("GET", "/dashboard.html", body)
+		if encoding != "" {
+			req.Header.Set("Content-Encoding", encoding)
+		}
+		if auth {
+			req.SetBasicAuth("admin", "s3cret")
+		}
+		w := httptest.NewRecorder()
+		server.ServeFileHTTP(w, req)
+		return w.Code
+	}
+
+	if code := request(nil, "", false); code != http.StatusUnauthorized {
+		t.Errorf("Expected 401 without credentials, got %d", code)
+	}
+	if code := request(nil, "", true); code != http.StatusOK {
+		t.Errorf("Expected 200 with credentials, got %d", code)
+	}
+
+	var gz bytes.Buffer
+	zw := gzip.NewWriter(&gz)
+	zw.Write([]byte("payload"))
+	zw.Close()
+	if code := request(&gz, "gzip", true); code != http.StatusOK {
+		t.Errorf("Expected 200 for a gzip body, got %d", code)
+	}
+	if code := request(strings.NewReader("not gzip"), "gzip", true); code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for a malformed gzip body, got %d", code)
+	}
+	if code := request(strings.NewReader("x"), "zstd", true); code != http.StatusUnsupportedMediaType {
+		t.Errorf("Expected 415 for an unsupported encoding, got %d", code)
+	}
+}
+
+func TestBasicAuthCredentialsRedacted(t *testing.T) {
+	server, err := New(
+		WithRoot(t.TempDir()),
+		WithWatcher(false),
+		WithBasicAuth("internal", map[string]string{"admin": "s3cret"}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	config := server.EffectiveConfig()
+	if config.BasicAuthCredentials["admin"] != HashPassword("s3cret") {
+		t.Errorf("Expected the password to be stored hashed, got %q", config.BasicAuthCredentials["admin"])
+	}
+	if redacted := config.Redacted(); redacted.BasicAuthCredentials["admin"] != redactedValue {
+		t.Errorf("Expected credentials to be redacted, got %q", redacted.BasicAuthCredentials["admin"])
+	}
+	if config.BasicAuthCredentials["admin"] == redactedValue {
+		t.Error("Redacted should not modify the original config")
+	}
+}
+
+func TestSecurePathSiblingPrefix(t *testing.T) {
+	parent := t.TempDir()
+	root := filepath.Join(parent, "www")
+	sibling := filepath.Join(parent, "www-secret")
+	os.MkdirAll(root, 0755)
+	os.MkdirAll(sibling, 0755)
+	os.WriteFile(filepath.Join(sibling, "secret.txt"), []byte("secret"), 0644)
+
+	if _, err := securePath(root, "../www-secret/secret.txt"); err == nil {
+		t.Error("Expected a path into a sibling directory to be rejected")
+	}
+
+	if fullPath, err := securePath(root, "/index.html"); err != nil || fullPath != filepath.Join(root, "index.html") {
+		t.Errorf("Expected a path inside root to resolve, got %q, %v", fullPath, err)
+	}
+
+	tests := []struct {
+		path, dir string
+		want      bool
+	}{
+		{sibling, root, false},
+		{filepath.Join(sibling, "secret.txt"), root, false},
+		{root, root, true},
+		{filepath.Join(root, "a", "b.txt"), root, true},
+		{filepath.Join(root, "..www"), root, true}, // a name starting with dots, not a parent
+		{filepath.Join(root, "a"), string(filepath.Separator), true},
+	}
+
+	for _, tt := range tests {
+		if got := isWithin(tt.path, tt.dir); got != tt.want {
+			t.Errorf("isWithin(%q, %q) = %v, want %v", tt.path, tt.dir, got, tt.want)
+		}
+	}
+}
+
+func TestRateLimitBurst(t *testing.T) {
+	tmpDir := t.TempDir()
+	os.WriteFile(filepath.Join(tmpDir, "app.txt"), []byte("ok"), 0644)
+
+	server, err := New(
+		WithRoot(tmpDir),
+		WithWatcher(false),
+		WithRateLimit(10),
+		WithRateLimitBurst(3),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// ServeHTTP and ServeFileHTTP draw from the same per-IP bucket
+	serves := []func(http.ResponseWriter, *http.Request){server.ServeHTTP, server.ServeFileHTTP}
+	request := func(i int) int {
+		w := httptest.NewRecorder()
+		serves[i%2](w, httptest.NewRequest("GET", "/app.txt", nil))
+		return w.Code
+	}
+
+	for i := 0; i < 3; i++ {
+		if code := request(i); code != http.StatusOK {
+			t.Fatalf("Request %d within the burst: expected 200, got %d", i, code)
+		}
+	}
+	if code := request(3); code != http.StatusTooManyRequests {
+		t.Fatalf("Expected 429 once the burst is spent, got %d", code)
+	}
+
+	// At 10 requests per second one token comes back every 100ms
+	time.Sleep(120 * time.Millisecond)
+	if code := request(4); code != http.StatusOK {
+		t.Errorf("Expected a refilled token to allow one request, got %d", code)
+	}
+	if code := request(5); code != http.StatusTooManyRequests {
+		t.Errorf("Expected the sustained rate to throttle again, got %d", code)
+	}
+}
+
+func TestResetRateLimit(t *testing.T) {
+	tmpDir := t.TempDir()
+	os.WriteFile(filepath.Join(tmpDir, "app.txt"), []byte("ok"), 0644)
+
+	server, err := New(
+		WithRoot(tmpDir),
+		WithWatcher(false),
+		WithRateLimit(1),
+		WithRateLimitBurst(1),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	request := func(remoteAddr string) int {
+		req := httptest.NewRequest("GET", "/app.txt", nil)
+		req.RemoteAddr = remoteAddr
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	request("192.0.2.1:1234")
+	request("198.51.100.7:1234")
+	if code := request("192.0.2.1:1234"); code != http.StatusTooManyRequests {
+		t.Fatalf("Expected the client to be throttled, got %d", code)
+	}
+
+	server.ResetRateLimit("192.0.2.1")
+	if code := request("192.0.2.1:1234"); code != http.StatusOK {
+		t.Errorf("Expected ResetRateLimit to restore capacity, got %d", code)
+	}
+	if code := request("198.51.100.7:1234"); code != http.StatusTooManyRequests {
+		t.Errorf("Expected other clients to stay throttled, got %d", code)
+	}
+}
+
+func TestRateLimitHeaders(t *testing.T) {
+	tmpDir := t.TempDir()
+	os.WriteFile(filepath.Join(tmpDir, "app.txt"), []byte("ok"), 0644)
+
+	server, err := New(
+		WithRoot(tmpDir),
+		WithWatcher(false),
+		WithRateLimit(2),
+		WithRateLimitBurst(5),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	headerInt := func(w *httptest.ResponseRecorder, name string) int64 {
+		t.Helper()
+		n, err := strconv.ParseInt(w.Header().Get(name), 10, 64)
+		if err != nil {
+			t.Fatalf("Expected numeric %s, got %q", name, w.Header().Get(name))
+		}
+		return n
+	}
+
+	for i := 0; i < 5; i++ {
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, httptest.NewRequest("GET", "/app.txt", nil))
+
+		if limit := headerInt(w, "X-RateLimit-Limit"); limit != 5 {
+			t.Errorf("Request %d: expected X-RateLimit-Limit 5, got %d", i, limit)
+		}
+		if remaining := headerInt(w, "X-RateLimit-Remaining"); remaining != int64(4-i) {
+			t.Errorf("Request %d: expected X-RateLimit-Remaining %d, got %d", i, 4-i, remaining)
+		}
+		// Refilling i+1 tokens at 2 per second takes about (i+1)/2 seconds
+		reset := time.Unix(headerInt(w, "X-RateLimit-Reset"), 0)
+		if until := time.Until(reset); until < 0 || until > time.Duration(i+1)*time.Second/2+time.Second {
+			t.Errorf("Request %d: X-RateLimit-Reset %v is not within the refill time", i, until)
+		}
+	}
+
+	req := httptest.NewRequest("GET", "/app.txt", nil)
+	req.Header.Set("Accept", "application/json")
+	w := httptest.NewRecorder()
+	server.ServeHTTP(w, req)
+
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("Expected 429 after the burst, got %d", w.Code)
+	}
+	if remaining := headerInt(w, "X-RateLimit-Remaining"); remaining != 0 {
+		t.Errorf("Expected X-RateLimit-Remaining 0 when throttled, got %d", remaining)
+	}
+	if retryAfter := headerInt(w, "Retry-After"); retryAfter != 1 {
+		t.Errorf("Expected Retry-After of 1s at 2 requests per second, got %d", retryAfter)
+	}
+	if ct := w.Header().Get("Content-Type"); ct != "application/json" {
+		t.Errorf("Expected a JSON body, got Content-Type %q", ct)
+	}
+	var body rateLimitJSON
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil || body.Error != "rate_limit_exceeded" || body.RetryAfter != 1 {
+		t.Errorf("Unexpected JSON body %q: %v", w.Body.String(), err)
+	}
+
+	// Clients that don't ask for JSON keep the plain-text body
+	w = httptest.NewRecorder()
+	server.ServeHTTP(w, httptest.NewRequest("GET", "/app.txt", nil))
+	if !strings.HasPrefix(w.Header().Get("Content-Type"), "text/plain") {
+		t.Errorf("Expected a plain-text body, got Content-Type %q", w.Header().Get("Content-Type"))
+	}
+
+	if remaining, resetAt := server.rateLimiter.Peek("192.0.2.1"); remaining >= 1 || !resetAt.After(time.Now()) {
+		t.Errorf("Expected Peek to report an empty bucket, got %v tokens, reset at %v", remaining, resetAt)
+	}
+}
@@ -1,13 +1,15 @@
 package gostc
 
 import (
+	"bytes"
 	"context"
 	"crypto/sha256"
+	"crypto/tls"
 	"encoding/hex"
+	"errors"
 	"fmt"
 	"io"
 	"log"
-	"mime"
 	"net"
 	"net/http"
 	"os"
@@ -16,13 +18,32 @@ import (
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	lru "github.com/hashicorp/golang-lru/v2"
+	"github.com/hashicorp/golang-lru/v2/expirable"
 	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"golang.org/x/crypto/acme"
+	"golang.org/x/crypto/acme/autocert"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+	"golang.org/x/sync/singleflight"
 )
 
+// Server serves static files. Its components are rebuilt as a unit by
+// Reload; everything else lives in serverState and is shared across reloads.
 type Server struct {
+	*components
+	*serverState
+}
+
+// components are everything built from a Config. Reload builds a new set
+// and swaps it in under mu; a set's fields are never reassigned once in
+// use, so the handlers bound to it (see setupHandler) need no lock.
+type components struct {
 	config         *Config
 	cache          Cache
 	compression    *CompressionManager
@@ -30,196 +51,383 @@ type Server struct {
 	versionManager *AssetVersionManager
 	htmlProcessor  *HTMLProcessor
 	handler        http.Handler
-	httpServer     *http.Server
-	metrics        *Metrics
+	fileHandler    http.Handler // handler's file route alone, for Handler() and ServeFileHTTP
 	csrfProtection *CSRFProtection
 	rateLimiter    *IPRateLimiter
 	errorHandler   *ErrorHandler
-	mu             sync.RWMutex
+	statCache      *expirable.LRU[string, os.FileInfo] // nil unless StatCacheTTL
+	headEntries    *lru.Cache[CacheKey, headEntry]     // HEAD metadata for files loaded before
+	notFound       *expirable.LRU[string, struct{}]    // URL paths found missing; nil unless NegativeCacheTTL
+	inflight       singleflight.Group
+	refreshing     sync.Map                   // CacheKeys with a stale-while-revalidate refresh running
+	caseLookups    *lru.Cache[string, string] // nil unless CaseInsensitivePaths
+	defaultFiles   *defaultFileEntries        // prepared Config.DefaultFiles responses
+}
+
+// serverState outlives Reload: the listener, metrics, hooks and counters
+type serverState struct {
+	httpServer     *http.Server
+	metrics        *Metrics
+	registry       *prometheus.Registry
+	stat           func(name string) (os.FileInfo, error)
+	open           func(name string) (*os.File, error)
+	onInvalidate   []func(path string) // registered by OnInvalidate
+	mu             sync.RWMutex        // guards the components swap during Reload
+	started        bool
+	ready          atomic.Bool  // readiness gate: set once started, cleared during Reload and Stop
+	rescanning     atomic.Bool  // a Reload is re-scanning assets for versioning
+	listenAddr     atomic.Value // net.Addr of the listener being served
+	redirectServer *http.Server // plain HTTP to HTTPS redirects, when HTTPSRedirectAddr is set
+	redirectAddr   net.Addr
+	certManager    *autocert.Manager // ACME certificates, when AutoTLSDomains is set
+	startedAt      time.Time
 	shutdown       chan struct{}
+	activeRequests atomic.Int64 // file requests being served, tracked with or without metrics
+	activeConns    atomic.Int64 // open connections on httpServer
+}
+
+// current returns a Server bound to the components in use now. They don't
+// change under it, so the caller can use it without holding mu.
+func (s *Server) current() *Server {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return &Server{components: s.components, serverState: s.serverState}
 }
 
 type Metrics struct {
-	requestsTotal     prometheus.Counter
+	requestsTotal     *prometheus.CounterVec
 	requestDuration   prometheus.Histogram
 	cacheHits         prometheus.Counter
 	cacheMisses       prometheus.Counter
+	cacheHitRatio     prometheus.GaugeFunc
+	cacheSize         prometheus.Gauge
+	compressionRatio  prometheus.Histogram
 	bytesServed       prometheus.Counter
 	activeConnections prometheus.Gauge
-}
 
-func New(opts ...Option) (*Server, error) {
-	config := DefaultConfig()
-	for _, opt := range opts {
-		opt(config)
-	}
-
-	// Validate configuration
-	if err := config.Validate(); err != nil {
-		return nil, fmt.Errorf("invalid configuration: %w", err)
-	}
-
-	cache, err := NewCache(config)
-	if err != nil {
-		return nil, err
-	}
-
-	compression := NewCompressionManager(config)
-	versionManager := NewAssetVersionManager(config)
-	htmlProcessor := NewHTMLProcessor(versionManager)
+	// Lookup totals behind cacheHitRatio, which counters can't be read back for
+	hits   atomic.Int64
+	misses atomic.Int64
+}
 
-	s := &Server{
-		config:         config,
-		cache:          cache,
-		compression:    compression,
-		versionManager: versionManager,
-		htmlProcessor:  htmlProcessor,
-		csrfProtection: NewCSRFProtection(time.Hour),
-		rateLimiter:    NewIPRateLimiter(config.RateLimitPerIP, config.RateLimitPerIP*10, 5*time.Minute),
-		errorHandler:   NewErrorHandler(config.Debug),
-		shutdown:       make(chan struct{}),
+// recordCacheLookup counts one cache lookup for a request as a hit or miss
+func (s *Server) recordCacheLookup(hit bool) {
+	if s.metrics == nil {
+		return
 	}
 
-	if config.EnableWatcher {
-		var watcher *FileWatcher
-		var err error
-
-		if config.EnableVersioning {
-			watcher, err = NewVersionedFileWatcher(config.Root, cache, compression, versionManager)
-		} else {
-			watcher, err = NewFileWatcher(config.Root, cache, compression)
-		}
-
-		if err != nil {
-			return nil, err
-		}
-		s.invalidator = watcher
+	if hit {
+		s.metrics.cacheHits.Inc()
+		s.metrics.hits.Add(1)
 	} else {
-		s.invalidator = NewManualInvalidator(cache)
+		s.metrics.cacheMisses.Inc()
+		s.metrics.misses.Add(1)
 	}
+}
 
-	if config.EnableMetrics {
-		s.setupMetrics()
+// hitRatio is the share of cache lookups that hit, or 0 before any lookup
+func (m *Metrics) hitRatio() float64 {
+	hits, misses := m.hits.Load(), m.misses.Load()
+	if hits+misses == 0 {
+		return 0
 	}
+	return float64(hits) / float64(hits+misses)
+}
 
-	// Initialize asset versioning if enabled
-	if config.EnableVersioning {
-		if err := s.versionManager.ScanDirectory(config.Root); err != nil {
-			return nil, fmt.Errorf("failed to scan directory for versioning: %w", err)
-		}
+func New(opts ...Option) (*Server, error) {
+	config := DefaultConfig()
+	for _, opt := range opts {
+		opt(config)
 	}
 
-	s.setupHandler()
-	s.setupHTTPServer()
-
-	return s, nil
+	return NewWithConfig(config)
 }
 
 func (s *Server) setupMetrics() {
-	s.metrics = &Metrics{
-		requestsTotal: prometheus.NewCounter(prometheus.CounterOpts{
-			Name: "gostc_requests_total",
-			Help: "Total number of requests",
-		}),
+	ns := s.config.MetricsNamespace
+	if ns == "" {
+		ns = DefaultMetricsNamespace
+	}
+
+	m := &Metrics{
+		requestsTotal: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: ns,
+			Name:      "requests_total",
+			Help:      "Total number of requests by method and status code",
+		}, []string{"method", "status"}),
 		requestDuration: prometheus.NewHistogram(prometheus.HistogramOpts{
-			Name:    "gostc_request_duration_seconds",
-			Help:    "Request duration in seconds",
-			Buckets: prometheus.DefBuckets,
+			Namespace: ns,
+			Name:      "request_duration_seconds",
+			Help:      "Request duration in seconds",
+			Buckets:   prometheus.DefBuckets,
 		}),
 		cacheHits: prometheus.NewCounter(prometheus.CounterOpts{
-			Name: "gostc_cache_hits_total",
-			Help: "Total number of cache hits",
+			Namespace: ns,
+			Name:      "cache_hits_total",
+			Help:      "Total number of cache hits",
 		}),
 		cacheMisses: prometheus.NewCounter(prometheus.CounterOpts{
-			Name: "gostc_cache_misses_total",
-			Help: "Total number of cache misses",
+			Namespace: ns,
+			Name:      "cache_misses_total",
+			Help:      "Total number of cache misses",
+		}),
+		cacheSize: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: ns,
+			Name:      "cache_size_bytes",
+			Help:      "Current size of cached entries in bytes",
+		}),
+		compressionRatio: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Namespace: ns,
+			Name:      "compression_ratio",
+			Help:      "Compressed size divided by original size",
+			Buckets:   prometheus.LinearBuckets(0.1, 0.1, 10),
 		}),
 		bytesServed: prometheus.NewCounter(prometheus.CounterOpts{
-			Name: "gostc_bytes_served_total",
-			Help: "Total bytes served",
+			Namespace: ns,
+			Name:      "bytes_served_total",
+			Help:      "Total bytes served",
 		}),
 		activeConnections: prometheus.NewGauge(prometheus.GaugeOpts{
-			Name: "gostc_active_connections",
-			Help: "Number of active connections",
+			Namespace: ns,
+			Name:      "active_connections",
+			Help:      "Number of active connections",
 		}),
 	}
-
-	prometheus.MustRegister(
+	m.cacheHitRatio = prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace: ns,
+		Name:      "cache_hit_ratio",
+		Help:      "Share of cache lookups that hit since start",
+	}, m.hitRatio)
+	s.metrics = m
+
+	// Each server owns its registry so several metrics-enabled servers can
+	// live in one process
+	s.registry = prometheus.NewRegistry()
+	s.registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
 		s.metrics.requestsTotal,
 		s.metrics.requestDuration,
 		s.metrics.cacheHits,
 		s.metrics.cacheMisses,
+		s.metrics.cacheHitRatio,
+		s.metrics.cacheSize,
+		s.metrics.compressionRatio,
 		s.metrics.bytesServed,
 		s.metrics.activeConnections,
 	)
 }
 
+// serveMetrics refreshes gauges sampled from server state and serves the
+// server's registry
+func (s *Server) serveMetrics(w http.ResponseWriter, r *http.Request) {
+	s.metrics.cacheSize.Set(float64(s.cache.Stats().Size))
+	promhttp.HandlerFor(s.registry, promhttp.HandlerOpts{}).ServeHTTP(w, r)
+}
+
+// setupHandler builds the mux and file handler bound to s. s must be a
+// generation whose components are never swapped, not the Server handed to
+// callers, so requests keep a consistent view across Reload.
 func (s *Server) setupHandler() {
 	mux := http.NewServeMux()
 
-	fileHandler := http.HandlerFunc(s.serveFile)
+	fileHandler := s.trackRequests(http.HandlerFunc(s.serveFile))
+
+	var middlewares []Middleware
+
+	// Outermost, so observers also see responses written by recovery
+	if s.config.RequestObserver != nil || s.config.ResponseObserver != nil {
+		middlewares = append(middlewares, ObserverMiddleware(s.config.RequestObserver, s.config.ResponseObserver))
+	}
 
-	middlewares := []Middleware{
+	middlewares = append(middlewares,
 		RecoveryMiddleware(),
 		LoggingMiddleware(),
 		SecurityHeadersMiddleware(s.config),
-		CORSMiddleware(s.config),
+	)
+
+	if len(s.config.ResponseHeaders) > 0 {
+		middlewares = append(middlewares, ResponseHeadersMiddleware(s.config.ResponseHeaders))
 	}
 
+	// Inside SecurityHeadersMiddleware, so preflights answered by CORS carry
+	// the security headers too
+	middlewares = append(middlewares, CORSMiddleware(s.config))
+
 	if s.config.RateLimitPerIP > 0 {
-		middlewares = append(middlewares, RateLimitMiddleware(s.config.RateLimitPerIP))
+		middlewares = append(middlewares, RateLimiterMiddleware(s.rateLimiter))
 	}
 
 	if s.config.MaxBodySize > 0 {
 		middlewares = append(middlewares, MaxBytesMiddleware(s.config.MaxBodySize))
 	}
 
+	if s.config.DecompressRequests {
+		middlewares = append(middlewares, DecompressRequestMiddleware(s.config.MaxBodySize))
+	}
+
 	if s.config.ReadTimeout > 0 {
 		middlewares = append(middlewares, TimeoutMiddleware(s.config.ReadTimeout))
 	}
 
+	// The health endpoint stays reachable without credentials
+	healthMiddlewares := middlewares
+	var authMiddlewares []Middleware
+	if len(s.config.BasicAuthCredentials) > 0 {
+		auth := BasicAuthMiddleware(s.config.BasicAuthRealm, s.config.BasicAuthCredentials)
+		middlewares = append(middlewares[:len(middlewares):len(middlewares)], auth)
+		authMiddlewares = append(authMiddlewares, auth)
+	}
+
+	// Applied after auth so rejected clients don't hold slots; /health and
+	// metrics stay responsive under load
+	if s.config.MaxConcurrency > 0 {
+		limiter := ConcurrencyLimitMiddleware(s.config.MaxConcurrency, s.config.QueueRequests)
+		middlewares = append(middlewares[:len(middlewares):len(middlewares)], limiter)
+	}
+
 	handler := ChainMiddleware(fileHandler, middlewares...)
+	s.fileHandler = handler
 
 	mux.Handle("/", handler)
 
 	if s.config.EnableMetrics {
-		mux.Handle(s.config.MetricsEndpoint, promhttp.Handler())
+		mux.Handle(s.config.MetricsEndpoint, ChainMiddleware(http.HandlerFunc(s.serveMetrics), authMiddlewares...))
 	}
 
-	healthHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		w.WriteHeader(http.StatusOK)
-		w.Write([]byte("OK"))
-	})
-	mux.Handle("/health", ChainMiddleware(healthHandler, middlewares...))
+	// Profiles can run for longer than ReadTimeout, so only the loopback
+	// guard and credentials apply
+	if s.config.EnablePprof {
+		pprofMiddlewares := append([]Middleware{LoopbackOnlyMiddleware()}, authMiddlewares...)
+		mux.Handle(pprofPrefix, ChainMiddleware(pprofHandler(), pprofMiddlewares...))
+	}
+
+	if s.config.ConfigEndpoint != "" {
+		configMiddlewares := append([]Middleware{LoopbackOnlyMiddleware()}, middlewares...)
+		mux.Handle(s.config.ConfigEndpoint, ChainMiddleware(http.HandlerFunc(s.serveConfig), configMiddlewares...))
+	}
+
+	if s.config.ImportMapEndpoint != "" {
+		mux.Handle(s.config.ImportMapEndpoint, ChainMiddleware(http.HandlerFunc(s.serveImportMap), middlewares...))
+	}
+
+	if s.config.CacheDebugEndpoint != "" {
+		debugMiddlewares := append([]Middleware{LoopbackOnlyMiddleware()}, middlewares...)
+		mux.Handle(s.config.CacheDebugEndpoint, ChainMiddleware(http.HandlerFunc(s.serveCacheDebug), debugMiddlewares...))
+	}
+
+	if s.config.ErrorsEndpoint != "" {
+		debugMiddlewares := append([]Middleware{LoopbackOnlyMiddleware()}, middlewares...)
+		mux.Handle(s.config.ErrorsEndpoint, ChainMiddleware(http.HandlerFunc(s.serveRecentErrors), debugMiddlewares...))
+	}
+
+	if s.config.CompressionStatsEndpoint != "" {
+		debugMiddlewares := append([]Middleware{LoopbackOnlyMiddleware()}, middlewares...)
+		mux.Handle(s.config.CompressionStatsEndpoint, ChainMiddleware(http.HandlerFunc(s.serveCompressionStats), debugMiddlewares...))
+	}
+
+	if s.config.HealthEndpoint != "" {
+		mux.Handle(s.config.HealthEndpoint, ChainMiddleware(http.HandlerFunc(s.serveHealth), healthMiddlewares...))
+	}
+
+	if s.config.LivenessEndpoint != "" {
+		mux.Handle(s.config.LivenessEndpoint, ChainMiddleware(http.HandlerFunc(s.serveLiveness), healthMiddlewares...))
+	}
+
+	if s.config.ReadinessEndpoint != "" {
+		mux.Handle(s.config.ReadinessEndpoint, ChainMiddleware(http.HandlerFunc(s.serveReadiness), healthMiddlewares...))
+	}
 
 	s.handler = mux
 }
 
 func (s *Server) setupHTTPServer() {
+	addr := s.config.Addr
+	if addr == "" {
+		addr = DefaultAddr
+	}
+
 	s.httpServer = &http.Server{
-		Addr:              ":8080",
-		Handler:           s.handler,
+		Addr:              addr,
+		Handler:           s,
 		ReadTimeout:       s.config.ReadTimeout,
 		ReadHeaderTimeout: s.config.ReadHeaderTimeout,
 		WriteTimeout:      s.config.WriteTimeout,
 		IdleTimeout:       s.config.IdleTimeout,
 		MaxHeaderBytes:    s.config.MaxHeaderBytes,
+
+		// Let ServeHTTP answer "OPTIONS *" with the Allow header
+		DisableGeneralOptionsHandler: true,
+	}
+
+	s.httpServer.ConnState = s.connStateHandler
+
+	// Plaintext HTTP/2 (h2c), for clients behind proxies that terminate TLS
+	// and speak HTTP/2 upstream. Registering the HTTP/2 server with
+	// httpServer lets Stop drain its connections too.
+	if s.config.HTTP2 && !s.config.EnableHTTPS {
+		h2s := &http2.Server{IdleTimeout: s.config.IdleTimeout}
+		if err := http2.ConfigureServer(s.httpServer, h2s); err != nil {
+			log.Printf("HTTP/2 setup failed, serving HTTP/1.1 only: %v", err)
+		} else {
+			s.httpServer.Handler = h2c.NewHandler(s, h2s)
+		}
+	}
+
+	if len(s.config.AutoTLSDomains) > 0 {
+		s.certManager = &autocert.Manager{
+			Prompt:     autocert.AcceptTOS,
+			HostPolicy: autocert.HostWhitelist(s.config.AutoTLSDomains...),
+			Cache:      autocert.DirCache(s.config.AutoTLSCacheDir),
+		}
+	}
+
+	if s.config.EnableHTTPS {
+		s.httpServer.TLSConfig = s.tlsConfig()
+		if !s.config.HTTP2 {
+			// A non-nil, empty map keeps net/http from enabling HTTP/2
+			s.httpServer.TLSNextProto = map[string]func(*http.Server, *tls.Conn, http.Handler){}
+		}
+	}
+}
+
+// tlsConfig returns a copy of Config.TLSConfig, or an empty config, with
+// NextProtos advertising HTTP/2 over ALPN only when HTTP2 is enabled. With
+// automatic TLS, certificates come from the ACME manager.
+func (s *Server) tlsConfig() *tls.Config {
+	cfg := &tls.Config{}
+	if s.config.TLSConfig != nil {
+		cfg = s.config.TLSConfig.Clone()
+	}
+
+	if len(cfg.NextProtos) == 0 {
+		if s.config.HTTP2 {
+			cfg.NextProtos = []string{"h2", "http/1.1"}
+		} else {
+			cfg.NextProtos = []string{"http/1.1"}
+		}
 	}
 
-	if s.config.MaxConnections > 0 {
-		s.httpServer.ConnState = s.connStateHandler
+	if s.certManager != nil {
+		cfg.GetCertificate = s.certManager.GetCertificate
+		cfg.NextProtos = append(cfg.NextProtos, acme.ALPNProto)
 	}
+	return cfg
 }
 
 func (s *Server) serveFile(w http.ResponseWriter, r *http.Request) {
 	if s.metrics != nil {
-		s.metrics.requestsTotal.Inc()
+		rw := wrapResponseWriter(w)
+		w = rw
 		defer func(start time.Time) {
+			s.metrics.requestsTotal.WithLabelValues(r.Method, strconv.Itoa(rw.status)).Inc()
 			s.metrics.requestDuration.Observe(time.Since(start).Seconds())
 		}(time.Now())
 	}
 
-	if r.Method != "GET" && r.Method != "HEAD" && r.Method != "OPTIONS" {
+	if !s.config.methodAllowed(r.Method) {
+		w.Header().Set("Allow", s.config.allowHeader())
 		err := NewServerError(ErrorTypeValidation, "server.serveFile", nil).
 			WithMessage("Method not allowed").
 			WithStatusCode(http.StatusMethodNotAllowed)
@@ -227,6 +435,13 @@ func (s *Server) serveFile(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// OPTIONS only asks which methods apply, which is the same for every path
+	if r.Method == "OPTIONS" {
+		w.Header().Set("Allow", s.config.allowHeader())
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
 	// Apply request size limit for all methods
 	if r.ContentLength > 0 && r.ContentLength > s.config.MaxBodySize {
 		err := NewServerError(ErrorTypeValidation, "server.serveFile", ErrRequestTooLarge).
@@ -249,16 +464,51 @@ func (s *Server) serveFile(w http.ResponseWriter, r *http.Request) {
 	isVersioned := false
 
 	// Check if this is a versioned asset path and resolve to original
-	if s.config.EnableVersioning && s.versionManager.IsVersionedPath(urlPath) {
-		if resolvedPath, exists := s.versionManager.GetOriginalPath(urlPath); exists {
-			originalPath = resolvedPath
-			isVersioned = true
+	if s.config.EnableVersioning {
+		versionedPath := urlPath
+		if s.config.VersioningMode == VersionQuery {
+			// A v that doesn't match the current hash is served unversioned
+			versionedPath = queryVersionedPath(urlPath, r.URL.Query().Get("v"))
+		}
+
+		if s.versionManager.IsVersionedPath(versionedPath) {
+			if resolvedPath, exists := s.versionManager.GetOriginalPath(versionedPath); exists {
+				originalPath = resolvedPath
+				isVersioned = true
+			}
+		} else if s.rescanning.Load() && s.versionManager.looksVersioned(versionedPath) {
+			// Likely an asset the running scan hasn't registered yet
+			w.Header().Set("Retry-After", "1")
+			err := NewServerError(ErrorTypeServerError, "server.resolveVersion", ErrScanInProgress).
+				WithPath(urlPath).
+				WithMessage("Asset versions are being rescanned").
+				WithStatusCode(http.StatusServiceUnavailable)
+			s.errorHandler.HandleError(w, r, err)
+			return
 		}
 	}
 
 	// Clean and secure the path
 	cleanedPath := path.Clean("/" + strings.TrimPrefix(originalPath, "/"))
-	fullPath, err := securePath(s.config.Root, cleanedPath)
+	if !s.config.dotfileAllowed(cleanedPath) {
+		serverErr := NewServerError(ErrorTypeNotFound, "server.dotfilePolicy", os.ErrNotExist).
+			WithPath(originalPath)
+		s.errorHandler.HandleError(w, r, serverErr)
+		return
+	}
+
+	// Registered in-memory files never touch the disk
+	if file, ok := s.config.DefaultFiles[cleanedPath]; ok {
+		compressor, compressionType, ok := s.negotiateEncoding(w, r, originalPath)
+		if !ok {
+			return
+		}
+		s.serveDefaultFile(w, r, cleanedPath, file, compressor, compressionType)
+		return
+	}
+
+	root, relPath := s.config.resolveRoot(cleanedPath)
+	fullPath, err := securePath(root, relPath)
 	if err != nil {
 		serverErr := NewServerError(ErrorTypeSecurity, "server.securePath", ErrPathTraversal).
 			WithPath(originalPath)
@@ -266,8 +516,41 @@ func (s *Server) serveFile(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	acceptEncoding := r.Header.Get("Accept-Encoding")
-	compressor, compressionType := s.compression.GetCompressor(acceptEncoding)
+	// Negotiate pre-rendered image variants from client hints
+	if len(s.config.ClientHintWidths) > 0 && isClientHintImage(cleanedPath) {
+		w.Header().Set("Accept-CH", "DPR, Width")
+		addVary(w.Header(), "DPR", "Width")
+
+		if variantURL, variantPath, ok := s.resolveImageVariant(r, cleanedPath, fullPath); ok {
+			r = r.Clone(r.Context())
+			r.URL.Path = variantURL
+			urlPath = variantURL
+			originalPath = variantURL
+			fullPath = variantPath
+		}
+	}
+
+	// Negotiate localized pages (index.fr.html) from Accept-Language, for a
+	// directory by its index file
+	if s.config.ContentNegotiation {
+		if docURL, docPath, ok := s.localizableDocument(r, cleanedPath, fullPath); ok {
+			addVary(w.Header(), "Accept-Language")
+
+			if variantURL, variantPath, lang, ok := s.resolveLanguageVariant(r, docURL, docPath); ok {
+				r = r.Clone(r.Context())
+				r.URL.Path = variantURL
+				urlPath = variantURL
+				originalPath = variantURL
+				fullPath = variantPath
+				w.Header().Set("Content-Language", lang)
+			}
+		}
+	}
+
+	compressor, compressionType, ok := s.negotiateEncoding(w, r, originalPath)
+	if !ok {
+		return
+	}
 
 	cacheKey := CacheKey{
 		Path:        urlPath,
@@ -275,23 +558,49 @@ func (s *Server) serveFile(w http.ResponseWriter, r *http.Request) {
 		IsVersioned: isVersioned,
 	}
 
+	// Each request records one lookup: the entry, the not-found cache, or
+	// for a directory listing, the listing cache
 	if entry, ok := s.cache.Get(cacheKey); ok {
-		if s.metrics != nil {
-			s.metrics.cacheHits.Inc()
+		fresh := s.config.StaleWhileRevalidate <= 0 || time.Since(entry.CreatedAt) <= s.config.CacheTTL
+		if fresh || getFileType(urlPath) == DynamicAsset && !isVersioned {
+			s.recordCacheLookup(true)
+
+			if !fresh {
+				s.refreshInBackground(r, cacheKey, fullPath, compressor, originalPath)
+			}
+			s.setContentDisposition(w, originalPath)
+			s.serveFromCache(w, r, entry, compressionType, isVersioned)
+			return
 		}
+	}
 
-		s.serveFromCache(w, r, entry, compressionType, isVersioned)
+	// Checked only after a miss, so served files don't pay for it
+	if s.isCachedNotFound(urlPath) {
+		s.recordCacheLookup(true)
+
+		serverErr := NewServerError(ErrorTypeNotFound, "server.negativeCache", os.ErrNotExist).
+			WithPath(originalPath)
+		s.errorHandler.HandleError(w, r, serverErr)
 		return
 	}
 
-	if s.metrics != nil {
-		s.metrics.cacheMisses.Inc()
+	info, err := s.cachedStat(fullPath)
+	if err != nil || !info.IsDir() {
+		s.recordCacheLookup(false)
 	}
-
-	info, err := os.Stat(fullPath)
 	if err != nil {
 		var serverErr *ServerError
 		if os.IsNotExist(err) {
+			if s.caseLookups != nil {
+				if canonical, ok := s.resolveCaseInsensitive(cleanedPath); ok && canonical != cleanedPath {
+					if strings.HasSuffix(r.URL.Path, "/") {
+						canonical += "/"
+					}
+					redirectRelative(w, r, canonical)
+					return
+				}
+			}
+			s.cacheNotFound(urlPath)
 			serverErr = NewServerError(ErrorTypeNotFound, "server.stat", err).
 				WithPath(originalPath)
 		} else if os.IsPermission(err) {
@@ -305,17 +614,35 @@ func (s *Server) serveFile(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if s.config.CanonicalRedirects && !isVersioned {
+		// Directories are canonical with a trailing slash
+		if info.IsDir() && !strings.HasSuffix(r.URL.Path, "/") {
+			s.recordCacheLookup(false)
+			redirectRelative(w, r, cleanedPath+"/")
+			return
+		}
+
+		// The index file the directory would serve is canonical as the directory
+		if !info.IsDir() {
+			if name, _, ok := s.findIndexFile(filepath.Dir(fullPath)); ok && name == path.Base(cleanedPath) {
+				redirectRelative(w, r, strings.TrimSuffix(path.Dir(cleanedPath), "/")+"/")
+				return
+			}
+		}
+	}
+
 	if info.IsDir() {
-		indexPath := filepath.Join(fullPath, s.config.IndexFile)
-		if indexInfo, err := os.Stat(indexPath); err == nil && !indexInfo.IsDir() {
-			fullPath = indexPath
+		if name, indexInfo, ok := s.findIndexFile(fullPath); ok {
+			s.recordCacheLookup(false)
+			fullPath = filepath.Join(fullPath, name)
 			info = indexInfo
-			originalPath = filepath.Join(originalPath, s.config.IndexFile)
+			originalPath = filepath.Join(originalPath, name)
 			urlPath = originalPath
 		} else if s.config.AllowBrowsing {
-			s.serveDirectory(w, r, fullPath)
+			s.serveDirectory(w, r, fullPath, info, compressor, compressionType)
 			return
 		} else {
+			s.recordCacheLookup(false)
 			err := NewServerError(ErrorTypeNotFound, "server.serveFile", nil).
 				WithPath(originalPath).
 				WithMessage("Directory listing disabled")
@@ -324,232 +651,486 @@ func (s *Server) serveFile(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
+	s.setContentDisposition(w, originalPath)
 	s.serveFileWithCompression(w, r, fullPath, info, compressor, compressionType, isVersioned, originalPath)
 }
 
+// negotiateEncoding picks the compressor for the request's Accept-Encoding.
+// It answers 406 and returns ok=false when nothing we offer is acceptable.
+func (s *Server) negotiateEncoding(w http.ResponseWriter, r *http.Request, originalPath string) (compressor Compressor, compressionType CompressionType, ok bool) {
+	acceptEncoding := r.Header.Get("Accept-Encoding")
+	compressor, compressionType = s.compression.GetCompressor(acceptEncoding)
+
+	// Identity is the fallback for every other coding, so it can only be
+	// refused outright when nothing we offer is acceptable
+	if compressionType == NoCompression && identityRefused(acceptEncoding) {
+		addVary(w.Header(), "Accept-Encoding")
+		err := NewServerError(ErrorTypeValidation, "server.negotiateEncoding", ErrNotAcceptable).
+			WithPath(originalPath).
+			WithMessage("No acceptable content encoding").
+			WithStatusCode(http.StatusNotAcceptable)
+		s.errorHandler.HandleError(w, r, err)
+		return nil, NoCompression, false
+	}
+
+	return compressor, compressionType, true
+}
+
+// findIndexFile returns the first of the configured index files that
+// exists as a regular file in dir
+func (s *Server) findIndexFile(dir string) (string, os.FileInfo, bool) {
+	for _, name := range s.config.indexFiles() {
+		if info, err := s.cachedStat(filepath.Join(dir, name)); err == nil && !info.IsDir() {
+			return name, info, true
+		}
+	}
+	return "", nil, false
+}
+
+// serveFromCache writes entry for a request that negotiated compressionType.
+// The body is sent in entry.Encoding, which may be identity when compression
+// was skipped for this entry.
 func (s *Server) serveFromCache(w http.ResponseWriter, r *http.Request, entry *CacheEntry, compressionType CompressionType, isVersioned bool) {
 	w.Header().Set("Content-Type", entry.ContentType)
-	w.Header().Set("ETag", entry.ETag)
+	if entry.Encoding != NoCompression {
+		w.Header().Set("ETag", weakETag(entry.ETag))
+	} else {
+		w.Header().Set("ETag", entry.ETag)
+	}
 	w.Header().Set("Last-Modified", entry.LastModified.UTC().Format(http.TimeFormat))
-	w.Header().Set("Cache-Control", getCacheControl(r.URL.Path, s.config, isVersioned))
+	w.Header().Set("Cache-Control", s.cacheControl(r, isVersioned))
+	for _, asset := range entry.Preload {
+		w.Header().Add("Link", preloadLink(asset))
+	}
 
-	if compressionType != NoCompression {
-		w.Header().Set("Content-Encoding", getEncodingName(compressionType))
-		w.Header().Set("Vary", "Accept-Encoding")
+	if entry.Encoding != NoCompression {
+		w.Header().Set("Content-Encoding", getEncodingName(entry.Encoding))
+		addVary(w.Header(), "Accept-Encoding")
+	} else if compressionType != NoCompression {
+		addVary(w.Header(), "Accept-Encoding")
 	}
 
-	// Check If-None-Match (ETag)
-	if r.Header.Get("If-None-Match") == entry.ETag {
+	// Check If-None-Match (ETag). Conditionals come before the HEAD branch so
+	// a HEAD revalidation gets the same bodiless 304 a GET would.
+	if inm := r.Header.Get("If-None-Match"); inm != "" && etagMatches(inm, entry.ETag) {
 		w.WriteHeader(http.StatusNotModified)
 		return
 	}
 
-	// Check If-Modified-Since
-	if ims := r.Header.Get("If-Modified-Since"); ims != "" {
+	// Check If-Modified-Since, which If-None-Match overrides (RFC 7232 3.3).
+	// Last-Modified only carries whole seconds, so compare at that precision.
+	if ims := r.Header.Get("If-Modified-Since"); ims != "" && r.Header.Get("If-None-Match") == "" {
 		imsTime, err := http.ParseTime(ims)
-		if err == nil && !entry.LastModified.After(imsTime) {
+		if err == nil && !entry.LastModified.Truncate(time.Second).After(imsTime.Truncate(time.Second)) {
 			w.WriteHeader(http.StatusNotModified)
 			return
 		}
 	}
 
+	// Byte ranges are only offered on identity bodies
+	if entry.Encoding == NoCompression {
+		w.Header().Set("Accept-Ranges", "bytes")
+
+		if rangeHeader := r.Header.Get("Range"); rangeHeader != "" && r.Method == "GET" && ifRangeMatches(r, entry) {
+			if s.serveRange(w, entry, rangeHeader) {
+				return
+			}
+		}
+	}
+
+	// HEAD reports the length a GET would send for this same variant. Entries
+	// remembered for HEAD carry it in Size, without the body.
+	length := int64(len(entry.Data))
+	if entry.Data == nil {
+		length = entry.Size
+	}
+	w.Header().Set("Content-Length", strconv.FormatInt(length, 10))
 	if r.Method == "HEAD" {
-		w.Header().Set("Content-Length", strconv.FormatInt(entry.Size, 10))
 		return
 	}
 
-	w.Header().Set("Content-Length", strconv.FormatInt(int64(len(entry.Data)), 10))
-	w.Write(entry.Data)
+	s.writeBody(w, entry.Data)
+}
+
+func (s *Server) serveFileWithCompression(w http.ResponseWriter, r *http.Request, fullPath string, info os.FileInfo, compressor Compressor, compressionType CompressionType, isVersioned bool, originalPath string) {
+	key := CacheKey{Path: r.URL.Path, Compression: compressionType, IsVersioned: isVersioned}
 
-	if s.metrics != nil {
-		s.metrics.bytesServed.Add(float64(len(entry.Data)))
+	// A HEAD only needs the headers and length a GET produced before
+	if r.Method == http.MethodHead {
+		if entry, ok := s.headFor(key, info); ok {
+			s.serveFromCache(w, r, entry, compressionType, isVersioned)
+			return
+		}
+	}
+
+	// Concurrent misses for the same key share a single read and compression
+	for {
+		v, err, _ := s.inflight.Do(key.String(), func() (interface{}, error) {
+			return s.loadEntry(r, key, fullPath, info, compressor, originalPath)
+		})
+		if err == nil {
+			s.serveFromCache(w, r, v.(*CacheEntry), compressionType, isVersioned)
+			return
+		}
+
+		if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+			if r.Context().Err() != nil {
+				log.Printf("Client disconnected while reading %s: %v", originalPath, r.Context().Err())
+				return
+			}
+			// The shared read belonged to a client that went away; load again
+			continue
+		}
+
+		s.errorHandler.HandleError(w, r, err)
+		return
 	}
 }
 
-func (s *Server) serveFileWithCompression(w http.ResponseWriter, r *http.Request, fullPath string, info os.FileInfo, compressor Compressor, compressionType CompressionType, isVersioned bool, originalPath string) {
-	file, err := os.Open(fullPath)
+// refreshInBackground reloads a stale entry without blocking the request.
+// At most one refresh per key runs at a time.
+func (s *Server) refreshInBackground(r *http.Request, key CacheKey, fullPath string, compressor Compressor, originalPath string) {
+	if _, running := s.refreshing.LoadOrStore(key, struct{}{}); running {
+		return
+	}
+
+	// Detach from the request so the refresh outlives it
+	r = r.Clone(context.Background())
+
+	go func() {
+		defer s.refreshing.Delete(key)
+
+		info, err := s.stat(fullPath)
+		if err != nil || info.IsDir() {
+			s.cache.Delete(key)
+			return
+		}
+
+		s.inflight.Do(key.String(), func() (interface{}, error) {
+			return s.loadEntry(r, key, fullPath, info, compressor, originalPath)
+		})
+	}()
+}
+
+// loadEntry reads the file at fullPath, applies HTML processing and the
+// negotiated compression, and stores the result in the cache
+func (s *Server) loadEntry(r *http.Request, key CacheKey, fullPath string, info os.FileInfo, compressor Compressor, originalPath string) (*CacheEntry, error) {
+	file, err := s.open(fullPath)
 	if err != nil {
-		var serverErr *ServerError
 		if os.IsPermission(err) {
-			serverErr = NewServerError(ErrorTypePermission, "server.openFile", err).
-				WithPath(fullPath)
-		} else {
-			serverErr = NewServerError(ErrorTypeServerError, "server.openFile", err).
+			return nil, NewServerError(ErrorTypePermission, "server.openFile", err).
 				WithPath(fullPath)
 		}
-		s.errorHandler.HandleError(w, r, serverErr)
-		return
+		return nil, NewServerError(ErrorTypeServerError, "server.openFile", err).
+			WithPath(fullPath)
 	}
 	defer SafeClose(file)
 
-	// Limit the amount of data read to prevent memory exhaustion
-	limitedReader := io.LimitReader(file, s.config.MaxFileSize)
-	data, err := io.ReadAll(limitedReader)
+	// Limit the amount of data read to prevent memory exhaustion. One byte
+	// past the limit is enough to tell a file at the limit from a larger one.
+	limitedReader := io.LimitReader(file, s.config.MaxFileSize+1)
+	data, err := readAllContext(r.Context(), limitedReader)
 	if err != nil {
-		serverErr := NewServerError(ErrorTypeServerError, "server.readFile", err).
+		if ctxErr := r.Context().Err(); ctxErr != nil && errors.Is(err, ctxErr) {
+			return nil, err
+		}
+		return nil, NewServerError(ErrorTypeServerError, "server.readFile", err).
 			WithPath(fullPath)
-		s.errorHandler.HandleError(w, r, serverErr)
-		return
 	}
 
-	// Check if file exceeded size limit
-	if int64(len(data)) == s.config.MaxFileSize {
-		// Try to read one more byte to check if file is larger
-		if _, err := file.Read(make([]byte, 1)); err == nil {
-			serverErr := NewServerError(ErrorTypeValidation, "server.readFile", ErrFileTooLarge).
-				WithPath(fullPath).
-				WithMessage(fmt.Sprintf("File exceeds maximum size of %d bytes", s.config.MaxFileSize))
-			s.errorHandler.HandleError(w, r, serverErr)
-			return
-		}
+	if int64(len(data)) > s.config.MaxFileSize {
+		return nil, NewServerError(ErrorTypeValidation, "server.readFile", ErrFileTooLarge).
+			WithPath(fullPath).
+			WithMessage(fmt.Sprintf("File exceeds maximum size of %d bytes", s.config.MaxFileSize))
 	}
 
-	contentType := mime.TypeByExtension(filepath.Ext(fullPath))
+	contentType := s.config.contentTypeByExtension(fullPath)
 	if contentType == "" {
-		contentType = http.DetectContentType(data[:512])
+		contentType = http.DetectContentType(data)
 	}
 
 	// Register asset for versioning if enabled and not already registered
-	if s.config.EnableVersioning && !isVersioned && s.versionManager.shouldVersionFile(originalPath) {
+	if s.config.EnableVersioning && !key.IsVersioned && s.versionManager.shouldVersionFile(originalPath) {
 		s.versionManager.RegisterAsset(originalPath, data)
 	}
 
-	etag := generateETag(data)
-	lastModified := info.ModTime()
-
-	w.Header().Set("Content-Type", contentType)
-	w.Header().Set("ETag", etag)
-	w.Header().Set("Last-Modified", lastModified.UTC().Format(http.TimeFormat))
-	w.Header().Set("Cache-Control", getCacheControl(r.URL.Path, s.config, isVersioned))
-
-	// Check If-None-Match (ETag)
-	if r.Header.Get("If-None-Match") == etag {
-		w.WriteHeader(http.StatusNotModified)
-		return
-	}
-
-	// Check If-Modified-Since
-	if ims := r.Header.Get("If-Modified-Since"); ims != "" {
-		imsTime, err := http.ParseTime(ims)
-		if err == nil && !lastModified.After(imsTime) {
-			w.WriteHeader(http.StatusNotModified)
-			return
+	// Process HTML and CSS files to inject versioned asset references BEFORE compression
+	processedData := data
+	var preload []string
+	rewritten := true
+	if s.config.EnableVersioning && strings.Contains(contentType, "text/html") {
+		if s.config.PreloadHeaders {
+			processedData, preload = s.htmlProcessor.ProcessHTMLWithAssets(data, originalPath)
+		} else {
+			processedData = s.htmlProcessor.ProcessHTML(data, originalPath)
 		}
+	} else if s.config.EnableVersioning && strings.Contains(contentType, "text/css") {
+		processedData = s.htmlProcessor.ProcessCSS(data, originalPath)
+	} else {
+		rewritten = false
 	}
 
-	// Process HTML files to inject versioned asset references BEFORE compression
-	processedData := data
-	if s.config.EnableVersioning && (contentType == "text/html" || strings.Contains(contentType, "text/html")) {
-		processedData = s.htmlProcessor.ProcessHTML(data, originalPath)
-		// Update ETag after HTML processing since content changed
+	// ETags describe the uncompressed body; encoded variants send them weak
+	var etag string
+	if s.config.ETagAlgorithm == ETagModTime && !rewritten {
+		etag = modTimeETag(info)
+	} else {
 		etag = generateETag(processedData)
 	}
 
-	shouldCompress := compressor != nil && compressionType != NoCompression &&
-		s.compression.ShouldCompress(contentType, info.Size())
+	entry := &CacheEntry{
+		Data:         processedData,
+		ContentType:  contentType,
+		ETag:         etag,
+		LastModified: info.ModTime().Truncate(time.Second), // the precision of Last-Modified
+		Size:         int64(len(processedData)),
+		Preload:      preload,
+	}
 
-	var responseData []byte
-	if shouldCompress {
-		compressed, err := compressor.Compress(processedData, s.config.CompressionLevel)
-		if err == nil {
-			responseData = compressed
-			w.Header().Set("Content-Encoding", getEncodingName(compressionType))
-			w.Header().Set("Vary", "Accept-Encoding")
-
-			entry := &CacheEntry{
-				Data:         responseData,
-				ContentType:  contentType,
-				ETag:         etag,
-				LastModified: lastModified,
-				Size:         int64(len(responseData)),
-			}
-			s.cache.Set(CacheKey{Path: r.URL.Path, Compression: compressionType, IsVersioned: isVersioned}, entry)
-		} else {
-			responseData = processedData
+	compressible := s.compression.ShouldCompressFile(fullPath, contentType, info.Size())
+	if compressible && s.config.EagerCompression {
+		s.cacheVariants(r, key, entry, fullPath)
+	}
+
+	if compressor != nil && key.Compression != NoCompression && compressible {
+		persistent, err := s.compressEntry(r, entry, compressor, key.Compression, fullPath)
+		if err != nil {
+			return nil, err
 		}
-	} else {
-		responseData = processedData
 
-		entry := &CacheEntry{
-			Data:         responseData,
-			ContentType:  contentType,
-			ETag:         etag,
-			LastModified: lastModified,
-			Size:         int64(len(responseData)),
+		// Transient fallbacks to identity are only cached under the identity key
+		if !persistent {
+			key.Compression = NoCompression
 		}
-		s.cache.Set(CacheKey{Path: r.URL.Path, Compression: NoCompression, IsVersioned: isVersioned}, entry)
 	}
 
-	if r.Method == "HEAD" {
-		w.Header().Set("Content-Length", strconv.FormatInt(int64(len(responseData)), 10))
-		return
+	// Copied before the cache shares entry with other requests
+	s.rememberHead(key, info, entry)
+	s.cache.Set(key, entry)
+	return entry, nil
+}
+
+// readChunkSize is how much readAllContext reads between cancellation checks
+const readChunkSize = 32 * 1024
+
+// readAllContext is io.ReadAll that gives up with ctx.Err() once ctx is done,
+// so a client that disconnects mid-read doesn't keep a slow read going
+func readAllContext(ctx context.Context, r io.Reader) ([]byte, error) {
+	var buf bytes.Buffer
+	for {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		n, err := io.CopyN(&buf, r, readChunkSize)
+		if err == io.EOF || err == nil && n < readChunkSize {
+			return buf.Bytes(), nil
+		}
+		if err != nil {
+			return nil, err
+		}
 	}
+}
 
-	w.Header().Set("Content-Length", strconv.FormatInt(int64(len(responseData)), 10))
-	w.Write(responseData)
+// cacheVariants stores entry, still uncompressed, under every other enabled
+// encoding of key, so later clients hit the cache whatever they accept
+func (s *Server) cacheVariants(r *http.Request, key CacheKey, entry *CacheEntry, sourcePath string) {
+	for _, compressionType := range allCompressionTypes() {
+		if compressionType == key.Compression ||
+			compressionType != NoCompression && s.config.Compression&compressionType == 0 {
+			continue
+		}
 
-	if s.metrics != nil {
-		s.metrics.bytesServed.Add(float64(len(responseData)))
+		variant := *entry
+		if compressionType != NoCompression {
+			compressor := s.compression.compressorFor(compressionType)
+			if compressor == nil {
+				continue
+			}
+			persistent, err := s.compressEntry(r, &variant, compressor, compressionType, sourcePath)
+			if err != nil || !persistent {
+				continue
+			}
+		}
+
+		variantKey := key
+		variantKey.Compression = compressionType
+		s.cache.Set(variantKey, &variant)
 	}
 }
 
-func (s *Server) serveDirectory(w http.ResponseWriter, r *http.Request, dirPath string) {
-	entries, err := os.ReadDir(dirPath)
+// compressEntry replaces entry's body with its compressed form when that
+// saves at least MinCompressionSavings. Bodies that barely shrink stay
+// identity, a decision worth caching under the compressed key. persistent is
+// false when compression was skipped for a transient reason such as busy
+// slots or a compressor failure.
+func (s *Server) compressEntry(r *http.Request, entry *CacheEntry, compressor Compressor, compressionType CompressionType, sourcePath string) (persistent bool, err error) {
+	// Fall back to identity when every compression slot is busy, but not for
+	// a request that timed out or went away while waiting for one
+	if !s.compression.Acquire(r.Context()) {
+		return false, r.Context().Err()
+	}
+
+	compressed, err := compressContext(r.Context(), compressor, entry.Data, s.compression.LevelFor(entry.ContentType))
+	s.compression.Release()
 	if err != nil {
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
-		return
+		// A request that timed out or went away gets nothing; don't serve it identity
+		if ctxErr := r.Context().Err(); ctxErr != nil && errors.Is(err, ctxErr) {
+			return false, err
+		}
+		return false, nil
+	}
+	if s.metrics != nil && len(entry.Data) > 0 {
+		s.metrics.compressionRatio.Observe(float64(len(compressed)) / float64(len(entry.Data)))
 	}
 
-	w.Header().Set("Content-Type", "text/html; charset=utf-8")
-	fmt.Fprintf(w, "<html><head><title>Directory listing for %s</title></head><body>", r.URL.Path)
-	fmt.Fprintf(w, "<h1>Directory listing for %s</h1><ul>", r.URL.Path)
+	if s.config.VerifyCompression {
+		if verifyErr := VerifyCompressed(entry.Data, compressed, compressionType); verifyErr != nil {
+			log.Printf("[VERIFY] %s compression of %s failed verification: %v", getEncodingName(compressionType), sourcePath, verifyErr)
+			return false, NewServerError(ErrorTypeServerError, "server.verifyCompression", verifyErr).
+				WithPath(sourcePath)
+		}
+	}
 
-	if r.URL.Path != "/" {
-		fmt.Fprintf(w, `<li><a href="../">../</a></li>`)
+	if s.compression.WorthCompressing(len(entry.Data), len(compressed)) {
+		entry.Data = compressed
+		entry.Size = int64(len(compressed))
+		entry.Encoding = compressionType
 	}
+	return true, nil
+}
 
-	for _, entry := range entries {
-		name := entry.Name()
-		if entry.IsDir() {
-			name += "/"
+// writeGenerated writes a body produced on the fly, such as a directory
+// listing or an admin endpoint's JSON, compressed the same way as files when
+// the client accepts it and contentType and size qualify
+func (s *Server) writeGenerated(w http.ResponseWriter, r *http.Request, status int, contentType string, data []byte) {
+	entry := &CacheEntry{Data: data, ContentType: contentType, Size: int64(len(data))}
+
+	if s.config.Compression != NoCompression {
+		compressor, compressionType := s.compression.GetCompressor(r.Header.Get("Accept-Encoding"))
+		if compressor != nil && s.compression.ShouldCompress(contentType, entry.Size) {
+			if _, err := s.compressEntry(r, entry, compressor, compressionType, r.URL.Path); err != nil {
+				s.errorHandler.HandleError(w, r, err)
+				return
+			}
 		}
-		fmt.Fprintf(w, `<li><a href="%s">%s</a></li>`, name, name)
+		addVary(w.Header(), "Accept-Encoding")
 	}
 
-	fmt.Fprintf(w, "</ul></body></html>")
+	w.Header().Set("Content-Type", contentType)
+	if entry.Encoding != NoCompression {
+		w.Header().Set("Content-Encoding", getEncodingName(entry.Encoding))
+	}
+	w.Header().Set("Content-Length", strconv.Itoa(len(entry.Data)))
+	w.WriteHeader(status)
+	if r.Method != "HEAD" {
+		s.writeBody(w, entry.Data)
+	}
 }
 
-func (s *Server) connStateHandler(conn net.Conn, state http.ConnState) {
-	if s.metrics == nil {
-		return
+// writeBody writes a response body whose headers are already set. net/http
+// buffers the response, so a small body goes out in the same write as the
+// headers without staging it here (see BenchmarkSmallFileWrites).
+func (s *Server) writeBody(w http.ResponseWriter, data []byte) {
+	w.Write(data)
+
+	if s.metrics != nil {
+		s.metrics.bytesServed.Add(float64(len(data)))
 	}
+}
 
+func (s *Server) connStateHandler(conn net.Conn, state http.ConnState) {
 	switch state {
 	case http.StateNew:
-		s.metrics.activeConnections.Inc()
+		s.activeConns.Add(1)
+		if s.metrics != nil {
+			s.metrics.activeConnections.Inc()
+		}
 	case http.StateClosed, http.StateHijacked:
-		s.metrics.activeConnections.Dec()
+		s.activeConns.Add(-1)
+		if s.metrics != nil {
+			s.metrics.activeConnections.Dec()
+		}
 	}
 }
 
-func (s *Server) Start() error {
-	if s.invalidator != nil {
-		if err := s.invalidator.Start(); err != nil {
-			return fmt.Errorf("failed to start invalidator: %w", err)
+// shuttingDown reports whether Stop has begun
+func (s *Server) shuttingDown() bool {
+	select {
+	case <-s.shutdown:
+		return true
+	default:
+		return false
+	}
+}
+
+// trackRequests counts requests in flight for Stop to drain, and turns new
+// requests away with 503 once Stop has begun
+func (s *Server) trackRequests(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-s.shutdown:
+			w.Header().Set("Connection", "close")
+			w.Header().Set("Retry-After", "1")
+			err := NewServerError(ErrorTypeServerError, "server.drain", ErrServerShutdown).
+				WithMessage("Server is shutting down").
+				WithStatusCode(http.StatusServiceUnavailable)
+			s.errorHandler.HandleError(w, r, err)
+			return
+		default:
+		}
+
+		s.activeRequests.Add(1)
+		defer s.activeRequests.Add(-1)
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// waitForRequests waits until no file requests are in flight, including
+// those reaching s through Handler or ServeFileHTTP under another server
+func (s *Server) waitForRequests(ctx context.Context) error {
+	ticker := time.NewTicker(10 * time.Millisecond)
+	defer ticker.Stop()
+
+	for s.activeRequests.Load() > 0 {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
 		}
 	}
+	return nil
+}
 
-	go func() {
-		log.Printf("Starting server on %s", s.httpServer.Addr)
+func (s *Server) Start() error {
+	// Listen before returning so a bad or busy address is reported to the
+	// caller, and Addr is known once Start returns
+	ln, err := net.Listen("tcp", s.httpServer.Addr)
+	if err != nil {
+		return fmt.Errorf("failed to listen on %s: %w", s.httpServer.Addr, err)
+	}
 
-		var err error
-		if s.config.EnableHTTPS {
-			err = s.httpServer.ListenAndServeTLS(s.config.TLSCert, s.config.TLSKey)
-		} else {
-			err = s.httpServer.ListenAndServe()
+	if s.config.EnableHTTPS && s.config.HTTPSRedirectAddr != "" {
+		if err := s.startHTTPSRedirect(ln.Addr()); err != nil {
+			ln.Close()
+			return err
 		}
+	}
+
+	if err := s.startComponents(); err != nil {
+		ln.Close()
+		if s.redirectServer != nil {
+			s.redirectServer.Close()
+		}
+		return err
+	}
+	s.warmOnStart()
 
-		if err != nil && err != http.ErrServerClosed {
+	s.listenAddr.Store(ln.Addr())
+	log.Printf("Starting server on %s", ln.Addr())
+
+	go func() {
+		if err := s.serve(ln); err != nil && err != http.ErrServerClosed {
 			log.Printf("Server error: %v", err)
 		}
 	}()
@@ -557,78 +1138,314 @@ func (s *Server) Start() error {
 	return nil
 }
 
+// startHTTPSRedirect listens on HTTPSRedirectAddr and redirects every
+// request there to the HTTPS listener at httpsAddr
+func (s *Server) startHTTPSRedirect(httpsAddr net.Addr) error {
+	ln, err := net.Listen("tcp", s.config.HTTPSRedirectAddr)
+	if err != nil {
+		return fmt.Errorf("failed to listen on %s: %w", s.config.HTTPSRedirectAddr, err)
+	}
+
+	var httpsPort string
+	if tcpAddr, ok := httpsAddr.(*net.TCPAddr); ok {
+		httpsPort = strconv.Itoa(tcpAddr.Port)
+	}
+
+	handler := httpsRedirectHandler(httpsPort)
+	if s.certManager != nil {
+		// Answer ACME HTTP-01 challenges before redirecting
+		handler = s.certManager.HTTPHandler(handler)
+	}
+
+	s.redirectAddr = ln.Addr()
+	s.redirectServer = &http.Server{
+		Handler:           handler,
+		ReadHeaderTimeout: s.config.ReadHeaderTimeout,
+		IdleTimeout:       s.config.IdleTimeout,
+		MaxHeaderBytes:    s.config.MaxHeaderBytes,
+	}
+
+	log.Printf("Redirecting HTTP on %s to HTTPS", s.redirectAddr)
+
+	go func() {
+		if err := s.redirectServer.Serve(ln); err != nil && err != http.ErrServerClosed {
+			log.Printf("HTTPS redirect server error: %v", err)
+		}
+	}()
+
+	return nil
+}
+
+// Addr returns the address the server is listening on, which differs from
+// Config.Addr when it picked a free port, or nil before it starts serving
+func (s *Server) Addr() net.Addr {
+	addr, _ := s.listenAddr.Load().(net.Addr)
+	return addr
+}
+
+// Serve starts the server's background components and accepts connections
+// on l until Stop is called. It is the blocking counterpart of Start for
+// callers that manage their own listener.
+func (s *Server) Serve(l net.Listener) error {
+	if err := s.startComponents(); err != nil {
+		return err
+	}
+	s.warmOnStart()
+	s.listenAddr.Store(l.Addr())
+	return s.serve(l)
+}
+
+// startComponents starts the invalidator and marks the server as started
+func (s *Server) startComponents() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.invalidator != nil {
+		if err := s.invalidator.Start(); err != nil {
+			return fmt.Errorf("failed to start invalidator: %w", err)
+		}
+	}
+	s.started = true
+	s.ready.Store(true)
+	return nil
+}
+
+// serve accepts connections on l, rejecting those over MaxConnections
+func (s *Server) serve(l net.Listener) error {
+	s.mu.RLock()
+	config := s.config
+	s.mu.RUnlock()
+
+	if config.MaxConnections > 0 {
+		l = newLimitListener(l, config.MaxConnections)
+	}
+
+	if s.certManager != nil {
+		return s.httpServer.ServeTLS(l, "", "")
+	}
+	if config.EnableHTTPS {
+		return s.httpServer.ServeTLS(l, config.TLSCert, config.TLSKey)
+	}
+	return s.httpServer.Serve(l)
+}
+
+// Stop drains the server: it turns new requests away with 503, waits up to
+// ShutdownTimeout for requests in flight, then closes whatever connections
+// remain, stops the background components and runs the shutdown hooks.
 func (s *Server) Stop() error {
+	s.ready.Store(false)
 	close(s.shutdown)
 
-	ctx, cancel := context.WithTimeout(context.Background(), s.config.ShutdownTimeout)
+	s.mu.RLock()
+	timeout := s.config.ShutdownTimeout
+	hooks := s.config.ShutdownHooks
+	s.mu.RUnlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
 	defer cancel()
 
-	// Stop all cleanup goroutines
-	if s.invalidator != nil {
-		s.invalidator.Stop()
+	// The redirect listener has nothing to drain beyond its own responses
+	if s.redirectServer != nil {
+		if err := s.redirectServer.Shutdown(ctx); err != nil {
+			s.redirectServer.Close()
+		}
 	}
 
-	// Stop cache cleanup goroutines
-	if lruCache, ok := s.cache.(*LRUCache); ok {
-		lruCache.Stop()
-	} else if lfuCache, ok := s.cache.(*LFUCache); ok {
-		lfuCache.Stop()
+	err := s.httpServer.Shutdown(ctx)
+	if err == nil {
+		err = s.waitForRequests(ctx)
+	}
+	if err != nil {
+		log.Printf("[SHUTDOWN] Drain timed out after %v; closing %d connections with %d requests in flight",
+			timeout, s.activeConns.Load(), s.activeRequests.Load())
+		s.httpServer.Close()
 	}
 
-	// Stop security components
-	if s.csrfProtection != nil {
-		s.csrfProtection.Stop()
+	// Stop all cleanup goroutines
+	s.mu.RLock()
+	s.stopComponents()
+	s.saveVersionState()
+	s.mu.RUnlock()
+
+	errs := []error{err}
+	for _, hook := range hooks {
+		errs = append(errs, hook(ctx))
 	}
-	if s.rateLimiter != nil {
-		s.rateLimiter.Stop()
+	return errors.Join(errs...)
+}
+
+// Reload applies opts on top of the current configuration, rebuilds the
+// cache, compression, versioning and handler, and swaps them in without
+// closing the listener. Requests already in flight finish against the old
+// configuration; Reload doesn't wait for them. An invalid configuration, or
+// a change to the listener, TLS, connection timeouts or metrics, which only
+// apply when the server is created (ErrNotReloadable), is rejected without
+// changing state, as is any Reload once Stop has begun (ErrServerShutdown).
+func (s *Server) Reload(opts ...Option) error {
+	s.mu.RLock()
+	previous := s.config
+	started := s.started
+	s.mu.RUnlock()
+	config := previous.Clone()
+	tlsConfig := config.TLSConfig
+
+	if s.shuttingDown() {
+		return ErrServerShutdown
+	}
+
+	// Not ready while rebuilding; restored on success and failure alike,
+	// unless Stop began meanwhile
+	if started {
+		s.ready.Store(false)
+		defer func() {
+			if !s.shuttingDown() {
+				s.ready.Store(true)
+			}
+		}()
 	}
 
-	return s.httpServer.Shutdown(ctx)
-}
+	for _, opt := range opts {
+		opt(config)
+	}
 
-func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	s.handler.ServeHTTP(w, r)
-}
+	if err := config.Validate(); err != nil {
+		return fmt.Errorf("invalid configuration: %w", err)
+	}
 
-// ServeFileHTTP serves files directly without going through the internal mux
-// This is useful when embedding gostc as a handler to avoid mux conflicts
-func (s *Server) ServeFileHTTP(w http.ResponseWriter, r *http.Request) {
-	// Create the file handler with middlewares, but bypass the internal mux
-	fileHandler := http.HandlerFunc(s.serveFile)
+	changed := previous.fixedSettingsChanged(config)
+	if config.TLSConfig != tlsConfig {
+		changed = append(changed, "TLSConfig")
+	}
+	if len(changed) > 0 {
+		return fmt.Errorf("%w: %s", ErrNotReloadable, strings.Join(changed, ", "))
+	}
 
-	middlewares := []Middleware{
-		RecoveryMiddleware(),
-		LoggingMiddleware(),
-		SecurityHeadersMiddleware(s.config),
-		CORSMiddleware(s.config),
+	// Versioned URLs from the new scan aren't known until the swap
+	if config.EnableVersioning {
+		s.rescanning.Store(true)
+		defer s.rescanning.Store(false)
 	}
 
-	if s.config.RateLimitPerIP > 0 {
-		middlewares = append(middlewares, RateLimitMiddleware(s.config.RateLimitPerIP))
+	next := &Server{components: &components{}, serverState: s.serverState}
+	if err := next.initComponents(config); err != nil {
+		return err
 	}
 
-	if s.config.MaxBodySize > 0 {
-		middlewares = append(middlewares, MaxBytesMiddleware(s.config.MaxBodySize))
+	if started {
+		if err := next.invalidator.Start(); err != nil {
+			next.stopComponents()
+			return fmt.Errorf("failed to start invalidator: %w", err)
+		}
 	}
 
-	if s.config.ReadTimeout > 0 {
-		middlewares = append(middlewares, TimeoutMiddleware(s.config.ReadTimeout))
+	next.setupHandler()
+
+	// Requests only hold the lock while picking up the handler, so this
+	// doesn't wait for responses in flight
+	s.mu.Lock()
+	// Stop may have begun while the new components were built; it only
+	// stops the ones it finds installed, so these must not replace them
+	if s.shuttingDown() {
+		s.mu.Unlock()
+		next.stopComponents()
+		return ErrServerShutdown
+	}
+	old := &Server{components: s.components, serverState: s.serverState}
+	for _, fn := range s.onInvalidate {
+		next.invalidator.RegisterCallback(fn)
+	}
+	s.components = next.components
+	s.mu.Unlock()
+
+	old.stopComponents()
+	s.warmConfigured()
+
+	return nil
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.RLock()
+	config, handler := s.config, s.handler
+	s.mu.RUnlock()
+
+	// "OPTIONS *" asks about the server as a whole; the mux would reject it
+	if r.Method == "OPTIONS" && r.RequestURI == "*" {
+		w.Header().Set("Allow", config.allowHeader())
+		w.WriteHeader(http.StatusNoContent)
+		return
 	}
 
-	handler := ChainMiddleware(fileHandler, middlewares...)
 	handler.ServeHTTP(w, r)
 }
 
+// ServeFileHTTP serves files directly without going through the internal mux
+// This is useful when embedding gostc as a handler to avoid mux conflicts.
+// It runs the same middleware chain as Handler, auth and limits included.
+func (s *Server) ServeFileHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.RLock()
+	handler := s.fileHandler
+	s.mu.RUnlock()
+
+	handler.ServeHTTP(w, r)
+}
+
+// Handler returns the middleware-wrapped file handler without the internal
+// routes (metrics, health, debug endpoints), for mounting under a parent
+// router. It follows Reload.
+func (s *Server) Handler() http.Handler {
+	return http.HandlerFunc(s.ServeFileHTTP)
+}
+
+// StripPrefix returns Handler serving requests below prefix, e.g. "/assets/",
+// as if they had arrived without it, so versioned and static paths resolve
+// as usual.
+func (s *Server) StripPrefix(prefix string) http.Handler {
+	handler := s.Handler()
+
+	return http.StripPrefix(strings.TrimSuffix(prefix, "/"), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "":
+			r.URL.Path = "/"
+			r.URL.RawPath = ""
+		case r.URL.Path[0] != '/':
+			// "/assetsfoo" shares the prefix's text but not its directory
+			http.NotFound(w, r)
+			return
+		}
+		handler.ServeHTTP(w, r)
+	}))
+}
+
 func (s *Server) InvalidatePath(path string) {
-	s.invalidator.InvalidatePath(path)
+	s.current().invalidator.InvalidatePath(path)
 }
 
 func (s *Server) InvalidateAll() {
-	s.invalidator.InvalidateAll()
+	s.current().invalidator.InvalidateAll()
+}
+
+// OnInvalidate registers fn to run with the URL path of every cache
+// invalidation, e.g. to purge a CDN. fn receives InvalidateAllPath when the
+// whole cache is cleared. Callbacks survive Reload.
+func (s *Server) OnInvalidate(fn func(path string)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.onInvalidate = append(s.onInvalidate, fn)
+	s.invalidator.RegisterCallback(fn)
+}
+
+// ResetRateLimit restores the full burst for a client IP, e.g. after an
+// operator unblocks it
+func (s *Server) ResetRateLimit(ip string) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	s.rateLimiter.Reset(ip)
 }
 
 func (s *Server) CacheStats() CacheStats {
-	return s.cache.Stats()
+	return s.current().cache.Stats()
 }
 
 func generateETag(data []byte) string {
@@ -696,14 +1513,25 @@ func securePath(root, relPath string) (string, error) {
 		return "", err
 	}
 
-	// Ensure the resolved path is within the root directory
-	if !strings.HasPrefix(absPath, absRoot) {
+	// Ensure the resolved path is within the root directory. A plain prefix
+	// check would accept a sibling such as /srv/www-secret for /srv/www.
+	if !isWithin(absPath, absRoot) {
 		return "", fmt.Errorf("path escapes root directory")
 	}
 
 	return absPath, nil
 }
 
+// isWithin reports whether path is dir or lies below it, comparing whole
+// path elements
+func isWithin(path, dir string) bool {
+	rel, err := filepath.Rel(dir, path)
+	if err != nil {
+		return false
+	}
+	return rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
 func getEncodingName(compressionType CompressionType) string {
 	switch compressionType {
 	case Gzip:
@@ -766,30 +1594,62 @@ func NewWithConfig(config *Config) (*Server, error) {
 		return nil, fmt.Errorf("invalid configuration: %w", err)
 	}
 
+	state := &serverState{
+		stat:      os.Stat,
+		open:      os.Open,
+		shutdown:  make(chan struct{}),
+		startedAt: time.Now(),
+	}
+
+	// The handler is bound to gen rather than s, whose components Reload
+	// replaces
+	gen := &Server{components: &components{}, serverState: state}
+	if err := gen.initComponents(config); err != nil {
+		return nil, err
+	}
+
+	if config.EnableMetrics {
+		gen.setupMetrics()
+	}
+
+	gen.setupHandler()
+
+	s := &Server{components: gen.components, serverState: state}
+	s.setupHTTPServer()
+	s.warmConfigured()
+
+	return s, nil
+}
+
+// initComponents builds everything derived from config: cache, compression,
+// versioning, invalidation and security helpers. On error any components
+// already created are stopped.
+func (s *Server) initComponents(config *Config) error {
 	cache, err := NewCache(config)
 	if err != nil {
-		return nil, err
+		return err
 	}
 
 	compression := NewCompressionManager(config)
 	versionManager := NewAssetVersionManager(config)
 	htmlProcessor := NewHTMLProcessor(versionManager)
 
-	s := &Server{
-		config:         config,
-		cache:          cache,
-		compression:    compression,
-		versionManager: versionManager,
-		htmlProcessor:  htmlProcessor,
-		csrfProtection: NewCSRFProtection(time.Hour),
-		rateLimiter:    NewIPRateLimiter(config.RateLimitPerIP, config.RateLimitPerIP*10, 5*time.Minute),
-		errorHandler:   NewErrorHandler(config.Debug),
-		shutdown:       make(chan struct{}),
+	s.config = config
+	s.cache = cache
+	s.compression = compression
+	s.versionManager = versionManager
+	s.htmlProcessor = htmlProcessor
+	s.csrfProtection = NewCSRFProtection(time.Hour)
+	s.rateLimiter = NewIPRateLimiter(config.RateLimitPerIP, config.rateLimitBurst(), 5*time.Minute)
+	s.errorHandler = newErrorHandlerWithCapacity(config.Debug, config.ErrorLogCapacity)
+	s.defaultFiles = &defaultFileEntries{modTime: time.Now().Truncate(time.Second)}
+
+	if config.CaseInsensitivePaths {
+		s.caseLookups, _ = lru.New[string, string](caseLookupCacheSize)
 	}
 
 	if config.EnableWatcher {
 		var watcher *FileWatcher
-		var err error
 
 		if config.EnableVersioning {
 			watcher, err = NewVersionedFileWatcher(config.Root, cache, compression, versionManager)
@@ -798,26 +1658,73 @@ func NewWithConfig(config *Config) (*Server, error) {
 		}
 
 		if err != nil {
-			return nil, err
+			s.stopComponents()
+			return err
 		}
+		watcher.SetMounts(config.Mounts)
+		watcher.SetDebounce(config.WatcherDebounce)
+		watcher.SetIgnore(config.WatcherIgnore)
 		s.invalidator = watcher
 	} else {
 		s.invalidator = NewManualInvalidator(cache)
 	}
 
-	if config.EnableMetrics {
-		s.setupMetrics()
+	if config.StatCacheTTL > 0 {
+		s.statCache = newStatCache(config, s.invalidator)
+	}
+	s.headEntries = newHeadEntries(s.invalidator)
+	if config.NegativeCacheTTL > 0 {
+		s.notFound = newNotFoundCache(config, s.invalidator)
 	}
 
 	// Initialize asset versioning if enabled
 	if config.EnableVersioning {
+		if config.VersionCacheFile != "" {
+			if err := s.versionManager.LoadState(config.VersionCacheFile); err != nil && !os.IsNotExist(err) {
+				log.Printf("Ignoring version manifest: %v", err)
+			}
+		}
+
 		if err := s.versionManager.ScanDirectory(config.Root); err != nil {
-			return nil, fmt.Errorf("failed to scan directory for versioning: %w", err)
+			s.stopComponents()
+			return fmt.Errorf("failed to scan directory for versioning: %w", err)
 		}
+
+		s.saveVersionState()
 	}
 
-	s.setupHandler()
-	s.setupHTTPServer()
+	return nil
+}
 
-	return s, nil
+// saveVersionState writes the version manifest when VersionCacheFile is set
+func (s *Server) saveVersionState() {
+	if !s.config.EnableVersioning || s.config.VersionCacheFile == "" {
+		return
+	}
+
+	if err := s.versionManager.SaveState(s.config.VersionCacheFile); err != nil {
+		log.Printf("Failed to save version manifest: %v", err)
+	}
+}
+
+// stopComponents stops the background goroutines owned by the components
+// built in initComponents
+func (s *Server) stopComponents() {
+	if s.invalidator != nil {
+		s.invalidator.Stop()
+	}
+
+	// Stop cache cleanup goroutines; a backend from WithCacheBackend belongs
+	// to its owner and may outlive this server or be shared across a Reload
+	if s.cache != nil && (s.config == nil || s.config.CacheBackend == nil) {
+		s.cache.Stop()
+	}
+
+	// Stop security components
+	if s.csrfProtection != nil {
+		s.csrfProtection.Stop()
+	}
+	if s.rateLimiter != nil {
+		s.rateLimiter.Stop()
+	}
 }
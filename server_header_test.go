@@ -13,7 +13,7 @@ func TestServerHeader(t *testing.T) {
 	testFile := filepath.Join(tmpDir, "test.txt")
 	os.WriteFile(testFile, []byte("test content"), 0644)
 
-	server, err := New(WithRoot(tmpDir))
+	server, err := New(WithRoot(tmpDir), WithServerHeader("static-edge"))
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -28,13 +28,13 @@ func TestServerHeader(t *testing.T) {
 	}
 
 	serverHeader := w.Header().Get("Server")
-	if serverHeader != "7424" {
-		t.Errorf("Expected Server header '7424', got '%s'", serverHeader)
+	if serverHeader != "static-edge" {
+		t.Errorf("Expected Server header 'static-edge', got '%s'", serverHeader)
 	}
 }
 
 func TestServerHeaderOnHealthEndpoint(t *testing.T) {
-	server, err := New()
+	server, err := New(WithServerHeader("static-edge"))
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -45,15 +45,15 @@ func TestServerHeaderOnHealthEndpoint(t *testing.T) {
 	server.ServeHTTP(w, req)
 
 	serverHeader := w.Header().Get("Server")
-	if serverHeader != "7424" {
-		t.Errorf("Expected Server header '7424' on health endpoint, got '%s'", serverHeader)
+	if serverHeader != "static-edge" {
+		t.Errorf("Expected Server header 'static-edge' on health endpoint, got '%s'", serverHeader)
 	}
 }
 
 func TestServerHeaderOnError(t *testing.T) {
 	tmpDir := t.TempDir()
 
-	server, err := New(WithRoot(tmpDir))
+	server, err := New(WithRoot(tmpDir), WithServerHeader("static-edge"))
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -68,7 +68,37 @@ func TestServerHeaderOnError(t *testing.T) {
 	}
 
 	serverHeader := w.Header().Get("Server")
-	if serverHeader != "7424" {
-		t.Errorf("Expected Server header '7424' on error response, got '%s'", serverHeader)
+	if serverHeader != "static-edge" {
+		t.Errorf("Expected Server header 'static-edge' on error response, got '%s'", serverHeader)
+	}
+}
+
+func TestServerHeaderSuppressed(t *testing.T) {
+	tmpDir := t.TempDir()
+	os.WriteFile(filepath.Join(tmpDir, "test.txt"), []byte("test content"), 0644)
+
+	server, err := New(WithRoot(tmpDir), WithServerHeader(""))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		path   string
+		status int
+	}{
+		{"/test.txt", http.StatusOK},
+		{"/nonexistent.txt", http.StatusNotFound},
+		{"/health", http.StatusOK},
+	} {
+		req := httptest.NewRequest("GET", tc.path, nil)
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, req)
+
+		if w.Code != tc.status {
+			t.Errorf("%s: expected status %d, got %d", tc.path, tc.status, w.Code)
+		}
+		if _, ok := w.Header()["Server"]; ok {
+			t.Errorf("%s: expected no Server header, got '%s'", tc.path, w.Header().Get("Server"))
+		}
 	}
 }
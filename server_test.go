@@ -3,15 +3,25 @@ package gostc
 import (
 	"bytes"
 	"compress/gzip"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"io"
+	"net"
 	"net/http"
 	"net/http/httptest"
 	"os"
 	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
 	"github.com/andybalholm/brotli"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 )
 
 func TestServerBasicServing(t *testing.T) {
@@ -247,16 +257,151 @@ func TestCORS(t *testing.T) {
 
 	req := httptest.NewRequest("OPTIONS", "/test.txt", nil)
 	req.Header.Set("Origin", "https://example.com")
+	req.Header.Set("Access-Control-Request-Method", "GET")
 	w := httptest.NewRecorder()
 
 	server.ServeHTTP(w, req)
 
+	if w.Code != http.StatusNoContent {
+		t.Errorf("Expected 204 for a preflight, got %d", w.Code)
+	}
+	if w.Body.Len() != 0 {
+		t.Errorf("Expected no body on a preflight, got %q", w.Body.String())
+	}
+
+	for _, name := range []string{
+		"Access-Control-Allow-Origin",
+		"Access-Control-Allow-Methods",
+		"Access-Control-Allow-Headers",
+		"Access-Control-Max-Age",
+		"X-Content-Type-Options",
+		"X-Frame-Options",
+		"Content-Security-Policy",
+	} {
+		if w.Header().Get(name) == "" {
+			t.Errorf("Expected %s on the preflight response", name)
+		}
+	}
+}
+
+func TestCORSCredentials(t *testing.T) {
+	tmpDir := t.TempDir()
+	os.WriteFile(filepath.Join(tmpDir, "test.txt"), []byte("test"), 0644)
+
+	server, err := New(
+		WithRoot(tmpDir),
+		WithCORS(CORSConfig{
+			AllowedOrigins:   []string{"https://app.example.com"},
+			AllowedMethods:   []string{"GET", "HEAD"},
+			AllowedHeaders:   []string{"Content-Type", "X-Requested-With"},
+			AllowCredentials: true,
+			MaxAge:           10 * time.Minute,
+			ExposedHeaders:   []string{"ETag"},
+		}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req := httptest.NewRequest("GET", "/test.txt", nil)
+	req.Header.Set("Origin", "https://app.example.com")
+	w := httptest.NewRecorder()
+	server.ServeHTTP(w, req)
+
+	expected := map[string]string{
+		"Access-Control-Allow-Origin":      "https://app.example.com",
+		"Access-Control-Allow-Credentials": "true",
+		"Access-Control-Expose-Headers":    "ETag",
+	}
+	for name, want := range expected {
+		if got := w.Header().Get(name); got != want {
+			t.Errorf("Expected %s %q, got %q", name, want, got)
+		}
+	}
+
+	req = httptest.NewRequest("OPTIONS", "/test.txt", nil)
+	req.Header.Set("Origin", "https://app.example.com")
+	req.Header.Set("Access-Control-Request-Method", "GET")
+	w = httptest.NewRecorder()
+	server.ServeHTTP(w, req)
+
+	expected = map[string]string{
+		"Access-Control-Allow-Origin":      "https://app.example.com",
+		"Access-Control-Allow-Credentials": "true",
+		"Access-Control-Allow-Methods":     "GET, HEAD, OPTIONS",
+		"Access-Control-Allow-Headers":     "Content-Type, X-Requested-With",
+		"Access-Control-Max-Age":           "600",
+	}
+	for name, want := range expected {
+		if got := w.Header().Get(name); got != want {
+			t.Errorf("Preflight: expected %s %q, got %q", name, want, got)
+		}
+	}
+
+	// A disallowed origin gets no CORS headers at all
+	req = httptest.NewRequest("GET", "/test.txt", nil)
+	req.Header.Set("Origin", "https://evil.example.com")
+	w = httptest.NewRecorder()
+	server.ServeHTTP(w, req)
+
 	if w.Code != http.StatusOK {
-		t.Errorf("Expected 200 for OPTIONS, got %d", w.Code)
+		t.Errorf("Expected the file to be served, got %d", w.Code)
+	}
+	for name := range w.Header() {
+		if strings.HasPrefix(name, "Access-Control-") {
+			t.Errorf("Disallowed origin got %s: %q", name, w.Header().Get(name))
+		}
+	}
+
+	// Credentials can't be combined with a wildcard origin
+	_, err = New(WithRoot(tmpDir), WithCORS(CORSConfig{AllowedOrigins: []string{"*"}, AllowCredentials: true}))
+	if err == nil {
+		t.Error("Expected credentials with a wildcard origin to be rejected")
+	}
+}
+
+func TestVaryCombinesOriginAndEncoding(t *testing.T) {
+	tmpDir := t.TempDir()
+	content := bytes.Repeat([]byte(`const message = "Hello World"; console.log(message); `), 20)
+	if err := os.WriteFile(filepath.Join(tmpDir, "test.js"), content, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	server, err := New(
+		WithRoot(tmpDir),
+		WithCompression(Gzip),
+		func(c *Config) {
+			c.MinSizeToCompress = 10
+			c.AllowedOrigins = []string{"https://example.com"}
+		},
+	)
+	if err != nil {
+		t.Fatal(err)
 	}
 
-	if w.Header().Get("Access-Control-Allow-Origin") == "" {
-		t.Error("Expected CORS headers")
+	// The second request is served from cache, which must not drop Origin
+	for i := 0; i < 2; i++ {
+		req := httptest.NewRequest("GET", "/test.js", nil)
+		req.Header.Set("Accept-Encoding", "gzip")
+		req.Header.Set("Origin", "https://example.com")
+		w := httptest.NewRecorder()
+
+		server.ServeHTTP(w, req)
+
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected status 200, got %d", w.Code)
+		}
+		if w.Header().Get("Content-Encoding") != "gzip" {
+			t.Fatal("Expected gzip encoding")
+		}
+
+		vary := w.Header().Values("Vary")
+		if len(vary) != 1 {
+			t.Fatalf("Expected a single Vary header, got %q", vary)
+		}
+		if vary[0] != "Origin, Accept-Encoding" {
+			t.Errorf("Expected Vary %q, got %q", "Origin, Accept-Encoding", vary[0])
+		}
 	}
 }
 
@@ -333,8 +478,195 @@ func TestHealthEndpoint(t *testing.T) {
 		t.Errorf("Expected 200 for health check, got %d", w.Code)
 	}
 
-	if w.Body.String() != "OK" {
-		t.Errorf("Expected 'OK' response, got %s", w.Body.String())
+	var health struct {
+		Status     string `json:"status"`
+		CacheItems *int   `json:"cache_items"`
+		UptimeSec  *int64 `json:"uptime_sec"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &health); err != nil {
+		t.Fatalf("Expected JSON health response, got %q", w.Body.String())
+	}
+	if health.Status != "ok" || health.CacheItems == nil || health.UptimeSec == nil {
+		t.Errorf("Unexpected health response %s", w.Body.String())
+	}
+}
+
+func TestHealthEndpointAfterStop(t *testing.T) {
+	server, err := New(WithRoot(t.TempDir()), WithHealthEndpoint("/healthz"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := server.Stop(); err != nil {
+		t.Fatal(err)
+	}
+
+	req := httptest.NewRequest("GET", "/healthz", nil)
+	w := httptest.NewRecorder()
+	server.ServeHTTP(w, req)
+
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected 503 after Stop, got %d", w.Code)
+	}
+	if !strings.Contains(w.Body.String(), `"shutting_down"`) {
+		t.Errorf("Expected shutting_down status, got %s", w.Body.String())
+	}
+}
+
+func TestStopDrainsInFlightRequests(t *testing.T) {
+	tmpDir := t.TempDir()
+	os.WriteFile(filepath.Join(tmpDir, "slow.txt"), []byte("slow"), 0644)
+	os.WriteFile(filepath.Join(tmpDir, "fast.txt"), []byte("fast"), 0644)
+
+	server, err := New(WithRoot(tmpDir), WithWatcher(false))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	release := make(chan struct{})
+	server.open = func(name string) (*os.File, error) {
+		if filepath.Base(name) == "slow.txt" {
+			<-release
+		}
+		return os.Open(name)
+	}
+
+	slow := httptest.NewRecorder()
+	slowDone := make(chan struct{})
+	go func() {
+		defer close(slowDone)
+		server.ServeHTTP(slow, httptest.NewRequest("GET", "/slow.txt", nil))
+	}()
+	for server.activeRequests.Load() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	stopped := make(chan error, 1)
+	go func() { stopped <- server.Stop() }()
+	<-server.shutdown
+
+	// New requests are turned away while the slow one drains
+	w := httptest.NewRecorder()
+	server.ServeHTTP(w, httptest.NewRequest("GET", "/fast.txt", nil))
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected 503 during drain, got %d", w.Code)
+	}
+
+	select {
+	case <-stopped:
+		t.Fatal("Stop returned before the in-flight request finished")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	close(release)
+	<-slowDone
+	if err := <-stopped; err != nil {
+		t.Fatalf("Stop: %v", err)
+	}
+	if slow.Code != http.StatusOK || slow.Body.String() != "slow" {
+		t.Errorf("Expected the in-flight request to complete, got %d %q", slow.Code, slow.Body.String())
+	}
+}
+
+func TestStopDrainTimeout(t *testing.T) {
+	tmpDir := t.TempDir()
+	os.WriteFile(filepath.Join(tmpDir, "stuck.txt"), []byte("stuck"), 0644)
+
+	server, err := New(WithRoot(tmpDir), WithWatcher(false), WithTimeouts(TimeoutConfig{Shutdown: 50 * time.Millisecond}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	release := make(chan struct{})
+	defer close(release)
+	server.open = func(name string) (*os.File, error) {
+		<-release
+		return os.Open(name)
+	}
+
+	go server.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/stuck.txt", nil))
+	for server.activeRequests.Load() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	if err := server.Stop(); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected Stop to give up after ShutdownTimeout, got %v", err)
+	}
+}
+
+func TestCancelledRequestAbortsRead(t *testing.T) {
+	tmpDir := t.TempDir()
+	content := bytes.Repeat([]byte("0123456789abcdef"), 64*1024)
+	if err := os.WriteFile(filepath.Join(tmpDir, "large.txt"), content, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	server, err := New(WithRoot(tmpDir))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	req := httptest.NewRequest("GET", "/large.txt", nil).WithContext(ctx)
+	w := httptest.NewRecorder()
+
+	done := make(chan struct{})
+	go func() {
+		server.serveFile(w, req)
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("serveFile did not return after the client went away")
+	}
+
+	if w.Body.Len() != 0 {
+		t.Errorf("Expected no body for a cancelled request, got %d bytes", w.Body.Len())
+	}
+	if _, ok := server.cache.Get(CacheKey{Path: "/large.txt"}); ok {
+		t.Error("Expected the aborted read not to be cached")
+	}
+
+	// A live request still gets the whole file
+	w = httptest.NewRecorder()
+	server.ServeHTTP(w, httptest.NewRequest("GET", "/large.txt", nil))
+	if w.Code != http.StatusOK || !bytes.Equal(w.Body.Bytes(), content) {
+		t.Errorf("Expected full body after cancellation, got status %d and %d bytes", w.Code, w.Body.Len())
+	}
+}
+
+func TestShutdownHooks(t *testing.T) {
+	errDeregister := errors.New("deregister failed")
+
+	var calls []string
+	server, err := New(
+		WithRoot(t.TempDir()),
+		WithWatcher(false),
+		WithShutdownHook(func(ctx context.Context) error {
+			if _, ok := ctx.Deadline(); !ok {
+				t.Error("Expected the hook context to carry the shutdown deadline")
+			}
+			calls = append(calls, "flush")
+			return nil
+		}),
+		WithShutdownHook(func(ctx context.Context) error {
+			calls = append(calls, "deregister")
+			return errDeregister
+		}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := server.Stop(); !errors.Is(err, errDeregister) {
+		t.Errorf("Expected Stop to surface the hook error, got %v", err)
+	}
+	if strings.Join(calls, ",") != "flush,deregister" {
+		t.Errorf("Expected each hook to run once in order, got %v", calls)
 	}
 }
 
@@ -362,6 +694,48 @@ func TestMethodNotAllowed(t *testing.T) {
 	}
 }
 
+func TestWithMethods(t *testing.T) {
+	tmpDir := t.TempDir()
+	os.WriteFile(filepath.Join(tmpDir, "test.txt"), []byte("test"), 0644)
+
+	server, err := New(WithRoot(tmpDir), WithMethods("head"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w := httptest.NewRecorder()
+	server.ServeHTTP(w, httptest.NewRequest("GET", "/test.txt", nil))
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("GET: Expected 405, got %d", w.Code)
+	}
+	if allow := w.Header().Get("Allow"); allow != "HEAD, OPTIONS" {
+		t.Errorf("Expected Allow %q, got %q", "HEAD, OPTIONS", allow)
+	}
+
+	w = httptest.NewRecorder()
+	server.ServeHTTP(w, httptest.NewRequest("HEAD", "/test.txt", nil))
+	if w.Code != http.StatusOK {
+		t.Errorf("HEAD: Expected 200, got %d", w.Code)
+	}
+
+	// OPTIONS stays available for CORS preflight
+	req := httptest.NewRequest("OPTIONS", "/test.txt", nil)
+	req.Header.Set("Origin", "https://example.com")
+	req.Header.Set("Access-Control-Request-Method", "HEAD")
+	w = httptest.NewRecorder()
+	server.ServeHTTP(w, req)
+	if w.Code != http.StatusNoContent {
+		t.Errorf("OPTIONS: Expected 204, got %d", w.Code)
+	}
+	if methods := w.Header().Get("Access-Control-Allow-Methods"); methods != "HEAD, OPTIONS" {
+		t.Errorf("Expected Access-Control-Allow-Methods %q, got %q", "HEAD, OPTIONS", methods)
+	}
+
+	if _, err := New(WithRoot(tmpDir), WithMethods("GET", "POST")); err == nil {
+		t.Error("Expected POST to be rejected by validation")
+	}
+}
+
 func BenchmarkServeFile(b *testing.B) {
 	tmpDir := b.TempDir()
 	testFile := filepath.Join(tmpDir, "test.txt")
@@ -403,3 +777,645 @@ func BenchmarkGzipCompression(b *testing.B) {
 		server.ServeHTTP(w, req)
 	}
 }
+
+func TestReloadSwapsRoot(t *testing.T) {
+	oldRoot := t.TempDir()
+	newRoot := t.TempDir()
+	os.WriteFile(filepath.Join(oldRoot, "page.txt"), []byte("old"), 0644)
+	os.WriteFile(filepath.Join(newRoot, "page.txt"), []byte("new"), 0644)
+
+	server, err := New(WithRoot(oldRoot), WithWatcher(false))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Stop()
+
+	get := func() string {
+		req := httptest.NewRequest("GET", "/page.txt", nil)
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, req)
+		return w.Body.String()
+	}
+
+	if body := get(); body != "old" {
+		t.Fatalf("Expected 'old' before reload, got %q", body)
+	}
+
+	if err := server.Reload(WithRoot(newRoot), WithCacheTTL(time.Minute)); err != nil {
+		t.Fatalf("Reload failed: %v", err)
+	}
+
+	if body := get(); body != "new" {
+		t.Errorf("Expected 'new' after reload, got %q", body)
+	}
+	if server.config.CacheTTL != time.Minute {
+		t.Errorf("Expected reloaded CacheTTL 1m, got %v", server.config.CacheTTL)
+	}
+}
+
+func TestReloadRejectsInvalidConfig(t *testing.T) {
+	tmpDir := t.TempDir()
+	os.WriteFile(filepath.Join(tmpDir, "page.txt"), []byte("content"), 0644)
+
+	server, err := New(WithRoot(tmpDir), WithWatcher(false))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Stop()
+
+	oldConfig := server.config
+	err = server.Reload(WithRoot(t.TempDir()), func(c *Config) { c.VersionHashLength = 7 })
+	if err == nil {
+		t.Fatal("Expected validation error from Reload")
+	}
+
+	if server.config != oldConfig || server.config.Root != tmpDir {
+		t.Error("Failed reload should not mutate server state")
+	}
+
+	req := httptest.NewRequest("GET", "/page.txt", nil)
+	w := httptest.NewRecorder()
+	server.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected 200 after failed reload, got %d", w.Code)
+	}
+}
+
+// stalledWriter blocks the first body write until release is closed, like
+// a client reading a large response slowly
+type stalledWriter struct {
+	*httptest.ResponseRecorder
+	writing chan struct{}
+	release chan struct{}
+	once    sync.Once
+}
+
+func (w *stalledWriter) Write(p []byte) (int, error) {
+	w.once.Do(func() { close(w.writing) })
+	<-w.release
+	return w.ResponseRecorder.Write(p)
+}
+
+func TestReloadDoesNotWaitForResponses(t *testing.T) {
+	tmpDir := t.TempDir()
+	os.WriteFile(filepath.Join(tmpDir, "page.txt"), []byte("content"), 0644)
+
+	server, err := New(WithRoot(tmpDir), WithWatcher(false))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Stop()
+
+	stalled := &stalledWriter{
+		ResponseRecorder: httptest.NewRecorder(),
+		writing:          make(chan struct{}),
+		release:          make(chan struct{}),
+	}
+	served := make(chan struct{})
+	go func() {
+		defer close(served)
+		server.ServeHTTP(stalled, httptest.NewRequest("GET", "/page.txt", nil))
+	}()
+	<-stalled.writing
+
+	reloaded := make(chan error, 1)
+	go func() { reloaded <- server.Reload(WithCacheTTL(time.Minute)) }()
+
+	select {
+	case err := <-reloaded:
+		if err != nil {
+			t.Fatalf("Reload failed: %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		close(stalled.release)
+		t.Fatal("Reload waited for a response in flight")
+	}
+
+	// New requests and accessors aren't held up by the stalled response
+	w := httptest.NewRecorder()
+	server.ServeHTTP(w, httptest.NewRequest("GET", "/page.txt", nil))
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected 200 while another response is stalled, got %d", w.Code)
+	}
+	server.RecentErrors(10)
+
+	close(stalled.release)
+	<-served
+	if body := stalled.Body.String(); body != "content" {
+		t.Errorf("Expected the stalled response to finish, got %q", body)
+	}
+}
+
+func TestReloadRejectsFixedSettings(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	server, err := New(WithRoot(tmpDir), WithWatcher(false))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Stop()
+
+	oldConfig := server.config
+
+	tests := []struct {
+		name    string
+		opt     Option
+		setting string
+	}{
+		{"Addr", WithAddr(":9999"), "Addr"},
+		{"WriteTimeout", func(c *Config) { c.WriteTimeout = time.Minute }, "WriteTimeout"},
+		{"Metrics", WithMetrics(true), "EnableMetrics"},
+		{"TLSConfig", func(c *Config) { c.TLSConfig = &tls.Config{} }, "TLSConfig"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := server.Reload(WithCacheTTL(time.Minute), tt.opt)
+			if !errors.Is(err, ErrNotReloadable) {
+				t.Fatalf("Expected ErrNotReloadable, got %v", err)
+			}
+			if !strings.Contains(err.Error(), tt.setting) {
+				t.Errorf("Expected the error to name %s, got %v", tt.setting, err)
+			}
+			if server.config != oldConfig {
+				t.Error("Rejected reload should not change the configuration")
+			}
+		})
+	}
+}
+
+func TestReloadAfterStop(t *testing.T) {
+	server, err := New(WithRoot(t.TempDir()), WithWatcher(false))
+	if err != nil {
+		t.Fatal(err)
+	}
+	server.Stop()
+
+	oldConfig := server.config
+	if err := server.Reload(WithCacheTTL(time.Minute)); !errors.Is(err, ErrServerShutdown) {
+		t.Fatalf("Expected ErrServerShutdown, got %v", err)
+	}
+	if server.config != oldConfig {
+		t.Error("Reload after Stop should not change the configuration")
+	}
+}
+
+func TestMetricsEndpoint(t *testing.T) {
+	tmpDir := t.TempDir()
+	content := strings.Repeat("body { color: red; }\n", 100)
+	os.WriteFile(filepath.Join(tmpDir, "style.css"), []byte(content), 0644)
+
+	newServer := func() *Server {
+		server, err := New(
+			WithRoot(tmpDir),
+			WithWatcher(false),
+			WithMetrics(true),
+			WithRateLimit(0),
+		)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return server
+	}
+
+	// Metrics registration must tolerate several servers in one process
+	newServer()
+	server := newServer()
+
+	req := httptest.NewRequest("GET", "/style.css", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	server.ServeHTTP(httptest.NewRecorder(), req)
+	server.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/missing.css", nil))
+
+	w := httptest.NewRecorder()
+	server.ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected 200 from /metrics, got %d", w.Code)
+	}
+
+	body := w.Body.String()
+	for _, series := range []string{
+		`gostc_requests_total{method="GET",status="200"}`,
+		`gostc_requests_total{method="GET",status="404"}`,
+		`gostc_cache_size_bytes `,
+		`gostc_compression_ratio_count `,
+	} {
+		if !strings.Contains(body, series) {
+			t.Errorf("Expected /metrics to contain %s", series)
+		}
+	}
+	if strings.Contains(body, "gostc_cache_size_bytes 0\n") {
+		t.Error("Expected a non-zero cache size after serving a file")
+	}
+}
+
+func TestMetricsRegistryPerServer(t *testing.T) {
+	tmpDir := t.TempDir()
+	os.WriteFile(filepath.Join(tmpDir, "a.txt"), []byte("a"), 0644)
+
+	first, err := New(WithRoot(tmpDir), WithWatcher(false), WithMetrics(true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := New(WithRoot(tmpDir), WithWatcher(false), WithMetrics(true))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 2; i++ {
+		first.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/a.txt", nil))
+	}
+
+	scrape := func(s *Server) string {
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected 200 from /metrics, got %d", w.Code)
+		}
+		return w.Body.String()
+	}
+
+	if body := scrape(first); !strings.Contains(body, `gostc_requests_total{method="GET",status="200"} 2`) {
+		t.Error("Expected the first server to report its two requests")
+	}
+	if body := scrape(second); strings.Contains(body, `gostc_requests_total{method="GET",status="200"}`) {
+		t.Error("Expected the second server's registry to be independent of the first")
+	}
+}
+
+func TestMetricsNamespace(t *testing.T) {
+	tmpDir := t.TempDir()
+	os.WriteFile(filepath.Join(tmpDir, "a.txt"), []byte("a"), 0644)
+
+	server, err := New(WithRoot(tmpDir), WithWatcher(false), WithMetrics(true), WithMetricsNamespace("cdn"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	server.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/a.txt", nil))
+
+	w := httptest.NewRecorder()
+	server.ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	body := w.Body.String()
+
+	if !strings.Contains(body, `cdn_requests_total{method="GET",status="200"} 1`) {
+		t.Error("Expected request metrics under the cdn namespace")
+	}
+	if strings.Contains(body, "gostc_") {
+		t.Error("Expected no metrics under the default namespace")
+	}
+
+	if _, err := New(WithRoot(tmpDir), WithMetricsNamespace("9-lives")); err == nil {
+		t.Error("Expected an invalid namespace to be rejected")
+	}
+}
+
+func TestCacheMetricsCountEachLookupOnce(t *testing.T) {
+	tmpDir := t.TempDir()
+	os.MkdirAll(filepath.Join(tmpDir, "static"), 0755)
+	os.WriteFile(filepath.Join(tmpDir, "static", "app.js"), []byte("console.log('app');"), 0644)
+
+	server, err := New(
+		WithRoot(tmpDir),
+		WithWatcher(false),
+		WithMetrics(true),
+		WithVersioning(true),
+		WithStaticPrefixes("/static/"),
+		WithNegativeCache(time.Minute),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	versioned, ok := server.versionManager.GetVersionedPath("/static/app.js")
+	if !ok {
+		t.Fatal("Expected app.js to be versioned")
+	}
+
+	counts := func() (hits, misses float64) {
+		return testutil.ToFloat64(server.metrics.cacheHits), testutil.ToFloat64(server.metrics.cacheMisses)
+	}
+
+	server.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", versioned, nil))
+	if hits, misses := counts(); hits != 0 || misses != 1 {
+		t.Errorf("First versioned fetch: expected 0 hits and 1 miss, got %v and %v", hits, misses)
+	}
+
+	server.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", versioned, nil))
+	if hits, misses := counts(); hits != 1 || misses != 1 {
+		t.Errorf("Second versioned fetch: expected 1 hit and 1 miss, got %v and %v", hits, misses)
+	}
+
+	// A missing file misses once, then hits the not-found sentinel
+	server.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/missing.js", nil))
+	server.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/missing.js", nil))
+	if hits, misses := counts(); hits != 2 || misses != 2 {
+		t.Errorf("Negative lookups: expected 2 hits and 2 misses, got %v and %v", hits, misses)
+	}
+
+	w := httptest.NewRecorder()
+	server.ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	if !strings.Contains(w.Body.String(), "gostc_cache_hit_ratio 0.5\n") {
+		t.Error("Expected a cache hit ratio of 0.5")
+	}
+}
+
+func TestStopReleasesGoroutines(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	// Let goroutines from earlier tests wind down before taking a baseline
+	time.Sleep(50 * time.Millisecond)
+	before := runtime.NumGoroutine()
+
+	for i := 0; i < 20; i++ {
+		strategy := LRU
+		if i%2 == 1 {
+			strategy = LFU
+		}
+
+		// Rate limiting is disabled so only server-owned components are measured
+		server, err := New(WithRoot(tmpDir), WithCacheStrategy(strategy), WithRateLimit(0))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := server.Stop(); err != nil {
+			t.Fatalf("Stop failed: %v", err)
+		}
+	}
+
+	// Stopped goroutines exit asynchronously
+	var after int
+	for deadline := time.Now().Add(2 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		if after = runtime.NumGoroutine(); after <= before {
+			return
+		}
+	}
+	t.Errorf("Goroutines grew from %d to %d after creating and stopping 20 servers", before, after)
+}
+
+func TestMaxConcurrency(t *testing.T) {
+	const limit, total = 2, 5
+
+	newBlockingServer := func(t *testing.T, opts ...Option) (*Server, chan struct{}, chan struct{}) {
+		tmpDir := t.TempDir()
+		for i := 0; i < total; i++ {
+			os.WriteFile(filepath.Join(tmpDir, fmt.Sprintf("file%d.txt", i)), []byte("content"), 0644)
+		}
+
+		server, err := New(append([]Option{WithRoot(tmpDir), WithWatcher(false), WithRateLimit(0)}, opts...)...)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		entered := make(chan struct{}, total)
+		release := make(chan struct{})
+		server.open = func(name string) (*os.File, error) {
+			entered <- struct{}{}
+			<-release
+			return os.Open(name)
+		}
+		return server, entered, release
+	}
+
+	serveAll := func(server *Server) chan int {
+		codes := make(chan int, total)
+		for i := 0; i < total; i++ {
+			go func(i int) {
+				req := httptest.NewRequest("GET", fmt.Sprintf("/file%d.txt", i), nil)
+				w := httptest.NewRecorder()
+				server.ServeHTTP(w, req)
+				if w.Code == http.StatusServiceUnavailable && w.Header().Get("Retry-After") == "" {
+					t.Error("Expected Retry-After on 503")
+				}
+				codes <- w.Code
+			}(i)
+		}
+		return codes
+	}
+
+	t.Run("Reject", func(t *testing.T) {
+		server, entered, release := newBlockingServer(t, WithMaxConcurrency(limit))
+		codes := serveAll(server)
+
+		for i := 0; i < limit; i++ {
+			<-entered
+		}
+
+		// Everything past the limit is rejected while the first requests block
+		for i := 0; i < total-limit; i++ {
+			if code := <-codes; code != http.StatusServiceUnavailable {
+				t.Errorf("Expected 503 for a request over the limit, got %d", code)
+			}
+		}
+
+		close(release)
+		for i := 0; i < limit; i++ {
+			if code := <-codes; code != http.StatusOK {
+				t.Errorf("Expected 200 for a request within the limit, got %d", code)
+			}
+		}
+	})
+
+	t.Run("Queue", func(t *testing.T) {
+		server, entered, release := newBlockingServer(t, WithMaxConcurrency(limit), WithRequestQueueing(true))
+		codes := serveAll(server)
+
+		for i := 0; i < limit; i++ {
+			<-entered
+		}
+
+		// Queued requests must not reach the handler until a slot frees up
+		select {
+		case <-entered:
+			t.Fatal("More requests than the limit were handled at once")
+		case <-time.After(50 * time.Millisecond):
+		}
+
+		close(release)
+		for i := 0; i < total; i++ {
+			if code := <-codes; code != http.StatusOK {
+				t.Errorf("Expected queued requests to succeed, got %d", code)
+			}
+		}
+	})
+}
+
+func TestAllowHeader(t *testing.T) {
+	tmpDir := t.TempDir()
+	os.WriteFile(filepath.Join(tmpDir, "test.txt"), []byte("test"), 0644)
+
+	server, err := New(WithRoot(tmpDir), WithWatcher(false))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req := httptest.NewRequest("POST", "/test.txt", nil)
+	w := httptest.NewRecorder()
+	server.ServeHTTP(w, req)
+
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("Expected 405 for POST, got %d", w.Code)
+	}
+	if allow := w.Header().Get("Allow"); allow != "GET, HEAD, OPTIONS" {
+		t.Errorf("Expected Allow on 405, got %q", allow)
+	}
+
+	for _, target := range []string{"/test.txt", "*"} {
+		req = httptest.NewRequest("OPTIONS", target, nil)
+		w = httptest.NewRecorder()
+		server.ServeHTTP(w, req)
+
+		if w.Code != http.StatusNoContent {
+			t.Errorf("OPTIONS %s: expected 204, got %d", target, w.Code)
+		}
+		if allow := w.Header().Get("Allow"); allow != "GET, HEAD, OPTIONS" {
+			t.Errorf("OPTIONS %s: expected Allow header, got %q", target, allow)
+		}
+		if w.Body.Len() != 0 {
+			t.Errorf("OPTIONS %s: expected no body, got %q", target, w.Body.String())
+		}
+	}
+}
+
+func TestResponseHeaders(t *testing.T) {
+	tmpDir := t.TempDir()
+	os.WriteFile(filepath.Join(tmpDir, "app.js"), bytes.Repeat([]byte("var x = 1; "), 200), 0644)
+
+	server, err := New(
+		WithRoot(tmpDir),
+		WithWatcher(false),
+		WithResponseHeaders(map[string]string{
+			"cross-origin-opener-policy":   "same-origin",
+			"Cross-Origin-Embedder-Policy": "require-corp",
+			"X-Frame-Options":              "SAMEORIGIN", // overrides a default
+			"X-XSS-Protection":             "",           // removes a default
+			"Content-Encoding":             "identity",   // per-response headers win
+		}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req := httptest.NewRequest("GET", "/app.js", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	w := httptest.NewRecorder()
+	server.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d", w.Code)
+	}
+
+	want := map[string]string{
+		"Cross-Origin-Opener-Policy":   "same-origin",
+		"Cross-Origin-Embedder-Policy": "require-corp",
+		"X-Frame-Options":              "SAMEORIGIN",
+		"X-XSS-Protection":             "",
+		"Content-Encoding":             "gzip",
+		"X-Content-Type-Options":       "nosniff",
+	}
+	for name, value := range want {
+		if got := w.Header().Get(name); got != value {
+			t.Errorf("Expected %s %q, got %q", name, value, got)
+		}
+	}
+}
+
+func TestProbeEndpoints(t *testing.T) {
+	server, err := New(WithRoot(t.TempDir()), WithWatcher(false))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	probe := func(path string) int {
+		req := httptest.NewRequest("GET", path, nil)
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	if code := probe("/livez"); code != http.StatusOK {
+		t.Errorf("Expected /livez 200 before Start, got %d", code)
+	}
+	if code := probe("/readyz"); code != http.StatusServiceUnavailable {
+		t.Errorf("Expected /readyz 503 before Start, got %d", code)
+	}
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go server.Serve(ln)
+
+	deadline := time.Now().Add(2 * time.Second)
+	for probe("/readyz") != http.StatusOK {
+		if time.Now().After(deadline) {
+			t.Fatal("Expected /readyz 200 once started")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	if err := server.Reload(WithCacheTTL(time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	if code := probe("/readyz"); code != http.StatusOK {
+		t.Errorf("Expected /readyz 200 after Reload, got %d", code)
+	}
+
+	server.Stop()
+	if code := probe("/readyz"); code != http.StatusServiceUnavailable {
+		t.Errorf("Expected /readyz 503 after Stop, got %d", code)
+	}
+	if code := probe("/livez"); code != http.StatusOK {
+		t.Errorf("Expected /livez 200 after Stop, got %d", code)
+	}
+}
+
+func TestStripPrefixHandler(t *testing.T) {
+	tmpDir := t.TempDir()
+	os.MkdirAll(filepath.Join(tmpDir, "static"), 0755)
+	os.WriteFile(filepath.Join(tmpDir, "static", "app.js"), []byte("console.log('app')"), 0644)
+
+	server, err := New(
+		WithRoot(tmpDir),
+		WithWatcher(false),
+		WithVersioning(true),
+		WithMetrics(true),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	parent := http.NewServeMux()
+	parent.Handle("/assets/", server.StripPrefix("/assets/"))
+	parent.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("app"))
+	})
+
+	versioned, ok := server.versionManager.GetVersionedPath("/static/app.js")
+	if !ok {
+		t.Fatal("Expected /static/app.js to be versioned")
+	}
+
+	tests := []struct {
+		path string
+		code int
+		body string
+	}{
+		{"/assets/static/app.js", http.StatusOK, "console.log('app')"},
+		{"/assets" + versioned, http.StatusOK, "console.log('app')"},
+		{"/assets/metrics", http.StatusNotFound, ""},
+		{"/static/app.js", http.StatusOK, "app"},
+	}
+
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		parent.ServeHTTP(w, httptest.NewRequest("GET", tt.path, nil))
+
+		if w.Code != tt.code {
+			t.Errorf("%s: expected %d, got %d", tt.path, tt.code, w.Code)
+			continue
+		}
+		if tt.body != "" && w.Body.String() != tt.body {
+			t.Errorf("%s: expected body %q, got %q", tt.path, tt.body, w.Body.String())
+		}
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"path"
 	"path/filepath"
 	"strings"
 	"testing"
@@ -438,6 +439,7 @@ func TestVersioningCacheInvalidation(t *testing.T) {
 		WithStaticPrefixes("/static/"),
 		WithWatcher(true),
 		WithCache(1024*1024),
+		WithAddr("127.0.0.1:0"),
 	)
 	if err != nil {
 		t.Fatalf("Failed to create server: %v", err)
@@ -464,8 +466,8 @@ func TestVersioningCacheInvalidation(t *testing.T) {
 		t.Fatalf("Failed to update file: %v", err)
 	}
 
-	// Give file watcher time to detect change
-	time.Sleep(100 * time.Millisecond)
+	// Give file watcher time to detect change and wait out the debounce window
+	time.Sleep(DefaultWatcherDebounce + 200*time.Millisecond)
 
 	// Get new versioned path
 	newVersionedPath, exists := server.versionManager.GetVersionedPath("/static/dynamic.js")
@@ -490,3 +492,282 @@ func TestVersioningCacheInvalidation(t *testing.T) {
 		t.Error("Should serve updated content at new versioned path")
 	}
 }
+
+// hashDirPath puts the hash in a directory: /assets/app.js -> /assets/<hash>/app.js
+func hashDirPath(original, hash, ext string) string {
+	return path.Join(path.Dir(original), hash, path.Base(original))
+}
+
+// hashDirReverse undoes hashDirPath, accepting hashes in either case
+func hashDirReverse(versioned string) (string, string, bool) {
+	dir, file := path.Split(versioned)
+	hashDir := strings.TrimSuffix(dir, "/")
+	hash := path.Base(hashDir)
+	if hash == "" || hash == "." || hash == "/" {
+		return "", "", false
+	}
+	return path.Join(path.Dir(hashDir), file), strings.ToLower(hash), true
+}
+
+func TestVersionedPathFunc(t *testing.T) {
+	tempDir := t.TempDir()
+	os.MkdirAll(filepath.Join(tempDir, "assets"), 0755)
+	os.WriteFile(filepath.Join(tempDir, "assets", "app.js"), []byte("console.log('app');"), 0644)
+	os.WriteFile(filepath.Join(tempDir, "index.html"), []byte(`<html><script src="/assets/app.js"></script></html>`), 0644)
+
+	server, err := New(
+		WithRoot(tempDir),
+		WithWatcher(false),
+		WithVersioning(true),
+		WithStaticPrefixes("/assets/"),
+		WithVersionedPathFunc(hashDirPath, hashDirReverse),
+	)
+	if err != nil {
+		t.Fatalf("Failed to create server: %v", err)
+	}
+
+	hash, ok := server.versionManager.GetContentHash("/assets/app.js")
+	if !ok {
+		t.Fatal("Expected app.js to be registered")
+	}
+	versionedPath := "/assets/" + hash + "/app.js"
+
+	t.Run("HTMLInjection", func(t *testing.T) {
+		req := httptest.NewRequest("GET", "/index.html", nil)
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, req)
+
+		if !strings.Contains(w.Body.String(), `src="`+versionedPath+`"`) {
+			t.Errorf("Expected HTML to reference %s, got %s", versionedPath, w.Body.String())
+		}
+	})
+
+	t.Run("Resolution", func(t *testing.T) {
+		for _, p := range []string{versionedPath, "/assets/" + strings.ToUpper(hash) + "/app.js"} {
+			req := httptest.NewRequest("GET", p, nil)
+			w := httptest.NewRecorder()
+			server.ServeHTTP(w, req)
+
+			if w.Code != http.StatusOK || w.Body.String() != "console.log('app');" {
+				t.Errorf("%s: expected 200 with app.js, got %d %q", p, w.Code, w.Body.String())
+			}
+			if cc := w.Header().Get("Cache-Control"); !strings.Contains(cc, "immutable") {
+				t.Errorf("%s: expected immutable Cache-Control, got %q", p, cc)
+			}
+		}
+	})
+
+	t.Run("StaleHash", func(t *testing.T) {
+		req := httptest.NewRequest("GET", "/assets/0000000000000000/app.js", nil)
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, req)
+
+		if w.Code != http.StatusNotFound {
+			t.Errorf("Expected 404 for a hash that does not match, got %d", w.Code)
+		}
+	})
+}
+
+func TestQueryStringVersioning(t *testing.T) {
+	tempDir := t.TempDir()
+	os.MkdirAll(filepath.Join(tempDir, "static"), 0755)
+	os.WriteFile(filepath.Join(tempDir, "static", "app.js"), []byte("console.log('app');"), 0644)
+	os.WriteFile(filepath.Join(tempDir, "index.html"), []byte(`<html><script src="/static/app.js"></script></html>`), 0644)
+
+	server, err := New(
+		WithRoot(tempDir),
+		WithWatcher(false),
+		WithVersioning(true),
+		WithVersioningMode(VersionQuery),
+		WithStaticPrefixes("/static/"),
+	)
+	if err != nil {
+		t.Fatalf("Failed to create server: %v", err)
+	}
+
+	hash, ok := server.versionManager.GetContentHash("/static/app.js")
+	if !ok {
+		t.Fatal("Expected app.js to be registered")
+	}
+	versionedPath := "/static/app.js?v=" + hash
+
+	if vp, _ := server.versionManager.GetVersionedPath("/static/app.js"); vp != versionedPath {
+		t.Errorf("Expected versioned path %s, got %s", versionedPath, vp)
+	}
+	if !server.versionManager.IsVersionedPath(versionedPath) {
+		t.Error("Expected the query form to be recognized as versioned")
+	}
+
+	t.Run("HTMLRewriting", func(t *testing.T) {
+		req := httptest.NewRequest("GET", "/index.html", nil)
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, req)
+
+		if !strings.Contains(w.Body.String(), `src="`+versionedPath+`"`) {
+			t.Errorf("Expected HTML to reference %s, got %s", versionedPath, w.Body.String())
+		}
+	})
+
+	tests := []struct {
+		name      string
+		url       string
+		immutable bool
+	}{
+		{"MatchingVersion", versionedPath, true},
+		{"MatchingVersionExtraParams", versionedPath + "&utm=x", true},
+		{"MismatchingVersion", "/static/app.js?v=0000000000000000", false},
+		{"NoVersion", "/static/app.js", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", tt.url, nil)
+			w := httptest.NewRecorder()
+			server.ServeHTTP(w, req)
+
+			if w.Code != http.StatusOK || w.Body.String() != "console.log('app');" {
+				t.Fatalf("Expected 200 with app.js, got %d %q", w.Code, w.Body.String())
+			}
+			if cc := w.Header().Get("Cache-Control"); strings.Contains(cc, "immutable") != tt.immutable {
+				t.Errorf("Expected immutable=%v, got Cache-Control %q", tt.immutable, cc)
+			}
+		})
+	}
+}
+
+func TestPreloadHeaders(t *testing.T) {
+	tempDir := t.TempDir()
+	os.MkdirAll(filepath.Join(tempDir, "static"), 0755)
+	os.WriteFile(filepath.Join(tempDir, "static", "app.css"), []byte("body{}"), 0644)
+	os.WriteFile(filepath.Join(tempDir, "static", "app.js"), []byte("console.log(1);"), 0644)
+	os.WriteFile(filepath.Join(tempDir, "static", "logo.png"), []byte("png"), 0644)
+	os.WriteFile(filepath.Join(tempDir, "index.html"), []byte(`<html><head>`+
+		`<link rel="stylesheet" href="/static/app.css">`+
+		`<script src="/static/app.js"></script>`+
+		`<script src="/static/app.js"></script>`+
+		`</head><body><img src="/static/logo.png"></body></html>`), 0644)
+
+	newServer := func(preload bool) *Server {
+		server, err := New(
+			WithRoot(tempDir),
+			WithWatcher(false),
+			WithVersioning(true),
+			WithStaticPrefixes("/static/"),
+			WithPreloadHeaders(preload),
+		)
+		if err != nil {
+			t.Fatalf("Failed to create server: %v", err)
+		}
+		return server
+	}
+
+	server := newServer(true)
+	css, _ := server.versionManager.GetVersionedPath("/static/app.css")
+	js, _ := server.versionManager.GetVersionedPath("/static/app.js")
+	want := []string{
+		"<" + css + ">; rel=preload; as=style",
+		"<" + js + ">; rel=preload; as=script",
+	}
+
+	// The second request is a cache hit and must carry the same headers
+	for i := 0; i < 2; i++ {
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, httptest.NewRequest("GET", "/index.html", nil))
+
+		links := w.Header().Values("Link")
+		if strings.Join(links, "\n") != strings.Join(want, "\n") {
+			t.Errorf("Request %d: expected Link headers %q, got %q", i, want, links)
+		}
+	}
+
+	w := httptest.NewRecorder()
+	newServer(false).ServeHTTP(w, httptest.NewRequest("GET", "/index.html", nil))
+	if links := w.Header().Values("Link"); len(links) != 0 {
+		t.Errorf("Expected no Link headers when disabled, got %q", links)
+	}
+}
+
+func TestServedCSSIsRewritten(t *testing.T) {
+	tempDir := t.TempDir()
+	os.MkdirAll(filepath.Join(tempDir, "static"), 0755)
+	os.WriteFile(filepath.Join(tempDir, "static", "bg.png"), []byte("png"), 0644)
+	os.WriteFile(filepath.Join(tempDir, "static", "style.css"), []byte("body{background:url('bg.png')}"), 0644)
+
+	server, err := New(
+		WithRoot(tempDir),
+		WithWatcher(false),
+		WithVersioning(true),
+		WithStaticPrefixes("/static/"),
+	)
+	if err != nil {
+		t.Fatalf("Failed to create server: %v", err)
+	}
+
+	bg, _ := server.versionManager.GetVersionedPath("/static/bg.png")
+
+	req := httptest.NewRequest("GET", "/static/style.css", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	w := httptest.NewRecorder()
+	server.ServeHTTP(w, req)
+
+	body := w.Body.Bytes()
+	if w.Header().Get("Content-Encoding") == "gzip" {
+		if body, err = Decompress(body, Gzip); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if want := "body{background:url('" + path.Base(bg) + "')}"; string(body) != want {
+		t.Errorf("Expected %s, got %s", want, body)
+	}
+}
+
+func TestVersionedPathDuringRescan(t *testing.T) {
+	tmpDir := t.TempDir()
+	os.MkdirAll(filepath.Join(tmpDir, "static"), 0755)
+	os.WriteFile(filepath.Join(tmpDir, "static", "app.js"), []byte("console.log('v1');"), 0644)
+
+	server, err := New(
+		WithRoot(tmpDir),
+		WithVersioning(true),
+		WithStaticPrefixes("/static/"),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	versioned, ok := server.versionManager.GetVersionedPath("/static/app.js")
+	if !ok {
+		t.Fatal("Expected app.js to be versioned")
+	}
+	// A version the running scan hasn't registered yet, e.g. from new HTML
+	unknown := strings.TrimSuffix(versioned, ".js")
+	unknown = unknown[:len(unknown)-8] + "0123abcd.js"
+
+	get := func(urlPath string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, httptest.NewRequest("GET", urlPath, nil))
+		return w
+	}
+
+	// Outside a scan an unknown version is simply missing
+	if w := get(unknown); w.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 for unknown version outside a scan, got %d", w.Code)
+	}
+
+	server.rescanning.Store(true)
+	defer server.rescanning.Store(false)
+
+	w := get(unknown)
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected 503 for unknown version during a scan, got %d", w.Code)
+	}
+	if w.Header().Get("Retry-After") != "1" {
+		t.Errorf("Expected Retry-After: 1, got %q", w.Header().Get("Retry-After"))
+	}
+
+	for _, urlPath := range []string{"/static/app.js", versioned} {
+		if w := get(urlPath); w.Code != http.StatusOK {
+			t.Errorf("%s: Expected 200 during a scan, got %d", urlPath, w.Code)
+		}
+	}
+}
@@ -0,0 +1,60 @@
+package gostc
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/hashicorp/golang-lru/v2/expirable"
+)
+
+// statCacheSize bounds the number of remembered stat results
+const statCacheSize = 4096
+
+// newStatCache returns a cache of os.FileInfo by filesystem path whose
+// entries expire after ttl, and registers it with invalidator so changed
+// files are evicted straight away
+func newStatCache(config *Config, invalidator Invalidator) *expirable.LRU[string, os.FileInfo] {
+	statCache := expirable.NewLRU[string, os.FileInfo](statCacheSize, nil, config.StatCacheTTL)
+
+	invalidator.RegisterCallback(func(urlPath string) {
+		if urlPath == InvalidateAllPath {
+			statCache.Purge()
+			return
+		}
+
+		fullPath, err := securePath(config.resolveRoot(urlPath))
+		if err != nil {
+			return
+		}
+
+		// Creating or removing an entry also changes its parent directory,
+		// and removing a directory takes everything below it
+		statCache.Remove(filepath.Dir(fullPath))
+		for _, name := range statCache.Keys() {
+			if name == fullPath || strings.HasPrefix(name, fullPath+string(filepath.Separator)) {
+				statCache.Remove(name)
+			}
+		}
+	})
+
+	return statCache
+}
+
+// cachedStat is s.stat through the stat cache, when one is configured.
+// Only successful results are cached; misses are left to the negative cache.
+func (s *Server) cachedStat(name string) (os.FileInfo, error) {
+	if s.statCache == nil {
+		return s.stat(name)
+	}
+
+	if info, ok := s.statCache.Get(name); ok {
+		return info, nil
+	}
+
+	info, err := s.stat(name)
+	if err == nil {
+		s.statCache.Add(name, info)
+	}
+	return info, err
+}
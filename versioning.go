@@ -1,14 +1,19 @@
 package gostc
 
 import (
+	"crypto/md5"
 	"crypto/sha256"
 	"encoding/hex"
 	"fmt"
+	"hash"
 	"os"
+	"path"
 	"path/filepath"
 	"regexp"
 	"strings"
 	"sync"
+
+	"github.com/cespare/xxhash/v2"
 )
 
 type AssetVersionManager struct {
@@ -18,13 +23,22 @@ type AssetVersionManager struct {
 	mu             sync.RWMutex
 	config         *Config
 	hashLength     int
+	newHash        func() hash.Hash
 	urlPrefix      string // URL prefix for serving (e.g., "/static")
+
+	versionedShape *regexp.Regexp // matches versioned URLs, registered or not
+
+	fileStates map[string]fileState     // original -> file state when scanned
+	restored   map[string]manifestAsset // assets from LoadState, reused when unchanged
+	readFile   func(name string) ([]byte, error)
 }
 
 type HTMLProcessor struct {
-	versionManager *AssetVersionManager
-	linkPattern    *regexp.Regexp
-	scriptPattern  *regexp.Regexp
+	versionManager   *AssetVersionManager
+	linkPattern      *regexp.Regexp
+	scriptPattern    *regexp.Regexp
+	cssURLPattern    *regexp.Regexp
+	cssImportPattern *regexp.Regexp
 }
 
 func NewAssetVersionManager(config *Config) *AssetVersionManager {
@@ -39,27 +53,81 @@ func NewAssetVersionManager(config *Config) *AssetVersionManager {
 		contentHashes:  make(map[string]string),
 		config:         config,
 		hashLength:     hashLength,
+		newHash:        newHashFunc(config.HashAlgorithm),
 		urlPrefix:      config.URLPrefix,
+		versionedShape: versionedShapePattern(config.VersioningPattern, hashLength),
+		fileStates:     make(map[string]fileState),
+		readFile:       os.ReadFile,
+	}
+}
+
+// newHashFunc returns the constructor for algorithm, defaulting to SHA-256
+func newHashFunc(algorithm HashAlgorithm) func() hash.Hash {
+	switch algorithm {
+	case HashMD5:
+		return md5.New
+	case HashXXH64:
+		return func() hash.Hash { return xxhash.New() }
+	default:
+		return sha256.New
 	}
 }
 
 func NewHTMLProcessor(versionManager *AssetVersionManager) *HTMLProcessor {
+	exts := defaultVersionableExtensions
+	if versionManager != nil {
+		exts = versionManager.versionableExtensions()
+	}
+
 	return &HTMLProcessor{
 		versionManager: versionManager,
-		linkPattern:    regexp.MustCompile(`(href|src)="([^"]*\.(css|js|mjs|png|jpg|jpeg|gif|svg|webp|ico|woff|woff2|ttf|otf))"[^>]*>`),
+		linkPattern:    linkPatternFor(exts),
 		scriptPattern:  regexp.MustCompile(`<script[^>]*src="([^"]*\.(?:js|mjs))"[^>]*>`),
+		// url("..."), url('...') or url(...)
+		cssURLPattern: regexp.MustCompile(`url\(\s*(?:"([^"]*)"|'([^']*)'|([^'"\s)]*))\s*\)`),
+		// @import "..." or @import '...'; @import url(...) is handled above
+		cssImportPattern: regexp.MustCompile(`@import\s+(?:"([^"]*)"|'([^']*)')`),
 	}
 }
 
+// linkPatternFor matches href and src attributes ending in one of exts
+func linkPatternFor(exts []string) *regexp.Regexp {
+	alternatives := make([]string, len(exts))
+	for i, ext := range exts {
+		alternatives[i] = regexp.QuoteMeta(strings.TrimPrefix(ext, "."))
+	}
+	return regexp.MustCompile(`(href|src)="([^"]*\.(` + strings.Join(alternatives, "|") + `))"[^>]*>`)
+}
+
 func (avm *AssetVersionManager) GenerateVersionedPath(originalPath string, content []byte) (string, string) {
-	hash := sha256.Sum256(content)
-	versionHash := hex.EncodeToString(hash[:avm.hashLength/2])
+	versionHash := avm.hashContent(content)
+	return avm.versionedPathFor(originalPath, versionHash), versionHash
+}
+
+// hashContent returns the truncated hex version hash of content
+func (avm *AssetVersionManager) hashContent(content []byte) string {
+	h := avm.newHash()
+	h.Write(content)
+	sum := h.Sum(nil)
 
+	n := avm.hashLength / 2
+	if n > len(sum) {
+		n = len(sum)
+	}
+	return hex.EncodeToString(sum[:n])
+}
+
+// versionedPathFor builds the versioned URL of originalPath for versionHash
+func (avm *AssetVersionManager) versionedPathFor(originalPath, versionHash string) string {
 	ext := filepath.Ext(originalPath)
 	base := strings.TrimSuffix(originalPath, ext)
 
 	var versionedPath string
-	if avm.config.VersioningPattern != "" {
+	if avm.config.VersioningMode == VersionQuery {
+		versionedPath = queryVersionedPath(originalPath, versionHash)
+	} else if avm.config.VersionedPathFunc != nil {
+		versionedPath = avm.config.VersionedPathFunc(originalPath, versionHash, ext)
+	} else if avm.config.VersioningPattern != "" {
 		versionedPath = strings.ReplaceAll(avm.config.VersioningPattern, "{base}", base)
 		versionedPath = strings.ReplaceAll(versionedPath, "{hash}", versionHash)
 		versionedPath = strings.ReplaceAll(versionedPath, "{ext}", ext)
@@ -67,14 +135,61 @@ func (avm *AssetVersionManager) GenerateVersionedPath(originalPath string, conte
 		versionedPath = fmt.Sprintf("%s.%s%s", base, versionHash, ext)
 	}
 
-	return versionedPath, versionHash
+	return versionedPath
+}
+
+// versionedShapePattern matches URLs built from pattern (default
+// "{base}.{hash}{ext}") with a hex hash of hashLength characters
+func versionedShapePattern(pattern string, hashLength int) *regexp.Regexp {
+	if pattern == "" {
+		pattern = "{base}.{hash}{ext}"
+	}
+
+	expr := regexp.QuoteMeta(pattern)
+	expr = strings.ReplaceAll(expr, `\{base\}`, `.+`)
+	expr = strings.ReplaceAll(expr, `\{hash\}`, fmt.Sprintf(`[0-9a-f]{%d}`, hashLength))
+	expr = strings.ReplaceAll(expr, `\{ext\}`, `\.[^./]+`)
+	return regexp.MustCompile("^" + expr + "$")
+}
+
+// looksVersioned reports whether path has the shape of a versioned URL,
+// whether or not it is registered. Custom VersionedPathFunc URLs are only
+// recognised through VersionedPathReverse.
+func (avm *AssetVersionManager) looksVersioned(path string) bool {
+	switch {
+	case avm.config.VersioningMode == VersionQuery:
+		return strings.Contains(path, "?v=")
+	case avm.config.VersionedPathReverse != nil:
+		_, _, ok := avm.config.VersionedPathReverse(path)
+		return ok
+	case avm.config.VersionedPathFunc != nil:
+		return false
+	default:
+		return avm.versionedShape.MatchString(path)
+	}
+}
+
+// queryVersionedPath appends the version to urlPath as a v query parameter
+func queryVersionedPath(urlPath, hash string) string {
+	if hash == "" {
+		return urlPath
+	}
+	return urlPath + "?v=" + hash
 }
 
 func (avm *AssetVersionManager) RegisterAsset(originalPath string, content []byte) {
+	if avm.isExcluded(originalPath) {
+		return
+	}
+	avm.registerHash(originalPath, avm.hashContent(content))
+}
+
+// registerHash records originalPath as versioned by hash
+func (avm *AssetVersionManager) registerHash(originalPath, hash string) {
 	avm.mu.Lock()
 	defer avm.mu.Unlock()
 
-	versionedPath, hash := avm.GenerateVersionedPath(originalPath, content)
+	versionedPath := avm.versionedPathFor(originalPath, hash)
 
 	// If URL prefix is set, also register with prefixed paths for HTML matching
 	if avm.urlPrefix != "" {
@@ -117,8 +232,29 @@ func (avm *AssetVersionManager) GetOriginalPath(versionedPath string) (string, b
 	avm.mu.RLock()
 	defer avm.mu.RUnlock()
 
-	originalPath, exists := avm.originalPaths[versionedPath]
-	return originalPath, exists
+	if originalPath, exists := avm.originalPaths[versionedPath]; exists {
+		return originalPath, true
+	}
+	return avm.reverseVersionedPath(versionedPath)
+}
+
+// reverseVersionedPath resolves versionedPath with the configured reverse
+// function. The hash must match the asset's current content so stale or
+// forged URLs are not treated as versioned. Callers hold avm.mu.
+func (avm *AssetVersionManager) reverseVersionedPath(versionedPath string) (string, bool) {
+	if avm.config.VersionedPathReverse == nil {
+		return "", false
+	}
+
+	originalPath, hash, ok := avm.config.VersionedPathReverse(versionedPath)
+	if !ok {
+		return "", false
+	}
+
+	if current, exists := avm.contentHashes[originalPath]; !exists || current != hash {
+		return "", false
+	}
+	return originalPath, true
 }
 
 func (avm *AssetVersionManager) GetContentHash(path string) (string, bool) {
@@ -129,11 +265,16 @@ func (avm *AssetVersionManager) GetContentHash(path string) (string, bool) {
 	return hash, exists
 }
 
+// IsVersionedPath reports whether path is a registered versioned URL. In
+// query mode path includes the ?v= parameter.
 func (avm *AssetVersionManager) IsVersionedPath(path string) bool {
 	avm.mu.RLock()
 	defer avm.mu.RUnlock()
 
-	_, exists := avm.originalPaths[path]
+	if _, exists := avm.originalPaths[path]; exists {
+		return true
+	}
+	_, exists := avm.reverseVersionedPath(path)
 	return exists
 }
 
@@ -147,31 +288,18 @@ func (avm *AssetVersionManager) RemoveAsset(originalPath string) {
 
 	delete(avm.versionedPaths, originalPath)
 	delete(avm.contentHashes, originalPath)
+	delete(avm.fileStates, originalPath)
 }
 
+// ScanDirectory registers the versionable files under rootPath and under
+// every configured mount
 func (avm *AssetVersionManager) ScanDirectory(rootPath string) error {
 	if !avm.config.EnableVersioning {
 		return nil
 	}
 
-	scannedCount := 0
-	registeredCount := 0
-
-	err := filepath.Walk(rootPath, func(fullPath string, info os.FileInfo, err error) error {
-		if err != nil {
-			return err
-		}
-
-		if info.IsDir() {
-			return nil
-		}
-
-		relativePath := strings.TrimPrefix(fullPath, rootPath)
-		relativePath = filepath.ToSlash(relativePath)
-		if !strings.HasPrefix(relativePath, "/") {
-			relativePath = "/" + relativePath
-		}
-
+	var scannedCount, registeredCount int
+	err := avm.walkServed(rootPath, func(relativePath, fullPath string, info os.FileInfo) error {
 		scannedCount++
 
 		if !avm.shouldVersionFile(relativePath) {
@@ -182,16 +310,30 @@ func (avm *AssetVersionManager) ScanDirectory(rootPath string) error {
 			return nil
 		}
 
-		content, err := os.ReadFile(fullPath)
-		if err != nil {
-			return err
+		state := fileState{ModTime: info.ModTime(), Size: info.Size()}
+		if hash, ok := avm.restoredHash(relativePath, state); ok {
+			avm.registerHash(relativePath, hash)
+		} else {
+			content, err := avm.readFile(fullPath)
+			if err != nil {
+				return err
+			}
+			avm.RegisterAsset(relativePath, content)
 		}
 
-		avm.RegisterAsset(relativePath, content)
+		avm.mu.Lock()
+		avm.fileStates[relativePath] = state
+		avm.mu.Unlock()
+
 		registeredCount++
 		return nil
 	})
 
+	// Restored hashes are only needed for one scan
+	avm.mu.Lock()
+	avm.restored = nil
+	avm.mu.Unlock()
+
 	// Debug logging can be enabled with environment variable
 	if err == nil && os.Getenv("GOSTC_DEBUG") != "" {
 		fmt.Printf("📦 [Versioning] Scanned %d files, registered %d for versioning\n", scannedCount, registeredCount)
@@ -200,11 +342,62 @@ func (avm *AssetVersionManager) ScanDirectory(rootPath string) error {
 	return err
 }
 
+// walkServed calls fn for every file served from rootPath and from each
+// mount, with the URL path it is served at. Files under rootPath that a
+// mount shadows are skipped. An error from fn stops the walk.
+func (avm *AssetVersionManager) walkServed(rootPath string, fn func(urlPath, fullPath string, info os.FileInfo) error) error {
+	err := avm.walkRoot(rootPath, "", fn)
+	for _, m := range avm.config.Mounts {
+		if err != nil {
+			break
+		}
+		err = avm.walkRoot(m.Root, m.Prefix, fn)
+	}
+	return err
+}
+
+// walkRoot calls fn for the files under rootPath, served at URL paths
+// beginning with mountPrefix
+func (avm *AssetVersionManager) walkRoot(rootPath, mountPrefix string, fn func(urlPath, fullPath string, info os.FileInfo) error) error {
+	return filepath.Walk(rootPath, func(fullPath string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if info.IsDir() {
+			return nil
+		}
+
+		relativePath := strings.TrimPrefix(fullPath, rootPath)
+		relativePath = filepath.ToSlash(relativePath)
+		if !strings.HasPrefix(relativePath, "/") {
+			relativePath = "/" + relativePath
+		}
+		relativePath = mountPrefix + relativePath
+
+		// Files under Root that a mount shadows are never served
+		if m, ok := findMount(avm.config.Mounts, relativePath); ok && m.Prefix != mountPrefix {
+			return nil
+		}
+
+		return fn(relativePath, fullPath, info)
+	})
+}
+
 func (avm *AssetVersionManager) shouldVersionFile(path string) bool {
 	if len(avm.config.StaticPrefixes) == 0 {
 		avm.config.StaticPrefixes = []string{"/static/", "/assets/", "/dist/", "/build/"}
 	}
 
+	if avm.isExcluded(path) {
+		return false
+	}
+
+	// Static prefixes apply within each mount, e.g. /docs/static/app.js
+	if m, ok := findMount(avm.config.Mounts, path); ok {
+		path = m.relativePath(path)
+	}
+
 	// If we have a URL prefix, we need to check for both prefixed and non-prefixed paths
 	for _, prefix := range avm.config.StaticPrefixes {
 		// Check direct prefix match
@@ -226,15 +419,48 @@ func (avm *AssetVersionManager) shouldVersionFile(path string) bool {
 	return false
 }
 
-func (avm *AssetVersionManager) isVersionableExtension(path string) bool {
-	ext := strings.ToLower(filepath.Ext(path))
-	versionableExts := []string{
-		".css", ".js", ".mjs",
-		".png", ".jpg", ".jpeg", ".gif", ".svg", ".webp", ".ico",
-		".woff", ".woff2", ".ttf", ".otf", ".eot",
+// isExcluded reports whether urlPath matches a VersioningExclude pattern,
+// with or without the URL prefix
+func (avm *AssetVersionManager) isExcluded(urlPath string) bool {
+	candidates := []string{urlPath}
+	if avm.urlPrefix != "" {
+		candidates = append(candidates, avm.urlPrefix+urlPath)
+	}
+
+	for _, pattern := range avm.config.VersioningExclude {
+		for _, candidate := range candidates {
+			if strings.HasSuffix(pattern, "/") {
+				if strings.HasPrefix(candidate, pattern) {
+					return true
+				}
+			} else if matched, _ := path.Match(pattern, candidate); matched {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// defaultVersionableExtensions are versioned unless VersionableExtensions
+// replaces them
+var defaultVersionableExtensions = []string{
+	".css", ".js", ".mjs",
+	".png", ".jpg", ".jpeg", ".gif", ".svg", ".webp", ".ico",
+	".woff", ".woff2", ".ttf", ".otf", ".eot",
+}
+
+// versionableExtensions returns the configured extension set, or the
+// built-in one when none is configured
+func (avm *AssetVersionManager) versionableExtensions() []string {
+	if avm.config.VersionableExtensions != nil {
+		return avm.config.VersionableExtensions
 	}
+	return defaultVersionableExtensions
+}
 
-	for _, e := range versionableExts {
+func (avm *AssetVersionManager) isVersionableExtension(path string) bool {
+	ext := strings.ToLower(filepath.Ext(path))
+	for _, e := range avm.versionableExtensions() {
 		if ext == e {
 			return true
 		}
@@ -243,17 +469,36 @@ func (avm *AssetVersionManager) isVersionableExtension(path string) bool {
 }
 
 func (hp *HTMLProcessor) ProcessHTML(content []byte, basePath string) []byte {
+	processed, _ := hp.processHTML(content, basePath, false)
+	return processed
+}
+
+// ProcessHTMLWithAssets is ProcessHTML that also returns the versioned URLs
+// of the stylesheets and scripts it rewrote, in document order
+func (hp *HTMLProcessor) ProcessHTMLWithAssets(content []byte, basePath string) ([]byte, []string) {
+	return hp.processHTML(content, basePath, true)
+}
+
+func (hp *HTMLProcessor) processHTML(content []byte, basePath string, collect bool) ([]byte, []string) {
 	if hp.versionManager == nil || !hp.versionManager.config.EnableVersioning {
-		return content
+		return content, nil
 	}
 
 	result := string(content)
 	replacements := 0
 
+	var assets []string
+	seen := make(map[string]bool)
+
 	result = hp.linkPattern.ReplaceAllStringFunc(result, func(match string) string {
-		processed := hp.processAssetReference(match)
+		processed, versionedPath := hp.processAssetReference(match)
 		if processed != match {
 			replacements++
+
+			if collect && preloadAs(versionedPath) != "" && !seen[versionedPath] {
+				seen[versionedPath] = true
+				assets = append(assets, versionedPath)
+			}
 		}
 		return processed
 	})
@@ -262,13 +507,93 @@ func (hp *HTMLProcessor) ProcessHTML(content []byte, basePath string) []byte {
 		fmt.Printf("🔄 [HTML Processing] Transformed %d asset references in %s\n", replacements, basePath)
 	}
 
+	return []byte(result), assets
+}
+
+// ProcessCSS rewrites url() and @import references in a stylesheet served
+// from basePath to their versioned paths. Relative references are resolved
+// against the stylesheet and stay relative; data: and absolute URLs are left
+// alone.
+func (hp *HTMLProcessor) ProcessCSS(content []byte, basePath string) []byte {
+	if hp.versionManager == nil || !hp.versionManager.config.EnableVersioning {
+		return content
+	}
+
+	result := hp.cssURLPattern.ReplaceAllStringFunc(string(content), func(match string) string {
+		ref, quote := cssReference(hp.cssURLPattern.FindStringSubmatch(match))
+		if versioned, ok := hp.versionCSSReference(ref, basePath); ok {
+			return "url(" + quote + versioned + quote + ")"
+		}
+		return match
+	})
+
+	result = hp.cssImportPattern.ReplaceAllStringFunc(result, func(match string) string {
+		ref, quote := cssReference(hp.cssImportPattern.FindStringSubmatch(match))
+		if versioned, ok := hp.versionCSSReference(ref, basePath); ok {
+			return "@import " + quote + versioned + quote
+		}
+		return match
+	})
+
 	return []byte(result)
 }
 
-func (hp *HTMLProcessor) processAssetReference(match string) string {
+// cssReference picks the reference and its quote character out of the
+// alternation groups of a CSS pattern match: double, single, then unquoted
+func cssReference(submatches []string) (ref, quote string) {
+	quotes := []string{`"`, `'`, ""}
+	for i, q := range quotes {
+		if i+1 < len(submatches) && submatches[i+1] != "" {
+			return submatches[i+1], q
+		}
+	}
+	return "", ""
+}
+
+// versionCSSReference maps a reference found in the stylesheet at basePath
+// to its versioned form, keeping any query or fragment suffix
+func (hp *HTMLProcessor) versionCSSReference(ref, basePath string) (string, bool) {
+	if ref == "" || strings.HasPrefix(ref, "//") || strings.HasPrefix(ref, "#") || strings.Contains(ref, ":") {
+		return "", false
+	}
+
+	refPath, suffix := ref, ""
+	if i := strings.IndexAny(ref, "?#"); i >= 0 {
+		refPath, suffix = ref[:i], ref[i:]
+	}
+
+	relative := !strings.HasPrefix(refPath, "/")
+	lookup := refPath
+	if relative {
+		lookup = path.Join(path.Dir(basePath), refPath)
+	}
+
+	versioned, ok := hp.versionManager.GetVersionedPath(lookup)
+	if !ok {
+		return "", false
+	}
+
+	if relative {
+		rel, err := filepath.Rel(filepath.FromSlash(path.Dir(basePath)), filepath.FromSlash(versioned))
+		if err != nil {
+			return "", false
+		}
+		versioned = filepath.ToSlash(rel)
+	}
+
+	// A query-mode version already carries a query string
+	if strings.HasPrefix(suffix, "?") && strings.Contains(versioned, "?") {
+		suffix = "&" + suffix[1:]
+	}
+	return versioned + suffix, true
+}
+
+// processAssetReference rewrites one matched reference and returns the
+// versioned URL it substituted, if any
+func (hp *HTMLProcessor) processAssetReference(match string) (string, string) {
 	submatches := hp.linkPattern.FindStringSubmatch(match)
 	if len(submatches) < 3 {
-		return match
+		return match, ""
 	}
 
 	attributeName := submatches[1] // href or src
@@ -278,7 +603,7 @@ func (hp *HTMLProcessor) processAssetReference(match string) string {
 		if os.Getenv("GOSTC_DEBUG") != "" {
 			fmt.Printf("    ➜ Replacing %s with %s\n", originalURL, versionedPath)
 		}
-		return strings.Replace(match, fmt.Sprintf(`%s="%s"`, attributeName, originalURL), fmt.Sprintf(`%s="%s"`, attributeName, versionedPath), 1)
+		return strings.Replace(match, fmt.Sprintf(`%s="%s"`, attributeName, originalURL), fmt.Sprintf(`%s="%s"`, attributeName, versionedPath), 1), versionedPath
 	} else {
 		// Debug: show what we're looking for but not finding
 		if os.Getenv("GOSTC_DEBUG") != "" && (strings.Contains(originalURL, ".css") || strings.Contains(originalURL, ".js")) {
@@ -286,5 +611,24 @@ func (hp *HTMLProcessor) processAssetReference(match string) string {
 		}
 	}
 
-	return match
+	return match, ""
+}
+
+// preloadAs returns the Link as= destination for a preloadable asset URL,
+// or "" for assets that aren't preloaded
+func preloadAs(assetURL string) string {
+	assetPath, _, _ := strings.Cut(assetURL, "?")
+	switch strings.ToLower(filepath.Ext(assetPath)) {
+	case ".css":
+		return "style"
+	case ".js", ".mjs":
+		return "script"
+	default:
+		return ""
+	}
+}
+
+// preloadLink formats a Link header value preloading assetURL
+func preloadLink(assetURL string) string {
+	return fmt.Sprintf("<%s>; rel=preload; as=%s", assetURL, preloadAs(assetURL))
 }
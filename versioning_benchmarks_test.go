@@ -365,6 +365,45 @@ func BenchmarkVersionHashGeneration(b *testing.B) {
 	})
 }
 
+func BenchmarkScanDirectoryHashAlgorithms(b *testing.B) {
+	rootDir := b.TempDir()
+	staticDir := filepath.Join(rootDir, "static")
+	os.MkdirAll(staticDir, 0755)
+
+	content := strings.Repeat("function asset() { return 42; }\n", 2000) // ~64KB
+	for i := 0; i < 200; i++ {
+		os.WriteFile(filepath.Join(staticDir, fmt.Sprintf("asset%d.js", i)), []byte(content), 0644)
+	}
+
+	algorithms := []struct {
+		name      string
+		algorithm HashAlgorithm
+	}{
+		{"SHA256", HashSHA256},
+		{"MD5", HashMD5},
+		{"XXH64", HashXXH64},
+	}
+
+	for _, alg := range algorithms {
+		b.Run(alg.name, func(b *testing.B) {
+			config := &Config{
+				EnableVersioning:  true,
+				VersionHashLength: 16,
+				HashAlgorithm:     alg.algorithm,
+				StaticPrefixes:    []string{"/static/"},
+			}
+
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				avm := NewAssetVersionManager(config)
+				if err := avm.ScanDirectory(rootDir); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
 func BenchmarkConcurrentVersioning(b *testing.B) {
 	config := &Config{
 		EnableVersioning:  true,
@@ -2,7 +2,10 @@ package gostc
 
 import (
 	"bytes"
+	"net/http"
+	"net/http/httptest"
 	"os"
+	"path"
 	"path/filepath"
 	"strings"
 	"testing"
@@ -197,6 +200,63 @@ func TestHTMLProcessor(t *testing.T) {
 	})
 }
 
+func TestProcessCSS(t *testing.T) {
+	config := &Config{
+		EnableVersioning:  true,
+		VersionHashLength: 16,
+		StaticPrefixes:    []string{"/static/"},
+	}
+
+	avm := NewAssetVersionManager(config)
+	processor := NewHTMLProcessor(avm)
+
+	avm.RegisterAsset("/static/img/bg.png", []byte("background"))
+	avm.RegisterAsset("/static/fonts/main.woff2", []byte("font"))
+	avm.RegisterAsset("/static/css/base.css", []byte("body{}"))
+	bg, _ := avm.GetVersionedPath("/static/img/bg.png")
+	font, _ := avm.GetVersionedPath("/static/fonts/main.woff2")
+	base, _ := avm.GetVersionedPath("/static/css/base.css")
+
+	relBg := "../img/" + path.Base(bg)
+
+	tests := []struct {
+		name string
+		css  string
+		want string
+	}{
+		{"DoubleQuotes", `a{background:url("/static/img/bg.png")}`, `a{background:url("` + bg + `")}`},
+		{"SingleQuotes", `a{background:url('/static/img/bg.png')}`, `a{background:url('` + bg + `')}`},
+		{"NoQuotes", `a{background:url(/static/img/bg.png)}`, `a{background:url(` + bg + `)}`},
+		{"Whitespace", `a{background:url( "/static/img/bg.png" )}`, `a{background:url("` + bg + `")}`},
+		{"Relative", `a{background:url(../img/bg.png)}`, `a{background:url(` + relBg + `)}`},
+		{"QueryAndFragment", `@font-face{src:url(/static/fonts/main.woff2?#iefix)}`, `@font-face{src:url(` + font + `?#iefix)}`},
+		{"ImportDoubleQuotes", `@import "/static/css/base.css";`, `@import "` + base + `";`},
+		{"ImportSingleQuotes", `@import 'base.css';`, `@import '` + path.Base(base) + `';`},
+		{"ImportURL", `@import url("base.css");`, `@import url("` + path.Base(base) + `");`},
+		{"DataURL", `a{background:url(data:image/png;base64,AAAA)}`, `a{background:url(data:image/png;base64,AAAA)}`},
+		{"AbsoluteURL", `a{background:url(https://cdn.example.com/static/img/bg.png)}`, `a{background:url(https://cdn.example.com/static/img/bg.png)}`},
+		{"ProtocolRelative", `a{background:url(//cdn.example.com/bg.png)}`, `a{background:url(//cdn.example.com/bg.png)}`},
+		{"Unregistered", `a{background:url(/static/img/missing.png)}`, `a{background:url(/static/img/missing.png)}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := string(processor.ProcessCSS([]byte(tt.css), "/static/css/style.css"))
+			if got != tt.want {
+				t.Errorf("Expected %s, got %s", tt.want, got)
+			}
+		})
+	}
+
+	t.Run("Disabled", func(t *testing.T) {
+		disabled := NewHTMLProcessor(NewAssetVersionManager(&Config{EnableVersioning: false}))
+		css := `a{background:url(/static/img/bg.png)}`
+		if got := string(disabled.ProcessCSS([]byte(css), "/static/css/style.css")); got != css {
+			t.Errorf("Should not modify CSS when versioning is disabled, got %s", got)
+		}
+	})
+}
+
 func TestAssetVersionManagerScanDirectory(t *testing.T) {
 	// Create temporary directory structure
 	tempDir, err := os.MkdirTemp("", "gostc-test-*")
@@ -283,6 +343,48 @@ func TestConsistentHashing(t *testing.T) {
 	}
 }
 
+func TestHashAlgorithms(t *testing.T) {
+	content := []byte("consistent test content")
+	path := "/static/test.js"
+
+	seen := make(map[string]HashAlgorithm)
+	for _, algorithm := range []HashAlgorithm{HashSHA256, HashMD5, HashXXH64} {
+		avm := NewAssetVersionManager(&Config{
+			EnableVersioning:  true,
+			VersionHashLength: 16,
+			HashAlgorithm:     algorithm,
+		})
+
+		_, hash1 := avm.GenerateVersionedPath(path, content)
+		_, hash2 := avm.GenerateVersionedPath(path, content)
+		_, hash3 := avm.GenerateVersionedPath(path, []byte("different content"))
+
+		if len(hash1) != 16 {
+			t.Errorf("algorithm %d: expected 16 hex characters, got %q", algorithm, hash1)
+		}
+		if hash1 != hash2 {
+			t.Errorf("algorithm %d: hash should be stable, got %s and %s", algorithm, hash1, hash2)
+		}
+		if hash1 == hash3 {
+			t.Errorf("algorithm %d: different content should produce a different hash", algorithm)
+		}
+		if other, dup := seen[hash1]; dup {
+			t.Errorf("algorithms %d and %d produced the same hash %s", other, algorithm, hash1)
+		}
+		seen[hash1] = algorithm
+	}
+
+	// The length clamp applies to every algorithm
+	avm := NewAssetVersionManager(&Config{VersionHashLength: 8, HashAlgorithm: HashXXH64})
+	if _, hash := avm.GenerateVersionedPath(path, content); len(hash) != 8 {
+		t.Errorf("Expected 8 hex characters, got %q", hash)
+	}
+
+	if err := (&Config{HashAlgorithm: HashAlgorithm(99)}).Validate(); err == nil {
+		t.Error("Expected an unknown hash algorithm to fail validation")
+	}
+}
+
 func TestVersioningWithCustomPattern(t *testing.T) {
 	config := &Config{
 		EnableVersioning:  true,
@@ -356,3 +458,121 @@ func BenchmarkHTMLProcessing(b *testing.B) {
 		processor.ProcessHTML(html, "/index.html")
 	}
 }
+
+func TestVersioningExclude(t *testing.T) {
+	tmpDir := t.TempDir()
+	os.MkdirAll(filepath.Join(tmpDir, "static", "vendor"), 0755)
+	os.WriteFile(filepath.Join(tmpDir, "static", "app.js"), []byte("console.log('app');"), 0644)
+	os.WriteFile(filepath.Join(tmpDir, "static", "vendor", "analytics.js"), []byte("console.log('analytics');"), 0644)
+	os.WriteFile(filepath.Join(tmpDir, "index.html"), []byte(`<html><head>
+<script src="/static/app.js"></script>
+<script src="/static/vendor/analytics.js"></script>
+</head></html>`), 0644)
+
+	server, err := New(
+		WithRoot(tmpDir),
+		WithWatcher(false),
+		WithVersioning(true),
+		WithStaticPrefixes("/static/"),
+		WithVersioningExclude("/static/vendor/*.js"),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := server.versionManager.GetVersionedPath("/static/vendor/analytics.js"); ok {
+		t.Error("Excluded asset should not be registered by ScanDirectory")
+	}
+	server.versionManager.RegisterAsset("/static/vendor/analytics.js", []byte("changed"))
+	if _, ok := server.versionManager.GetVersionedPath("/static/vendor/analytics.js"); ok {
+		t.Error("Excluded asset should not be registered by RegisterAsset")
+	}
+
+	req := httptest.NewRequest("GET", "/index.html", nil)
+	w := httptest.NewRecorder()
+	server.ServeHTTP(w, req)
+
+	body := w.Body.String()
+	if !strings.Contains(body, `src="/static/vendor/analytics.js"`) {
+		t.Errorf("Excluded script should keep its original path, got:\n%s", body)
+	}
+	if strings.Contains(body, `src="/static/app.js"`) {
+		t.Errorf("Non-excluded script should be versioned, got:\n%s", body)
+	}
+
+	req = httptest.NewRequest("GET", "/static/vendor/analytics.js", nil)
+	w = httptest.NewRecorder()
+	server.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected excluded asset to be served, got %d", w.Code)
+	}
+
+	if _, err := New(WithRoot(tmpDir), WithWatcher(false), WithVersioningExclude("/static/[")); err == nil {
+		t.Error("Expected an invalid exclude pattern to be rejected")
+	}
+}
+
+func TestVersionableExtensions(t *testing.T) {
+	tmpDir := t.TempDir()
+	os.MkdirAll(filepath.Join(tmpDir, "data"), 0755)
+	os.WriteFile(filepath.Join(tmpDir, "data", "module.wasm"), []byte("\x00asm\x01\x00\x00\x00"), 0644)
+	os.WriteFile(filepath.Join(tmpDir, "data", "points.json"), []byte(`{"points":[]}`), 0644)
+	os.WriteFile(filepath.Join(tmpDir, "index.html"), []byte(`<html><head>
+<link rel="preload" href="/data/module.wasm" as="fetch">
+<link rel="preload" href="/data/points.json" as="fetch">
+</head></html>`), 0644)
+
+	newServer := func(opts ...Option) *Server {
+		server, err := New(append([]Option{
+			WithRoot(tmpDir),
+			WithWatcher(false),
+			WithVersioning(true),
+			WithStaticPrefixes("/data/"),
+		}, opts...)...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return server
+	}
+
+	if _, ok := newServer().versionManager.GetVersionedPath("/data/module.wasm"); ok {
+		t.Error(".wasm should not be versioned by default")
+	}
+
+	server := newServer(WithAdditionalVersionableExtensions("wasm"))
+
+	versioned, ok := server.versionManager.GetVersionedPath("/data/module.wasm")
+	if !ok {
+		t.Fatal("Expected .wasm to be versioned after adding the extension")
+	}
+	if _, ok := server.versionManager.GetVersionedPath("/data/points.json"); ok {
+		t.Error(".json was not added and should not be versioned")
+	}
+	if !server.versionManager.shouldVersionFile("/data/app.js") {
+		t.Error("Built-in extensions should still be versioned")
+	}
+
+	req := httptest.NewRequest("GET", "/index.html", nil)
+	w := httptest.NewRecorder()
+	server.ServeHTTP(w, req)
+
+	body := w.Body.String()
+	if !strings.Contains(body, `href="`+versioned+`"`) {
+		t.Errorf("Expected HTML to reference %s, got:\n%s", versioned, body)
+	}
+	if !strings.Contains(body, `href="/data/points.json"`) {
+		t.Errorf("Expected unversioned JSON reference to be left alone, got:\n%s", body)
+	}
+
+	req = httptest.NewRequest("GET", versioned, nil)
+	w = httptest.NewRecorder()
+	server.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected versioned .wasm to be served, got %d", w.Code)
+	}
+
+	replaced := newServer(WithVersionableExtensions(".json"))
+	if !replaced.versionManager.shouldVersionFile("/data/points.json") || replaced.versionManager.shouldVersionFile("/data/app.js") {
+		t.Error("WithVersionableExtensions should replace the built-in set")
+	}
+}
@@ -0,0 +1,176 @@
+package gostc
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// Warm loads each URL path ("/app.js") into the cache in every enabled
+// encoding, through the same read, rewrite and compression steps a request
+// takes, so the first visitors after a deploy hit a warm cache. Versioned
+// assets are also warmed under their versioned URL. Missing files are
+// skipped with a warning; other failures are joined into the result.
+func (s *Server) Warm(paths ...string) error {
+	// Without the lock, so a slow warm-up doesn't hold up Reload
+	s = s.current()
+
+	var errs []error
+	for _, urlPath := range paths {
+		if err := s.warmPath(urlPath, nil); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// warmConfigured warms Config.WarmPaths, logging rather than returning
+// failures so a bad path doesn't keep the server from starting
+func (s *Server) warmConfigured() {
+	s.mu.RLock()
+	paths := s.config.WarmPaths
+	s.mu.RUnlock()
+
+	if len(paths) == 0 {
+		return
+	}
+
+	if err := s.Warm(paths...); err != nil {
+		log.Printf("[WARM] %v", err)
+	}
+}
+
+// warmOnStart runs WarmDirectory when WarmOnStart is set, logging failures
+func (s *Server) warmOnStart() {
+	s.mu.RLock()
+	enabled := s.config.WarmOnStart
+	s.mu.RUnlock()
+
+	if !enabled {
+		return
+	}
+
+	if err := s.WarmDirectory(); err != nil {
+		log.Printf("[WARM] %v", err)
+	}
+}
+
+// errWarmBudget stops a directory warm-up once the next entry could push
+// the cache past CacheSize and start evicting what was just warmed
+var errWarmBudget = errors.New("cache warm-up budget exhausted")
+
+// WarmDirectory walks Root and the mounts and warms every versionable
+// asset (see WithStaticPrefixes), like Warm. It stops once the cache is
+// full rather than evicting entries it has just loaded.
+func (s *Server) WarmDirectory() error {
+	s = s.current()
+
+	budget := s.config.CacheSize - s.cache.Stats().Size
+	warmed := 0
+	err := s.versionManager.walkServed(s.config.Root, func(urlPath, fullPath string, info os.FileInfo) error {
+		if !s.versionManager.shouldVersionFile(urlPath) {
+			return nil
+		}
+		if err := s.warmPath(urlPath, &budget); err != nil {
+			return err
+		}
+		warmed++
+		return nil
+	})
+
+	if errors.Is(err, errWarmBudget) {
+		log.Printf("[WARM] Cache full after warming %d assets", warmed)
+		return nil
+	}
+	return err
+}
+
+// warmPath loads urlPath's cache entries. With a budget, each entry is only
+// loaded while the file's full size still fits, and its size is deducted.
+func (s *Server) warmPath(urlPath string, budget *int64) error {
+	cleanedPath := path.Clean("/" + strings.TrimPrefix(urlPath, "/"))
+	if !isValidPath(cleanedPath) || !s.config.dotfileAllowed(cleanedPath) {
+		return NewServerError(ErrorTypeSecurity, "server.warm", ErrInvalidPath).
+			WithPath(urlPath)
+	}
+
+	root, relPath := s.config.resolveRoot(cleanedPath)
+	fullPath, err := securePath(root, relPath)
+	if err != nil {
+		return NewServerError(ErrorTypeSecurity, "server.warm", ErrPathTraversal).
+			WithPath(urlPath)
+	}
+
+	info, err := s.cachedStat(fullPath)
+	if err == nil && info.IsDir() {
+		name, indexInfo, ok := s.findIndexFile(fullPath)
+		if !ok {
+			err = os.ErrNotExist
+		} else {
+			fullPath = filepath.Join(fullPath, name)
+			cleanedPath = path.Join(cleanedPath, name)
+			info = indexInfo
+		}
+	}
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			log.Printf("[WARM] Skipping %s: file not found", urlPath)
+			return nil
+		}
+		return NewServerError(ErrorTypeServerError, "server.warm", err).
+			WithPath(urlPath)
+	}
+
+	// Versioned requests are cached under the versioned URL, minus any
+	// query string in query mode
+	keys := []CacheKey{{Path: cleanedPath}}
+	if s.config.EnableVersioning {
+		if versioned, ok := s.versionManager.GetVersionedPath(cleanedPath); ok {
+			versionedPath, _, _ := strings.Cut(versioned, "?")
+			keys = append(keys, CacheKey{Path: versionedPath, IsVersioned: true})
+		}
+	}
+
+	r, err := http.NewRequestWithContext(context.Background(), http.MethodGet, cleanedPath, nil)
+	if err != nil {
+		return err
+	}
+
+	for _, base := range keys {
+		for _, compressionType := range allCompressionTypes() {
+			var compressor Compressor
+			if compressionType != NoCompression {
+				if s.config.Compression&compressionType == 0 {
+					continue
+				}
+				if compressor = s.compression.compressorFor(compressionType); compressor == nil {
+					continue
+				}
+			}
+
+			// A compressed entry is at most the identity size, so that bounds each one
+			if budget != nil && *budget < info.Size() {
+				return errWarmBudget
+			}
+
+			key := base
+			key.Compression = compressionType
+			v, err, _ := s.inflight.Do(key.String(), func() (interface{}, error) {
+				return s.loadEntry(r, key, fullPath, info, compressor, cleanedPath)
+			})
+			if err != nil {
+				return err
+			}
+			if budget != nil {
+				*budget -= v.(*CacheEntry).Size
+			}
+		}
+	}
+
+	return nil
+}
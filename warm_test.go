@@ -0,0 +1,127 @@
+package gostc
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+func TestWarm(t *testing.T) {
+	tmpDir := t.TempDir()
+	content := strings.Repeat("body { color: red; }\n", 200)
+	os.WriteFile(filepath.Join(tmpDir, "style.css"), []byte(content), 0644)
+
+	server, err := New(WithRoot(tmpDir), WithWatcher(false), WithMetrics(true))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var opens atomic.Int64
+	server.open = func(name string) (*os.File, error) {
+		opens.Add(1)
+		return os.Open(name)
+	}
+
+	if err := server.Warm("/style.css", "/missing.css"); err != nil {
+		t.Fatalf("Expected missing files to be skipped, got %v", err)
+	}
+	if opens.Load() == 0 {
+		t.Fatal("Expected Warm to read the file")
+	}
+	opens.Store(0)
+
+	for _, encoding := range []string{"", "gzip", "br"} {
+		req := httptest.NewRequest("GET", "/style.css", nil)
+		req.Header.Set("Accept-Encoding", encoding)
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, req)
+
+		if w.Code != http.StatusOK || w.Header().Get("Content-Encoding") != encoding {
+			t.Errorf("Accept-Encoding %q: expected 200 with that encoding, got %d %q", encoding, w.Code, w.Header().Get("Content-Encoding"))
+		}
+	}
+
+	if n := opens.Load(); n != 0 {
+		t.Errorf("Expected warmed requests to skip the disk, got %d reads", n)
+	}
+	if hits := server.metrics.hits.Load(); hits != 3 {
+		t.Errorf("Expected 3 cache hits, got %d", hits)
+	}
+}
+
+func TestWithWarmPaths(t *testing.T) {
+	tmpDir := t.TempDir()
+	os.MkdirAll(filepath.Join(tmpDir, "docs"), 0755)
+	os.WriteFile(filepath.Join(tmpDir, "docs", "index.html"), []byte("<h1>Docs</h1>"), 0644)
+
+	server, err := New(WithRoot(tmpDir), WithWatcher(false), WithWarmPaths("/docs/"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := server.cache.Get(CacheKey{Path: "/docs/index.html"}); !ok {
+		t.Error("Expected the directory's index file to be cached by New")
+	}
+}
+
+func TestWarmDirectoryStopsAtCacheSize(t *testing.T) {
+	tmpDir := t.TempDir()
+	os.MkdirAll(filepath.Join(tmpDir, "static"), 0755)
+	for _, name := range []string{"a.js", "b.js", "c.js", "d.js", "e.js"} {
+		os.WriteFile(filepath.Join(tmpDir, "static", name), []byte(strings.Repeat("x", 1000)), 0644)
+	}
+	os.WriteFile(filepath.Join(tmpDir, "readme.txt"), []byte("not an asset"), 0644)
+
+	server, err := New(
+		WithRoot(tmpDir),
+		WithWatcher(false),
+		WithCompression(NoCompression),
+		WithCache(2500),
+		WithStaticPrefixes("/static/"),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := server.WarmDirectory(); err != nil {
+		t.Fatal(err)
+	}
+
+	stats := server.cache.Stats()
+	if stats.ItemCount != 2 || stats.Size != 2000 {
+		t.Errorf("Expected two assets warmed into 2000 bytes, got %d entries and %d bytes", stats.ItemCount, stats.Size)
+	}
+	if stats.Evictions != 0 {
+		t.Errorf("Expected warm-up to stop before evicting, got %d evictions", stats.Evictions)
+	}
+	if _, ok := server.cache.Get(CacheKey{Path: "/readme.txt"}); ok {
+		t.Error("Expected files outside the static prefixes to be skipped")
+	}
+}
+
+func TestWithWarmOnStart(t *testing.T) {
+	tmpDir := t.TempDir()
+	os.MkdirAll(filepath.Join(tmpDir, "assets"), 0755)
+	os.WriteFile(filepath.Join(tmpDir, "assets", "app.css"), []byte("body{}"), 0644)
+
+	server, err := New(WithRoot(tmpDir), WithWatcher(false), WithWarmOnStart(true), WithAddr("127.0.0.1:0"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := server.cache.Get(CacheKey{Path: "/assets/app.css"}); ok {
+		t.Fatal("Expected nothing warmed before Start")
+	}
+
+	if err := server.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer server.Stop()
+
+	if _, ok := server.cache.Get(CacheKey{Path: "/assets/app.css"}); !ok {
+		t.Error("Expected Start to warm the asset")
+	}
+}